@@ -0,0 +1,152 @@
+package auth_proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+)
+
+// DecodeAuthorizationRules decodes the rules set in the request header by the envoy filter of a protected endpoint.
+func DecodeAuthorizationRules(header string) ([]v1alpha1.AuthorizationRule, error) {
+	if header == "" {
+		return nil, nil
+	}
+
+	bts, err := base64.StdEncoding.DecodeString(header)
+
+	if err != nil {
+		return nil, fmt.Errorf("base64 decode authorization rules failed, %+v", err)
+	}
+
+	var rules []v1alpha1.AuthorizationRule
+
+	if err := json.Unmarshal(bts, &rules); err != nil {
+		return nil, fmt.Errorf("json unmarshal authorization rules failed, %+v", err)
+	}
+
+	return rules, nil
+}
+
+// IsAuthorized returns true if the claims satisfy all the rules applying to the method and path.
+// The matching is the same as the istio AuthorizationPolicy generated for the rules.
+func IsAuthorized(rules []v1alpha1.AuthorizationRule, method, requestPath string, claims map[string]interface{}) bool {
+	requestPath = cleanRequestPath(requestPath)
+
+	for i := range rules {
+		if !ruleAppliesTo(&rules[i], method, requestPath) {
+			continue
+		}
+
+		if !ruleSatisfiedBy(&rules[i], claims) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func cleanRequestPath(requestPath string) string {
+	cleaned := path.Clean("/" + requestPath)
+
+	// keep the trailing slash, /admin/ is under the prefix /admin/
+	if strings.HasSuffix(requestPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return cleaned
+}
+
+func ruleAppliesTo(rule *v1alpha1.AuthorizationRule, method, requestPath string) bool {
+	if len(rule.Methods) > 0 && !containsString(rule.Methods, strings.ToUpper(method)) {
+		return false
+	}
+
+	if len(rule.PathPrefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range rule.PathPrefixes {
+		if strings.HasSuffix(prefix, "/") {
+			if strings.HasPrefix(requestPath, prefix) {
+				return true
+			}
+		} else if requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ruleSatisfiedBy(rule *v1alpha1.AuthorizationRule, claims map[string]interface{}) bool {
+	for i := range rule.Conditions {
+		holds := conditionHolds(&rule.Conditions[i], claims)
+
+		if rule.Match == v1alpha1.ClaimMatchAll && !holds {
+			return false
+		}
+
+		if rule.Match != v1alpha1.ClaimMatchAll && holds {
+			return true
+		}
+	}
+
+	return rule.Match == v1alpha1.ClaimMatchAll
+}
+
+func conditionHolds(condition *v1alpha1.ClaimCondition, claims map[string]interface{}) bool {
+	claim, exist := claims[condition.Claim]
+
+	if !exist || claim == nil {
+		return false
+	}
+
+	var values []string
+
+	switch typedClaim := claim.(type) {
+	case []interface{}:
+		for _, item := range typedClaim {
+			values = append(values, fmt.Sprint(item))
+		}
+	default:
+		values = []string{fmt.Sprint(typedClaim)}
+	}
+
+	for _, value := range values {
+		for _, pattern := range condition.Values {
+			if matchClaimValue(pattern, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// same as the string match of istio, exact, prefix match with abc*, suffix match with *abc, and presence match with *
+func matchClaimValue(pattern, value string) bool {
+	switch {
+	case pattern == "*":
+		return value != ""
+	case strings.HasPrefix(pattern, "*"):
+		return strings.HasSuffix(value, pattern[1:])
+	case strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(value, pattern[:len(pattern)-1])
+	default:
+		return value == pattern
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
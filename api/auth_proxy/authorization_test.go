@@ -0,0 +1,101 @@
+package auth_proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAuthorized(t *testing.T) {
+	rules := []v1alpha1.AuthorizationRule{
+		{
+			PathPrefixes: []string{"/admin"},
+			Conditions: []v1alpha1.ClaimCondition{
+				{Claim: "email", Values: []string{"*@example.com"}},
+				{Claim: "sub", Values: []string{"root"}},
+			},
+		},
+		{
+			PathPrefixes: []string{"/api/"},
+			Methods:      []string{"POST", "DELETE"},
+			Match:        v1alpha1.ClaimMatchAll,
+			Conditions: []v1alpha1.ClaimCondition{
+				{Claim: "groups", Values: []string{"dev", "ops"}},
+				{Claim: "tier", Values: []string{"gold*"}},
+			},
+		},
+	}
+
+	alice := map[string]interface{}{
+		"email":  "alice@example.com",
+		"sub":    "alice",
+		"groups": []interface{}{"dev"},
+		"tier":   "silver",
+	}
+
+	bob := map[string]interface{}{
+		"email":  "bob@another.com",
+		"sub":    "root",
+		"groups": []interface{}{"qa", "ops"},
+		"tier":   "golden",
+	}
+
+	eve := map[string]interface{}{
+		"email": "eve@example.com.evil",
+		"sub":   "eve",
+	}
+
+	// any of the conditions
+	assert.True(t, IsAuthorized(rules, "GET", "/admin", alice))
+	assert.True(t, IsAuthorized(rules, "GET", "/admin/users", bob))
+	assert.False(t, IsAuthorized(rules, "GET", "/admin/users", eve))
+	assert.False(t, IsAuthorized(rules, "GET", "/public/../admin", eve))
+
+	// prefixes match whole path segments
+	assert.True(t, IsAuthorized(rules, "GET", "/administrator", eve))
+
+	// all of the conditions, only for the methods
+	assert.False(t, IsAuthorized(rules, "POST", "/api/items", alice))
+	assert.True(t, IsAuthorized(rules, "POST", "/api/items", bob))
+	assert.False(t, IsAuthorized(rules, "DELETE", "/api/items", eve))
+	assert.True(t, IsAuthorized(rules, "GET", "/api/items", eve))
+	assert.True(t, IsAuthorized(rules, "POST", "/api", eve))
+
+	// paths not covered by any rule
+	assert.True(t, IsAuthorized(rules, "DELETE", "/", eve))
+	assert.True(t, IsAuthorized(nil, "GET", "/admin", eve))
+}
+
+func TestMatchClaimValue(t *testing.T) {
+	assert.True(t, matchClaimValue("alice", "alice"))
+	assert.False(t, matchClaimValue("alice", "alice2"))
+	assert.True(t, matchClaimValue("*@example.com", "alice@example.com"))
+	assert.False(t, matchClaimValue("*@example.com", "alice@example.org"))
+	assert.True(t, matchClaimValue("team-*", "team-a"))
+	assert.True(t, matchClaimValue("*", "anything"))
+	assert.False(t, matchClaimValue("*", ""))
+}
+
+func TestDecodeAuthorizationRules(t *testing.T) {
+	rules := []v1alpha1.AuthorizationRule{
+		{
+			PathPrefixes: []string{"/admin"},
+			Conditions:   []v1alpha1.ClaimCondition{{Claim: "email", Values: []string{"*@example.com"}}},
+		},
+	}
+
+	bts, _ := json.Marshal(rules)
+	decoded, err := DecodeAuthorizationRules(base64.StdEncoding.EncodeToString(bts))
+	assert.Nil(t, err)
+	assert.Equal(t, rules, decoded)
+
+	decoded, err = DecodeAuthorizationRules("")
+	assert.Nil(t, err)
+	assert.Nil(t, decoded)
+
+	_, err = DecodeAuthorizationRules("not base64!")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,436 @@
+package auth_proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// api keys are kalm_ak_<credential name>.<secret>
+	APIKeyPrefix = "kalm_ak_"
+
+	// access tokens issued with the client credentials grant
+	AccessTokenPrefix = "kalm_at_"
+
+	AccessTokenMaxAge = time.Hour
+
+	// Changes of credentials, e.g. deletions, take effect after this duration at most.
+	defaultCredentialCacheTTL = 10 * time.Second
+
+	// Names are taken from requests before they are authenticated, only existing credentials are cached and at most this many.
+	defaultCredentialCacheSize = 1000
+)
+
+var ErrInvalidCredential = errors.New("invalid credential")
+var ErrCredentialExpired = errors.New("credential expired")
+
+// IsCredentialToken returns true if the bearer token is an api key or an access token issued by kalm.
+func IsCredentialToken(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix) || strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// GenerateCredentialSecret returns a random secret and the hash to save in the SSOCredential.
+func GenerateCredentialSecret() (secret string, hash string, err error) {
+	bts := make([]byte, 32)
+
+	if _, err := rand.Read(bts); err != nil {
+		return "", "", err
+	}
+
+	secret = hex.EncodeToString(bts)
+
+	return secret, HashCredentialSecret(secret), nil
+}
+
+func HashCredentialSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func FormatAPIKey(name, secret string) string {
+	return APIKeyPrefix + name + "." + secret
+}
+
+// ScopeCovers returns true if the granted scope includes the requested one.
+// Scopes are namespace/name, namespace/* grants all protected endpoints in the namespace.
+func ScopeCovers(granted, requested string) bool {
+	if granted == requested {
+		return true
+	}
+
+	if !strings.HasSuffix(granted, "/*") {
+		return false
+	}
+
+	return strings.HasPrefix(requested, strings.TrimSuffix(granted, "*")) && !strings.HasSuffix(requested, "/")
+}
+
+func anyScopeCovers(granted []string, requested string) bool {
+	for _, scope := range granted {
+		if ScopeCovers(scope, requested) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CredentialIdentity is who made the request with an api key or an access token.
+type CredentialIdentity struct {
+	Name   string
+	Scopes []string
+}
+
+func (i *CredentialIdentity) CanAccess(endpoint string) bool {
+	return anyScopeCovers(i.Scopes, endpoint)
+}
+
+// Claims are used to check the authorization rules of protected endpoints, and are passed to the upstream as the user info.
+func (i *CredentialIdentity) Claims() map[string]interface{} {
+	scopes := make([]interface{}, len(i.Scopes))
+
+	for j := range i.Scopes {
+		scopes[j] = i.Scopes[j]
+	}
+
+	return map[string]interface{}{
+		"sub":       "credential:" + i.Name,
+		"client_id": i.Name,
+		"scope":     scopes,
+	}
+}
+
+type accessTokenPayload struct {
+	Name      string    `json:"n"`
+	UID       types.UID `json:"u"`
+	Scopes    []string  `json:"s"`
+	ExpiresAt int64     `json:"e"`
+}
+
+type credentialCacheItem struct {
+	credential *v1alpha1.SSOCredential
+	fetchedAt  time.Time
+}
+
+type credentialUsage struct {
+	count      int
+	lastUsedAt time.Time
+}
+
+// CredentialStore authenticates the SSOCredentials in the namespace of the auth proxy,
+// and records their usage in the status.
+type CredentialStore struct {
+	client    client.Client
+	namespace string
+
+	cacheTTL  time.Duration
+	cacheSize int
+	cacheMut  sync.Mutex
+	cache     map[string]*credentialCacheItem
+
+	usageMut sync.Mutex
+	usages   map[string]*credentialUsage
+}
+
+func NewCredentialStore(c client.Client, namespace string) *CredentialStore {
+	return &CredentialStore{
+		client:    c,
+		namespace: namespace,
+		cacheTTL:  defaultCredentialCacheTTL,
+		cacheSize: defaultCredentialCacheSize,
+		cache:     make(map[string]*credentialCacheItem),
+		usages:    make(map[string]*credentialUsage),
+	}
+}
+
+// returns nil if the credential doesn't exist
+func (s *CredentialStore) get(ctx context.Context, name string) (*v1alpha1.SSOCredential, error) {
+	// can't be the name of any credential, no need to ask the api server
+	if len(validation.IsDNS1123Subdomain(name)) > 0 {
+		return nil, nil
+	}
+
+	s.cacheMut.Lock()
+	item, exist := s.cache[name]
+	s.cacheMut.Unlock()
+
+	if exist && time.Since(item.fetchedAt) < s.cacheTTL {
+		return item.credential, nil
+	}
+
+	var credential v1alpha1.SSOCredential
+	err := s.client.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: name}, &credential)
+
+	if apiErrors.IsNotFound(err) {
+		// misses are not cached, otherwise random names in requests fill up the memory
+		s.cacheMut.Lock()
+		delete(s.cache, name)
+		s.cacheMut.Unlock()
+
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.cacheMut.Lock()
+	defer s.cacheMut.Unlock()
+
+	if _, exist := s.cache[name]; !exist && len(s.cache) >= s.cacheSize {
+		s.evictCache()
+	}
+
+	s.cache[name] = &credentialCacheItem{credential: &credential, fetchedAt: time.Now()}
+
+	return &credential, nil
+}
+
+// evictCache drops the expired items, or some random items if all of them are still fresh. cacheMut must be held.
+func (s *CredentialStore) evictCache() {
+	for name, item := range s.cache {
+		if time.Since(item.fetchedAt) >= s.cacheTTL {
+			delete(s.cache, name)
+		}
+	}
+
+	for name := range s.cache {
+		if len(s.cache) < s.cacheSize {
+			break
+		}
+
+		delete(s.cache, name)
+	}
+}
+
+// VerifySecret returns the credential if the secret matches, and the credential is of the type and not expired.
+func (s *CredentialStore) VerifySecret(ctx context.Context, name, secret string, credentialType v1alpha1.SSOCredentialType) (*v1alpha1.SSOCredential, error) {
+	if name == "" || secret == "" {
+		return nil, ErrInvalidCredential
+	}
+
+	credential, err := s.get(ctx, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if credential == nil || credential.Spec.Type != credentialType {
+		return nil, ErrInvalidCredential
+	}
+
+	if subtle.ConstantTimeCompare([]byte(HashCredentialSecret(secret)), []byte(credential.Spec.SecretHash)) != 1 {
+		return nil, ErrInvalidCredential
+	}
+
+	if credential.IsExpired() {
+		return nil, ErrCredentialExpired
+	}
+
+	return credential, nil
+}
+
+// Authenticate verifies an api key or an access token.
+func (s *CredentialStore) Authenticate(ctx context.Context, token string) (*CredentialIdentity, error) {
+	switch {
+	case strings.HasPrefix(token, APIKeyPrefix):
+		return s.authenticateAPIKey(ctx, strings.TrimPrefix(token, APIKeyPrefix))
+	case strings.HasPrefix(token, AccessTokenPrefix):
+		return s.authenticateAccessToken(ctx, strings.TrimPrefix(token, AccessTokenPrefix))
+	default:
+		return nil, ErrInvalidCredential
+	}
+}
+
+func (s *CredentialStore) authenticateAPIKey(ctx context.Context, key string) (*CredentialIdentity, error) {
+	// credential names may contain dots, secrets don't
+	index := strings.LastIndex(key, ".")
+
+	if index < 0 {
+		return nil, ErrInvalidCredential
+	}
+
+	credential, err := s.VerifySecret(ctx, key[:index], key[index+1:], v1alpha1.SSOCredentialTypeAPIKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &CredentialIdentity{Name: credential.Name, Scopes: credential.Spec.Scopes}, nil
+}
+
+func (s *CredentialStore) authenticateAccessToken(ctx context.Context, token string) (*CredentialIdentity, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signAccessTokenPayload(parts[0]))) {
+		return nil, ErrInvalidCredential
+	}
+
+	bts, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+
+	var payload accessTokenPayload
+
+	if err := json.Unmarshal(bts, &payload); err != nil {
+		return nil, ErrInvalidCredential
+	}
+
+	if time.Now().Unix() >= payload.ExpiresAt {
+		return nil, ErrCredentialExpired
+	}
+
+	credential, err := s.get(ctx, payload.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// tokens of deleted credentials are rejected, even if a credential with the same name is created later
+	if credential == nil || credential.UID != payload.UID || credential.Spec.Type != v1alpha1.SSOCredentialTypeClientCredentials {
+		return nil, ErrInvalidCredential
+	}
+
+	if credential.IsExpired() {
+		return nil, ErrCredentialExpired
+	}
+
+	// scopes removed from the credential after the token is issued are not granted
+	var scopes []string
+
+	for _, scope := range payload.Scopes {
+		if anyScopeCovers(credential.Spec.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &CredentialIdentity{Name: credential.Name, Scopes: scopes}, nil
+}
+
+// IssueAccessToken issues an access token of the requested scopes, all scopes of the credential if none is requested.
+// The token expires in AccessTokenMaxAge, or when the credential expires.
+func (s *CredentialStore) IssueAccessToken(credential *v1alpha1.SSOCredential, requestedScopes []string) (token string, scopes []string, expiresIn time.Duration, err error) {
+	if len(requestedScopes) == 0 {
+		scopes = credential.Spec.Scopes
+	} else {
+		for _, scope := range requestedScopes {
+			if !anyScopeCovers(credential.Spec.Scopes, scope) {
+				return "", nil, 0, fmt.Errorf("scope %s is not granted", scope)
+			}
+		}
+
+		scopes = requestedScopes
+	}
+
+	expiresIn = AccessTokenMaxAge
+
+	if credential.Spec.ExpiresAt != nil && time.Until(credential.Spec.ExpiresAt.Time) < expiresIn {
+		expiresIn = time.Until(credential.Spec.ExpiresAt.Time).Truncate(time.Second)
+	}
+
+	bts, err := json.Marshal(accessTokenPayload{
+		Name:      credential.Name,
+		UID:       credential.UID,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(expiresIn).Unix(),
+	})
+
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(bts)
+
+	return AccessTokenPrefix + payload + "." + signAccessTokenPayload(payload), scopes, expiresIn, nil
+}
+
+// The payload of access tokens is not encrypted, the aes encryption of thin tokens doesn't prevent tampering.
+func signAccessTokenPayload(payload string) string {
+	mac := hmac.New(sha256.New, stateEncryptKey[:])
+	mac.Write([]byte(AccessTokenPrefix + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// RecordUsage counts the usage in memory, the counters are written to the status by FlushUsage.
+func (s *CredentialStore) RecordUsage(name string) {
+	s.usageMut.Lock()
+	defer s.usageMut.Unlock()
+
+	usage, exist := s.usages[name]
+
+	if !exist {
+		usage = &credentialUsage{}
+		s.usages[name] = usage
+	}
+
+	usage.count += 1
+	usage.lastUsedAt = time.Now()
+}
+
+// FlushUsage adds the counted usage to the status of credentials. Counters failed to write are kept for the next flush.
+func (s *CredentialStore) FlushUsage(ctx context.Context) error {
+	s.usageMut.Lock()
+	usages := s.usages
+	s.usages = make(map[string]*credentialUsage)
+	s.usageMut.Unlock()
+
+	var lastErr error
+
+	for name, usage := range usages {
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			var credential v1alpha1.SSOCredential
+
+			if err := s.client.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: name}, &credential); err != nil {
+				return err
+			}
+
+			credential.Status.UsedCount += usage.count
+
+			if lastUsed := int(usage.lastUsedAt.Unix()); lastUsed > credential.Status.LastUsedTimestamp {
+				credential.Status.LastUsedTimestamp = lastUsed
+			}
+
+			return s.client.Status().Update(ctx, &credential)
+		})
+
+		if err == nil || apiErrors.IsNotFound(err) {
+			continue
+		}
+
+		lastErr = err
+
+		s.usageMut.Lock()
+		if current, exist := s.usages[name]; exist {
+			current.count += usage.count
+
+			if usage.lastUsedAt.After(current.lastUsedAt) {
+				current.lastUsedAt = usage.lastUsedAt
+			}
+		} else {
+			s.usages[name] = usage
+		}
+		s.usageMut.Unlock()
+	}
+
+	return lastErr
+}
@@ -0,0 +1,224 @@
+package auth_proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestCredential(name string, credentialType v1alpha1.SSOCredentialType, secretHash string, scopes ...string) *v1alpha1.SSOCredential {
+	return &v1alpha1.SSOCredential{
+		ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: "kalm-system", UID: types.UID(name + "-uid")},
+		Spec: v1alpha1.SSOCredentialSpec{
+			Type:       credentialType,
+			Scopes:     scopes,
+			SecretHash: secretHash,
+		},
+	}
+}
+
+func newTestCredentialStore(t *testing.T, objs ...runtime.Object) (*CredentialStore, client.Client) {
+	InitEncrypteKey(sha256.Sum256([]byte("client-secret")))
+
+	scheme := runtime.NewScheme()
+	assert.Nil(t, v1alpha1.AddToScheme(scheme))
+
+	c := fake.NewFakeClientWithScheme(scheme, objs...)
+	store := NewCredentialStore(c, "kalm-system")
+	store.cacheTTL = 0
+
+	return store, c
+}
+
+func TestCredentialStoreAPIKey(t *testing.T) {
+	ctx := context.Background()
+	secret, hash, err := GenerateCredentialSecret()
+	assert.Nil(t, err)
+
+	expired := newTestCredential("expired", v1alpha1.SSOCredentialTypeAPIKey, hash, "default/web")
+	expired.Spec.ExpiresAt = &metaV1.Time{Time: time.Now().Add(-time.Minute)}
+
+	store, _ := newTestCredentialStore(t,
+		newTestCredential("ci.example.com", v1alpha1.SSOCredentialTypeAPIKey, hash, "default/web", "staging/*"),
+		newTestCredential("client", v1alpha1.SSOCredentialTypeClientCredentials, hash, "default/web"),
+		expired,
+	)
+
+	apiKey := FormatAPIKey("ci.example.com", secret)
+	assert.True(t, IsCredentialToken(apiKey))
+
+	identity, err := store.Authenticate(ctx, apiKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "ci.example.com", identity.Name)
+	assert.True(t, identity.CanAccess("default/web"))
+	assert.True(t, identity.CanAccess("staging/api"))
+	assert.False(t, identity.CanAccess("default/api"))
+	assert.Equal(t, "credential:ci.example.com", identity.Claims()["sub"])
+
+	_, err = store.Authenticate(ctx, FormatAPIKey("ci.example.com", strings.Repeat("0", 64)))
+	assert.Equal(t, ErrInvalidCredential, err)
+
+	_, err = store.Authenticate(ctx, FormatAPIKey("not-exist", secret))
+	assert.Equal(t, ErrInvalidCredential, err)
+
+	// client credentials can't be used as api keys
+	_, err = store.Authenticate(ctx, FormatAPIKey("client", secret))
+	assert.Equal(t, ErrInvalidCredential, err)
+
+	_, err = store.Authenticate(ctx, FormatAPIKey("expired", secret))
+	assert.Equal(t, ErrCredentialExpired, err)
+
+	_, err = store.Authenticate(ctx, APIKeyPrefix+secret)
+	assert.Equal(t, ErrInvalidCredential, err)
+}
+
+func TestCredentialStoreCache(t *testing.T) {
+	ctx := context.Background()
+	_, hash, err := GenerateCredentialSecret()
+	assert.Nil(t, err)
+
+	store, c := newTestCredentialStore(t,
+		newTestCredential("ci-0", v1alpha1.SSOCredentialTypeAPIKey, hash),
+		newTestCredential("ci-1", v1alpha1.SSOCredentialTypeAPIKey, hash),
+		newTestCredential("ci-2", v1alpha1.SSOCredentialTypeAPIKey, hash),
+	)
+	store.cacheTTL = time.Minute
+	store.cacheSize = 2
+
+	// names of missing credentials are not cached
+	for _, name := range []string{"not-exist-0", "not-exist-1", "Not_A_Name"} {
+		credential, err := store.get(ctx, name)
+		assert.Nil(t, err)
+		assert.Nil(t, credential)
+	}
+
+	assert.Len(t, store.cache, 0)
+
+	for _, name := range []string{"ci-0", "ci-1", "ci-2"} {
+		credential, err := store.get(ctx, name)
+		assert.Nil(t, err)
+		assert.Equal(t, name, credential.Name)
+		assert.LessOrEqual(t, len(store.cache), 2)
+	}
+
+	// a credential created after a miss is found right away
+	credential, err := store.get(ctx, "ci-3")
+	assert.Nil(t, err)
+	assert.Nil(t, credential)
+
+	assert.Nil(t, c.Create(ctx, newTestCredential("ci-3", v1alpha1.SSOCredentialTypeAPIKey, hash)))
+
+	credential, err = store.get(ctx, "ci-3")
+	assert.Nil(t, err)
+	assert.Equal(t, "ci-3", credential.Name)
+}
+
+func TestCredentialStoreAccessToken(t *testing.T) {
+	ctx := context.Background()
+	secret, hash, err := GenerateCredentialSecret()
+	assert.Nil(t, err)
+
+	store, c := newTestCredentialStore(t,
+		newTestCredential("client", v1alpha1.SSOCredentialTypeClientCredentials, hash, "default/web", "staging/*"),
+	)
+
+	credential, err := store.VerifySecret(ctx, "client", secret, v1alpha1.SSOCredentialTypeClientCredentials)
+	assert.Nil(t, err)
+
+	_, _, _, err = store.IssueAccessToken(credential, []string{"default/api"})
+	assert.NotNil(t, err)
+
+	token, scopes, expiresIn, err := store.IssueAccessToken(credential, []string{"staging/api"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"staging/api"}, scopes)
+	assert.Equal(t, AccessTokenMaxAge, expiresIn)
+
+	identity, err := store.Authenticate(ctx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, "client", identity.Name)
+	assert.True(t, identity.CanAccess("staging/api"))
+	assert.False(t, identity.CanAccess("staging/web"))
+
+	// tampered tokens
+	_, err = store.Authenticate(ctx, token+"x")
+	assert.Equal(t, ErrInvalidCredential, err)
+
+	parts := strings.Split(token, ".")
+	_, err = store.Authenticate(ctx, parts[0]+"."+signAccessTokenPayload("other"))
+	assert.Equal(t, ErrInvalidCredential, err)
+
+	// scopes removed from the credential are not granted anymore
+	credential.Spec.Scopes = []string{"default/web"}
+	assert.Nil(t, c.Update(ctx, credential))
+
+	identity, err = store.Authenticate(ctx, token)
+	assert.Nil(t, err)
+	assert.False(t, identity.CanAccess("staging/api"))
+
+	// tokens of a recreated credential are rejected
+	assert.Nil(t, c.Delete(ctx, credential))
+	assert.Nil(t, c.Create(ctx, newTestCredential("client", v1alpha1.SSOCredentialTypeClientCredentials, hash, "default/web")))
+
+	var recreated v1alpha1.SSOCredential
+	assert.Nil(t, c.Get(ctx, types.NamespacedName{Namespace: "kalm-system", Name: "client"}, &recreated))
+	recreated.UID = "another-uid"
+	assert.Nil(t, c.Update(ctx, &recreated))
+
+	_, err = store.Authenticate(ctx, token)
+	assert.Equal(t, ErrInvalidCredential, err)
+}
+
+func TestCredentialStoreAccessTokenExpiry(t *testing.T) {
+	credential := newTestCredential("client", v1alpha1.SSOCredentialTypeClientCredentials, strings.Repeat("0", 64), "default/web")
+	credential.Spec.ExpiresAt = &metaV1.Time{Time: time.Now().Add(10 * time.Minute)}
+
+	store, _ := newTestCredentialStore(t, credential)
+
+	_, scopes, expiresIn, err := store.IssueAccessToken(credential, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default/web"}, scopes)
+	assert.True(t, expiresIn <= 10*time.Minute)
+	assert.True(t, expiresIn > 9*time.Minute)
+}
+
+func TestCredentialStoreFlushUsage(t *testing.T) {
+	ctx := context.Background()
+	store, c := newTestCredentialStore(t,
+		newTestCredential("client", v1alpha1.SSOCredentialTypeClientCredentials, strings.Repeat("0", 64), "default/web"),
+	)
+
+	store.RecordUsage("client")
+	store.RecordUsage("client")
+	store.RecordUsage("deleted")
+	assert.Nil(t, store.FlushUsage(ctx))
+
+	store.RecordUsage("client")
+	assert.Nil(t, store.FlushUsage(ctx))
+
+	var credential v1alpha1.SSOCredential
+	assert.Nil(t, c.Get(ctx, types.NamespacedName{Namespace: "kalm-system", Name: "client"}, &credential))
+	assert.Equal(t, 3, credential.Status.UsedCount)
+	assert.InDelta(t, time.Now().Unix(), credential.Status.LastUsedTimestamp, 5)
+
+	// usage of deleted credentials are dropped
+	assert.Empty(t, store.usages)
+}
+
+func TestScopeCovers(t *testing.T) {
+	assert.True(t, ScopeCovers("default/web", "default/web"))
+	assert.False(t, ScopeCovers("default/web", "default/api"))
+	assert.True(t, ScopeCovers("default/*", "default/web"))
+	assert.True(t, ScopeCovers("default/*", "default/*"))
+	assert.False(t, ScopeCovers("default/*", "default2/web"))
+	assert.False(t, ScopeCovers("default/web", "default/*"))
+}
@@ -1,53 +1,90 @@
 package auth_proxy
 
 import (
-	"github.com/coreos/go-oidc"
+	"context"
 	"sync"
 	"time"
 )
 
-type RefreshContext struct {
-	Cond *sync.Cond
+// RefreshResult is the tokens returned by the oidc provider for a refresh token.
+type RefreshResult struct {
+	IDTokenString string `json:"i"`
+	RefreshToken  string `json:"r"`
+}
+
+type RefreshFunc func() (*RefreshResult, error)
 
-	// After broadcast, Either the error is nil or the tokens are nil
-	Error         error
-	IDToken       *oidc.IDToken
-	IDTokenString string
-	RefreshToken  string
+// When a user's id_token has expired, but the refresh_token is still valid, multiple requests may be received in a short time window.
+// But refresh_token is not allowed to be used twice. We can't let all the requests to refresh token at the same time.
+// A RefreshCoordinator ensures that only one request calls the refresh func for a refresh token,
+// and the other requests, maybe received by other auth-proxy replicas, wait for and share the result.
+type RefreshCoordinator interface {
+	Refresh(ctx context.Context, refreshToken string, refresh RefreshFunc) (*RefreshResult, error)
 }
 
-// A lock to protected getRefreshTokenCond
-var refreshLock *sync.Mutex
-var refreshCondMap map[string]*RefreshContext
+// Results are kept for a while after the refresh. Requests carrying the old refresh token may still arrive,
+// e.g. from other tabs of the browser, they get the refreshed tokens instead of burning the token again.
+const refreshResultTTL = 60 * time.Second
 
-func init() {
-	refreshLock = &sync.Mutex{}
-	refreshCondMap = make(map[string]*RefreshContext)
+type memoryRefreshContext struct {
+	// closed after the result or the error is set
+	done   chan struct{}
+	result *RefreshResult
+	err    error
 }
 
-func GetRefreshTokenCond(token string) (*RefreshContext, bool) {
-	refreshLock.Lock()
-	defer refreshLock.Unlock()
+// MemoryRefreshCoordinator coordinates refreshes in process memory.
+// This is enough if the auth-proxy service only has one replica, or is deployed with sticky load balancing strategy.
+type MemoryRefreshCoordinator struct {
+	mut      sync.Mutex
+	contexts map[string]*memoryRefreshContext
+	ttl      time.Duration
+}
 
-	if cond, ok := refreshCondMap[token]; ok {
-		return cond, false
+func NewMemoryRefreshCoordinator() *MemoryRefreshCoordinator {
+	return &MemoryRefreshCoordinator{
+		contexts: make(map[string]*memoryRefreshContext),
+		ttl:      refreshResultTTL,
 	}
-
-	m := sync.Mutex{}
-	refreshCondMap[token] = &RefreshContext{Cond: sync.NewCond(&m)}
-	return refreshCondMap[token], true
 }
 
-func RemoveRefreshTokenCond(token string, delaySeconds int) {
-	go func() {
-		time.Sleep(time.Duration(delaySeconds) * time.Second)
-		refreshLock.Lock()
-		defer refreshLock.Unlock()
+func (m *MemoryRefreshCoordinator) Refresh(ctx context.Context, refreshToken string, refresh RefreshFunc) (*RefreshResult, error) {
+	m.mut.Lock()
+	refreshContext, exist := m.contexts[refreshToken]
+
+	if !exist {
+		refreshContext = &memoryRefreshContext{done: make(chan struct{})}
+		m.contexts[refreshToken] = refreshContext
+	}
+	m.mut.Unlock()
+
+	if !exist {
+		refreshContext.result, refreshContext.err = refresh()
+		close(refreshContext.done)
 
-		if refreshCondMap == nil {
-			return
+		// errors are only shared with the requests already waiting, later requests try the refresh again
+		if refreshContext.err != nil {
+			m.deleteContext(refreshToken, refreshContext)
+		} else {
+			time.AfterFunc(m.ttl, func() {
+				m.deleteContext(refreshToken, refreshContext)
+			})
 		}
+	}
+
+	select {
+	case <-refreshContext.done:
+		return refreshContext.result, refreshContext.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *MemoryRefreshCoordinator) deleteContext(refreshToken string, refreshContext *memoryRefreshContext) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
 
-		delete(refreshCondMap, token)
-	}()
+	if m.contexts[refreshToken] == refreshContext {
+		delete(m.contexts, refreshToken)
+	}
 }
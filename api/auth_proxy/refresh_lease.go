@@ -0,0 +1,421 @@
+package auth_proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kalmhq/kalm/api/log"
+	coordinationV1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	refreshLeaseNamePrefix       = "kalm-sso-refresh-"
+	refreshLeaseLabel            = "kalm-sso-refresh"
+	refreshLeaseResultAnnotation = "kalm-sso-refresh/result"
+
+	// A lease not renewed in this duration is considered abandoned, e.g. the replica doing the refresh crashed.
+	defaultRefreshLeaseDuration = 15 * time.Second
+	defaultRefreshPollInterval  = 200 * time.Millisecond
+)
+
+var errRefreshLeaseLost = fmt.Errorf("refresh lease is held by another replica")
+
+// LeaseRefreshCoordinator coordinates refreshes between auth-proxy replicas through leases.
+// The replica which holds the lease of a refresh token does the refresh. It keeps renewing the lease during the refresh,
+// and writes the encrypted result into the lease. Other replicas poll the lease until the result is written.
+// A lease is only taken over once it's no longer renewed, and a replica never deletes a lease held by others.
+type LeaseRefreshCoordinator struct {
+	client    kubernetes.Interface
+	namespace string
+
+	// name of the replica, for debugging
+	identity string
+
+	ttl           time.Duration
+	leaseDuration time.Duration
+	pollInterval  time.Duration
+
+	gcMut    sync.Mutex
+	lastGCAt time.Time
+}
+
+func NewLeaseRefreshCoordinator(client kubernetes.Interface, namespace, identity string) *LeaseRefreshCoordinator {
+	return &LeaseRefreshCoordinator{
+		client:        client,
+		namespace:     namespace,
+		identity:      identity,
+		ttl:           refreshResultTTL,
+		leaseDuration: defaultRefreshLeaseDuration,
+		pollInterval:  defaultRefreshPollInterval,
+	}
+}
+
+// the refresh token itself is a credential, only its hash is saved in the name
+func getRefreshLeaseName(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return refreshLeaseNamePrefix + fmt.Sprintf("%x", sum[:20])
+}
+
+func getRefreshLeaseHolder(lease *coordinationV1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+
+	return *lease.Spec.HolderIdentity
+}
+
+// every claim gets its own holder identity, requests handled by the same replica can't renew or delete each other's lease
+func (c *LeaseRefreshCoordinator) newHolderIdentity() string {
+	return c.identity + "-" + rand.String(8)
+}
+
+func (c *LeaseRefreshCoordinator) Refresh(ctx context.Context, refreshToken string, refresh RefreshFunc) (*RefreshResult, error) {
+	c.collectGarbage()
+
+	name := getRefreshLeaseName(refreshToken)
+
+	for {
+		holder := c.newHolderIdentity()
+		now := metaV1.NewMicroTime(time.Now())
+		leaseDurationSeconds := int32(c.leaseDuration.Seconds())
+
+		if leaseDurationSeconds < 1 {
+			leaseDurationSeconds = 1
+		}
+
+		lease, err := c.client.CoordinationV1().Leases(c.namespace).Create(ctx, &coordinationV1.Lease{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      name,
+				Namespace: c.namespace,
+				Labels: map[string]string{
+					refreshLeaseLabel: "true",
+				},
+			},
+			Spec: coordinationV1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &leaseDurationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metaV1.CreateOptions{})
+
+		if err == nil {
+			return c.doRefresh(lease, refresh)
+		}
+
+		if !errors.IsAlreadyExists(err) {
+			return nil, err
+		}
+
+		result, takenOver, err := c.waitForResult(ctx, name)
+
+		if err != nil || result != nil {
+			return result, err
+		}
+
+		if takenOver != nil {
+			return c.doRefresh(takenOver, refresh)
+		}
+	}
+}
+
+func (c *LeaseRefreshCoordinator) doRefresh(lease *coordinationV1.Lease, refresh RefreshFunc) (*RefreshResult, error) {
+	holder := getRefreshLeaseHolder(lease)
+
+	stopRenew := make(chan struct{})
+	renewStopped := make(chan struct{})
+
+	go func() {
+		defer close(renewStopped)
+		c.renewLease(lease.Name, holder, stopRenew)
+	}()
+
+	result, err := refresh()
+
+	close(stopRenew)
+	<-renewStopped
+
+	// the request may be canceled, but the waiting replicas still need the result
+	writeCtx, cancel := context.WithTimeout(context.Background(), c.leaseDuration)
+	defer cancel()
+
+	if err != nil {
+		// errors are not shared, the waiting replicas try the refresh themselves once the lease is gone
+		c.deleteOwnLease(writeCtx, lease.Name, holder)
+		return nil, err
+	}
+
+	encoded, err := encodeRefreshResult(result)
+
+	if err != nil {
+		log.Error(err, "encode refresh result failed", "lease", lease.Name)
+		c.deleteOwnLease(writeCtx, lease.Name, holder)
+		return result, nil
+	}
+
+	err = c.updateOwnLease(writeCtx, lease.Name, holder, func(lease *coordinationV1.Lease) {
+		if lease.Annotations == nil {
+			lease.Annotations = make(map[string]string)
+		}
+
+		lease.Annotations[refreshLeaseResultAnnotation] = encoded
+		now := metaV1.NewMicroTime(time.Now())
+		lease.Spec.RenewTime = &now
+	})
+
+	if err != nil {
+		log.Error(err, "save refresh result failed", "lease", lease.Name)
+		return result, nil
+	}
+
+	time.AfterFunc(c.ttl, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.leaseDuration)
+		defer cancel()
+
+		c.deleteOwnLease(ctx, lease.Name, holder)
+	})
+
+	return result, nil
+}
+
+// renewLease keeps the lease held until stop is closed, so that other replicas don't take over a slow refresh.
+func (c *LeaseRefreshCoordinator) renewLease(name, holder string, stop <-chan struct{}) {
+	ticker := time.NewTicker(c.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.leaseDuration)
+		err := c.updateOwnLease(ctx, name, holder, func(lease *coordinationV1.Lease) {
+			now := metaV1.NewMicroTime(time.Now())
+			lease.Spec.RenewTime = &now
+		})
+		cancel()
+
+		if err == errRefreshLeaseLost {
+			log.Info("refresh lease is taken over", "lease", name, "holder", holder)
+			return
+		}
+
+		if err != nil {
+			log.Error(err, "renew refresh lease failed", "lease", name)
+		}
+	}
+}
+
+// waitForResult returns the lease if it's taken over from an abandoned refresh, the caller should do the refresh with it.
+// All the results are nil if the lease is gone, the caller should try to create it again.
+func (c *LeaseRefreshCoordinator) waitForResult(ctx context.Context, name string) (*RefreshResult, *coordinationV1.Lease, error) {
+	for {
+		lease, err := c.client.CoordinationV1().Leases(c.namespace).Get(ctx, name, metaV1.GetOptions{})
+
+		if errors.IsNotFound(err) {
+			return nil, nil, nil
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if encoded, exist := lease.Annotations[refreshLeaseResultAnnotation]; exist {
+			result, err := decodeRefreshResult(encoded)
+			return result, nil, err
+		}
+
+		if isRefreshLeaseExpired(lease, 0) {
+			log.Info("refresh lease is not renewed, take it over", "lease", name, "holder", getRefreshLeaseHolder(lease))
+
+			takenOver, err := c.takeOverLease(ctx, lease)
+
+			if err == nil {
+				return nil, takenOver, nil
+			}
+
+			// another replica took it over first, wait for its result
+			if !errors.IsConflict(err) {
+				return nil, nil, err
+			}
+
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+// takeOverLease updates the lease with the resource version it's read with, it fails if the lease is changed in the meantime.
+func (c *LeaseRefreshCoordinator) takeOverLease(ctx context.Context, lease *coordinationV1.Lease) (*coordinationV1.Lease, error) {
+	lease = lease.DeepCopy()
+	holder := c.newHolderIdentity()
+	now := metaV1.NewMicroTime(time.Now())
+
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+
+	transitions := int32(1)
+
+	if lease.Spec.LeaseTransitions != nil {
+		transitions = *lease.Spec.LeaseTransitions + 1
+	}
+
+	lease.Spec.LeaseTransitions = &transitions
+
+	return c.client.CoordinationV1().Leases(c.namespace).Update(ctx, lease, metaV1.UpdateOptions{})
+}
+
+// updateOwnLease returns errRefreshLeaseLost if the lease is no longer held by the holder.
+func (c *LeaseRefreshCoordinator) updateOwnLease(ctx context.Context, name, holder string, mutate func(lease *coordinationV1.Lease)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lease, err := c.client.CoordinationV1().Leases(c.namespace).Get(ctx, name, metaV1.GetOptions{})
+
+		if err != nil {
+			return err
+		}
+
+		if getRefreshLeaseHolder(lease) != holder {
+			return errRefreshLeaseLost
+		}
+
+		mutate(lease)
+
+		_, err = c.client.CoordinationV1().Leases(c.namespace).Update(ctx, lease, metaV1.UpdateOptions{})
+
+		return err
+	})
+}
+
+// deleteOwnLease does nothing if the lease is no longer held by the holder.
+func (c *LeaseRefreshCoordinator) deleteOwnLease(ctx context.Context, name, holder string) {
+	lease, err := c.client.CoordinationV1().Leases(c.namespace).Get(ctx, name, metaV1.GetOptions{})
+
+	if errors.IsNotFound(err) {
+		return
+	}
+
+	if err != nil {
+		log.Error(err, "get refresh lease failed", "lease", name)
+		return
+	}
+
+	if getRefreshLeaseHolder(lease) != holder {
+		return
+	}
+
+	c.deleteLease(ctx, lease)
+}
+
+// deleteLease only deletes the lease in the version it's read with, in case it's taken over or recreated for a new refresh.
+func (c *LeaseRefreshCoordinator) deleteLease(ctx context.Context, lease *coordinationV1.Lease) {
+	uid := lease.UID
+	resourceVersion := lease.ResourceVersion
+
+	err := c.client.CoordinationV1().Leases(c.namespace).Delete(ctx, lease.Name, metaV1.DeleteOptions{
+		Preconditions: &metaV1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion},
+	})
+
+	if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+		log.Error(err, "delete refresh lease failed", "lease", lease.Name)
+	}
+}
+
+func isRefreshLeaseExpired(lease *coordinationV1.Lease, grace time.Duration) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+
+	return time.Since(lease.Spec.RenewTime.Time) > duration+grace
+}
+
+// collectGarbage deletes leases left by crashed replicas, at most once per ttl.
+// Leases of running refreshes are renewed, they never expire this long.
+func (c *LeaseRefreshCoordinator) collectGarbage() {
+	c.gcMut.Lock()
+	defer c.gcMut.Unlock()
+
+	if time.Since(c.lastGCAt) < c.ttl {
+		return
+	}
+
+	c.lastGCAt = time.Now()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.leaseDuration)
+		defer cancel()
+
+		list, err := c.client.CoordinationV1().Leases(c.namespace).List(ctx, metaV1.ListOptions{
+			LabelSelector: refreshLeaseLabel + "=true",
+		})
+
+		if err != nil {
+			log.Error(err, "list refresh leases failed")
+			return
+		}
+
+		for i := range list.Items {
+			if isRefreshLeaseExpired(&list.Items[i], c.ttl) {
+				c.deleteLease(ctx, &list.Items[i])
+			}
+		}
+	}()
+}
+
+// the result contains tokens, it's encrypted in the same way as cookies
+func encodeRefreshResult(result *RefreshResult) (string, error) {
+	bts, err := json.Marshal(result)
+
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := AesEncrypt(bts)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawStdEncoding.EncodeToString(encrypted), nil
+}
+
+func decodeRefreshResult(data string) (*RefreshResult, error) {
+	encrypted, err := base64.RawStdEncoding.DecodeString(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("base64 decode refresh result failed, %+v", err)
+	}
+
+	bts, err := AesDecrypt(encrypted)
+
+	if err != nil {
+		return nil, fmt.Errorf("decrypt refresh result failed, %+v", err)
+	}
+
+	var result RefreshResult
+
+	if err := json.Unmarshal(bts, &result); err != nil {
+		return nil, fmt.Errorf("json unmarshal refresh result failed, %+v", err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,177 @@
+package auth_proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordinationV1 "k8s.io/api/coordination/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// refreshConcurrently refreshes the same token through the coordinators at the same time,
+// and returns how many times the token is actually refreshed.
+func refreshConcurrently(t *testing.T, coordinators ...RefreshCoordinator) int32 {
+	var calls int32
+	var wg sync.WaitGroup
+
+	refresh := func() (*RefreshResult, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return &RefreshResult{IDTokenString: "new-id-token", RefreshToken: "new-refresh-token"}, nil
+	}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(coordinator RefreshCoordinator) {
+			defer wg.Done()
+
+			result, err := coordinator.Refresh(context.Background(), "refresh-token", refresh)
+			assert.Nil(t, err)
+			assert.Equal(t, &RefreshResult{IDTokenString: "new-id-token", RefreshToken: "new-refresh-token"}, result)
+		}(coordinators[i%len(coordinators)])
+	}
+
+	wg.Wait()
+
+	return calls
+}
+
+func TestMemoryRefreshCoordinator(t *testing.T) {
+	assert.Equal(t, int32(1), refreshConcurrently(t, NewMemoryRefreshCoordinator()))
+}
+
+func TestMemoryRefreshCoordinatorDoesNotCacheError(t *testing.T) {
+	coordinator := NewMemoryRefreshCoordinator()
+
+	_, err := coordinator.Refresh(context.Background(), "refresh-token", func() (*RefreshResult, error) {
+		return nil, fmt.Errorf("connection reset")
+	})
+	assert.EqualError(t, err, "connection reset")
+
+	// the failure may be temporary, a later request refreshes again
+	result, err := coordinator.Refresh(context.Background(), "refresh-token", func() (*RefreshResult, error) {
+		return &RefreshResult{IDTokenString: "new-id-token", RefreshToken: "new-refresh-token"}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "new-id-token", result.IDTokenString)
+}
+
+func newTestLeaseRefreshCoordinator(client *fake.Clientset, identity string) *LeaseRefreshCoordinator {
+	coordinator := NewLeaseRefreshCoordinator(client, "kalm-system", identity)
+	coordinator.pollInterval = 10 * time.Millisecond
+	return coordinator
+}
+
+func TestLeaseRefreshCoordinator(t *testing.T) {
+	InitEncrypteKey(sha256.Sum256([]byte("client-secret")))
+	client := fake.NewSimpleClientset()
+
+	calls := refreshConcurrently(t,
+		newTestLeaseRefreshCoordinator(client, "auth-proxy-0"),
+		newTestLeaseRefreshCoordinator(client, "auth-proxy-1"),
+		newTestLeaseRefreshCoordinator(client, "auth-proxy-2"),
+	)
+
+	assert.Equal(t, int32(1), calls)
+
+	lease, err := client.CoordinationV1().Leases("kalm-system").Get(context.Background(), getRefreshLeaseName("refresh-token"), metaV1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Contains(t, *lease.Spec.HolderIdentity, "auth-proxy-")
+	assert.NotContains(t, lease.Name, "refresh-token")
+	assert.NotContains(t, lease.Annotations[refreshLeaseResultAnnotation], "new-refresh-token")
+}
+
+func TestLeaseRefreshCoordinatorWaitsForSlowRefresh(t *testing.T) {
+	InitEncrypteKey(sha256.Sum256([]byte("client-secret")))
+	client := fake.NewSimpleClientset()
+
+	var calls int32
+	var wg sync.WaitGroup
+
+	// the refresh takes longer than the lease duration, the lease is renewed meanwhile
+	refresh := func() (*RefreshResult, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(2500 * time.Millisecond)
+		return &RefreshResult{IDTokenString: "new-id-token", RefreshToken: "new-refresh-token"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		coordinator := newTestLeaseRefreshCoordinator(client, fmt.Sprintf("auth-proxy-%d", i))
+		coordinator.leaseDuration = time.Second
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			result, err := coordinator.Refresh(context.Background(), "refresh-token", refresh)
+			assert.Nil(t, err)
+			assert.Equal(t, "new-id-token", result.IDTokenString)
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestLeaseRefreshCoordinatorDoesNotShareError(t *testing.T) {
+	InitEncrypteKey(sha256.Sum256([]byte("client-secret")))
+	client := fake.NewSimpleClientset()
+	coordinator := newTestLeaseRefreshCoordinator(client, "auth-proxy-0")
+
+	_, err := coordinator.Refresh(context.Background(), "refresh-token", func() (*RefreshResult, error) {
+		return nil, fmt.Errorf("connection reset")
+	})
+	assert.EqualError(t, err, "connection reset")
+
+	result, err := newTestLeaseRefreshCoordinator(client, "auth-proxy-1").Refresh(context.Background(), "refresh-token", func() (*RefreshResult, error) {
+		return &RefreshResult{IDTokenString: "new-id-token", RefreshToken: "new-refresh-token"}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "new-id-token", result.IDTokenString)
+}
+
+func TestLeaseRefreshCoordinatorTakesOverExpiredLease(t *testing.T) {
+	InitEncrypteKey(sha256.Sum256([]byte("client-secret")))
+
+	holder := "crashed-auth-proxy"
+	leaseDurationSeconds := int32(15)
+	renewTime := metaV1.NewMicroTime(time.Now().Add(-time.Minute))
+
+	// left by a replica which crashed during the refresh
+	client := fake.NewSimpleClientset(&coordinationV1.Lease{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      getRefreshLeaseName("refresh-token"),
+			Namespace: "kalm-system",
+		},
+		Spec: coordinationV1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &leaseDurationSeconds,
+			AcquireTime:          &renewTime,
+			RenewTime:            &renewTime,
+		},
+	})
+
+	result, err := newTestLeaseRefreshCoordinator(client, "auth-proxy-0").Refresh(context.Background(), "refresh-token", func() (*RefreshResult, error) {
+		return &RefreshResult{IDTokenString: "new-id-token", RefreshToken: "new-refresh-token"}, nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "new-id-token", result.IDTokenString)
+
+	lease, err := client.CoordinationV1().Leases("kalm-system").Get(context.Background(), getRefreshLeaseName("refresh-token"), metaV1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Contains(t, *lease.Spec.HolderIdentity, "auth-proxy-0")
+	assert.Equal(t, int32(1), *lease.Spec.LeaseTransitions)
+}
@@ -0,0 +1,64 @@
+package auth_proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Sessions live as long as the cookie of the protected endpoint.
+const SessionMaxAge = 24 * 7 * time.Hour
+
+var ErrSessionNotFound = fmt.Errorf("session not found")
+
+// Session keeps the tokens of a logged in user on the server side.
+// With a session store enabled, the cookie only carries the session id, and a session can be revoked by deleting it.
+type Session struct {
+	ID          string    `json:"id"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	RefreshedAt time.Time `json:"refreshedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+
+	// tokens are never returned by the session apis
+	IDTokenString string `json:"-"`
+	RefreshToken  string `json:"-"`
+}
+
+func (s *Session) IsExpired() bool {
+	return !s.ExpiresAt.IsZero() && time.Now().After(s.ExpiresAt)
+}
+
+// SessionStore saves sessions. Get returns ErrSessionNotFound for missing or expired sessions.
+// List returns the sessions of the subject, or all sessions if the subject is empty.
+type SessionStore interface {
+	Create(ctx context.Context, session *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	Update(ctx context.Context, session *Session) error
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, subject string) ([]*Session, error)
+}
+
+// NewSession returns a session with a random opaque id.
+func NewSession(subject, email, idTokenString, refreshToken string) (*Session, error) {
+	bts := make([]byte, 24)
+
+	if _, err := rand.Read(bts); err != nil {
+		return nil, fmt.Errorf("generate session id failed, %+v", err)
+	}
+
+	now := time.Now()
+
+	return &Session{
+		ID:            hex.EncodeToString(bts),
+		Subject:       subject,
+		Email:         email,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(SessionMaxAge),
+		IDTokenString: idTokenString,
+		RefreshToken:  refreshToken,
+	}, nil
+}
@@ -0,0 +1,277 @@
+package auth_proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	coreListers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	sessionSecretNamePrefix          = "kalm-sso-session-"
+	sessionSecretLabel               = "kalm-sso-session"
+	sessionSecretSubjectLabel        = "kalm-sso-session/subject-hash"
+	sessionSecretSubjectAnnotation   = "kalm-sso-session/subject"
+	sessionSecretEmailAnnotation     = "kalm-sso-session/email"
+	sessionSecretCreatedAnnotation   = "kalm-sso-session/created-at"
+	sessionSecretRefreshedAnnotation = "kalm-sso-session/refreshed-at"
+	sessionSecretExpiresAnnotation   = "kalm-sso-session/expires-at"
+	sessionSecretIDTokenKey          = "id_token"
+	sessionSecretRefreshTokenKey     = "refresh_token"
+)
+
+var sessionIDRegexp = regexp.MustCompile(`^[0-9a-f]{1,64}$`)
+
+// SecretSessionStore saves each session in a secret.
+type SecretSessionStore struct {
+	client    kubernetes.Interface
+	namespace string
+
+	// set by StartInformer, Get reads sessions from the API server if nil
+	lister coreListers.SecretNamespaceLister
+}
+
+func NewSecretSessionStore(client kubernetes.Interface, namespace string) *SecretSessionStore {
+	return &SecretSessionStore{
+		client:    client,
+		namespace: namespace,
+	}
+}
+
+// StartInformer makes Get read sessions from an informer on the session namespace instead of the API server.
+// Revoked sessions are deleted secrets, the watch of the informer removes them from the cache.
+func (s *SecretSessionStore) StartInformer(stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(s.client, 0,
+		informers.WithNamespace(s.namespace),
+		informers.WithTweakListOptions(func(options *metaV1.ListOptions) {
+			options.LabelSelector = sessionSecretLabel + "=true"
+		}),
+	)
+
+	informer := factory.Core().V1().Secrets()
+	s.lister = informer.Lister().Secrets(s.namespace)
+
+	factory.Start(stopCh)
+
+	if !cache.WaitForCacheSync(stopCh, informer.Informer().HasSynced) {
+		return fmt.Errorf("failed to sync the sessions in %s namespace", s.namespace)
+	}
+
+	return nil
+}
+
+// subjects may contain any characters, only their hash can be used as a label value
+func getSessionSubjectHash(subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return fmt.Sprintf("%x", sum[:20])
+}
+
+func (s *SecretSessionStore) Create(ctx context.Context, session *Session) error {
+	secret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      sessionSecretNamePrefix + session.ID,
+			Namespace: s.namespace,
+			Labels: map[string]string{
+				sessionSecretLabel:        "true",
+				sessionSecretSubjectLabel: getSessionSubjectHash(session.Subject),
+			},
+		},
+	}
+
+	setSessionToSecret(session, secret)
+
+	_, err := s.client.CoreV1().Secrets(s.namespace).Create(ctx, secret, metaV1.CreateOptions{})
+
+	return err
+}
+
+func (s *SecretSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	if !sessionIDRegexp.MatchString(id) {
+		return nil, ErrSessionNotFound
+	}
+
+	secret, err := s.getSecret(ctx, sessionSecretNamePrefix+id)
+
+	if errors.IsNotFound(err) {
+		return nil, ErrSessionNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	session := getSessionFromSecret(secret)
+
+	if session.IsExpired() {
+		return nil, ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+// getSecret reads the secret from the informer if it's started.
+// Sessions just created by other replicas may not be in the informer yet, they are read from the API server.
+func (s *SecretSessionStore) getSecret(ctx context.Context, name string) (*coreV1.Secret, error) {
+	if s.lister != nil {
+		secret, err := s.lister.Get(name)
+
+		if !errors.IsNotFound(err) {
+			return secret, err
+		}
+	}
+
+	return s.client.CoreV1().Secrets(s.namespace).Get(ctx, name, metaV1.GetOptions{})
+}
+
+// Update retries on conflicts, replicas refreshing the same session write the same tokens.
+func (s *SecretSessionStore) Update(ctx context.Context, session *Session) error {
+	if !sessionIDRegexp.MatchString(session.ID) {
+		return ErrSessionNotFound
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, sessionSecretNamePrefix+session.ID, metaV1.GetOptions{})
+
+		if err != nil {
+			return err
+		}
+
+		setSessionToSecret(session, secret)
+
+		_, err = s.client.CoreV1().Secrets(s.namespace).Update(ctx, secret, metaV1.UpdateOptions{})
+
+		return err
+	})
+
+	if errors.IsNotFound(err) {
+		return ErrSessionNotFound
+	}
+
+	return err
+}
+
+func (s *SecretSessionStore) Delete(ctx context.Context, id string) error {
+	if !sessionIDRegexp.MatchString(id) {
+		return ErrSessionNotFound
+	}
+
+	err := s.client.CoreV1().Secrets(s.namespace).Delete(ctx, sessionSecretNamePrefix+id, metaV1.DeleteOptions{})
+
+	if errors.IsNotFound(err) {
+		return ErrSessionNotFound
+	}
+
+	return err
+}
+
+func (s *SecretSessionStore) List(ctx context.Context, subject string) ([]*Session, error) {
+	selector := sessionSecretLabel + "=true"
+
+	if subject != "" {
+		selector += "," + sessionSecretSubjectLabel + "=" + getSessionSubjectHash(subject)
+	}
+
+	list, err := s.client.CoreV1().Secrets(s.namespace).List(ctx, metaV1.ListOptions{LabelSelector: selector})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*Session, 0, len(list.Items))
+
+	for i := range list.Items {
+		session := getSessionFromSecret(&list.Items[i])
+
+		// the hash is only used to narrow down the list
+		if session.IsExpired() || subject != "" && session.Subject != subject {
+			continue
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// DeleteExpired deletes the sessions of users who never come back.
+func (s *SecretSessionStore) DeleteExpired(ctx context.Context) error {
+	list, err := s.client.CoreV1().Secrets(s.namespace).List(ctx, metaV1.ListOptions{
+		LabelSelector: sessionSecretLabel + "=true",
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for i := range list.Items {
+		if !getSessionFromSecret(&list.Items[i]).IsExpired() {
+			continue
+		}
+
+		uid := list.Items[i].UID
+		err := s.client.CoreV1().Secrets(s.namespace).Delete(ctx, list.Items[i].Name, metaV1.DeleteOptions{
+			Preconditions: &metaV1.Preconditions{UID: &uid},
+		})
+
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setSessionToSecret(session *Session, secret *coreV1.Secret) {
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+
+	secret.Annotations[sessionSecretSubjectAnnotation] = session.Subject
+	secret.Annotations[sessionSecretEmailAnnotation] = session.Email
+	secret.Annotations[sessionSecretCreatedAnnotation] = formatSessionTime(session.CreatedAt)
+	secret.Annotations[sessionSecretRefreshedAnnotation] = formatSessionTime(session.RefreshedAt)
+	secret.Annotations[sessionSecretExpiresAnnotation] = formatSessionTime(session.ExpiresAt)
+
+	secret.Type = coreV1.SecretTypeOpaque
+	secret.Data = map[string][]byte{
+		sessionSecretIDTokenKey:      []byte(session.IDTokenString),
+		sessionSecretRefreshTokenKey: []byte(session.RefreshToken),
+	}
+}
+
+func getSessionFromSecret(secret *coreV1.Secret) *Session {
+	return &Session{
+		ID:            strings.TrimPrefix(secret.Name, sessionSecretNamePrefix),
+		Subject:       secret.Annotations[sessionSecretSubjectAnnotation],
+		Email:         secret.Annotations[sessionSecretEmailAnnotation],
+		CreatedAt:     parseSessionTime(secret.Annotations[sessionSecretCreatedAnnotation]),
+		RefreshedAt:   parseSessionTime(secret.Annotations[sessionSecretRefreshedAnnotation]),
+		ExpiresAt:     parseSessionTime(secret.Annotations[sessionSecretExpiresAnnotation]),
+		IDTokenString: string(secret.Data[sessionSecretIDTokenKey]),
+		RefreshToken:  string(secret.Data[sessionSecretRefreshTokenKey]),
+	}
+}
+
+func formatSessionTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseSessionTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
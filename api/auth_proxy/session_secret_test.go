@@ -0,0 +1,127 @@
+package auth_proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecretSessionStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewSecretSessionStore(fake.NewSimpleClientset(), "kalm-system")
+
+	alice, err := NewSession("alice", "alice@example.com", "id-token", "refresh-token")
+	assert.Nil(t, err)
+	assert.Nil(t, store.Create(ctx, alice))
+
+	bob, err := NewSession("bob", "", "bob-id-token", "bob-refresh-token")
+	assert.Nil(t, err)
+	assert.Nil(t, store.Create(ctx, bob))
+
+	session, err := store.Get(ctx, alice.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", session.Subject)
+	assert.Equal(t, "alice@example.com", session.Email)
+	assert.Equal(t, "id-token", session.IDTokenString)
+	assert.Equal(t, "refresh-token", session.RefreshToken)
+	assert.Equal(t, alice.ExpiresAt.Unix(), session.ExpiresAt.Unix())
+
+	session.IDTokenString = "new-id-token"
+	session.RefreshToken = "new-refresh-token"
+	session.RefreshedAt = time.Now()
+	assert.Nil(t, store.Update(ctx, session))
+
+	session, err = store.Get(ctx, alice.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "new-id-token", session.IDTokenString)
+	assert.Equal(t, "new-refresh-token", session.RefreshToken)
+	assert.False(t, session.RefreshedAt.IsZero())
+
+	sessions, err := store.List(ctx, "alice")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, alice.ID, sessions[0].ID)
+
+	sessions, err = store.List(ctx, "")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+
+	assert.Nil(t, store.Delete(ctx, alice.ID))
+	assert.Equal(t, ErrSessionNotFound, store.Delete(ctx, alice.ID))
+
+	_, err = store.Get(ctx, alice.ID)
+	assert.Equal(t, ErrSessionNotFound, err)
+	assert.Equal(t, ErrSessionNotFound, store.Update(ctx, alice))
+
+	// ids are part of the secret names, anything else is treated as not found
+	_, err = store.Get(ctx, "../kalm-system")
+	assert.Equal(t, ErrSessionNotFound, err)
+}
+
+func TestSecretSessionStoreExpiredSessions(t *testing.T) {
+	ctx := context.Background()
+	store := NewSecretSessionStore(fake.NewSimpleClientset(), "kalm-system")
+
+	expired, err := NewSession("alice", "", "id-token", "refresh-token")
+	assert.Nil(t, err)
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	assert.Nil(t, store.Create(ctx, expired))
+
+	active, err := NewSession("alice", "", "id-token", "refresh-token")
+	assert.Nil(t, err)
+	assert.Nil(t, store.Create(ctx, active))
+
+	_, err = store.Get(ctx, expired.ID)
+	assert.Equal(t, ErrSessionNotFound, err)
+
+	sessions, err := store.List(ctx, "alice")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+
+	assert.Nil(t, store.DeleteExpired(ctx))
+
+	list, err := store.client.CoreV1().Secrets("kalm-system").List(ctx, metaV1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, list.Items, 1)
+	assert.Equal(t, sessionSecretNamePrefix+active.ID, list.Items[0].Name)
+}
+
+func TestSecretSessionStoreInformer(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	alice, err := NewSession("alice", "", "id-token", "refresh-token")
+	assert.Nil(t, err)
+	assert.Nil(t, NewSecretSessionStore(client, "kalm-system").Create(ctx, alice))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	store := NewSecretSessionStore(client, "kalm-system")
+	assert.Nil(t, store.StartInformer(stopCh))
+
+	client.ClearActions()
+
+	session, err := store.Get(ctx, alice.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", session.Subject)
+
+	// sessions in the informer are read without requests to the API server
+	assert.Len(t, client.Actions(), 0)
+
+	// sessions revoked by other processes are removed from the informer by the watch
+	assert.Nil(t, NewSecretSessionStore(client, "kalm-system").Delete(ctx, alice.ID))
+
+	assert.Eventually(t, func() bool {
+		_, err := store.lister.Get(sessionSecretNamePrefix + alice.ID)
+		return errors.IsNotFound(err)
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = store.Get(ctx, alice.ID)
+	assert.Equal(t, ErrSessionNotFound, err)
+}
@@ -9,9 +9,11 @@ import (
 // This is a simplified Token of oidc.Token
 // This token is used to safely transfer id_token and refresh_token between dex and auth-proxy, auth-proxy and protected endpoint.
 // And this is also the encrypted structure of the cookie in protected_endpoint
+// If a session store is enabled, only the SessionID is transferred, the tokens are kept in the store.
 type ThinToken struct {
-	RefreshToken  string `json:"r"`
-	IDTokenString string `json:"i"`
+	RefreshToken  string `json:"r,omitempty"`
+	IDTokenString string `json:"i,omitempty"`
+	SessionID     string `json:"s,omitempty"`
 }
 
 // the result is save to use in url query
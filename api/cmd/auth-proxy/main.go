@@ -13,13 +13,19 @@ import (
 	"github.com/kalmhq/kalm/api/log"
 	"github.com/kalmhq/kalm/api/server"
 	"github.com/kalmhq/kalm/api/utils"
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
 	"github.com/kalmhq/kalm/controller/controllers"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/net/http2"
 	"golang.org/x/oauth2"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"net/http"
 	"net/url"
 	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,12 +38,26 @@ var oauth2ConfigMut = &sync.Mutex{}
 
 var oidcVerifier *oidc.IDTokenVerifier
 
+var refreshCoordinator auth_proxy.RefreshCoordinator
+
+// nil if sessions are not kept on the server side
+var sessionStore auth_proxy.SessionStore
+
+// nil if sso credentials are not enabled
+var credentialStore *auth_proxy.CredentialStore
+
+// RFC 7009 token revocation endpoint, empty if the provider doesn't advertise one
+var revocationEndpoint string
+
 var authProxyURL string
 var clientSecret string
 
 const KALM_TOKEN_KEY_NAME = "kalm-sso"
 const ENVOY_EXT_AUTH_PATH_PREFIX = "ext_authz"
 
+// Requests to this path of protected endpoints are handled by the auth proxy to log out
+const KALM_SSO_LOGOUT_PATH = "/kalm-sso/logout"
+
 // CSRF protection and pass payload
 type OauthState struct {
 	Nonce       string
@@ -80,6 +100,16 @@ func getOauth2Config() *oauth2.Config {
 
 	oidcVerifier = provider.Verifier(&oidc.Config{ClientID: clientID})
 
+	var providerClaims struct {
+		RevocationEndpoint string `json:"revocation_endpoint"`
+	}
+
+	if err := provider.Claims(&providerClaims); err != nil {
+		logger.Error(err, "KALM parse provider claims failed.")
+	}
+
+	revocationEndpoint = providerClaims.RevocationEndpoint
+
 	scopes := []string{}
 	scopes = append(scopes, oidc.ScopeOpenID, "profile", "email", "groups", "offline_access")
 
@@ -165,6 +195,15 @@ func handleExtAuthz(c echo.Context) error {
 		return c.String(503, "Please configure KALM OIDC environments.")
 	}
 
+	if isLogoutRequest(c) {
+		return handleLogout(c)
+	}
+
+	// api keys and access tokens issued by kalm are never passed to the upstream
+	if bearerToken := getBearerToken(c); auth_proxy.IsCredentialToken(bearerToken) {
+		return handleCredentialAuthz(c, bearerToken)
+	}
+
 	if c.QueryParam(KALM_TOKEN_KEY_NAME) != "" {
 		thinToken := new(auth_proxy.ThinToken)
 
@@ -173,6 +212,11 @@ func handleExtAuthz(c echo.Context) error {
 			return c.String(401, err.Error())
 		}
 
+		if _, err := resolveSession(c.Request().Context(), thinToken); err != nil {
+			contextLog.Info(err.Error())
+			return c.String(401, err.Error())
+		}
+
 		// only valid if the token is valid.
 		// do not check group permission here
 		if _, err := oidcVerifier.Verify(context.Background(), thinToken.IDTokenString); err != nil {
@@ -198,6 +242,17 @@ func handleExtAuthz(c echo.Context) error {
 		return redirectToAuthProxyUrl(c)
 	}
 
+	session, err := resolveSession(c.Request().Context(), token)
+
+	if err == auth_proxy.ErrSessionNotFound {
+		contextLog.Info("Session not found, redirect to auth proxy", "session", token.SessionID)
+		clearTokenInCookie(c)
+		return redirectToAuthProxyUrl(c)
+	} else if err != nil {
+		logger.Error(err, "get session error")
+		return c.JSON(503, "Get session failed.")
+	}
+
 	idToken, err := oidcVerifier.Verify(context.Background(), token.IDTokenString)
 
 	if err != nil {
@@ -205,12 +260,26 @@ func handleExtAuthz(c echo.Context) error {
 		if strings.Contains(strings.ToLower(err.Error()), "expire") {
 
 			// use refresh token to fetch the id_token
-			if err := refreshIDToken(token); err != nil {
+			if err := refreshIDToken(c.Request().Context(), token); err != nil {
 				logger.Error(err, "refresh token error")
 				clearTokenInCookie(c)
 				return c.JSON(401, "The jwt token is invalid, expired, revoked, or was issued to another client. (After refresh)")
 			}
 
+			if session != nil {
+				session.IDTokenString = token.IDTokenString
+				session.RefreshToken = token.RefreshToken
+				session.RefreshedAt = time.Now()
+
+				if err := sessionStore.Update(c.Request().Context(), session); err != nil {
+					logger.Error(err, "update session error")
+					return c.JSON(503, "Save session failed.")
+				}
+
+				// the tokens are kept in the session, not in the cookie
+				token = &auth_proxy.ThinToken{SessionID: session.ID}
+			}
+
 			encodedToken, _ := token.Encode()
 			setTokenInCookie(c, encodedToken)
 			return c.Redirect(302, getOriginalURL(c))
@@ -225,6 +294,18 @@ func handleExtAuthz(c echo.Context) error {
 		return c.JSON(401, "You don't in any granted groups. Contact you admin please.")
 	}
 
+	var claims map[string]interface{}
+
+	if err := idToken.Claims(&claims); err != nil {
+		logger.Error(err, "parse id token claims error")
+		return c.JSON(401, "The jwt token is invalid.")
+	}
+
+	// the user is still logged in, only not allowed to access this path
+	if !isAuthorized(c, claims) {
+		return c.JSON(403, "You are not allowed to access this path. Contact you admin please.")
+	}
+
 	// Set user info in meta header
 	// if the verify returns no error. It's safe to get claims in this way
 	parts := strings.Split(token.IDTokenString, ".")
@@ -233,55 +314,50 @@ func handleExtAuthz(c echo.Context) error {
 	return c.NoContent(200)
 }
 
-// When a user's id_token has expired, but the refresh_token is still valid, multiple requests may be received in a short time window.
-// But refresh_token is not allowed to be used twice. We can't let all the requests to refresh token at the same time.
-// So a condition variable is used to ensure that only one process sends a refresh request,
-// and other processes wait for the result. This is enough if there is the auth-proxy service only has one replica.
-// If you deploy auth-proxy with scaling, make sure use sticky load balancing strategy.
-func refreshIDToken(token *auth_proxy.ThinToken) (err error) {
-	refreshContext, isProducer := auth_proxy.GetRefreshTokenCond(token.RefreshToken)
+// resolveSession fills the tokens of the session into the token if sessions are kept on the server side.
+// Tokens without a session are rejected in this case, otherwise revoked users could still pass with old cookies.
+func resolveSession(ctx context.Context, token *auth_proxy.ThinToken) (*auth_proxy.Session, error) {
+	if sessionStore == nil {
+		if token.SessionID != "" {
+			return nil, auth_proxy.ErrSessionNotFound
+		}
 
-	if isProducer {
-		logger.V(1).Info("[refresh token producer] do refresh")
-		err := doRefresh(token, refreshContext)
-		logger.V(1).Info(fmt.Sprintf("[refresh writer] refresh done, error: %+v", err))
+		return nil, nil
+	}
 
-		auth_proxy.RemoveRefreshTokenCond(token.RefreshToken, 60)
-	} else {
-		refreshContext.Cond.L.Lock()
-		logger.V(1).Info("[refresh token consumer] wait")
+	if token.SessionID == "" {
+		return nil, auth_proxy.ErrSessionNotFound
+	}
 
-		for refreshContext.IDToken == nil && refreshContext.Error == nil {
-			refreshContext.Cond.Wait()
-		}
+	session, err := sessionStore.Get(ctx, token.SessionID)
 
-		err = refreshContext.Error
+	if err != nil {
+		return nil, err
+	}
 
-		logger.V(1).Info(fmt.Sprintf("[refresh token consumer] got result. error: %+v", err))
+	token.IDTokenString = session.IDTokenString
+	token.RefreshToken = session.RefreshToken
 
-		refreshContext.Cond.L.Unlock()
-	}
+	return session, nil
+}
+
+func refreshIDToken(ctx context.Context, token *auth_proxy.ThinToken) error {
+	result, err := refreshCoordinator.Refresh(ctx, token.RefreshToken, func() (*auth_proxy.RefreshResult, error) {
+		logger.V(1).Info("[refresh token] do refresh")
+		return doRefresh(token)
+	})
 
 	if err != nil {
 		return err
 	}
 
-	token.IDTokenString = refreshContext.IDTokenString
-	token.RefreshToken = refreshContext.RefreshToken
+	token.IDTokenString = result.IDTokenString
+	token.RefreshToken = result.RefreshToken
 
 	return nil
 }
 
-func doRefresh(token *auth_proxy.ThinToken, refreshContext *auth_proxy.RefreshContext) (err error) {
-	// Tell other blocked routines the data is ready
-	defer func() {
-		if err != nil {
-			refreshContext.Error = err
-		}
-
-		refreshContext.Cond.Broadcast()
-	}()
-
+func doRefresh(token *auth_proxy.ThinToken) (*auth_proxy.RefreshResult, error) {
 	logger.V(1).Info("IDToken Expired, try refresh")
 
 	t := &oauth2.Token{
@@ -293,32 +369,134 @@ func doRefresh(token *auth_proxy.ThinToken, refreshContext *auth_proxy.RefreshCo
 
 	if err != nil {
 		logger.Error(err, "Refresh token error")
-		return err
+		return nil, err
 	}
 
 	rawIDToken, ok := newOauth2Token.Extra("id_token").(string)
 
 	if !ok {
-		return fmt.Errorf("no id_token in refresh token response")
+		return nil, fmt.Errorf("no id_token in refresh token response")
 	}
 
-	IDToken, err := oidcVerifier.Verify(context.Background(), rawIDToken)
+	if _, err := oidcVerifier.Verify(context.Background(), rawIDToken); err != nil {
+		logger.Error(err, "refreshed token verify error")
+		return nil, fmt.Errorf("The jwt token is invalid, expired, revoked, or was issued to another client. (After refresh)")
+	}
+
+	return &auth_proxy.RefreshResult{
+		IDTokenString: rawIDToken,
+		RefreshToken:  newOauth2Token.RefreshToken,
+	}, nil
+}
+
+// handleLogout deletes the session, invalidates the refresh token at the oidc provider and clears the cookie.
+// The user is redirected to the path in the redirect param, or the root of the protected endpoint.
+func handleLogout(c echo.Context) error {
+	// any page can make the browser send a GET request, e.g. through an image, only a POST logs the user out
+	if c.Request().Method != http.MethodPost {
+		c.Response().Header().Set(echo.HeaderAllow, http.MethodPost)
+		return c.String(405, "Logout must be a POST request.")
+	}
+
+	ctx := c.Request().Context()
+
+	if token, err := getTokenFromRequest(c); err == nil {
+		if sessionStore != nil && token.SessionID != "" {
+			if session, err := sessionStore.Get(ctx, token.SessionID); err == nil {
+				token.RefreshToken = session.RefreshToken
+			}
+
+			if err := sessionStore.Delete(ctx, token.SessionID); err != nil && err != auth_proxy.ErrSessionNotFound {
+				logger.Error(err, "delete session error", "session", token.SessionID)
+			}
+		}
+
+		if token.RefreshToken != "" {
+			if err := revokeRefreshToken(ctx, token.RefreshToken); err != nil {
+				logger.Error(err, "revoke refresh token error")
+			}
+		}
+	}
+
+	clearTokenInCookie(c)
+
+	return c.Redirect(302, getLogoutRedirectPath(c))
+}
+
+// only local paths are allowed, to prevent open redirects
+func getLogoutRedirectPath(c echo.Context) string {
+	uri, err := getOriginalRequestURI(c)
 
 	if err != nil {
-		logger.Error(err, "refreshed token verify error")
-		return fmt.Errorf("The jwt token is invalid, expired, revoked, or was issued to another client. (After refresh)")
+		return "/"
+	}
+
+	redirect := uri.Query().Get("redirect")
+
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return "/"
+	}
+
+	return redirect
+}
+
+// revokeRefreshToken invalidates the refresh token at the oidc provider.
+// Providers advertising a revocation endpoint are asked to revoke it. Dex doesn't have one, but it rotates
+// refresh tokens on every use, so the token is invalidated by refreshing it once and dropping the result.
+func revokeRefreshToken(ctx context.Context, refreshToken string) error {
+	if revocationEndpoint == "" {
+		_, err := oauth2Config.TokenSource(ctx, &oauth2.Token{
+			RefreshToken: refreshToken,
+			Expiry:       time.Now().Add(-time.Hour),
+		}).Token()
+
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("token", refreshToken)
+	form.Set("token_type_hint", "refresh_token")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, revocationEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.SetBasicAuth(url.QueryEscape(oauth2Config.ClientID), url.QueryEscape(oauth2Config.ClientSecret))
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return err
 	}
 
-	refreshContext.Cond.L.Lock()
-	refreshContext.Cond.L.Unlock()
+	defer res.Body.Close()
 
-	refreshContext.IDToken = IDToken
-	refreshContext.IDTokenString = rawIDToken
-	refreshContext.RefreshToken = newOauth2Token.RefreshToken
+	if res.StatusCode != 200 {
+		return fmt.Errorf("revoke refresh token failed, status code: %d", res.StatusCode)
+	}
 
 	return nil
 }
 
+func getOriginalRequestURI(c echo.Context) (*url.URL, error) {
+	requestURI := c.Request().Header.Get("X-Envoy-Original-Path")
+
+	if requestURI == "" {
+		requestURI = removeExtAuthPathPrefix(c.Request().RequestURI)
+	}
+
+	return url.Parse(requestURI)
+}
+
+func isLogoutRequest(c echo.Context) bool {
+	uri, err := getOriginalRequestURI(c)
+
+	return err == nil && uri.Path == KALM_SSO_LOGOUT_PATH
+}
+
 func getTokenFromRequest(c echo.Context) (*auth_proxy.ThinToken, error) {
 	var tokenString string
 
@@ -355,6 +533,110 @@ func getTokenFromRequest(c echo.Context) (*auth_proxy.ThinToken, error) {
 	return token, nil
 }
 
+func getBearerToken(c echo.Context) string {
+	authorization := c.Request().Header.Get("Authorization")
+
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(authorization[len("Bearer "):])
+}
+
+// handleCredentialAuthz authenticates the api keys and access tokens of SSOCredentials.
+// Credentials have no groups, the scopes grant the access to protected endpoints.
+func handleCredentialAuthz(c echo.Context, token string) error {
+	if credentialStore == nil || c.Request().Header.Get(controllers.KALM_ALLOW_CREDENTIALS_HEADER) != "true" {
+		return c.JSON(401, "Credentials are not allowed to access this endpoint.")
+	}
+
+	identity, err := credentialStore.Authenticate(c.Request().Context(), token)
+
+	if err == auth_proxy.ErrInvalidCredential || err == auth_proxy.ErrCredentialExpired {
+		return c.JSON(401, fmt.Sprintf("The credential is rejected, %s.", err.Error()))
+	} else if err != nil {
+		logger.Error(err, "authenticate credential error")
+		return c.JSON(503, "Authenticate credential failed.")
+	}
+
+	if !identity.CanAccess(c.Request().Header.Get(controllers.KALM_SSO_PROTECTED_ENDPOINT_HEADER)) {
+		return c.JSON(403, "The credential is not allowed to access this endpoint.")
+	}
+
+	claims := identity.Claims()
+
+	if !isAuthorized(c, claims) {
+		return c.JSON(403, "The credential is not allowed to access this path.")
+	}
+
+	claimsBytes, _ := json.Marshal(claims)
+	c.Response().Header().Set(controllers.KALM_SSO_USERINFO_HEADER, base64.RawURLEncoding.EncodeToString(claimsBytes))
+
+	credentialStore.RecordUsage(identity.Name)
+
+	return c.NoContent(200)
+}
+
+// handleOAuth2Token issues access tokens with the oauth2 client credentials grant.
+// Errors are in the format of RFC 6749 section 5.2.
+func handleOAuth2Token(c echo.Context) error {
+	if getOauth2Config() == nil {
+		return c.String(503, "Please configure KALM OIDC environments.")
+	}
+
+	if credentialStore == nil {
+		return oauth2Error(c, 400, "unauthorized_client", "Credentials are not enabled.")
+	}
+
+	if c.FormValue("grant_type") != "client_credentials" {
+		return oauth2Error(c, 400, "unsupported_grant_type", "Only client_credentials is supported.")
+	}
+
+	id, secret, useBasicAuth := c.Request().BasicAuth()
+
+	if !useBasicAuth {
+		id, secret = c.FormValue("client_id"), c.FormValue("client_secret")
+	}
+
+	credential, err := credentialStore.VerifySecret(c.Request().Context(), id, secret, v1alpha1.SSOCredentialTypeClientCredentials)
+
+	if err == auth_proxy.ErrInvalidCredential || err == auth_proxy.ErrCredentialExpired {
+		if useBasicAuth {
+			c.Response().Header().Set("WWW-Authenticate", "Basic")
+		}
+
+		return oauth2Error(c, 401, "invalid_client", err.Error())
+	} else if err != nil {
+		logger.Error(err, "verify client credentials error")
+		return oauth2Error(c, 500, "server_error", "Verify client credentials failed.")
+	}
+
+	token, scopes, expiresIn, err := credentialStore.IssueAccessToken(credential, strings.Fields(c.FormValue("scope")))
+
+	if err != nil {
+		return oauth2Error(c, 400, "invalid_scope", err.Error())
+	}
+
+	credentialStore.RecordUsage(credential.Name)
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	return c.JSON(200, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(expiresIn.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+func oauth2Error(c echo.Context, status int, code, description string) error {
+	return c.JSON(status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
 func shouldLetPass(c echo.Context) bool {
 	return c.Request().Header.Get(controllers.KALM_ALLOW_TO_PASS_IF_HAS_BEARER_TOKEN_HEADER) == "true" &&
 		strings.HasPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
@@ -385,6 +667,19 @@ func inGrantedGroups(c echo.Context, idToken *oidc.IDToken) bool {
 	return false
 }
 
+// isAuthorized checks the authorization rules of the protected endpoint.
+// The path is the one received by the workload, as it's checked by istio.
+func isAuthorized(c echo.Context, claims map[string]interface{}) bool {
+	rules, err := auth_proxy.DecodeAuthorizationRules(c.Request().Header.Get(controllers.KALM_SSO_AUTHORIZATION_RULES_HEADER))
+
+	if err != nil {
+		logger.Error(err, "decode authorization rules error")
+		return false
+	}
+
+	return auth_proxy.IsAuthorized(rules, c.Request().Method, removeExtAuthPathPrefix(c.Request().URL.Path), claims)
+}
+
 func clearTokenInCookie(c echo.Context) {
 	c.SetCookie(&http.Cookie{
 		Name:     KALM_TOKEN_KEY_NAME,
@@ -399,7 +694,7 @@ func clearTokenInCookie(c echo.Context) {
 func setTokenInCookie(c echo.Context, token string) {
 	cookie := new(http.Cookie)
 	cookie.Name = KALM_TOKEN_KEY_NAME
-	cookie.Expires = time.Now().Add(24 * 7 * time.Hour)
+	cookie.Expires = time.Now().Add(auth_proxy.SessionMaxAge)
 	cookie.HttpOnly = true
 	cookie.SameSite = http.SameSiteLaxMode
 	cookie.Path = "/"
@@ -555,7 +850,7 @@ func handleOIDCCallback(c echo.Context) error {
 		return c.String(400, "no id_token in token response")
 	}
 
-	_, err = oidcVerifier.Verify(context.Background(), rawIDToken)
+	idToken, err := oidcVerifier.Verify(context.Background(), rawIDToken)
 
 	if err != nil {
 		logger.Error(err, "jwt verify failed")
@@ -567,6 +862,17 @@ func handleOIDCCallback(c echo.Context) error {
 		IDTokenString: rawIDToken,
 	}
 
+	if sessionStore != nil {
+		session, err := createSession(c.Request().Context(), idToken, thinToken)
+
+		if err != nil {
+			logger.Error(err, "create session error")
+			return c.String(500, "create session error")
+		}
+
+		thinToken = &auth_proxy.ThinToken{SessionID: session.ID}
+	}
+
 	encryptedThinToken, err := thinToken.Encode()
 
 	if err != nil {
@@ -581,6 +887,26 @@ func handleOIDCCallback(c echo.Context) error {
 	return c.Redirect(302, uri.String())
 }
 
+func createSession(ctx context.Context, idToken *oidc.IDToken, token *auth_proxy.ThinToken) (*auth_proxy.Session, error) {
+	var claims struct {
+		Email string `json:"email"`
+	}
+
+	_ = idToken.Claims(&claims)
+
+	session, err := auth_proxy.NewSession(idToken.Subject, claims.Email, token.IDTokenString, token.RefreshToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sessionStore.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
 func handleLog(c echo.Context) error {
 	level := c.QueryParam("level")
 
@@ -594,21 +920,167 @@ func handleLog(c echo.Context) error {
 	return c.NoContent(200)
 }
 
+func newInClusterClientset() (kubernetes.Interface, string, error) {
+	namespace := os.Getenv(controllers.KALM_AUTH_PROXY_NAMESPACE_ENV)
+
+	if namespace == "" {
+		return nil, "", fmt.Errorf("%s is required", controllers.KALM_AUTH_PROXY_NAMESPACE_ENV)
+	}
+
+	config, err := rest.InClusterConfig()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return clientset, namespace, nil
+}
+
+// newRefreshCoordinator shares refreshes through leases if the auth-proxy runs with several replicas.
+func newRefreshCoordinator() (auth_proxy.RefreshCoordinator, error) {
+	switch os.Getenv(controllers.KALM_AUTH_PROXY_REFRESH_COORDINATOR_ENV) {
+	case controllers.KALM_AUTH_PROXY_REFRESH_COORDINATOR_LEASE:
+		clientset, namespace, err := newInClusterClientset()
+
+		if err != nil {
+			return nil, err
+		}
+
+		hostname, _ := os.Hostname()
+		return auth_proxy.NewLeaseRefreshCoordinator(clientset, namespace, hostname), nil
+	case "":
+		return auth_proxy.NewMemoryRefreshCoordinator(), nil
+	default:
+		return nil, fmt.Errorf("unknown refresh coordinator %s", os.Getenv(controllers.KALM_AUTH_PROXY_REFRESH_COORDINATOR_ENV))
+	}
+}
+
+// newSessionStore returns nil if sessions are not kept on the server side.
+func newSessionStore() (auth_proxy.SessionStore, error) {
+	switch os.Getenv(controllers.KALM_AUTH_PROXY_SESSION_STORE_ENV) {
+	case controllers.KALM_AUTH_PROXY_SESSION_STORE_SECRET:
+		clientset, _, err := newInClusterClientset()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the auth proxy is only allowed to access secrets in the session namespace
+		namespace := os.Getenv(controllers.KALM_AUTH_PROXY_SESSION_NAMESPACE_ENV)
+
+		if namespace == "" {
+			return nil, fmt.Errorf("%s is required", controllers.KALM_AUTH_PROXY_SESSION_NAMESPACE_ENV)
+		}
+
+		store := auth_proxy.NewSecretSessionStore(clientset, namespace)
+
+		// every ext_authz request reads the session, read them from a cache instead of the API server
+		if err := store.StartInformer(wait.NeverStop); err != nil {
+			return nil, err
+		}
+
+		go deleteExpiredSessions(store)
+
+		return store, nil
+	case "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown session store %s", os.Getenv(controllers.KALM_AUTH_PROXY_SESSION_STORE_ENV))
+	}
+}
+
+// newCredentialStore returns nil if the namespace of the auth proxy is not set, e.g. running out of the cluster.
+func newCredentialStore() (*auth_proxy.CredentialStore, error) {
+	namespace := os.Getenv(controllers.KALM_AUTH_PROXY_NAMESPACE_ENV)
+
+	if namespace == "" {
+		return nil, nil
+	}
+
+	config, err := rest.InClusterConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(config, client.Options{Scheme: scheme})
+
+	if err != nil {
+		return nil, err
+	}
+
+	store := auth_proxy.NewCredentialStore(c, namespace)
+	go flushCredentialUsage(store)
+
+	return store, nil
+}
+
+func flushCredentialUsage(store *auth_proxy.CredentialStore) {
+	for range time.Tick(30 * time.Second) {
+		if err := store.FlushUsage(context.Background()); err != nil {
+			logger.Error(err, "flush credential usage error")
+		}
+	}
+}
+
+// sessions of users who never come back are never deleted by requests
+func deleteExpiredSessions(store *auth_proxy.SecretSessionStore) {
+	for range time.Tick(time.Hour) {
+		if err := store.DeleteExpired(context.Background()); err != nil {
+			logger.Error(err, "delete expired sessions error")
+		}
+	}
+}
+
 func main() {
 	logger = log.NewLogger("info")
 	e := server.NewEchoInstance()
 
+	var err error
+	refreshCoordinator, err = newRefreshCoordinator()
+
+	if err != nil {
+		panic(err)
+	}
+
+	sessionStore, err = newSessionStore()
+
+	if err != nil {
+		panic(err)
+	}
+
+	credentialStore, err = newCredentialStore()
+
+	if err != nil {
+		panic(err)
+	}
+
 	// oidc auth proxy handlers
 	e.GET("/oidc/login", handleOIDCLogin)
 	e.GET("/oidc/callback", handleOIDCCallback)
 
+	// oauth2 client credentials grant of sso credentials
+	e.POST("/oauth2/token", handleOAuth2Token)
+
 	// envoy ext_authz handlers
 	e.Any("/"+ENVOY_EXT_AUTH_PATH_PREFIX+"/*", handleExtAuthz)
 	e.Any("/"+ENVOY_EXT_AUTH_PATH_PREFIX, handleExtAuthz)
 
 	e.POST("/log", handleLog)
 
-	err := e.StartH2CServer("0.0.0.0:3002", &http2.Server{
+	err = e.StartH2CServer("0.0.0.0:3002", &http2.Server{
 		MaxConcurrentStreams: 250,
 		MaxReadFrameSize:     1048576,
 		IdleTimeout:          60 * time.Second,
@@ -7,6 +7,7 @@ import (
 	coreV1 "k8s.io/api/core/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net/http"
+	"sigs.k8s.io/yaml"
 )
 
 func (h *ApiHandler) handleGetApplications(c echo.Context) error {
@@ -72,6 +73,57 @@ func (h *ApiHandler) handleDeleteApplication(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+func (h *ApiHandler) handleExportApplication(c echo.Context) error {
+	bundle, err := h.Builder(c).ExportApplication(c.Param("name"))
+
+	if err != nil {
+		return err
+	}
+
+	if c.QueryParam("format") != "yaml" {
+		return c.JSON(200, bundle)
+	}
+
+	bts, err := yaml.Marshal(bundle)
+
+	if err != nil {
+		return err
+	}
+
+	return c.Blob(200, "application/x-yaml", bts)
+}
+
+// bundles are plain yaml of the resources of an application
+const maxApplicationBundleSize = 10 << 20
+
+// the bundle is applied only if dryRun is not true, the diff is returned in both cases.
+// Bundles with unresolved secrets are rejected unless allowUnresolvedSecrets is true.
+func (h *ApiHandler) handleImportApplication(c echo.Context) error {
+	data, err := readRequestBody(c, maxApplicationBundleSize)
+
+	if err != nil {
+		return err
+	}
+
+	objs, err := resources.DecodeApplicationBundle(data, c.Param("name"))
+
+	if err != nil {
+		return err
+	}
+
+	res, err := h.Builder(c).ImportApplication(
+		objs,
+		c.QueryParam("dryRun") == "true",
+		c.QueryParam("allowUnresolvedSecrets") == "true",
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, res)
+}
+
 func getKalmNamespaceFromContext(c echo.Context) (*coreV1.Namespace, error) {
 	var ns resources.Application
 
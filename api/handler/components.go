@@ -124,11 +124,22 @@ func (h *ApiHandler) createComponent(c echo.Context) (*v1alpha1.Component, error
 	}
 
 	crdComponent.Namespace = c.Param("applicationName")
+
+	secretValues, err := resources.ExtractComponentSecrets(&crdComponent.Spec)
+	if err != nil {
+		return nil, err
+	}
+
 	err = h.Builder(c).Create(crdComponent)
 	if err != nil {
 		return nil, err
 	}
 
+	// the user is allowed to write the component, so is the secret owned by it
+	if err := h.KalmBuilder().UpdateComponentSecret(crdComponent, secretValues); err != nil {
+		return nil, err
+	}
+
 	err = h.Builder(c).UpdateComponentPluginBindingsForObject(crdComponent.Namespace, crdComponent.Name, plugins)
 
 	if err != nil {
@@ -144,10 +155,26 @@ func (h *ApiHandler) updateComponent(c echo.Context) (*v1alpha1.Component, error
 		return nil, err
 	}
 
+	// clients send empty secret values if they are unchanged
+	secretValues, err := resources.ExtractComponentSecrets(&crdComponent.Spec)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := h.Builder(c).Apply(crdComponent); err != nil {
 		return nil, err
 	}
 
+	// the secret is only written once the updated component is accepted
+	var updated v1alpha1.Component
+	if err := h.Builder(c).Get(crdComponent.Namespace, crdComponent.Name, &updated); err != nil {
+		return nil, err
+	}
+
+	if err := h.KalmBuilder().UpdateComponentSecret(&updated, secretValues); err != nil {
+		return nil, err
+	}
+
 	err = h.Builder(c).UpdateComponentPluginBindingsForObject(crdComponent.Namespace, crdComponent.Name, plugins)
 
 	if err != nil {
@@ -19,6 +19,9 @@ type H map[string]interface{}
 func (h *ApiHandler) InstallWebhookRoutes(e *echo.Echo) {
 	e.GET("/ping", handlePing)
 	e.POST("/webhook/components", h.handleDeployWebhookCall)
+	e.POST("/webhook/github/:deployKey", h.handleGithubWebhookCall)
+	e.POST("/webhook/gitlab/:deployKey", h.handleGitlabWebhookCall)
+	e.POST("/webhook/registry/:deployKey", h.handleRegistryWebhookCall)
 }
 
 func (h *ApiHandler) InstallMainRoutes(e *echo.Echo) {
@@ -39,6 +42,7 @@ func (h *ApiHandler) InstallMainRoutes(e *echo.Echo) {
 	gv1Alpha1 := e.Group("/v1alpha1")
 	gv1Alpha1.GET("/logs", h.logWebsocketHandler)
 	gv1Alpha1.GET("/exec", h.execWebsocketHandler)
+	gv1Alpha1.GET("/logs/tail", h.lokiTailWebsocketHandler)
 
 	gv1Alpha1WithAuth := gv1Alpha1.Group("", h.AuthClientMiddleware)
 
@@ -47,10 +51,16 @@ func (h *ApiHandler) InstallMainRoutes(e *echo.Echo) {
 	gv1Alpha1WithAuth.POST("/reset", h.handleResetCluster)
 
 	gv1Alpha1WithAuth.GET("/cluster", h.handleClusterInfo)
+
+	gv1Alpha1WithAuth.GET("/logs/query", h.handleLokiQuery)
+
 	gv1Alpha1WithAuth.GET("/applications", h.handleGetApplications)
 	gv1Alpha1WithAuth.POST("/applications", h.handleCreateApplication)
 	gv1Alpha1WithAuth.GET("/applications/:name", h.handleGetApplicationDetails)
 	gv1Alpha1WithAuth.DELETE("/applications/:name", h.handleDeleteApplication)
+	gv1Alpha1WithAuth.GET("/applications/:name/export", h.handleExportApplication)
+	gv1Alpha1WithAuth.POST("/applications/:name/import", h.handleImportApplication)
+	gv1Alpha1WithAuth.GET("/applications/:name/logs", h.handleDownloadApplicationLogs)
 
 	gv1Alpha1WithAuth.GET("/services", h.handleListClusterServices)
 
@@ -60,6 +70,7 @@ func (h *ApiHandler) InstallMainRoutes(e *echo.Echo) {
 	gv1Alpha1WithAuth.GET("/applications/:applicationName/components/:name", h.handleGetComponent)
 	gv1Alpha1WithAuth.PUT("/applications/:applicationName/components/:name", h.handleUpdateComponent)
 	gv1Alpha1WithAuth.DELETE("/applications/:applicationName/components/:name", h.handleDeleteComponent)
+	gv1Alpha1WithAuth.GET("/applications/:applicationName/components/:name/logs", h.handleDownloadComponentLogs)
 	gv1Alpha1WithAuth.POST("/applications/:applicationName/components", h.handleCreateComponent)
 
 	gv1Alpha1WithAuth.GET("/registries", h.handleListRegistries)
@@ -69,6 +80,7 @@ func (h *ApiHandler) InstallMainRoutes(e *echo.Echo) {
 	gv1Alpha1WithAuth.DELETE("/registries/:name", h.handleDeleteRegistry)
 
 	gv1Alpha1WithAuth.DELETE("/pods/:namespace/:name", h.handleDeletePod)
+	gv1Alpha1WithAuth.GET("/pods/:namespace/:name/logs", h.handleDownloadPodLogs)
 
 	gv1Alpha1WithAuth.GET("/rolebindings", h.handleListRoleBindings)
 	gv1Alpha1WithAuth.POST("/rolebindings", h.handleCreateRoleBinding)
@@ -86,6 +98,13 @@ func (h *ApiHandler) InstallMainRoutes(e *echo.Echo) {
 	gv1Alpha1WithAuth.PUT("/httproutes/:namespace/:name", h.handleUpdateRoute)
 	gv1Alpha1WithAuth.DELETE("/httproutes/:namespace/:name", h.handleDeleteRoute)
 
+	gv1Alpha1WithAuth.GET("/promotions", h.handleListAllPromotions)
+	gv1Alpha1WithAuth.GET("/promotions/:namespace", h.handleListPromotions)
+	gv1Alpha1WithAuth.GET("/promotions/:namespace/:name", h.handleGetPromotion)
+	gv1Alpha1WithAuth.POST("/promotions/:namespace", h.handleCreatePromotion)
+	gv1Alpha1WithAuth.PUT("/promotions/:namespace/:name", h.handleUpdatePromotion)
+	gv1Alpha1WithAuth.DELETE("/promotions/:namespace/:name", h.handleDeletePromotion)
+
 	gv1Alpha1WithAuth.GET("/httpscertissuers", h.handleGetHttpsCertIssuer)
 	gv1Alpha1WithAuth.POST("/httpscertissuers", h.handleCreateHttpsCertIssuer)
 	gv1Alpha1WithAuth.PUT("/httpscertissuers/:name", h.handleUpdateHttpsCertIssuer)
@@ -113,6 +132,14 @@ func (h *ApiHandler) InstallMainRoutes(e *echo.Echo) {
 	gv1Alpha1WithAuth.PUT("/sso", h.handleUpdateSSOConfig)
 	gv1Alpha1WithAuth.POST("/sso", h.handleCreateSSOConfig)
 
+	gv1Alpha1WithAuth.GET("/sso/sessions", h.handleListSSOSessions)
+	gv1Alpha1WithAuth.DELETE("/sso/sessions", h.handleDeleteSSOSessions)
+	gv1Alpha1WithAuth.DELETE("/sso/sessions/:id", h.handleDeleteSSOSession)
+
+	gv1Alpha1WithAuth.GET("/ssocredentials", h.handleListSSOCredentials)
+	gv1Alpha1WithAuth.POST("/ssocredentials", h.handleCreateSSOCredential)
+	gv1Alpha1WithAuth.DELETE("/ssocredentials/:name", h.handleDeleteSSOCredential)
+
 	gv1Alpha1WithAuth.GET("/protectedendpoints", h.handleListProtectedEndpoints)
 	gv1Alpha1WithAuth.DELETE("/protectedendpoints", h.handleDeleteProtectedEndpoints)
 	gv1Alpha1WithAuth.POST("/protectedendpoints", h.handleCreateProtectedEndpoints)
@@ -0,0 +1,414 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kalmhq/kalm/api/log"
+	"github.com/labstack/echo/v4"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	LogArchiveFormatGzip = "gzip"
+	LogArchiveFormatZip  = "zip"
+
+	// failures of single containers are collected in this file instead of failing the whole download
+	logArchiveErrorsFile = "errors.txt"
+
+	// logs of each container are read up to this size, from the since time
+	maxContainerLogArchiveBytes = 32 * 1024 * 1024
+
+	// logs of the remaining containers are skipped after this size, before compression
+	maxLogArchiveBytes = 512 * 1024 * 1024
+)
+
+func (h *ApiHandler) handleDownloadPodLogs(c echo.Context) error {
+	namespace := c.Param("namespace")
+
+	pod, err := getK8sClient(c).CoreV1().Pods(namespace).Get(c.Request().Context(), c.Param("name"), metaV1.GetOptions{})
+
+	if err != nil {
+		return err
+	}
+
+	return writeLogArchiveResponse(c, fmt.Sprintf("%s-%s-logs", namespace, pod.Name), []coreV1.Pod{*pod})
+}
+
+func (h *ApiHandler) handleDownloadComponentLogs(c echo.Context) error {
+	namespace := c.Param("applicationName")
+	name := c.Param("name")
+
+	pods, err := getK8sClient(c).CoreV1().Pods(namespace).List(c.Request().Context(), metaV1.ListOptions{
+		LabelSelector: fmt.Sprintf("kalm-component=%s", name),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return writeLogArchiveResponse(c, fmt.Sprintf("%s-%s-logs", namespace, name), pods.Items)
+}
+
+func (h *ApiHandler) handleDownloadApplicationLogs(c echo.Context) error {
+	namespace := c.Param("name")
+
+	pods, err := getK8sClient(c).CoreV1().Pods(namespace).List(c.Request().Context(), metaV1.ListOptions{})
+
+	if err != nil {
+		return err
+	}
+
+	return writeLogArchiveResponse(c, fmt.Sprintf("%s-logs", namespace), pods.Items)
+}
+
+// writeLogArchiveResponse streams logs of the pods as an attachment.
+// The format query param is gzip (a .tar.gz file, default) or zip,
+// since and until are RFC3339 timestamps of the time window.
+func writeLogArchiveResponse(c echo.Context, name string, pods []coreV1.Pod) error {
+	format := c.QueryParam("format")
+
+	if format == "" {
+		format = LogArchiveFormatGzip
+	}
+
+	window, err := parseLogTimeWindow(c.QueryParam("since"), c.QueryParam("until"))
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var contentType, fileName string
+
+	switch format {
+	case LogArchiveFormatGzip:
+		contentType, fileName = "application/gzip", name+".tar.gz"
+	case LogArchiveFormatZip:
+		contentType, fileName = "application/zip", name+".zip"
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown archive format %s", format))
+	}
+
+	k8sClient := getK8sClient(c)
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, contentType)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	res.WriteHeader(http.StatusOK)
+
+	archive := newPodLogArchive(window, newLogArchiveWriter(format, res), kubernetesPodLogOpener(k8sClient))
+
+	// the status code is already sent, errors can only be logged from here
+	if err := archive.writePods(c.Request().Context(), pods); err != nil {
+		log.Error(err, "write log archive error", "name", name)
+	}
+
+	return nil
+}
+
+type logTimeWindow struct {
+	Since *time.Time
+	Until *time.Time
+}
+
+func parseLogTimeWindow(since, until string) (*logTimeWindow, error) {
+	window := &logTimeWindow{}
+
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid since %s, must be RFC3339 format", since)
+		}
+
+		window.Since = &t
+	}
+
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid until %s, must be RFC3339 format", until)
+		}
+
+		window.Until = &t
+	}
+
+	if window.Since != nil && window.Until != nil && window.Until.Before(*window.Since) {
+		return nil, fmt.Errorf("until must be after since")
+	}
+
+	return window, nil
+}
+
+// includes reports whether a log line, prefixed with the timestamp added by kubernetes, is in the window.
+// The apiserver already applies since, so only until is checked here. Lines are in time order,
+// so no line after the first excluded one is included either.
+func (w *logTimeWindow) includes(line string) bool {
+	if w.Until == nil {
+		return true
+	}
+
+	parts := strings.SplitN(line, " ", 2)
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+
+	if err != nil {
+		// continuation of a previous line, or the line is not prefixed
+		return true
+	}
+
+	return !t.After(*w.Until)
+}
+
+type podLogOpener func(ctx context.Context, namespace, podName string, opts *coreV1.PodLogOptions) (io.ReadCloser, error)
+
+func kubernetesPodLogOpener(k8sClient kubernetes.Interface) podLogOpener {
+	return func(ctx context.Context, namespace, podName string, opts *coreV1.PodLogOptions) (io.ReadCloser, error) {
+		return k8sClient.CoreV1().Pods(namespace).GetLogs(podName, opts).Stream(ctx)
+	}
+}
+
+type podLogArchive struct {
+	window  *logTimeWindow
+	writer  logArchiveWriter
+	openLog podLogOpener
+	errors  []string
+
+	containerLimitBytes int64
+	limitBytes          int64
+	written             int64
+}
+
+func newPodLogArchive(window *logTimeWindow, writer logArchiveWriter, openLog podLogOpener) *podLogArchive {
+	return &podLogArchive{
+		window:              window,
+		writer:              writer,
+		openLog:             openLog,
+		containerLimitBytes: maxContainerLogArchiveBytes,
+		limitBytes:          maxLogArchiveBytes,
+	}
+}
+
+// writePods adds a file for each container of the pods, at <namespace>/<pod>/<container>.log.
+// Logs of the previous terminated instance of restarted containers are saved as <container>.previous.log.
+func (a *podLogArchive) writePods(ctx context.Context, pods []coreV1.Pod) error {
+	for i := range pods {
+		pod := &pods[i]
+
+		statuses := make(map[string]coreV1.ContainerStatus)
+
+		for _, status := range pod.Status.InitContainerStatuses {
+			statuses[status.Name] = status
+		}
+
+		for _, status := range pod.Status.ContainerStatuses {
+			statuses[status.Name] = status
+		}
+
+		for _, container := range componentLogContainers(pod, "") {
+			dir := path.Join(pod.Namespace, pod.Name)
+
+			if err := a.writeContainerLog(ctx, pod, container, false, path.Join(dir, container+".log")); err != nil {
+				return err
+			}
+
+			if status, exist := statuses[container]; exist && status.RestartCount > 0 {
+				if err := a.writeContainerLog(ctx, pod, container, true, path.Join(dir, container+".previous.log")); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if len(a.errors) > 0 {
+		content := strings.Join(a.errors, "\n") + "\n"
+
+		if err := a.writer.WriteFile(logArchiveErrorsFile, time.Now(), func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return a.writer.Close()
+}
+
+// writeContainerLog returns an error only if the archive itself can't be written.
+func (a *podLogArchive) writeContainerLog(ctx context.Context, pod *coreV1.Pod, container string, previous bool, fileName string) error {
+	limitBytes := a.limitBytes - a.written
+
+	if limitBytes <= 0 {
+		a.errors = append(a.errors, fmt.Sprintf("%s: skipped, logs in the archive exceed %d bytes", fileName, a.limitBytes))
+		return nil
+	}
+
+	if limitBytes > a.containerLimitBytes {
+		limitBytes = a.containerLimitBytes
+	}
+
+	opts := &coreV1.PodLogOptions{
+		Container:  container,
+		Previous:   previous,
+		Timestamps: true,
+		LimitBytes: &limitBytes,
+	}
+
+	if a.window.Since != nil {
+		sinceTime := metaV1.NewTime(*a.window.Since)
+		opts.SinceTime = &sinceTime
+	}
+
+	stream, err := a.openLog(ctx, pod.Namespace, pod.Name, opts)
+
+	if err != nil {
+		a.errors = append(a.errors, fmt.Sprintf("%s: %s", fileName, err.Error()))
+		return nil
+	}
+
+	defer stream.Close()
+
+	return a.writer.WriteFile(fileName, time.Now(), func(w io.Writer) error {
+		reader := &io.LimitedReader{R: stream, N: limitBytes}
+		entry := &logArchiveEntryWriter{w: w}
+
+		if err := a.filterLog(reader, entry); err != nil && entry.err == nil {
+			a.errors = append(a.errors, fmt.Sprintf("%s: %s", fileName, err.Error()))
+		} else if reader.N <= 0 {
+			a.errors = append(a.errors, fmt.Sprintf("%s: truncated at %d bytes", fileName, limitBytes))
+		}
+
+		a.written += entry.size
+
+		return entry.err
+	})
+}
+
+// filterLog copies lines in the time window, reading stops at the first line after the window.
+func (a *podLogArchive) filterLog(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+
+	for {
+		line, err := readLogLine(reader)
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !a.window.includes(line) {
+			return nil
+		}
+
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+}
+
+// logArchiveEntryWriter counts the written bytes, and keeps the error to tell it from errors of reading logs.
+type logArchiveEntryWriter struct {
+	w    io.Writer
+	size int64
+	err  error
+}
+
+func (e *logArchiveEntryWriter) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	e.size += int64(n)
+
+	if err != nil {
+		e.err = err
+	}
+
+	return n, err
+}
+
+// logArchiveWriter adds a file to the archive, the content is written by write.
+type logArchiveWriter interface {
+	WriteFile(name string, modTime time.Time, write func(w io.Writer) error) error
+	Close() error
+}
+
+func newLogArchiveWriter(format string, w io.Writer) logArchiveWriter {
+	if format == LogArchiveFormatZip {
+		return &zipLogArchiveWriter{zip.NewWriter(w)}
+	}
+
+	gz := gzip.NewWriter(w)
+	return &tarGzipLogArchiveWriter{gz: gz, tar: tar.NewWriter(gz)}
+}
+
+type tarGzipLogArchiveWriter struct {
+	gz  *gzip.Writer
+	tar *tar.Writer
+}
+
+// tar headers require the size in advance, so the content is buffered in memory.
+// It's no larger than the limit of the log of a container.
+func (t *tarGzipLogArchiveWriter) WriteFile(name string, modTime time.Time, write func(w io.Writer) error) error {
+	buf := &bytes.Buffer{}
+
+	if err := write(buf); err != nil {
+		return err
+	}
+
+	err := t.tar.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(buf.Len()),
+		ModTime: modTime,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(t.tar)
+	return err
+}
+
+func (t *tarGzipLogArchiveWriter) Close() error {
+	if err := t.tar.Close(); err != nil {
+		return err
+	}
+
+	return t.gz.Close()
+}
+
+type zipLogArchiveWriter struct {
+	zip *zip.Writer
+}
+
+// the content is streamed into the zip entry, the size is written after it
+func (z *zipLogArchiveWriter) WriteFile(name string, modTime time.Time, write func(w io.Writer) error) error {
+	w, err := z.zip.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return write(w)
+}
+
+func (z *zipLogArchiveWriter) Close() error {
+	return z.zip.Close()
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func fakePodLogOpener(logs map[string]string) podLogOpener {
+	return func(ctx context.Context, namespace, podName string, opts *coreV1.PodLogOptions) (io.ReadCloser, error) {
+		key := fmt.Sprintf("%s/%s/%s/%t", namespace, podName, opts.Container, opts.Previous)
+
+		if content, exist := logs[key]; exist {
+			return ioutil.NopCloser(strings.NewReader(content)), nil
+		}
+
+		return nil, fmt.Errorf("container %s is waiting to start", opts.Container)
+	}
+}
+
+func logArchiveTestPods() []coreV1.Pod {
+	return []coreV1.Pod{
+		{
+			ObjectMeta: metaV1.ObjectMeta{Namespace: "shop", Name: "web-0"},
+			Spec: coreV1.PodSpec{
+				InitContainers: []coreV1.Container{{Name: "migrate"}},
+				Containers:     []coreV1.Container{{Name: "web"}, {Name: "istio-proxy"}},
+			},
+			Status: coreV1.PodStatus{
+				ContainerStatuses: []coreV1.ContainerStatus{{Name: "web", RestartCount: 1}},
+			},
+		},
+	}
+}
+
+var logArchiveTestLogs = map[string]string{
+	"shop/web-0/migrate/false": "2020-08-01T09:00:00.000000000Z migrated\n",
+	"shop/web-0/web/false":     "2020-08-01T10:00:00.000000000Z started\n2020-08-01T12:00:00.000000000Z too late\n",
+	"shop/web-0/web/true":      "2020-08-01T09:30:00.000000000Z panic\n",
+}
+
+func readTarGzipLogArchive(t *testing.T, r io.Reader) map[string]string {
+	gz, err := gzip.NewReader(r)
+	assert.Nil(t, err)
+	reader := tar.NewReader(gz)
+
+	files := make(map[string]string)
+
+	for {
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		assert.Nil(t, err)
+		content, _ := ioutil.ReadAll(reader)
+		files[header.Name] = string(content)
+	}
+
+	return files
+}
+
+func TestLogArchiveTarGzip(t *testing.T) {
+	window, err := parseLogTimeWindow("", "2020-08-01T11:00:00Z")
+	assert.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	archive := newPodLogArchive(window, newLogArchiveWriter(LogArchiveFormatGzip, buf), fakePodLogOpener(logArchiveTestLogs))
+	assert.Nil(t, archive.writePods(context.Background(), logArchiveTestPods()))
+
+	files := readTarGzipLogArchive(t, buf)
+
+	assert.Equal(t, "2020-08-01T09:00:00.000000000Z migrated\n", files["shop/web-0/migrate.log"])
+	assert.Equal(t, "2020-08-01T10:00:00.000000000Z started\n", files["shop/web-0/web.log"])
+	assert.Equal(t, "2020-08-01T09:30:00.000000000Z panic\n", files["shop/web-0/web.previous.log"])
+	assert.Contains(t, files[logArchiveErrorsFile], "shop/web-0/istio-proxy.log: container istio-proxy is waiting to start")
+	assert.Len(t, files, 4)
+}
+
+func TestLogArchiveZip(t *testing.T) {
+	window, _ := parseLogTimeWindow("", "")
+
+	buf := &bytes.Buffer{}
+	archive := newPodLogArchive(window, newLogArchiveWriter(LogArchiveFormatZip, buf), fakePodLogOpener(logArchiveTestLogs))
+	assert.Nil(t, archive.writePods(context.Background(), logArchiveTestPods()))
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+
+	files := make(map[string]string)
+
+	for _, f := range reader.File {
+		r, err := f.Open()
+		assert.Nil(t, err)
+		content, _ := ioutil.ReadAll(r)
+		files[f.Name] = string(content)
+	}
+
+	assert.Equal(t, logArchiveTestLogs["shop/web-0/web/false"], files["shop/web-0/web.log"])
+	assert.Contains(t, files, "shop/web-0/web.previous.log")
+}
+
+type failingLogReader struct{}
+
+func (failingLogReader) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("read after the time window")
+}
+
+func TestLogArchiveLimits(t *testing.T) {
+	window, _ := parseLogTimeWindow("", "2020-08-01T11:00:00Z")
+	line := "2020-08-01T10:00:00.000000000Z 0123456789\n"
+	var limits []int64
+
+	openLog := func(ctx context.Context, namespace, podName string, opts *coreV1.PodLogOptions) (io.ReadCloser, error) {
+		limits = append(limits, *opts.LimitBytes)
+
+		content := strings.Repeat(line, 10)
+
+		// the stream is not read after the first line out of the time window
+		if opts.Container == "migrate" {
+			content = strings.Repeat(line, 5) + "2020-08-01T12:00:00.000000000Z too late\n"
+		}
+
+		return ioutil.NopCloser(io.MultiReader(strings.NewReader(content), failingLogReader{})), nil
+	}
+
+	buf := &bytes.Buffer{}
+	archive := newPodLogArchive(window, newLogArchiveWriter(LogArchiveFormatGzip, buf), openLog)
+	archive.containerLimitBytes = 300
+	archive.limitBytes = 500
+
+	assert.Nil(t, archive.writePods(context.Background(), logArchiveTestPods()))
+
+	// the second container gets the rest of the archive limit
+	migrateSize := int64(5 * len(line))
+	assert.Equal(t, []int64{300, 500 - migrateSize}, limits)
+
+	files := readTarGzipLogArchive(t, buf)
+	assert.Equal(t, strings.Repeat(line, 5), files["shop/web-0/migrate.log"])
+	assert.True(t, strings.HasPrefix(files["shop/web-0/web.log"], strings.Repeat(line, 6)))
+
+	errors := files[logArchiveErrorsFile]
+	assert.Contains(t, errors, fmt.Sprintf("shop/web-0/web.log: truncated at %d bytes", 500-migrateSize))
+	assert.Contains(t, errors, "shop/web-0/web.previous.log: skipped")
+	assert.Contains(t, errors, "shop/web-0/istio-proxy.log: skipped")
+	assert.NotContains(t, errors, "migrate")
+	assert.NotContains(t, errors, "read after the time window")
+}
+
+func TestParseLogTimeWindow(t *testing.T) {
+	_, err := parseLogTimeWindow("2020-08-01T11:00:00Z", "2020-08-01T10:00:00Z")
+	assert.NotNil(t, err)
+
+	_, err = parseLogTimeWindow("an hour ago", "")
+	assert.NotNil(t, err)
+
+	window, err := parseLogTimeWindow("2020-08-01T10:00:00Z", "2020-08-01T11:00:00Z")
+	assert.Nil(t, err)
+	assert.True(t, window.includes("2020-08-01T10:30:00.123456789Z request served"))
+	assert.False(t, window.includes("2020-08-01T11:00:00.000000001Z request served"))
+	assert.True(t, window.includes("\tat main.go:12"))
+}
@@ -0,0 +1,394 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kalmhq/kalm/api/log"
+	"github.com/kalmhq/kalm/api/resources"
+	"github.com/labstack/echo/v4"
+)
+
+// namespace is the label promtail of the LogSystem attaches to every log stream
+const lokiNamespaceLabel = "namespace"
+
+var lokiHTTPClient = &http.Client{Timeout: 60 * time.Second}
+
+// query params passed to loki's query_range api as is
+var lokiQueryRangeParams = []string{"start", "end", "limit", "direction", "step"}
+
+// handleLokiQuery proxies a LogQL query to loki. The query is restricted to namespaces
+// in which the caller can read pod logs, optionally narrowed by the namespace query params.
+func (h *ApiHandler) handleLokiQuery(c echo.Context) error {
+	query := c.QueryParam("query")
+
+	if query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "query is required")
+	}
+
+	lokiAddress, err := h.getLokiAddress()
+
+	if err != nil {
+		return err
+	}
+
+	namespaces, err := h.getLogReadableNamespaces(h.Builder(c), c.QueryParams()["namespace"])
+
+	if err != nil {
+		return err
+	}
+
+	scopedQuery, err := scopeLogQLQuery(query, namespaces)
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	params := url.Values{}
+	params.Set("query", scopedQuery)
+
+	for _, name := range lokiQueryRangeParams {
+		if value := c.QueryParam(name); value != "" {
+			params.Set(name, value)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, lokiAddress+"/loki/api/v1/query_range?"+params.Encode(), nil)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := lokiHTTPClient.Do(req)
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("query loki failed, %s", err.Error()))
+	}
+
+	defer res.Body.Close()
+
+	// errors from loki, e.g. LogQL syntax errors, are returned to the caller with their status code
+	return c.Stream(res.StatusCode, res.Header.Get(echo.HeaderContentType), res.Body)
+}
+
+func (h *ApiHandler) getLokiAddress() (string, error) {
+	lokiAddress, err := h.KalmBuilder().GetLokiAddress()
+
+	if err == resources.NoLokiLogSystemError {
+		return "", echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return lokiAddress, err
+}
+
+// getLogReadableNamespaces checks the requested namespaces, or all namespaces if none is requested.
+// The namespaces are listed with kalm's permission because the caller may not be able to list namespaces.
+func (h *ApiHandler) getLogReadableNamespaces(builder *resources.Builder, requested []string) ([]string, error) {
+	var err error
+
+	if len(requested) == 0 {
+		if requested, err = h.KalmBuilder().ListAllNamespaceNames(); err != nil {
+			return nil, err
+		}
+	}
+
+	namespaces, err := builder.FilterLogReadableNamespaces(requested)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(namespaces) == 0 {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "no permission to read logs of the requested namespaces")
+	}
+
+	return namespaces, nil
+}
+
+// scopeLogQLQuery adds a namespace matcher to every stream selector in the query.
+// Loki requires all matchers of a selector to match, so matchers written by the caller
+// can't widen the scope. Comments are rejected, the added matchers would be commented out by them.
+func scopeLogQLQuery(query string, namespaces []string) (string, error) {
+	if len(namespaces) == 0 {
+		return "", fmt.Errorf("no namespace to query")
+	}
+
+	if strings.ContainsAny(query, "\r\n") {
+		return "", fmt.Errorf("invalid query, line breaks are not allowed")
+	}
+
+	quoted := make([]string, len(namespaces))
+
+	for i := range namespaces {
+		quoted[i] = regexp.QuoteMeta(namespaces[i])
+	}
+
+	matcher := fmt.Sprintf(`%s=~"%s"`, lokiNamespaceLabel, strings.ReplaceAll(strings.Join(quoted, "|"), `\`, `\\`))
+
+	var sb strings.Builder
+	var quote byte
+	selectorStart := -1
+	selectors := 0
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+
+		if quote != 0 {
+			end := i
+
+			if ch == '\\' && quote != '`' && i+1 < len(query) {
+				end++
+			} else if ch == quote {
+				quote = 0
+			}
+
+			if selectorStart < 0 {
+				sb.WriteString(query[i : end+1])
+			}
+
+			i = end
+			continue
+		}
+
+		switch ch {
+		case '"', '`':
+			quote = ch
+		case '#':
+			return "", fmt.Errorf("invalid query, comments are not allowed")
+		case '{':
+			if selectorStart >= 0 {
+				return "", fmt.Errorf("invalid query, unexpected { at %d", i)
+			}
+
+			selectorStart = i
+		case '}':
+			if selectorStart < 0 {
+				return "", fmt.Errorf("invalid query, unexpected } at %d", i)
+			}
+
+			matchers := strings.TrimSpace(query[selectorStart+1 : i])
+
+			if matchers == "" {
+				sb.WriteString("{" + matcher + "}")
+			} else {
+				sb.WriteString("{" + matchers + ", " + matcher + "}")
+			}
+
+			selectorStart = -1
+			selectors++
+			continue
+		}
+
+		if selectorStart < 0 {
+			sb.WriteByte(ch)
+		}
+	}
+
+	if quote != 0 || selectorStart >= 0 {
+		return "", fmt.Errorf("invalid query, unterminated string or stream selector")
+	}
+
+	if selectors == 0 {
+		return "", fmt.Errorf("invalid query, no stream selector found")
+	}
+
+	return sb.String(), nil
+}
+
+type WSLokiTailResponse struct {
+	Type  WSResponseType  `json:"type"`
+	Query string          `json:"query"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// copyLokiTailToWS subscribes to loki's tail api and forwards the raw messages to the client.
+// m.SinceTime and m.TailLines are passed as start and limit.
+func (h *ApiHandler) copyLokiTailToWS(ctx context.Context, conn *WSConn, m *WSPodResourceRequest) {
+	var errMessage string
+
+	defer func() {
+		_ = conn.WriteJSON(&WSLokiTailResponse{
+			Type:  WSResponseTypeLokiTailDisconnected,
+			Query: m.Query,
+			Error: errMessage,
+		})
+	}()
+
+	lokiConn, err := h.dialLokiTail(ctx, conn, m)
+
+	if err != nil {
+		log.Error(err, "tail loki error")
+		errMessage = err.Error()
+		return
+	}
+
+	defer lokiConn.Close()
+
+	go func() {
+		// closing the connection unblocks ReadMessage below
+		<-ctx.Done()
+		_ = lokiConn.Close()
+	}()
+
+	for {
+		_, message, err := lokiConn.ReadMessage()
+
+		if err != nil {
+			if ctx.Err() == nil && !isNormalWebsocketCloseError(err) {
+				log.Error(err, "read loki tail message error")
+				errMessage = err.Error()
+			}
+			return
+		}
+
+		err = conn.WriteJSON(&WSLokiTailResponse{
+			Type:  WSResponseTypeLokiTailUpdate,
+			Query: m.Query,
+			Data:  message,
+		})
+
+		if err != nil {
+			if !isNormalWebsocketCloseError(err) {
+				log.Error(err, "write message error")
+			}
+			return
+		}
+	}
+}
+
+func (h *ApiHandler) dialLokiTail(ctx context.Context, conn *WSConn, m *WSPodResourceRequest) (*websocket.Conn, error) {
+	if m.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	lokiAddress, err := h.getLokiAddress()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var requested []string
+
+	if m.Namespace != "" {
+		requested = []string{m.Namespace}
+	}
+
+	namespaces, err := h.getLogReadableNamespaces(resources.NewBuilder(conn.K8sConfig, h.logger), requested)
+
+	if err != nil {
+		return nil, err
+	}
+
+	scopedQuery, err := scopeLogQLQuery(m.Query, namespaces)
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("query", scopedQuery)
+
+	if m.TailLines > 0 {
+		params.Set("limit", fmt.Sprint(m.TailLines))
+	}
+
+	if m.SinceTime != "" {
+		start, err := time.Parse(time.RFC3339, m.SinceTime)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid sinceTime %s, must be RFC3339 format", m.SinceTime)
+		}
+
+		params.Set("start", fmt.Sprint(start.UnixNano()))
+	}
+
+	tailURL := "ws" + strings.TrimPrefix(lokiAddress, "http") + "/loki/api/v1/tail?" + params.Encode()
+	lokiConn, res, err := websocket.DefaultDialer.DialContext(ctx, tailURL, nil)
+
+	if err != nil && res != nil {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+		return nil, fmt.Errorf("%s, %s", err.Error(), strings.TrimSpace(string(body)))
+	}
+
+	return lokiConn, err
+}
+
+func (h *ApiHandler) handleLokiTailRequests(conn *WSConn) {
+	subscriptions := make(map[string]*logSubscription)
+	mut := &sync.Mutex{}
+
+	defer func() {
+		mut.Lock()
+		for _, sub := range subscriptions {
+			sub.stop()
+		}
+		mut.Unlock()
+	}()
+
+	for {
+		select {
+		case <-conn.ctx.Done():
+			return
+		case m := <-conn.podResourceRequest:
+			key := fmt.Sprintf("%s___%s", m.Namespace, m.Query)
+
+			mut.Lock()
+			if sub, existing := subscriptions[key]; existing {
+				sub.stop()
+				delete(subscriptions, key)
+			}
+
+			if m.Type != WSRequestTypeSubscribeLokiTail {
+				mut.Unlock()
+				continue
+			}
+
+			ctx, stop := context.WithCancel(conn.ctx)
+			sub := &logSubscription{stop: stop}
+			subscriptions[key] = sub
+			mut.Unlock()
+
+			go func(m *WSPodResourceRequest) {
+				defer func() {
+					mut.Lock()
+					if subscriptions[key] == sub {
+						delete(subscriptions, key)
+					}
+					mut.Unlock()
+					stop()
+				}()
+
+				h.copyLokiTailToWS(ctx, conn, m)
+			}(m)
+		}
+	}
+}
+
+func (h *ApiHandler) lokiTailWebsocketHandler(c echo.Context) error {
+	conn, err := h.prepareWSConnection(c)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		conn.stopFunc()
+		_ = conn.Close()
+	}()
+
+	go h.handleLokiTailRequests(conn)
+	_ = wsReadLoop(conn, h.clientManager)
+
+	return nil
+}
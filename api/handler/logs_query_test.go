@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeLogQLQuery(t *testing.T) {
+	namespaces := []string{"kalm-shop", "kalm-blog"}
+
+	query, err := scopeLogQLQuery(`{app="web"} |= "error"`, namespaces)
+	assert.Nil(t, err)
+	assert.Equal(t, `{app="web", namespace=~"kalm-shop|kalm-blog"} |= "error"`, query)
+
+	query, err = scopeLogQLQuery(`{}`, namespaces[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, `{namespace=~"kalm-shop"}`, query)
+
+	// braces in strings are not stream selectors
+	query, err = scopeLogQLQuery(`{app="web"} |~ "\"{id}\"" | line_format "{{.msg}}"`, namespaces[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, `{app="web", namespace=~"kalm-shop"} |~ "\"{id}\"" | line_format "{{.msg}}"`, query)
+
+	// every selector of a metric query is scoped, including the ones widening namespace
+	query, err = scopeLogQLQuery("sum(rate({namespace=~\".+\"}[5m])) / sum(rate({app=`web`}[5m]))", namespaces[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, "sum(rate({namespace=~\".+\", namespace=~\"kalm-shop\"}[5m])) / sum(rate({app=`web`, namespace=~\"kalm-shop\"}[5m]))", query)
+
+	_, err = scopeLogQLQuery(`{app="web"`, namespaces)
+	assert.NotNil(t, err)
+
+	_, err = scopeLogQLQuery(`{app="web}`, namespaces)
+	assert.NotNil(t, err)
+
+	_, err = scopeLogQLQuery(`rate([5m])`, namespaces)
+	assert.NotNil(t, err)
+
+	_, err = scopeLogQLQuery(`{app="web"}`, nil)
+	assert.NotNil(t, err)
+
+	// the added matcher would be commented out
+	_, err = scopeLogQLQuery("{job=~\".+\" #}\"\n} #\"", namespaces)
+	assert.NotNil(t, err)
+
+	_, err = scopeLogQLQuery(`{job=~".+"} # comment`, namespaces)
+	assert.NotNil(t, err)
+
+	_, err = scopeLogQLQuery("{job=~\".+\"}\n|= \"error\"", namespaces)
+	assert.NotNil(t, err)
+
+	// but not in strings
+	query, err = scopeLogQLQuery(`{app="web"} |= "#1"`, namespaces[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, `{app="web", namespace=~"kalm-shop"} |= "#1"`, query)
+}
@@ -1,6 +1,10 @@
 package handler
 
 import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/kalmhq/kalm/api/client"
 	"github.com/labstack/echo/v4"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -9,6 +13,7 @@ import (
 const (
 	KUBERNETES_CLIENT_CONFIG_KEY = "k8sClientConfig"
 	KUBERNETES_CLIENT_CLIENT_KEY = "k8sClient"
+	KALM_CLIENT_INFO_KEY         = "kalmClientInfo"
 )
 
 func (h *ApiHandler) AuthClientMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
@@ -20,6 +25,7 @@ func (h *ApiHandler) AuthClientMiddleware(next echo.HandlerFunc) echo.HandlerFun
 		}
 
 		c.Set(KUBERNETES_CLIENT_CONFIG_KEY, clientInfo.Cfg)
+		c.Set(KALM_CLIENT_INFO_KEY, clientInfo)
 
 		k8sClient, err := kubernetes.NewForConfig(clientInfo.Cfg)
 		if err != nil {
@@ -39,3 +45,19 @@ func getK8sClient(c echo.Context) *kubernetes.Clientset {
 func getK8sClientConfig(c echo.Context) *rest.Config {
 	return c.Get(KUBERNETES_CLIENT_CONFIG_KEY).(*rest.Config)
 }
+
+// readRequestBody reads the body of the request, bodies larger than limit are rejected.
+func readRequestBody(c echo.Context, limit int64) ([]byte, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, limit))
+
+	if err != nil && int64(len(body)) >= limit {
+		return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request body is too large")
+	}
+
+	return body, err
+}
+
+// getClientInfo returns the authenticated user of the request.
+func getClientInfo(c echo.Context) *client.ClientInfo {
+	return c.Get(KALM_CLIENT_INFO_KEY).(*client.ClientInfo)
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRequestBody(t *testing.T) {
+	e := echo.New()
+
+	newContext := func(body string) echo.Context {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		return e.NewContext(req, httptest.NewRecorder())
+	}
+
+	body, err := readRequestBody(newContext("payload"), 16)
+	assert.Nil(t, err)
+	assert.Equal(t, "payload", string(body))
+
+	body, err = readRequestBody(newContext("payload"), 7)
+	assert.Nil(t, err)
+	assert.Equal(t, "payload", string(body))
+
+	_, err = readRequestBody(newContext(strings.Repeat("x", 17)), 16)
+	httpErr, ok := err.(*echo.HTTPError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, httpErr.Code)
+}
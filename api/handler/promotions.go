@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/kalmhq/kalm/api/resources"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *ApiHandler) handleListAllPromotions(c echo.Context) error {
+	list, err := h.Builder(c).GetPromotions("")
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, list)
+}
+
+func (h *ApiHandler) handleListPromotions(c echo.Context) error {
+	list, err := h.Builder(c).GetPromotions(c.Param("namespace"))
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, list)
+}
+
+func (h *ApiHandler) handleGetPromotion(c echo.Context) error {
+	promotion, err := h.Builder(c).GetPromotion(c.Param("namespace"), c.Param("name"))
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, promotion)
+}
+
+func (h *ApiHandler) handleCreatePromotion(c echo.Context) (err error) {
+	var promotion *resources.Promotion
+
+	if promotion, err = getPromotionFromContext(c); err != nil {
+		return err
+	}
+
+	if promotion, err = h.Builder(c).CreatePromotion(promotion); err != nil {
+		return err
+	}
+
+	return c.JSON(201, promotion)
+}
+
+func (h *ApiHandler) handleUpdatePromotion(c echo.Context) (err error) {
+	var promotion *resources.Promotion
+
+	if promotion, err = getPromotionFromContext(c); err != nil {
+		return err
+	}
+
+	promotion.Name = c.Param("name")
+
+	if promotion, err = h.Builder(c).UpdatePromotion(promotion); err != nil {
+		return err
+	}
+
+	return c.JSON(200, promotion)
+}
+
+func (h *ApiHandler) handleDeletePromotion(c echo.Context) (err error) {
+	if err = h.Builder(c).DeletePromotion(c.Param("namespace"), c.Param("name")); err != nil {
+		return err
+	}
+
+	return c.NoContent(200)
+}
+
+func getPromotionFromContext(c echo.Context) (*resources.Promotion, error) {
+	var promotion resources.Promotion
+
+	if err := c.Bind(&promotion); err != nil {
+		return nil, err
+	}
+
+	// a promotion lives in the target application
+	promotion.Namespace = c.Param("namespace")
+
+	if promotion.PromotionSpec == nil {
+		return nil, fmt.Errorf("spec of promotion can't be blank")
+	}
+
+	return &promotion, nil
+}
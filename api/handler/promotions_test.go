@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/kalmhq/kalm/api/resources"
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/suite"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type PromotionsHandlerTestSuite struct {
+	WithControllerTestSuite
+}
+
+func (suite *PromotionsHandlerTestSuite) SetupSuite() {
+	suite.WithControllerTestSuite.SetupSuite()
+	suite.ensureNamespaceExist("test-promotions-dev")
+	suite.ensureNamespaceExist("test-promotions-staging")
+
+	suite.Nil(suite.Create(&v1alpha1.Component{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "web",
+			Namespace: "test-promotions-dev",
+		},
+		Spec: v1alpha1.ComponentSpec{
+			Image: "nginx:alpine",
+		},
+	}))
+}
+
+func (suite *PromotionsHandlerTestSuite) TestPromotionsHandler() {
+	promotion := resources.Promotion{
+		PromotionSpec: &v1alpha1.PromotionSpec{
+			SourceNamespace: "test-promotions-dev",
+			Components:      []string{"web"},
+		},
+		Name: "dev-to-staging",
+	}
+
+	req, err := json.Marshal(promotion)
+	suite.Nil(err)
+
+	rec := suite.NewRequest(http.MethodPost, "/v1alpha1/promotions/test-promotions-staging", string(req))
+	suite.EqualValues(201, rec.Code)
+
+	var promotions []*resources.Promotion
+	rec = suite.NewRequest(http.MethodGet, "/v1alpha1/promotions/test-promotions-staging", "")
+	rec.BodyAsJSON(&promotions)
+	suite.EqualValues(1, len(promotions))
+	suite.EqualValues("dev-to-staging", promotions[0].Name)
+	suite.EqualValues("test-promotions-dev", promotions[0].SourceNamespace)
+
+	// components which don't exist in the source can't be promoted
+	promotion.Components = []string{"web", "not-exist"}
+	req, err = json.Marshal(promotion)
+	suite.Nil(err)
+
+	rec = suite.NewRequest(http.MethodPut, "/v1alpha1/promotions/test-promotions-staging/dev-to-staging", string(req))
+	suite.EqualValues(404, rec.Code)
+
+	rec = suite.NewRequest(http.MethodDelete, "/v1alpha1/promotions/test-promotions-staging/dev-to-staging", "")
+	suite.EqualValues(200, rec.Code)
+
+	rec = suite.NewRequest(http.MethodGet, "/v1alpha1/promotions", "")
+	rec.BodyAsJSON(&promotions)
+	suite.EqualValues(0, len(promotions))
+}
+
+func TestPromotionsHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(PromotionsHandlerTestSuite))
+}
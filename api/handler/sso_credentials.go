@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"github.com/kalmhq/kalm/api/resources"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *ApiHandler) handleListSSOCredentials(c echo.Context) error {
+	credentials, err := h.Builder(c).GetSSOCredentials()
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, credentials)
+}
+
+// handleCreateSSOCredential returns the api key or the client secret of the credential, they can't be read again.
+func (h *ApiHandler) handleCreateSSOCredential(c echo.Context) error {
+	var credential resources.SSOCredentialRequest
+
+	if err := c.Bind(&credential); err != nil {
+		return err
+	}
+
+	// the creator is the authenticated user, it can't be set by the request
+	res, err := h.Builder(c).CreateSSOCredential(&credential, getClientInfo(c).Name)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(201, res)
+}
+
+func (h *ApiHandler) handleDeleteSSOCredential(c echo.Context) error {
+	if err := h.Builder(c).DeleteSSOCredential(c.Param("name")); err != nil {
+		return err
+	}
+
+	return c.NoContent(200)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kalmhq/kalm/api/auth_proxy"
+	"github.com/kalmhq/kalm/controller/controllers"
+	"github.com/labstack/echo/v4"
+)
+
+// Sessions are saved as secrets in the dex namespace by the auth proxy.
+// They are managed with the user's own permission, only admins who can manage these secrets are allowed.
+func (h *ApiHandler) getSSOSessionStore(c echo.Context) auth_proxy.SessionStore {
+	return auth_proxy.NewSecretSessionStore(getK8sClient(c), controllers.KALM_AUTH_PROXY_SESSION_NAMESPACE)
+}
+
+// handleListSSOSessions lists active sessions, optionally filtered by the subject or email query params.
+func (h *ApiHandler) handleListSSOSessions(c echo.Context) error {
+	sessions, err := h.getSSOSessionStore(c).List(c.Request().Context(), c.QueryParam("subject"))
+
+	if err != nil {
+		return err
+	}
+
+	email := c.QueryParam("email")
+	res := make([]*auth_proxy.Session, 0, len(sessions))
+
+	for _, session := range sessions {
+		if email != "" && session.Email != email {
+			continue
+		}
+
+		res = append(res, session)
+	}
+
+	return c.JSON(200, res)
+}
+
+// handleDeleteSSOSession revokes a session. The refresh token of the session is deleted with it,
+// the user has to log in again on the next request.
+func (h *ApiHandler) handleDeleteSSOSession(c echo.Context) error {
+	err := h.getSSOSessionStore(c).Delete(c.Request().Context(), c.Param("id"))
+
+	if err == auth_proxy.ErrSessionNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(200)
+}
+
+// handleDeleteSSOSessions revokes all sessions of the user in the subject query param.
+func (h *ApiHandler) handleDeleteSSOSessions(c echo.Context) error {
+	subject := c.QueryParam("subject")
+
+	if subject == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "subject is required")
+	}
+
+	store := h.getSSOSessionStore(c)
+	sessions, err := store.List(c.Request().Context(), subject)
+
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := store.Delete(c.Request().Context(), session.ID); err != nil && err != auth_proxy.ErrSessionNotFound {
+			return err
+		}
+	}
+
+	return c.NoContent(200)
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"github.com/kalmhq/kalm/api/auth_proxy"
 	"github.com/kalmhq/kalm/api/resources"
 	"github.com/stretchr/testify/suite"
+	"k8s.io/client-go/kubernetes"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -98,6 +102,62 @@ func (suite *SsoHandlerTestSuite) TestProtectedEndpointsHandler() {
 	suite.EqualValues(0, len(protectedEndpoints))
 }
 
+func (suite *SsoHandlerTestSuite) TestSSOSessionsHandler() {
+	store := auth_proxy.NewSecretSessionStore(kubernetes.NewForConfigOrDie(suite.testEnv.Config), suite.namespace)
+
+	session, err := auth_proxy.NewSession("alice", "alice@example.com", "id-token", "refresh-token")
+	suite.Nil(err)
+	suite.Nil(store.Create(context.Background(), session))
+
+	var sessions []*auth_proxy.Session
+	rec := suite.NewRequest(http.MethodGet, "/v1alpha1/sso/sessions?subject=alice", "")
+	rec.BodyAsJSON(&sessions)
+	suite.EqualValues(200, rec.Code)
+	suite.Len(sessions, 1)
+	suite.EqualValues("alice@example.com", sessions[0].Email)
+	suite.NotContains(rec.BodyAsString(), "refresh-token")
+
+	rec = suite.NewRequest(http.MethodDelete, "/v1alpha1/sso/sessions/"+session.ID, "")
+	suite.EqualValues(200, rec.Code)
+
+	rec = suite.NewRequest(http.MethodDelete, "/v1alpha1/sso/sessions/"+session.ID, "")
+	suite.EqualValues(404, rec.Code)
+
+	rec = suite.NewRequest(http.MethodGet, "/v1alpha1/sso/sessions?subject=alice", "")
+	rec.BodyAsJSON(&sessions)
+	suite.EqualValues(200, rec.Code)
+	suite.Len(sessions, 0)
+}
+
+func (suite *SsoHandlerTestSuite) TestSSOCredentialsHandler() {
+	req := `{"name":"ci","type":"apiKey","scopes":["default/web"],"creator":"mallory"}`
+	rec := suite.NewRequest(http.MethodPost, "/v1alpha1/ssocredentials", req)
+	suite.EqualValues(201, rec.Code)
+
+	var credential resources.SSOCredential
+	rec.BodyAsJSON(&credential)
+	suite.True(strings.HasPrefix(credential.APIKey, auth_proxy.FormatAPIKey("ci", "")))
+
+	// the creator in the body is ignored, the fake token of the test client isn't a jwt
+	suite.Equal("token", credential.Creator)
+
+	var credentials []resources.SSOCredential
+	rec = suite.NewRequest(http.MethodGet, "/v1alpha1/ssocredentials", "")
+	rec.BodyAsJSON(&credentials)
+	suite.EqualValues(200, rec.Code)
+	suite.Len(credentials, 1)
+	suite.EqualValues([]string{"default/web"}, credentials[0].Scopes)
+	suite.Empty(credentials[0].APIKey)
+
+	rec = suite.NewRequest(http.MethodDelete, "/v1alpha1/ssocredentials/ci", "")
+	suite.EqualValues(200, rec.Code)
+
+	rec = suite.NewRequest(http.MethodGet, "/v1alpha1/ssocredentials", "")
+	rec.BodyAsJSON(&credentials)
+	suite.EqualValues(200, rec.Code)
+	suite.Len(credentials, 0)
+}
+
 func TestSsoHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(SsoHandlerTestSuite))
 }
@@ -99,20 +99,16 @@ func (h *ApiHandler) handleDeployWebhookCall(c echo.Context) error {
 			h.logger.Error(err, "fail to list deployKeys")
 		}
 
-		for _, key := range deployKeyList.Items {
-			if callParams.DeployKey != key.Status.ServiceAccountToken {
+		for i := range deployKeyList.Items {
+			if callParams.DeployKey != deployKeyList.Items[i].Status.ServiceAccountToken {
 				continue
 			}
 
-			copiedKey := key.DeepCopy()
-			copiedKey.Status.LastUsedTimestamp = updateTs
-			copiedKey.Status.UsedCount += 1
-
-			if err := kClient.Status().Update(ctx, copiedKey); err != nil {
-				h.logger.Error(err, "fail update status of deployKeys")
-			}
+			h.recordDeployKeyUsage(kClient, &deployKeyList.Items[i], updateTs)
 			break
 		}
+
+		h.recordComponentWebhookEvent(kClient, copiedComp, fmt.Sprintf("image is updated to %s by webhook.", copiedComp.Spec.Image))
 	}
 
 	h.logger.Info("updating component", "name", copiedComp.Name, "time", updateTs)
@@ -124,14 +120,16 @@ func (h *ApiHandler) handleDeployWebhookCall(c echo.Context) error {
 
 // controller/foo,    v1 -> controller/foo:v1
 // controller/foo:v2, v3 -> controller/foo:v3
+// localhost:5000/foo, v1 -> localhost:5000/foo:v1
+// controller/foo@sha256:..., v1 -> controller/foo:v1
 func replaceImageTag(image string, tag string) string {
-	sepIdx := strings.LastIndex(image, ":")
-	if sepIdx == -1 {
-		return image + ":" + tag
+	if sepIdx := strings.Index(image, "@"); sepIdx != -1 {
+		image = image[:sepIdx]
 	}
 
-	parts := strings.Split(image, ":")
-	parts[len(parts)-1] = tag
+	if sepIdx := strings.LastIndex(image, ":"); sepIdx > strings.LastIndex(image, "/") {
+		image = image[:sepIdx]
+	}
 
-	return strings.Join(parts, ":")
+	return image + ":" + tag
 }
@@ -0,0 +1,526 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/kalmhq/kalm/api/resources"
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/kalmhq/kalm/controller/controllers"
+	"github.com/labstack/echo/v4"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Receivers of push and tag events of CI providers and registries.
+// The token of the deploy key in the url is the secret shared with the provider.
+
+const (
+	// hex encoded hmac sha256 of the body, signed with the deploy key token, in "sha256=<hex>" format
+	HeaderKalmSignature = "X-Kalm-Signature-256"
+
+	// Registries can't sign their notifications, they send the deploy key token as it is,
+	// in the header or the query parameter, e.g. the webhook url of docker hub.
+	HeaderKalmToken     = "X-Kalm-Token"
+	QueryParamKalmToken = "token"
+
+	// the registry of images built from tags of source repositories, which only know the repository path
+	QueryParamRegistry = "registry"
+	defaultRegistry    = "docker.io"
+
+	HeaderGithubEvent           = "X-GitHub-Event"
+	HeaderGithubSignature256    = "X-Hub-Signature-256"
+	HeaderGithubSignature       = "X-Hub-Signature"
+	HeaderGitlabEvent           = "X-Gitlab-Event"
+	HeaderGitlabToken           = "X-Gitlab-Token"
+	gitlabTagPushEvent          = "Tag Push Hook"
+	githubPushEvent             = "push"
+	githubPackageEvent          = "package"
+	githubRegistryPackageEvent  = "registry_package"
+	githubPackagePublishedEvent = "published"
+)
+
+// imagePushEvent is a new tag of an image repository.
+type imagePushEvent struct {
+	// empty if the provider doesn't know the registry, e.g. tags of a source repository,
+	// it is set to the registry of the webhook before matching images.
+	Domain string
+	Path   string
+	Tag    string
+}
+
+// matches returns whether the image is in the pushed repository.
+func (e imagePushEvent) matches(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+
+	if err != nil {
+		return false
+	}
+
+	return reference.Domain(named) == e.Domain && reference.Path(named) == e.Path
+}
+
+// getRegistryDomain normalizes the registry param of the webhook, docker hub by default.
+func getRegistryDomain(registry string) (string, error) {
+	if registry == "" {
+		return defaultRegistry, nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(registry + "/image")
+
+	if err != nil {
+		return "", fmt.Errorf("invalid registry %s: %s", registry, err)
+	}
+
+	return reference.Domain(named), nil
+}
+
+func newImagePushEvent(repository, tag string) (*imagePushEvent, error) {
+	named, err := reference.ParseNormalizedNamed(repository)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &imagePushEvent{
+		Domain: reference.Domain(named),
+		Path:   reference.Path(named),
+		Tag:    tag,
+	}, nil
+}
+
+func verifyHMACSignature(newHash func() hash.Hash, secret, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(newHash, secret)
+	mac.Write(body)
+
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func verifyGithubSignature(header http.Header, secret, body []byte) bool {
+	if signature := header.Get(HeaderGithubSignature256); signature != "" {
+		return strings.HasPrefix(signature, "sha256=") &&
+			verifyHMACSignature(sha256.New, secret, body, strings.TrimPrefix(signature, "sha256="))
+	}
+
+	signature := header.Get(HeaderGithubSignature)
+
+	return strings.HasPrefix(signature, "sha1=") &&
+		verifyHMACSignature(sha1.New, secret, body, strings.TrimPrefix(signature, "sha1="))
+}
+
+// gitlab sends the secret token as it is instead of a signature
+func verifyGitlabToken(header http.Header, secret []byte) bool {
+	return hmac.Equal([]byte(header.Get(HeaderGitlabToken)), secret)
+}
+
+func verifyKalmSignature(header http.Header, secret, body []byte) bool {
+	signature := header.Get(HeaderKalmSignature)
+
+	return strings.HasPrefix(signature, "sha256=") &&
+		verifyHMACSignature(sha256.New, secret, body, strings.TrimPrefix(signature, "sha256="))
+}
+
+// verifyRegistryToken accepts a signature, or the token in the header or the query of the request.
+func verifyRegistryToken(req *http.Request, secret, body []byte) bool {
+	if req.Header.Get(HeaderKalmSignature) != "" {
+		return verifyKalmSignature(req.Header, secret, body)
+	}
+
+	token := req.Header.Get(HeaderKalmToken)
+
+	if token == "" {
+		token = req.URL.Query().Get(QueryParamKalmToken)
+	}
+
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), secret) == 1
+}
+
+type githubWebhookPayload struct {
+	Ref        string `json:"ref"`
+	Deleted    bool   `json:"deleted"`
+	Action     string `json:"action"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Package *struct {
+		Name           string `json:"name"`
+		Namespace      string `json:"namespace"`
+		PackageVersion struct {
+			ContainerMetadata struct {
+				Tag struct {
+					Name string `json:"name"`
+				} `json:"tag"`
+			} `json:"container_metadata"`
+		} `json:"package_version"`
+	} `json:"package"`
+}
+
+// parseGithubWebhook supports tags pushed to a repository, and images published to the github container registry.
+func parseGithubWebhook(event string, body []byte) ([]imagePushEvent, error) {
+	var payload githubWebhookPayload
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	switch event {
+	case githubPushEvent:
+		if payload.Deleted || !strings.HasPrefix(payload.Ref, "refs/tags/") {
+			return nil, nil
+		}
+
+		return []imagePushEvent{{
+			Path: strings.ToLower(payload.Repository.FullName),
+			Tag:  strings.TrimPrefix(payload.Ref, "refs/tags/"),
+		}}, nil
+	case githubPackageEvent, githubRegistryPackageEvent:
+		if payload.Action != githubPackagePublishedEvent || payload.Package == nil {
+			return nil, nil
+		}
+
+		tag := payload.Package.PackageVersion.ContainerMetadata.Tag.Name
+
+		if tag == "" {
+			return nil, nil
+		}
+
+		pushEvent, err := newImagePushEvent(
+			strings.ToLower(fmt.Sprintf("ghcr.io/%s/%s", payload.Package.Namespace, payload.Package.Name)),
+			tag,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []imagePushEvent{*pushEvent}, nil
+	}
+
+	return nil, nil
+}
+
+type gitlabWebhookPayload struct {
+	ObjectKind  string  `json:"object_kind"`
+	Ref         string  `json:"ref"`
+	CheckoutSha *string `json:"checkout_sha"`
+	Project     struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+}
+
+// parseGitlabWebhook supports tags pushed to a project.
+func parseGitlabWebhook(event string, body []byte) ([]imagePushEvent, error) {
+	if event != gitlabTagPushEvent {
+		return nil, nil
+	}
+
+	var payload gitlabWebhookPayload
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	// checkout_sha is null if the tag is deleted
+	if payload.ObjectKind != "tag_push" || payload.CheckoutSha == nil {
+		return nil, nil
+	}
+
+	return []imagePushEvent{{
+		Path: strings.ToLower(payload.Project.PathWithNamespace),
+		Tag:  strings.TrimPrefix(payload.Ref, "refs/tags/"),
+	}}, nil
+}
+
+type registryWebhookPayload struct {
+	// docker hub
+	PushData *struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+
+	// docker distribution notifications
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// parseRegistryWebhook supports docker hub pushes, and notifications of registries based on docker distribution.
+func parseRegistryWebhook(body []byte) ([]imagePushEvent, error) {
+	var payload registryWebhookPayload
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	var res []imagePushEvent
+
+	if payload.PushData != nil && payload.PushData.Tag != "" {
+		pushEvent, err := newImagePushEvent(payload.Repository.RepoName, payload.PushData.Tag)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, *pushEvent)
+	}
+
+	for _, event := range payload.Events {
+		if event.Action != "push" || event.Target.Tag == "" {
+			continue
+		}
+
+		repository := event.Target.Repository
+
+		if event.Request.Host != "" {
+			repository = event.Request.Host + "/" + repository
+		}
+
+		pushEvent, err := newImagePushEvent(repository, event.Target.Tag)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, *pushEvent)
+	}
+
+	return res, nil
+}
+
+func isComponentInDeployKeyScope(key *v1alpha1.DeployKey, component *v1alpha1.Component) bool {
+	switch key.Spec.Scope {
+	case v1alpha1.DeployKeyTypeCluster:
+		return true
+	case v1alpha1.DeployKeyTypeNamespace:
+		for _, ns := range key.Spec.Resources {
+			if ns == component.Namespace {
+				return true
+			}
+		}
+	case v1alpha1.DeployKeyTypeComponent:
+		for _, res := range key.Spec.Resources {
+			if res == component.Namespace+"/"+component.Name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (h *ApiHandler) handleGithubWebhookCall(c echo.Context) error {
+	return h.handleProviderWebhookCall(c, "github",
+		func(secret, body []byte) bool {
+			return verifyGithubSignature(c.Request().Header, secret, body)
+		},
+		func(body []byte) ([]imagePushEvent, error) {
+			return parseGithubWebhook(c.Request().Header.Get(HeaderGithubEvent), body)
+		},
+	)
+}
+
+func (h *ApiHandler) handleGitlabWebhookCall(c echo.Context) error {
+	return h.handleProviderWebhookCall(c, "gitlab",
+		func(secret, body []byte) bool {
+			return verifyGitlabToken(c.Request().Header, secret)
+		},
+		func(body []byte) ([]imagePushEvent, error) {
+			return parseGitlabWebhook(c.Request().Header.Get(HeaderGitlabEvent), body)
+		},
+	)
+}
+
+func (h *ApiHandler) handleRegistryWebhookCall(c echo.Context) error {
+	return h.handleProviderWebhookCall(c, "registry",
+		func(secret, body []byte) bool {
+			return verifyRegistryToken(c.Request(), secret, body)
+		},
+		parseRegistryWebhook,
+	)
+}
+
+// payloads of image push events are small, the limit only protects the api server
+const maxWebhookPayloadSize = 5 << 20
+
+func (h *ApiHandler) handleProviderWebhookCall(
+	c echo.Context,
+	provider string,
+	verify func(secret, body []byte) bool,
+	parse func(body []byte) ([]imagePushEvent, error),
+) error {
+	body, err := readRequestBody(c, maxWebhookPayloadSize)
+
+	if err != nil {
+		return err
+	}
+
+	kClient, err := client.New(h.clientManager.ClusterConfig, client.Options{Scheme: scheme.Scheme})
+
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	var deployKey v1alpha1.DeployKey
+
+	if err := kClient.Get(ctx, client.ObjectKey{Name: c.Param("deployKey")}, &deployKey); err != nil {
+		if errors.IsNotFound(err) {
+			return errors.NewUnauthorized("invalid deploy key")
+		}
+
+		return err
+	}
+
+	token := deployKey.Status.ServiceAccountToken
+
+	if token == "" || !verify([]byte(token), body) {
+		return errors.NewUnauthorized("invalid signature")
+	}
+
+	pushEvents, err := parse(body)
+
+	if err != nil {
+		return fmt.Errorf("invalid %s payload: %s", provider, err)
+	}
+
+	registry, err := getRegistryDomain(c.QueryParam(QueryParamRegistry))
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	for i := range pushEvents {
+		if pushEvents[i].Domain == "" {
+			pushEvents[i].Domain = registry
+		}
+	}
+
+	deployKeyConfig, err := h.clientManager.BuildClientConfigWithAuthInfo(&api.AuthInfo{Token: token})
+
+	if err != nil {
+		return err
+	}
+
+	// updates are made with the deploy key, so its roles are respected as well
+	builder := resources.NewBuilder(deployKeyConfig, h.logger)
+
+	var componentList v1alpha1.ComponentList
+
+	if len(pushEvents) > 0 {
+		if err := kClient.List(ctx, &componentList); err != nil {
+			return err
+		}
+	}
+
+	updateTs := int(time.Now().Unix())
+	deployed := []string{}
+
+	for _, pushEvent := range pushEvents {
+		for i := range componentList.Items {
+			component := &componentList.Items[i]
+
+			if !pushEvent.matches(component.Spec.Image) || !isComponentInDeployKeyScope(&deployKey, component) {
+				continue
+			}
+
+			copiedComp := component.DeepCopy()
+			copiedComp.Spec.Image = replaceImageTag(component.Spec.Image, pushEvent.Tag)
+
+			if copiedComp.Annotations == nil {
+				copiedComp.Annotations = make(map[string]string)
+			}
+
+			copiedComp.Annotations[controllers.AnnoLastUpdatedByWebhook] = strconv.Itoa(updateTs)
+
+			if err := builder.Patch(copiedComp, client.MergeFrom(component)); err != nil {
+				h.logger.Error(err, "fail updating component", "namespace", component.Namespace, "name", component.Name)
+				continue
+			}
+
+			h.recordComponentWebhookEvent(kClient, copiedComp, fmt.Sprintf("image is updated to %s by %s webhook.", copiedComp.Spec.Image, provider))
+			deployed = append(deployed, component.Namespace+"/"+component.Name)
+		}
+	}
+
+	if len(deployed) > 0 {
+		h.recordDeployKeyUsage(kClient, &deployKey, updateTs)
+	}
+
+	h.logger.Info("webhook call", "provider", provider, "deployKey", deployKey.Name, "components", deployed)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status":     "Success",
+		"components": deployed,
+	})
+}
+
+func (h *ApiHandler) recordDeployKeyUsage(kClient client.Client, key *v1alpha1.DeployKey, updateTs int) {
+	copiedKey := key.DeepCopy()
+	copiedKey.Status.LastUsedTimestamp = updateTs
+	copiedKey.Status.UsedCount += 1
+
+	if err := kClient.Status().Update(context.Background(), copiedKey); err != nil {
+		h.logger.Error(err, "fail update status of deployKeys")
+	}
+}
+
+func (h *ApiHandler) recordComponentWebhookEvent(kClient client.Client, component *v1alpha1.Component, message string) {
+	now := metaV1.Now()
+
+	event := &coreV1.Event{
+		ObjectMeta: metaV1.ObjectMeta{
+			Namespace: component.Namespace,
+			Name:      fmt.Sprintf("%s.%x", component.Name, now.UnixNano()),
+		},
+		InvolvedObject: coreV1.ObjectReference{
+			APIVersion: v1alpha1.GroupVersion.String(),
+			Kind:       "Component",
+			Namespace:  component.Namespace,
+			Name:       component.Name,
+			UID:        component.UID,
+		},
+		Reason:         "WebhookDeploy",
+		Message:        message,
+		Type:           coreV1.EventTypeNormal,
+		Source:         coreV1.EventSource{Component: "kalm-webhook"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if err := kClient.Create(context.Background(), event); err != nil {
+		h.logger.Error(err, "fail to record webhook event", "namespace", component.Namespace, "name", component.Name)
+	}
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhookSignatures(t *testing.T) {
+	body := []byte(`{"ref":"refs/tags/v1"}`)
+
+	header := http.Header{}
+	header.Set(HeaderGithubSignature256, sign("token", string(body)))
+	assert.True(t, verifyGithubSignature(header, []byte("token"), body))
+	assert.False(t, verifyGithubSignature(header, []byte("other-token"), body))
+	assert.False(t, verifyGithubSignature(header, []byte("token"), []byte(`{"ref":"refs/tags/v2"}`)))
+	assert.False(t, verifyGithubSignature(http.Header{}, []byte("token"), body))
+
+	header = http.Header{}
+	header.Set(HeaderKalmSignature, sign("token", string(body)))
+	assert.True(t, verifyKalmSignature(header, []byte("token"), body))
+	header.Set(HeaderKalmSignature, "sha256=not-hex")
+	assert.False(t, verifyKalmSignature(header, []byte("token"), body))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/registry/key?token=token", nil)
+	assert.True(t, verifyRegistryToken(req, []byte("token"), body))
+	assert.False(t, verifyRegistryToken(req, []byte("other-token"), body))
+	assert.False(t, verifyRegistryToken(httptest.NewRequest(http.MethodPost, "/webhook/registry/key", nil), []byte("token"), body))
+
+	req = httptest.NewRequest(http.MethodPost, "/webhook/registry/key", nil)
+	req.Header.Set(HeaderKalmToken, "token")
+	assert.True(t, verifyRegistryToken(req, []byte("token"), body))
+
+	// a wrong signature is not bypassed by a token
+	req = httptest.NewRequest(http.MethodPost, "/webhook/registry/key?token=token", nil)
+	req.Header.Set(HeaderKalmSignature, sign("other-token", string(body)))
+	assert.False(t, verifyRegistryToken(req, []byte("token"), body))
+
+	header = http.Header{}
+	header.Set(HeaderGitlabToken, "token")
+	assert.True(t, verifyGitlabToken(header, []byte("token")))
+	assert.False(t, verifyGitlabToken(header, []byte("other-token")))
+}
+
+func TestParseGithubWebhook(t *testing.T) {
+	events, err := parseGithubWebhook("push", []byte(`{"ref":"refs/tags/v1.2.0","repository":{"full_name":"Kalmhq/Web"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []imagePushEvent{{Path: "kalmhq/web", Tag: "v1.2.0"}}, events)
+
+	// branches and deleted tags are ignored
+	events, _ = parseGithubWebhook("push", []byte(`{"ref":"refs/heads/master","repository":{"full_name":"kalmhq/web"}}`))
+	assert.Empty(t, events)
+	events, _ = parseGithubWebhook("push", []byte(`{"ref":"refs/tags/v1","deleted":true,"repository":{"full_name":"kalmhq/web"}}`))
+	assert.Empty(t, events)
+
+	events, err = parseGithubWebhook("package", []byte(`{"action":"published","package":{"name":"web","namespace":"kalmhq","package_version":{"container_metadata":{"tag":{"name":"v2"}}}}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []imagePushEvent{{Domain: "ghcr.io", Path: "kalmhq/web", Tag: "v2"}}, events)
+
+	events, _ = parseGithubWebhook("ping", []byte(`{"zen":"Keep it logically awesome."}`))
+	assert.Empty(t, events)
+}
+
+func TestParseGitlabWebhook(t *testing.T) {
+	events, err := parseGitlabWebhook(gitlabTagPushEvent, []byte(`{"object_kind":"tag_push","ref":"refs/tags/v1","checkout_sha":"82b3d5ae","project":{"path_with_namespace":"kalm/web"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []imagePushEvent{{Path: "kalm/web", Tag: "v1"}}, events)
+
+	events, _ = parseGitlabWebhook(gitlabTagPushEvent, []byte(`{"object_kind":"tag_push","ref":"refs/tags/v1","checkout_sha":null,"project":{"path_with_namespace":"kalm/web"}}`))
+	assert.Empty(t, events)
+
+	events, _ = parseGitlabWebhook("Push Hook", []byte(`{"object_kind":"push"}`))
+	assert.Empty(t, events)
+}
+
+func TestParseRegistryWebhook(t *testing.T) {
+	events, err := parseRegistryWebhook([]byte(`{"push_data":{"tag":"latest"},"repository":{"repo_name":"nginx"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []imagePushEvent{{Domain: "docker.io", Path: "library/nginx", Tag: "latest"}}, events)
+
+	events, err = parseRegistryWebhook([]byte(`{"events":[
+		{"action":"push","target":{"repository":"team/web","tag":"v3"},"request":{"host":"registry.example.com:5000"}},
+		{"action":"pull","target":{"repository":"team/web","tag":"v3"},"request":{"host":"registry.example.com:5000"}},
+		{"action":"push","target":{"repository":"team/web"},"request":{"host":"registry.example.com:5000"}}
+	]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []imagePushEvent{{Domain: "registry.example.com:5000", Path: "team/web", Tag: "v3"}}, events)
+}
+
+func TestImagePushEventMatches(t *testing.T) {
+	event := imagePushEvent{Domain: "docker.io", Path: "library/nginx", Tag: "v1"}
+	assert.True(t, event.matches("nginx"))
+	assert.True(t, event.matches("nginx:1.19"))
+	assert.True(t, event.matches("docker.io/library/nginx@sha256:a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"))
+	assert.False(t, event.matches("kalmhq/nginx"))
+	assert.False(t, event.matches("quay.io/library/nginx"))
+
+	// images of other registries never match
+	event = imagePushEvent{Domain: "ghcr.io", Path: "kalmhq/web", Tag: "v1"}
+	assert.False(t, event.matches("kalmhq/web:v0"))
+	assert.True(t, event.matches("ghcr.io/kalmhq/web"))
+	assert.False(t, event.matches("ghcr.io/kalmhq/web-api"))
+}
+
+func TestGetRegistryDomain(t *testing.T) {
+	domain, err := getRegistryDomain("")
+	assert.Nil(t, err)
+	assert.Equal(t, "docker.io", domain)
+
+	domain, err = getRegistryDomain("registry.example.com:5000")
+	assert.Nil(t, err)
+	assert.Equal(t, "registry.example.com:5000", domain)
+
+	_, err = getRegistryDomain("Invalid Registry")
+	assert.NotNil(t, err)
+}
+
+func TestReplaceImageTag(t *testing.T) {
+	assert.Equal(t, "kalmhq/web:v1", replaceImageTag("kalmhq/web", "v1"))
+	assert.Equal(t, "kalmhq/web:v3", replaceImageTag("kalmhq/web:v2", "v3"))
+	assert.Equal(t, "localhost:5000/web:v1", replaceImageTag("localhost:5000/web", "v1"))
+	assert.Equal(t, "localhost:5000/web:v2", replaceImageTag("localhost:5000/web:v1", "v2"))
+	assert.Equal(t, "kalmhq/web:v1", replaceImageTag("kalmhq/web@sha256:abc", "v1"))
+}
+
+func TestIsComponentInDeployKeyScope(t *testing.T) {
+	component := &v1alpha1.Component{ObjectMeta: metaV1.ObjectMeta{Namespace: "production", Name: "web"}}
+
+	key := &v1alpha1.DeployKey{Spec: v1alpha1.DeployKeySpec{Scope: v1alpha1.DeployKeyTypeCluster}}
+	assert.True(t, isComponentInDeployKeyScope(key, component))
+
+	key.Spec = v1alpha1.DeployKeySpec{Scope: v1alpha1.DeployKeyTypeNamespace, Resources: []string{"staging"}}
+	assert.False(t, isComponentInDeployKeyScope(key, component))
+	key.Spec.Resources = append(key.Spec.Resources, "production")
+	assert.True(t, isComponentInDeployKeyScope(key, component))
+
+	key.Spec = v1alpha1.DeployKeySpec{Scope: v1alpha1.DeployKeyTypeComponent, Resources: []string{"production/api"}}
+	assert.False(t, isComponentInDeployKeyScope(key, component))
+	key.Spec.Resources = append(key.Spec.Resources, "production/web")
+	assert.True(t, isComponentInDeployKeyScope(key, component))
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/kalmhq/kalm/api/utils"
 	"github.com/labstack/echo/v4"
 	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
@@ -54,6 +55,14 @@ const (
 	WSRequestTypeSubscribePodLog   WSRequestType = "subscribePodLog"
 	WSRequestTypeUnsubscribePodLog WSRequestType = "unsubscribePodLog"
 
+	// component log, merges logs of all pods and containers of a component
+	WSRequestTypeSubscribeComponentLog   WSRequestType = "subscribeComponentLog"
+	WSRequestTypeUnsubscribeComponentLog WSRequestType = "unsubscribeComponentLog"
+
+	// loki tail
+	WSRequestTypeSubscribeLokiTail   WSRequestType = "subscribeLokiTail"
+	WSRequestTypeUnsubscribeLokiTail WSRequestType = "unsubscribeLokiTail"
+
 	// exec
 	WSRequestTypeExecStartSession WSRequestType = "execStartSession"
 	WSRequestTypeExecEndSession   WSRequestType = "execEndSession"
@@ -71,15 +80,22 @@ type WSClientAuthRequest struct {
 }
 
 type WSPodResourceRequest struct {
-	WSRequest  `json:",inline"`
-	PodName    string `json:"podName"`
-	Container  string `json:"container"`
-	TailLines  int64  `json:"tailLines"`
-	Timestamps bool   `json:"timestamps"`
-	Follow     bool   `json:"follow"`
-	Previous   bool   `json:"previous"`
-	Namespace  string `json:"namespace"`
-	Data       string `json:"data"`
+	WSRequest     `json:",inline"`
+	PodName       string `json:"podName"`
+	ComponentName string `json:"componentName"`
+	Container     string `json:"container"`
+	TailLines     int64  `json:"tailLines"`
+	Timestamps    bool   `json:"timestamps"`
+	Follow        bool   `json:"follow"`
+	Previous      bool   `json:"previous"`
+	// RFC3339 timestamp, only logs after this time are returned
+	SinceTime string `json:"sinceTime"`
+	// regular expression, only matching log lines are returned
+	Grep string `json:"grep"`
+	// LogQL query of loki tail requests
+	Query     string `json:"query"`
+	Namespace string `json:"namespace"`
+	Data      string `json:"data"`
 }
 
 type StatusValue int
@@ -101,6 +117,10 @@ const (
 	WSResponseTypeLogStreamUpdate       WSResponseType = "logStreamUpdate"
 	WSResponseTypeLogStreamDisconnected WSResponseType = "logStreamDisconnected"
 
+	// loki tail
+	WSResponseTypeLokiTailUpdate       WSResponseType = "lokiTailUpdate"
+	WSResponseTypeLokiTailDisconnected WSResponseType = "lokiTailDisconnected"
+
 	// exec
 	WSResponseTypeExecStdout       WSResponseType = "execStreamUpdate"
 	WSResponseTypeExecDisconnected WSResponseType = "execStreamDisconnected"
@@ -113,10 +133,12 @@ type WSResponse struct {
 }
 
 type WSPodDataResponse struct {
-	Type      WSResponseType `json:"type"`
-	Namespace string         `json:"namespace"`
-	PodName   string         `json:"podName"`
-	Data      string         `json:"data"`
+	Type          WSResponseType `json:"type"`
+	Namespace     string         `json:"namespace"`
+	ComponentName string         `json:"componentName,omitempty"`
+	PodName       string         `json:"podName"`
+	Container     string         `json:"container,omitempty"`
+	Data          string         `json:"data"`
 }
 
 const END_OF_TRANSMISSION = "\u0004"
@@ -136,9 +158,11 @@ type TerminalSession struct {
 	namespace string
 
 	podName string
+
+	container string
 }
 
-func NewTerminalSession(conn *WSConn, ctx context.Context, ns, podName string) *TerminalSession {
+func NewTerminalSession(conn *WSConn, ctx context.Context, ns, podName, container string) *TerminalSession {
 	return &TerminalSession{
 		conn,
 		make(chan []byte),
@@ -146,6 +170,7 @@ func NewTerminalSession(conn *WSConn, ctx context.Context, ns, podName string) *
 		ctx,
 		ns,
 		podName,
+		container,
 	}
 }
 
@@ -172,6 +197,7 @@ func (t *TerminalSession) Write(p []byte) (int, error) {
 		Type:      WSResponseTypeExecStdout,
 		Namespace: t.namespace,
 		PodName:   t.podName,
+		Container: t.container,
 		Data:      string(p),
 	})
 
@@ -254,7 +280,7 @@ func wsReadLoop(conn *WSConn, clientManager *client.ClientManager) (err error) {
 			} else {
 				res.Message = "Invalid Auth Token"
 			}
-		case WSRequestTypeSubscribePodLog, WSRequestTypeUnsubscribePodLog, WSRequestTypeExecStartSession, WSRequestTypeExecEndSession, WSRequestTypeExecStdin, WSRequestTypeExecResize:
+		case WSRequestTypeSubscribePodLog, WSRequestTypeUnsubscribePodLog, WSRequestTypeSubscribeComponentLog, WSRequestTypeUnsubscribeComponentLog, WSRequestTypeSubscribeLokiTail, WSRequestTypeUnsubscribeLokiTail, WSRequestTypeExecStartSession, WSRequestTypeExecEndSession, WSRequestTypeExecStdin, WSRequestTypeExecResize:
 			isAuthorized := conn.IsAuthorized
 
 			if !isAuthorized {
@@ -300,13 +326,45 @@ func wsReadLoop(conn *WSConn, clientManager *client.ClientManager) (err error) {
 	}
 }
 
+// logSubscription is used as an identity in handleLogRequests, so a finished stream
+// won't remove a newer subscription registered under the same key.
+type logSubscription struct {
+	stop context.CancelFunc
+}
+
 func handleLogRequests(conn *WSConn) {
-	podRegistrations := make(map[string]context.CancelFunc)
+	podRegistrations := make(map[string]*logSubscription)
+	mut := &sync.Mutex{}
+
+	register := func(key string) (context.Context, *logSubscription) {
+		ctx, stop := context.WithCancel(conn.ctx)
+		sub := &logSubscription{stop: stop}
+
+		mut.Lock()
+		if old, existing := podRegistrations[key]; existing {
+			old.stop()
+		}
+		podRegistrations[key] = sub
+		mut.Unlock()
+
+		return ctx, sub
+	}
+
+	release := func(key string, sub *logSubscription) {
+		mut.Lock()
+		if current, existing := podRegistrations[key]; existing && (sub == nil || current == sub) {
+			current.stop()
+			delete(podRegistrations, key)
+		}
+		mut.Unlock()
+	}
 
 	defer func() {
-		for _, cancelFunc := range podRegistrations {
-			cancelFunc()
+		mut.Lock()
+		for _, sub := range podRegistrations {
+			sub.stop()
 		}
+		mut.Unlock()
 	}()
 
 	for {
@@ -314,21 +372,18 @@ func handleLogRequests(conn *WSConn) {
 		case <-conn.ctx.Done():
 			return
 		case m := <-conn.podResourceRequest:
-			key := fmt.Sprintf("%s___%s", m.Namespace, m.PodName)
+			switch m.Type {
+			case WSRequestTypeSubscribePodLog:
+				key := fmt.Sprintf("%s___%s", m.Namespace, m.PodName)
 
-			if m.Type == WSRequestTypeSubscribePodLog {
-				k8sClient := conn.K8sClient
+				podLogOpts, filter, err := parseLogOptions(m)
 
-				podLogOpts := coreV1.PodLogOptions{
-					Container:  m.Container,
-					TailLines:  &m.TailLines,
-					Timestamps: m.Timestamps,
-					Follow:     m.Follow,
-					Previous:   m.Previous,
-				}
+				var podLogs io.ReadCloser
 
-				req := k8sClient.CoreV1().Pods(m.Namespace).GetLogs(m.PodName, &podLogOpts)
-				podLogs, err := req.Stream(conn.ctx)
+				if err == nil {
+					podLogOpts.Container = m.Container
+					podLogs, err = conn.K8sClient.CoreV1().Pods(m.Namespace).GetLogs(m.PodName, podLogOpts).Stream(conn.ctx)
+				}
 
 				if err != nil {
 					log.Error(err, "stream error")
@@ -341,21 +396,40 @@ func handleLogRequests(conn *WSConn) {
 					continue
 				}
 
-				ctx, stop := context.WithCancel(conn.ctx)
-				if oldStop, existing := podRegistrations[key]; existing {
-					oldStop()
-				}
-				podRegistrations[key] = stop
+				ctx, sub := register(key)
 
-				go func() {
-					copyPodLogStreamToWS(ctx, m.Namespace, m.PodName, conn, podLogs)
-					delete(podRegistrations, key)
-				}()
-			} else {
-				if stop, existing := podRegistrations[key]; existing {
-					stop()
-					delete(podRegistrations, key)
-				}
+				go func(m *WSPodResourceRequest) {
+					defer release(key, sub)
+
+					if filter == nil {
+						copyPodLogStreamToWS(ctx, m.Namespace, m.PodName, conn, podLogs)
+						return
+					}
+
+					copyPodLogLinesToWS(ctx, conn, podLogs, filter, WSPodDataResponse{
+						Namespace: m.Namespace,
+						PodName:   m.PodName,
+						Container: m.Container,
+					})
+
+					_ = conn.WriteJSON(&WSPodDataResponse{
+						Type:      WSResponseTypeLogStreamDisconnected,
+						Namespace: m.Namespace,
+						PodName:   m.PodName,
+					})
+				}(m)
+			case WSRequestTypeUnsubscribePodLog:
+				release(fmt.Sprintf("%s___%s", m.Namespace, m.PodName), nil)
+			case WSRequestTypeSubscribeComponentLog:
+				key := fmt.Sprintf("component___%s___%s", m.Namespace, m.ComponentName)
+				ctx, sub := register(key)
+
+				go func(m *WSPodResourceRequest) {
+					defer release(key, sub)
+					copyComponentLogsToWS(ctx, conn, m)
+				}(m)
+			case WSRequestTypeUnsubscribeComponentLog:
+				release(fmt.Sprintf("component___%s___%s", m.Namespace, m.ComponentName), nil)
 			}
 		}
 	}
@@ -456,15 +530,96 @@ func startExecTerminalSession(conn *WSConn, shell string, terminalSession *Termi
 	return err
 }
 
+// validateExecContainer makes sure the container exists in the pod.
+// Sidecars, running init containers and ephemeral containers are all valid targets.
+func validateExecContainer(pod *coreV1.Pod, container string) error {
+	if container == "" {
+		return nil
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if c.Name == container {
+			return nil
+		}
+	}
+
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == container {
+			return validateExecInitContainer(pod, container)
+		}
+	}
+
+	for _, c := range pod.Spec.EphemeralContainers {
+		if c.Name == container {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("container %s is not found in pod %s", container, pod.Name)
+}
+
+// init containers can only be executed in while they are running, they are not restarted after they succeed.
+func validateExecInitContainer(pod *coreV1.Pod, container string) error {
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name != container {
+			continue
+		}
+
+		if status.State.Terminated != nil {
+			return fmt.Errorf("init container %s of pod %s has terminated, exec into a running container instead", container, pod.Name)
+		}
+
+		if status.State.Running != nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("init container %s of pod %s is not running", container, pod.Name)
+}
+
+// findTerminalSession looks up the session of a container. Clients which don't
+// specify the container in stdin and resize messages are matched by pod,
+// as long as only one session is open for that pod.
+func findTerminalSession(sessions map[string]*TerminalSession, ns, podName, container string) (string, *TerminalSession) {
+	key := fmt.Sprintf("%s___%s___%s", ns, podName, container)
+
+	if session, existing := sessions[key]; existing {
+		return key, session
+	}
+
+	if container != "" {
+		return "", nil
+	}
+
+	var foundKey string
+	var found *TerminalSession
+
+	for k, session := range sessions {
+		if session.namespace != ns || session.podName != podName {
+			continue
+		}
+
+		if found != nil {
+			return "", nil
+		}
+
+		foundKey, found = k, session
+	}
+
+	return foundKey, found
+}
+
 func handleExecRequests(conn *WSConn) {
 	podRegistrations := make(map[string]context.CancelFunc)
 	terminalSessions := make(map[string]*TerminalSession)
 	mut := &sync.Mutex{}
 
 	defer func() {
+		mut.Lock()
 		for _, cancelFunc := range podRegistrations {
 			cancelFunc()
 		}
+		mut.Unlock()
 	}()
 
 	for {
@@ -472,38 +627,44 @@ func handleExecRequests(conn *WSConn) {
 		case <-conn.ctx.Done():
 			return
 		case m := <-conn.podResourceRequest:
-			key := fmt.Sprintf("%s___%s", m.Namespace, m.PodName)
-
 			if m.Type == WSRequestTypeExecStartSession {
+				key := fmt.Sprintf("%s___%s___%s", m.Namespace, m.PodName, m.Container)
 				ctx, stop := context.WithCancel(conn.ctx)
+				session := NewTerminalSession(conn, ctx, m.Namespace, m.PodName, m.Container)
 
+				mut.Lock()
 				if oldStop, existing := podRegistrations[key]; existing {
 					oldStop()
 				}
-
-				session := NewTerminalSession(conn, ctx, m.Namespace, m.PodName)
-
-				mut.Lock()
 				podRegistrations[key] = stop
 				terminalSessions[key] = session
 				mut.Unlock()
 
-				go func() {
+				go func(m *WSPodResourceRequest) {
 					defer func() {
 						stop()
 						mut.Lock()
-						delete(podRegistrations, key)
-						delete(terminalSessions, key)
+						if terminalSessions[key] == session {
+							delete(podRegistrations, key)
+							delete(terminalSessions, key)
+						}
 						mut.Unlock()
 					}()
 
-					var err error
-					validShells := []string{"bash", "ash", "sh"}
-					for _, shell := range validShells {
-						err = startExecTerminalSession(conn, shell, session, m.Namespace, m.PodName, m.Container)
+					pod, err := conn.K8sClient.CoreV1().Pods(m.Namespace).Get(ctx, m.PodName, metaV1.GetOptions{})
 
-						if err == nil {
-							break
+					if err == nil {
+						err = validateExecContainer(pod, m.Container)
+					}
+
+					if err == nil {
+						validShells := []string{"bash", "ash", "sh"}
+						for _, shell := range validShells {
+							err = startExecTerminalSession(conn, shell, session, m.Namespace, m.PodName, m.Container)
+
+							if err == nil {
+								break
+							}
 						}
 					}
 
@@ -518,40 +679,51 @@ func handleExecRequests(conn *WSConn) {
 						Type:      WSResponseTypeExecDisconnected,
 						Namespace: m.Namespace,
 						PodName:   m.PodName,
+						Container: m.Container,
 						Data:      data,
 					})
-				}()
-			} else if m.Type == WSRequestTypeExecEndSession {
+				}(m)
+
+				continue
+			}
+
+			mut.Lock()
+			key, session := findTerminalSession(terminalSessions, m.Namespace, m.PodName, m.Container)
+			mut.Unlock()
+
+			if session == nil {
+				log.Error(nil, "can't find terminal session", "namespace", m.Namespace, "pod", m.PodName, "container", m.Container)
+				continue
+			}
+
+			if m.Type == WSRequestTypeExecEndSession {
+				mut.Lock()
 				if stop, existing := podRegistrations[key]; existing {
 					stop()
-					mut.Lock()
 					delete(podRegistrations, key)
 					delete(terminalSessions, key)
-					mut.Unlock()
 				}
+				mut.Unlock()
 			} else if m.Type == WSRequestTypeExecStdin {
-				session, existing := terminalSessions[key]
-
-				if !existing {
-					log.Error(nil, "can't find terminal session", "key", key)
-					continue
+				select {
+				case session.stdinChan <- []byte(m.Data):
+				case <-session.ctx.Done():
 				}
-
-				session.stdinChan <- []byte(m.Data)
 			} else if m.Type == WSRequestTypeExecResize {
-				session, existing := terminalSessions[key]
+				parts := strings.Split(m.Data, ",")
 
-				if !existing {
-					log.Error(nil, "can't find terminal session", "key", key)
+				if len(parts) != 2 {
+					log.Error(nil, "invalid resize data", "data", m.Data)
 					continue
 				}
 
-				parts := strings.Split(m.Data, ",")
-
 				width, _ := strconv.Atoi(parts[0])
 				height, _ := strconv.Atoi(parts[1])
 
-				session.sizeChan <- &remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+				select {
+				case session.sizeChan <- &remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}:
+				case <-session.ctx.Done():
+				}
 			}
 		}
 	}
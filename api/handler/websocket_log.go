@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/kalmhq/kalm/api/log"
+	coreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// log lines longer than this are truncated, the rest of them are dropped
+const maxLogLineSize = 1024 * 1024
+
+// parseLogOptions converts a log subscription request to PodLogOptions.
+// The returned regexp is nil if the request doesn't ask for grep filtering.
+func parseLogOptions(m *WSPodResourceRequest) (*coreV1.PodLogOptions, *regexp.Regexp, error) {
+	opts := &coreV1.PodLogOptions{
+		Timestamps: m.Timestamps,
+		Follow:     m.Follow,
+		Previous:   m.Previous,
+	}
+
+	if m.TailLines > 0 {
+		tailLines := m.TailLines
+		opts.TailLines = &tailLines
+	}
+
+	if m.SinceTime != "" {
+		sinceTime, err := time.Parse(time.RFC3339, m.SinceTime)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid sinceTime %s, must be RFC3339 format", m.SinceTime)
+		}
+
+		t := metaV1.NewTime(sinceTime)
+		opts.SinceTime = &t
+	}
+
+	if m.Grep == "" {
+		return opts, nil, nil
+	}
+
+	filter, err := regexp.Compile(m.Grep)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid grep expression, %s", err.Error())
+	}
+
+	return opts, filter, nil
+}
+
+// componentLogContainers returns names of containers in the pod to read logs from.
+// Init containers come first, in the order they are executed.
+// If container is not empty, only the container with that name is returned.
+func componentLogContainers(pod *coreV1.Pod, container string) []string {
+	var names []string
+
+	for _, c := range pod.Spec.InitContainers {
+		if container == "" || c.Name == container {
+			names = append(names, c.Name)
+		}
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if container == "" || c.Name == container {
+			names = append(names, c.Name)
+		}
+	}
+
+	return names
+}
+
+// readLogLine reads a line without the line ending, at most maxLogLineSize bytes of it are kept.
+func readLogLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+
+		if err != nil {
+			// the last line without a line ending, the error is returned by the next read
+			if len(line) > 0 {
+				return string(line), nil
+			}
+
+			return "", err
+		}
+
+		if rest := maxLogLineSize - len(line); len(chunk) > rest {
+			chunk = chunk[:rest]
+		}
+
+		line = append(line, chunk...)
+
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// copyPodLogLinesToWS sends the log stream to client line by line, dropping lines not matching the filter.
+// Each line is sent as a WSResponseTypeLogStreamUpdate message based on template.
+func copyPodLogLinesToWS(ctx context.Context, conn *WSConn, logStream io.ReadCloser, filter *regexp.Regexp, template WSPodDataResponse) {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		// closing the stream unblocks the scanner below
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = logStream.Close()
+	}()
+
+	reader := bufio.NewReaderSize(logStream, 64*1024)
+
+	for {
+		line, err := readLogLine(reader)
+
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				log.Error(err, "read error")
+			}
+
+			return
+		}
+
+		if filter != nil && !filter.MatchString(line) {
+			continue
+		}
+
+		res := template
+		res.Type = WSResponseTypeLogStreamUpdate
+		res.Data = line + "\n"
+
+		if err := conn.WriteJSON(&res); err != nil {
+			if !isNormalWebsocketCloseError(err) {
+				log.Error(err, "write message error")
+			}
+			return
+		}
+	}
+}
+
+// getContainerRunID returns an id of the current run of the container in the pod,
+// and false if the container is not started yet, so there is no log to read.
+func getContainerRunID(pod *coreV1.Pod, container string) (string, bool) {
+	for _, statuses := range [][]coreV1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.Name != container {
+				continue
+			}
+
+			if status.State.Running == nil && status.State.Terminated == nil {
+				return "", false
+			}
+
+			return fmt.Sprintf("%s/%s/%d", pod.UID, container, status.RestartCount), true
+		}
+	}
+
+	return "", false
+}
+
+// copyComponentLogsToWS merges logs of all containers in all pods of a component.
+// Every line is labeled with its pod and container. With follow, pods of the component are watched,
+// containers in new pods and restarted containers are attached once they are started.
+// Once all streams end, a WSResponseTypeLogStreamDisconnected message with an empty pod name is sent.
+func copyComponentLogsToWS(ctx context.Context, conn *WSConn, m *WSPodResourceRequest) {
+	var errMessage string
+
+	defer func() {
+		_ = conn.WriteJSON(&WSPodDataResponse{
+			Type:          WSResponseTypeLogStreamDisconnected,
+			Namespace:     m.Namespace,
+			ComponentName: m.ComponentName,
+			Data:          errMessage,
+		})
+	}()
+
+	podLogOpts, filter, err := parseLogOptions(m)
+
+	if err != nil {
+		errMessage = err.Error()
+		return
+	}
+
+	labelSelector := fmt.Sprintf("kalm-component=%s", m.ComponentName)
+
+	pods, err := conn.K8sClient.CoreV1().Pods(m.Namespace).List(ctx, metaV1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+
+	if err != nil {
+		log.Error(err, "list component pods error")
+		errMessage = err.Error()
+		return
+	}
+
+	// logs of previous containers don't change
+	watchPods := m.Follow && !m.Previous
+
+	if len(pods.Items) == 0 && !watchPods {
+		errMessage = fmt.Sprintf("no pods found for component %s", m.ComponentName)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	attached := make(map[string]bool)
+
+	attach := func(pod *coreV1.Pod) {
+		for _, container := range componentLogContainers(pod, m.Container) {
+			if watchPods {
+				runID, started := getContainerRunID(pod, container)
+
+				// attached when it's started
+				if !started || attached[runID] {
+					continue
+				}
+
+				attached[runID] = true
+			}
+
+			opts := podLogOpts.DeepCopy()
+			opts.Container = container
+
+			template := WSPodDataResponse{
+				Namespace:     m.Namespace,
+				ComponentName: m.ComponentName,
+				PodName:       pod.Name,
+				Container:     container,
+			}
+
+			logStream, err := conn.K8sClient.CoreV1().Pods(m.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
+
+			if err != nil {
+				// e.g. the init container is not started yet or there is no previous terminated container
+				res := template
+				res.Type = WSResponseTypeLogStreamDisconnected
+				res.Data = err.Error()
+				_ = conn.WriteJSON(&res)
+				continue
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				copyPodLogLinesToWS(ctx, conn, logStream, filter, template)
+			}()
+		}
+	}
+
+	for i := range pods.Items {
+		attach(&pods.Items[i])
+	}
+
+	if watchPods {
+		if err := watchComponentPods(ctx, conn, m.Namespace, labelSelector, pods.ResourceVersion, attach); err != nil {
+			log.Error(err, "watch component pods error")
+			errMessage = err.Error()
+		}
+	}
+
+	wg.Wait()
+}
+
+// watchComponentPods calls onPod with added and updated pods, until the context is done.
+func watchComponentPods(ctx context.Context, conn *WSConn, namespace, labelSelector, resourceVersion string, onPod func(pod *coreV1.Pod)) error {
+	watcher, err := watchtools.NewRetryWatcher(resourceVersion, &cache.ListWatch{
+		WatchFunc: func(options metaV1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = labelSelector
+			return conn.K8sClient.CoreV1().Pods(namespace).Watch(ctx, options)
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return fmt.Errorf("watch of pods is closed, new pods are not followed")
+			}
+
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if pod, ok := event.Object.(*coreV1.Pod); ok {
+					onPod(pod)
+				}
+			case watch.Error:
+				return apiErrors.FromObject(event.Object)
+			}
+		}
+	}
+}
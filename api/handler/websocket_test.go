@@ -1 +1,182 @@
 package handler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseLogOptions(t *testing.T) {
+	opts, filter, err := parseLogOptions(&WSPodResourceRequest{Follow: true, Previous: true})
+	assert.Nil(t, err)
+	assert.Nil(t, filter)
+	assert.Nil(t, opts.TailLines)
+	assert.Nil(t, opts.SinceTime)
+	assert.True(t, opts.Follow)
+	assert.True(t, opts.Previous)
+
+	opts, filter, err = parseLogOptions(&WSPodResourceRequest{
+		TailLines: 100,
+		SinceTime: "2020-08-01T10:00:00Z",
+		Grep:      "error|panic",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), *opts.TailLines)
+	assert.True(t, opts.SinceTime.Time.Equal(time.Date(2020, 8, 1, 10, 0, 0, 0, time.UTC)))
+	assert.True(t, filter.MatchString("runtime panic"))
+	assert.False(t, filter.MatchString("all good"))
+
+	_, _, err = parseLogOptions(&WSPodResourceRequest{SinceTime: "yesterday"})
+	assert.NotNil(t, err)
+
+	_, _, err = parseLogOptions(&WSPodResourceRequest{Grep: "("})
+	assert.NotNil(t, err)
+}
+
+func TestComponentLogContainers(t *testing.T) {
+	pod := &coreV1.Pod{
+		Spec: coreV1.PodSpec{
+			InitContainers: []coreV1.Container{{Name: "migrate"}},
+			Containers:     []coreV1.Container{{Name: "web"}, {Name: "istio-proxy"}},
+		},
+	}
+
+	assert.Equal(t, []string{"migrate", "web", "istio-proxy"}, componentLogContainers(pod, ""))
+	assert.Equal(t, []string{"web"}, componentLogContainers(pod, "web"))
+	assert.Empty(t, componentLogContainers(pod, "unknown"))
+}
+
+func TestValidateExecContainer(t *testing.T) {
+	pod := &coreV1.Pod{
+		ObjectMeta: metaV1.ObjectMeta{Name: "web-0"},
+		Spec: coreV1.PodSpec{
+			InitContainers: []coreV1.Container{{Name: "migrate"}},
+			Containers:     []coreV1.Container{{Name: "web"}, {Name: "istio-proxy"}},
+			EphemeralContainers: []coreV1.EphemeralContainer{
+				{EphemeralContainerCommon: coreV1.EphemeralContainerCommon{Name: "debugger"}},
+			},
+		},
+		Status: coreV1.PodStatus{
+			InitContainerStatuses: []coreV1.ContainerStatus{
+				{Name: "migrate", State: coreV1.ContainerState{Running: &coreV1.ContainerStateRunning{}}},
+			},
+		},
+	}
+
+	assert.Nil(t, validateExecContainer(pod, ""))
+	assert.Nil(t, validateExecContainer(pod, "web"))
+	assert.Nil(t, validateExecContainer(pod, "istio-proxy"))
+	assert.Nil(t, validateExecContainer(pod, "migrate"))
+	assert.Nil(t, validateExecContainer(pod, "debugger"))
+	assert.NotNil(t, validateExecContainer(pod, "unknown"))
+
+	pod.Status.InitContainerStatuses[0].State = coreV1.ContainerState{Terminated: &coreV1.ContainerStateTerminated{}}
+	err := validateExecContainer(pod, "migrate")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "has terminated")
+}
+
+func TestGetContainerRunID(t *testing.T) {
+	pod := &coreV1.Pod{
+		ObjectMeta: metaV1.ObjectMeta{UID: "uid"},
+		Status: coreV1.PodStatus{
+			InitContainerStatuses: []coreV1.ContainerStatus{
+				{Name: "migrate", State: coreV1.ContainerState{Terminated: &coreV1.ContainerStateTerminated{}}},
+			},
+			ContainerStatuses: []coreV1.ContainerStatus{
+				{Name: "web", State: coreV1.ContainerState{Waiting: &coreV1.ContainerStateWaiting{}}},
+				{Name: "istio-proxy", RestartCount: 2, State: coreV1.ContainerState{Running: &coreV1.ContainerStateRunning{}}},
+			},
+		},
+	}
+
+	runID, started := getContainerRunID(pod, "migrate")
+	assert.True(t, started)
+	assert.Equal(t, "uid/migrate/0", runID)
+
+	_, started = getContainerRunID(pod, "web")
+	assert.False(t, started)
+
+	// restarted containers are attached again
+	runID, _ = getContainerRunID(pod, "istio-proxy")
+	assert.Equal(t, "uid/istio-proxy/2", runID)
+
+	_, started = getContainerRunID(pod, "unknown")
+	assert.False(t, started)
+}
+
+func TestReadLogLine(t *testing.T) {
+	long := strings.Repeat("a", maxLogLineSize+100)
+	reader := bufio.NewReaderSize(strings.NewReader("first\n"+long+"\nlast"), 64*1024)
+
+	line, err := readLogLine(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", line)
+
+	// truncated, the stream goes on
+	line, err = readLogLine(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, maxLogLineSize, len(line))
+
+	line, err = readLogLine(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "last", line)
+
+	_, err = readLogLine(reader)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFindTerminalSession(t *testing.T) {
+	web := &TerminalSession{namespace: "ns", podName: "web-0", container: "web"}
+	proxy := &TerminalSession{namespace: "ns", podName: "web-0", container: "istio-proxy"}
+	api := &TerminalSession{namespace: "ns", podName: "api-0", container: "api"}
+
+	sessions := map[string]*TerminalSession{
+		"ns___web-0___web":         web,
+		"ns___web-0___istio-proxy": proxy,
+		"ns___api-0___api":         api,
+	}
+
+	key, session := findTerminalSession(sessions, "ns", "web-0", "istio-proxy")
+	assert.Equal(t, "ns___web-0___istio-proxy", key)
+	assert.Equal(t, proxy, session)
+
+	// the container can be omitted if there is only one session for the pod
+	key, session = findTerminalSession(sessions, "ns", "api-0", "")
+	assert.Equal(t, "ns___api-0___api", key)
+	assert.Equal(t, api, session)
+
+	// ambiguous
+	_, session = findTerminalSession(sessions, "ns", "web-0", "")
+	assert.Nil(t, session)
+
+	_, session = findTerminalSession(sessions, "ns", "api-0", "sidecar")
+	assert.Nil(t, session)
+}
+
+func TestCopyPodLogLinesToWSStopsOnClosedStream(t *testing.T) {
+	// the filter drops every line so nothing is written to the nil connection
+	_, filter, _ := parseLogOptions(&WSPodResourceRequest{Grep: "^never$"})
+	stream := ioutil.NopCloser(strings.NewReader("line 1\nline 2\n"))
+
+	done := make(chan struct{})
+
+	go func() {
+		copyPodLogLinesToWS(context.Background(), nil, stream, filter, WSPodDataResponse{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("copyPodLogLinesToWS doesn't return after the stream ends")
+	}
+}
@@ -41,16 +41,20 @@ type PodStatus struct {
 	CreationTimestamp int64             `json:"createTimestamp"`
 	StartTimestamp    int64             `json:"startTimestamp"`
 	Containers        []ContainerStatus `json:"containers"`
+	InitContainers    []ContainerStatus `json:"initContainers"`
 	Metrics           MetricHistories   `json:"metrics"`
 	Warnings          []coreV1.Event    `json:"warnings"`
 }
 
 type ContainerStatus struct {
-	Name         string `json:"name"`
-	RestartCount int32  `json:"restartCount"`
-	Ready        bool   `json:"ready"`
-	Started      bool   `json:"started"`
-	StartedAt    int64  `json:"startedAt"`
+	Name         string        `json:"name"`
+	Type         ContainerType `json:"type"`
+	Image        string        `json:"image"`
+	State        string        `json:"state"`
+	RestartCount int32         `json:"restartCount"`
+	Ready        bool          `json:"ready"`
+	Started      bool          `json:"started"`
+	StartedAt    int64         `json:"startedAt"`
 }
 
 type ServiceStatus struct {
@@ -270,12 +274,7 @@ func GetPodStatus(pod coreV1.Pod, events []coreV1.Event, workloadType v1alpha1.W
 				//readyContainers++
 			}
 
-			containers = append(containers, ContainerStatus{
-				Name:         container.Name,
-				RestartCount: container.RestartCount,
-				Ready:        container.Ready,
-				Started:      container.Started != nil && *container.Started == true,
-			})
+			containers = append(containers, buildContainerStatus(pod, container, false))
 		}
 	}
 
@@ -300,6 +299,7 @@ func GetPodStatus(pod coreV1.Pod, events []coreV1.Event, workloadType v1alpha1.W
 		CreationTimestamp: pod.CreationTimestamp.UnixNano() / int64(time.Millisecond),
 		StartTimestamp:    startTimestamp,
 		Containers:        containers,
+		InitContainers:    getInitContainerStatuses(pod),
 		Warnings:          warnings,
 	}
 }
@@ -0,0 +1,528 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ApplicationBundleActionCreate    = "create"
+	ApplicationBundleActionUpdate    = "update"
+	ApplicationBundleActionUnchanged = "unchanged"
+)
+
+// ApplicationBundleItemDiff is what importing an item of a bundle does to the cluster.
+type ApplicationBundleItemDiff struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+
+	// top level fields of the spec which are changed by an update
+	ChangedFields []string `json:"changedFields,omitempty"`
+
+	// secret envs and secret files of a component without values in the cluster, exported values are redacted
+	UnresolvedSecrets []string `json:"unresolvedSecrets,omitempty"`
+}
+
+type componentSecretField struct {
+	key         string
+	description string
+}
+
+func getComponentSecretFields(spec *v1alpha1.ComponentSpec) []componentSecretField {
+	var fields []componentSecretField
+
+	addEnvs := func(containerName string, envs []v1alpha1.EnvVar) {
+		for _, env := range envs {
+			if env.Type != v1alpha1.EnvVarTypeSecret {
+				continue
+			}
+
+			description := "env " + env.Name
+
+			if containerName != "" {
+				description += " of container " + containerName
+			}
+
+			fields = append(fields, componentSecretField{v1alpha1.ComponentSecretEnvKey(containerName, env.Name), description})
+		}
+	}
+
+	addEnvs("", spec.Env)
+
+	for _, containers := range [][]v1alpha1.Container{spec.InitContainers, spec.Sidecars} {
+		for _, container := range containers {
+			addEnvs(container.Name, container.Env)
+		}
+	}
+
+	for _, file := range spec.PreInjectedFiles {
+		if file.Secret {
+			fields = append(fields, componentSecretField{v1alpha1.ComponentSecretFileKey(file.MountPath), "file " + file.MountPath})
+		}
+	}
+
+	return fields
+}
+
+// getUnresolvedComponentSecrets returns the secret fields of the imported component which have no values
+// in the secret of the existing component. existing is nil if the component is created by the import.
+func (builder *Builder) getUnresolvedComponentSecrets(component, existing *v1alpha1.Component) ([]string, error) {
+	fields := getComponentSecretFields(&component.Spec)
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	var data map[string][]byte
+
+	if existing != nil {
+		var secret coreV1.Secret
+
+		err := builder.Get(existing.Namespace, v1alpha1.ComponentSecretName(existing.Name), &secret)
+
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		if err == nil && metaV1.IsControlledBy(&secret, existing) {
+			data = secret.Data
+		}
+	}
+
+	var unresolved []string
+
+	for _, field := range fields {
+		if _, exist := data[field.key]; !exist {
+			unresolved = append(unresolved, field.description)
+		}
+	}
+
+	return unresolved, nil
+}
+
+// bundleObjectMeta keeps the metadata which is needed to recreate the object.
+func bundleObjectMeta(meta metaV1.ObjectMeta) metaV1.ObjectMeta {
+	annotations := make(map[string]string)
+
+	for k, v := range meta.Annotations {
+		if k == coreV1.LastAppliedConfigAnnotation {
+			continue
+		}
+
+		annotations[k] = v
+	}
+
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+
+	return metaV1.ObjectMeta{
+		Name:        meta.Name,
+		Namespace:   meta.Namespace,
+		Labels:      meta.Labels,
+		Annotations: annotations,
+	}
+}
+
+func isImageInRegistry(image, host string) bool {
+	return host != "" && strings.HasPrefix(image, strings.TrimSuffix(host, "/")+"/")
+}
+
+// ExportApplication returns everything needed to recreate an application, as a List.
+// Secret values of components are not exported, they are kept in the secrets of the components.
+func (builder *Builder) ExportApplication(name string) (*metaV1.List, error) {
+	var objs []runtime.Object
+
+	var namespace coreV1.Namespace
+
+	if err := builder.Get("", name, &namespace); err != nil {
+		return nil, err
+	}
+
+	objs = append(objs, &coreV1.Namespace{ObjectMeta: bundleObjectMeta(namespace.ObjectMeta)})
+
+	inNamespace := client.InNamespace(name)
+
+	var components v1alpha1.ComponentList
+
+	if err := builder.List(&components, inNamespace); err != nil {
+		return nil, err
+	}
+
+	var registries v1alpha1.DockerRegistryList
+
+	if err := builder.List(&registries); err != nil {
+		return nil, err
+	}
+
+	exportedRegistries := make(map[string]bool)
+	exportedPVCs := make(map[string]bool)
+
+	for _, component := range components.Items {
+		for _, registry := range registries.Items {
+			if exportedRegistries[registry.Name] || !isImageInRegistry(component.Spec.Image, registry.Spec.Host) {
+				continue
+			}
+
+			exportedRegistries[registry.Name] = true
+			objs = append(objs, &v1alpha1.DockerRegistry{
+				ObjectMeta: bundleObjectMeta(registry.ObjectMeta),
+				Spec:       registry.Spec,
+			})
+		}
+
+		for _, vol := range component.Spec.Volumes {
+			if vol.PVC == "" || exportedPVCs[vol.PVC] {
+				continue
+			}
+
+			if vol.Type != v1alpha1.VolumeTypePersistentVolumeClaim && vol.Type != v1alpha1.VolumeTypePersistentVolumeClaimTemplate {
+				continue
+			}
+
+			var pvc coreV1.PersistentVolumeClaim
+
+			if err := builder.Get(name, vol.PVC, &pvc); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+
+				return nil, err
+			}
+
+			exportedPVCs[vol.PVC] = true
+
+			// the volume is bound again in the new cluster
+			objs = append(objs, &coreV1.PersistentVolumeClaim{
+				ObjectMeta: bundleObjectMeta(pvc.ObjectMeta),
+				Spec: coreV1.PersistentVolumeClaimSpec{
+					AccessModes:      pvc.Spec.AccessModes,
+					Resources:        pvc.Spec.Resources,
+					StorageClassName: pvc.Spec.StorageClassName,
+					VolumeMode:       pvc.Spec.VolumeMode,
+				},
+			})
+		}
+
+		objs = append(objs, &v1alpha1.Component{
+			ObjectMeta: bundleObjectMeta(component.ObjectMeta),
+			Spec:       component.Spec,
+		})
+	}
+
+	var bindings v1alpha1.ComponentPluginBindingList
+
+	if err := builder.List(&bindings, inNamespace); err != nil {
+		return nil, err
+	}
+
+	for _, binding := range bindings.Items {
+		objs = append(objs, &v1alpha1.ComponentPluginBinding{
+			ObjectMeta: bundleObjectMeta(binding.ObjectMeta),
+			Spec:       binding.Spec,
+		})
+	}
+
+	var routes v1alpha1.HttpRouteList
+
+	if err := builder.List(&routes, inNamespace); err != nil {
+		return nil, err
+	}
+
+	exportedCerts := make(map[string]bool)
+
+	for _, route := range routes.Items {
+		for _, certName := range route.Status.HostCertifications {
+			if exportedCerts[certName] {
+				continue
+			}
+
+			var cert v1alpha1.HttpsCert
+
+			if err := builder.Get("", certName, &cert); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+
+				return nil, err
+			}
+
+			exportedCerts[certName] = true
+			objs = append(objs, &v1alpha1.HttpsCert{
+				ObjectMeta: bundleObjectMeta(cert.ObjectMeta),
+				Spec:       cert.Spec,
+			})
+		}
+
+		objs = append(objs, &v1alpha1.HttpRoute{
+			ObjectMeta: bundleObjectMeta(route.ObjectMeta),
+			Spec:       route.Spec,
+		})
+	}
+
+	var endpoints v1alpha1.ProtectedEndpointList
+
+	if err := builder.List(&endpoints, inNamespace); err != nil {
+		return nil, err
+	}
+
+	for _, endpoint := range endpoints.Items {
+		objs = append(objs, &v1alpha1.ProtectedEndpoint{
+			ObjectMeta: bundleObjectMeta(endpoint.ObjectMeta),
+			Spec:       endpoint.Spec,
+		})
+	}
+
+	list := &metaV1.List{
+		TypeMeta: metaV1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "List",
+		},
+	}
+
+	for _, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, scheme.Scheme)
+
+		if err != nil {
+			return nil, err
+		}
+
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+		// RawExtension only marshals Raw
+		raw, err := json.Marshal(obj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		list.Items = append(list.Items, runtime.RawExtension{Raw: raw})
+	}
+
+	return list, nil
+}
+
+// the kinds a bundle can contain
+var applicationBundleKinds = map[string]bool{
+	"Namespace":              true,
+	"PersistentVolumeClaim":  true,
+	"DockerRegistry":         true,
+	"HttpsCert":              true,
+	"Component":              true,
+	"ComponentPluginBinding": true,
+	"HttpRoute":              true,
+	"ProtectedEndpoint":      true,
+}
+
+// DecodeApplicationBundle decodes a bundle in yaml or json format, and moves the
+// namespaced objects into the given application.
+func DecodeApplicationBundle(data []byte, application string) ([]runtime.Object, error) {
+	jsonData, err := yaml.YAMLToJSON(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var list metaV1.List
+
+	if err := json.Unmarshal(jsonData, &list); err != nil {
+		return nil, err
+	}
+
+	decoder := serializer.NewCodecFactory(scheme.Scheme).UniversalDeserializer()
+	objs := make([]runtime.Object, 0, len(list.Items))
+
+	for i, item := range list.Items {
+		obj, gvk, err := decoder.Decode(item.Raw, nil, nil)
+
+		if err != nil {
+			return nil, fmt.Errorf("items[%d]: %s", i, err)
+		}
+
+		if !applicationBundleKinds[gvk.Kind] {
+			return nil, fmt.Errorf("items[%d]: kind %s is not supported", i, gvk.Kind)
+		}
+
+		obj.GetObjectKind().SetGroupVersionKind(*gvk)
+		meta := obj.(metaV1.Object)
+
+		if gvk.Kind == "Namespace" {
+			meta.SetName(application)
+		} else if meta.GetNamespace() != "" {
+			meta.SetNamespace(application)
+		}
+
+		meta.SetResourceVersion("")
+		meta.SetUID("")
+
+		objs = append(objs, obj)
+	}
+
+	// the namespace has to exist before anything in it is created
+	sort.SliceStable(objs, func(i, j int) bool {
+		return objs[i].GetObjectKind().GroupVersionKind().Kind == "Namespace" &&
+			objs[j].GetObjectKind().GroupVersionKind().Kind != "Namespace"
+	})
+
+	return objs, nil
+}
+
+func getSpecFields(obj runtime.Object) (map[string]interface{}, error) {
+	spec := reflect.ValueOf(obj).Elem().FieldByName("Spec")
+
+	if !spec.IsValid() {
+		return nil, fmt.Errorf("%T has no spec", obj)
+	}
+
+	bts, err := json.Marshal(spec.Interface())
+
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+
+	if err := json.Unmarshal(bts, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// getChangedSpecFields returns the top level fields of spec that differ between the objects.
+func getChangedSpecFields(obj, existing runtime.Object) ([]string, error) {
+	fields, err := getSpecFields(obj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	existingFields, err := getSpecFields(existing)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+
+	for k, v := range fields {
+		if !reflect.DeepEqual(v, existingFields[k]) {
+			changed = append(changed, k)
+		}
+	}
+
+	for k := range existingFields {
+		if _, exist := fields[k]; !exist {
+			changed = append(changed, k)
+		}
+	}
+
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+// ImportApplication diffs the objects of a bundle against the cluster, and applies them unless dryRun is true.
+// Namespaces and volumes that already exist are left alone.
+// Nothing is applied if a component has unresolved secrets, unless allowUnresolvedSecrets is true,
+// the values should be written into the secret of the component after the import then.
+func (builder *Builder) ImportApplication(objs []runtime.Object, dryRun, allowUnresolvedSecrets bool) ([]ApplicationBundleItemDiff, error) {
+	diffs := make([]ApplicationBundleItemDiff, 0, len(objs))
+	var unresolvedErrs v1alpha1.KalmValidateErrorList
+
+	for _, obj := range objs {
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		meta := obj.(metaV1.Object)
+
+		diff := ApplicationBundleItemDiff{
+			Kind:      gvk.Kind,
+			Namespace: meta.GetNamespace(),
+			Name:      meta.GetName(),
+			Action:    ApplicationBundleActionUnchanged,
+		}
+
+		existing, err := scheme.Scheme.New(gvk)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = builder.Get(meta.GetNamespace(), meta.GetName(), existing)
+
+		switch {
+		case errors.IsNotFound(err):
+			diff.Action = ApplicationBundleActionCreate
+			existing = nil
+		case err != nil:
+			return nil, err
+		case gvk.Kind == "Namespace" || gvk.Kind == "PersistentVolumeClaim":
+			// unchanged
+		default:
+			if diff.ChangedFields, err = getChangedSpecFields(obj, existing); err != nil {
+				return nil, err
+			}
+
+			if len(diff.ChangedFields) > 0 {
+				diff.Action = ApplicationBundleActionUpdate
+			}
+		}
+
+		if component, ok := obj.(*v1alpha1.Component); ok {
+			existingComponent, _ := existing.(*v1alpha1.Component)
+
+			if diff.UnresolvedSecrets, err = builder.getUnresolvedComponentSecrets(component, existingComponent); err != nil {
+				return nil, err
+			}
+
+			for _, field := range diff.UnresolvedSecrets {
+				unresolvedErrs = append(unresolvedErrs, v1alpha1.KalmValidateError{
+					Err:  fmt.Sprintf("secret %s has no value in the cluster", field),
+					Path: fmt.Sprintf("%s/%s", diff.Kind, diff.Name),
+				})
+			}
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	if dryRun {
+		return diffs, nil
+	}
+
+	if len(unresolvedErrs) > 0 && !allowUnresolvedSecrets {
+		return nil, unresolvedErrs
+	}
+
+	for i, obj := range objs {
+		var err error
+
+		switch diffs[i].Action {
+		case ApplicationBundleActionCreate:
+			err = builder.Create(obj)
+		case ApplicationBundleActionUpdate:
+			err = builder.Apply(obj)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s %s/%s: %s", diffs[i].Action, diffs[i].Kind, diffs[i].Name, err)
+		}
+	}
+
+	return diffs, nil
+}
@@ -0,0 +1,153 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testApplicationBundle = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: core.kalm.dev/v1alpha1
+  kind: Component
+  metadata:
+    name: web
+    namespace: staging
+  spec:
+    image: nginx
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: staging
+- apiVersion: core.kalm.dev/v1alpha1
+  kind: HttpsCert
+  metadata:
+    name: cert
+  spec:
+    domains:
+    - example.com
+`
+
+func TestDecodeApplicationBundle(t *testing.T) {
+	objs, err := DecodeApplicationBundle([]byte(testApplicationBundle), "production")
+
+	assert.Nil(t, err)
+	assert.Len(t, objs, 3)
+
+	ns, ok := objs[0].(*coreV1.Namespace)
+	assert.True(t, ok)
+	assert.Equal(t, "production", ns.Name)
+
+	component, ok := objs[1].(*v1alpha1.Component)
+	assert.True(t, ok)
+	assert.Equal(t, "production", component.Namespace)
+	assert.Equal(t, "Component", component.GetObjectKind().GroupVersionKind().Kind)
+
+	// cluster scoped objects are kept as they are
+	cert, ok := objs[2].(*v1alpha1.HttpsCert)
+	assert.True(t, ok)
+	assert.Equal(t, "", cert.Namespace)
+}
+
+func TestDecodeApplicationBundleUnsupportedKind(t *testing.T) {
+	_, err := DecodeApplicationBundle([]byte(`{"apiVersion":"v1","kind":"List","items":[{"apiVersion":"v1","kind":"Secret","metadata":{"name":"s"}}]}`), "production")
+	assert.NotNil(t, err)
+}
+
+func TestGetChangedSpecFields(t *testing.T) {
+	replicas := int32(2)
+
+	existing := &v1alpha1.Component{Spec: v1alpha1.ComponentSpec{Image: "nginx", Command: "run"}}
+	obj := &v1alpha1.Component{Spec: v1alpha1.ComponentSpec{Image: "nginx:2", Replicas: &replicas}}
+
+	changed, err := getChangedSpecFields(obj, existing)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"command", "image", "replicas"}, changed)
+
+	changed, err = getChangedSpecFields(existing.DeepCopy(), existing)
+	assert.Nil(t, err)
+	assert.Empty(t, changed)
+}
+
+func TestBundleObjectMeta(t *testing.T) {
+	meta := bundleObjectMeta(metaV1.ObjectMeta{
+		Name:            "web",
+		Namespace:       "staging",
+		ResourceVersion: "1",
+		UID:             "uid",
+		Labels:          map[string]string{"app": "web"},
+		Annotations:     map[string]string{coreV1.LastAppliedConfigAnnotation: "{}"},
+	})
+
+	assert.Equal(t, metaV1.ObjectMeta{
+		Name:      "web",
+		Namespace: "staging",
+		Labels:    map[string]string{"app": "web"},
+	}, meta)
+}
+
+func TestImportApplicationUnresolvedSecrets(t *testing.T) {
+	assert.Nil(t, v1alpha1.AddToScheme(scheme.Scheme))
+
+	existing := &v1alpha1.Component{
+		ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "production", UID: "web-uid"},
+		Spec:       v1alpha1.ComponentSpec{Image: "nginx"},
+	}
+
+	secret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:            "web-secret",
+			Namespace:       "production",
+			OwnerReferences: []metaV1.OwnerReference{*metaV1.NewControllerRef(existing, v1alpha1.GroupVersion.WithKind("Component"))},
+		},
+		Data: map[string][]byte{"DB_PASSWORD": []byte("s3cret")},
+	}
+
+	builder := &Builder{ctx: context.Background(), Client: fake.NewFakeClientWithScheme(scheme.Scheme, existing, secret)}
+
+	newComponent := func(name string) *v1alpha1.Component {
+		component := &v1alpha1.Component{
+			ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: "production"},
+			Spec: v1alpha1.ComponentSpec{
+				Image: "nginx",
+				Env: []v1alpha1.EnvVar{
+					{Name: "DB_PASSWORD", Type: v1alpha1.EnvVarTypeSecret},
+					{Name: "API_TOKEN", Type: v1alpha1.EnvVarTypeSecret},
+				},
+				PreInjectedFiles: []v1alpha1.PreInjectFile{{MountPath: "/etc/tls/tls.key", Secret: true}},
+			},
+		}
+
+		component.SetGroupVersionKind(v1alpha1.GroupVersion.WithKind("Component"))
+
+		return component
+	}
+
+	objs := []runtime.Object{newComponent("web"), newComponent("worker")}
+
+	diffs, err := builder.ImportApplication(objs, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"env API_TOKEN", "file /etc/tls/tls.key"}, diffs[0].UnresolvedSecrets)
+	assert.Equal(t, []string{"env DB_PASSWORD", "env API_TOKEN", "file /etc/tls/tls.key"}, diffs[1].UnresolvedSecrets)
+
+	// nothing is applied
+	_, err = builder.ImportApplication(objs, false, false)
+	errs, ok := err.(v1alpha1.KalmValidateErrorList)
+	assert.True(t, ok)
+	assert.Len(t, errs, 5)
+	assert.Equal(t, "Component/web", errs[0].Path)
+	assert.NotNil(t, builder.Get("production", "worker", &v1alpha1.Component{}))
+
+	_, err = builder.ImportApplication(objs, false, true)
+	assert.Nil(t, err)
+	assert.Nil(t, builder.Get("production", "worker", &v1alpha1.Component{}))
+}
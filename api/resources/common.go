@@ -7,6 +7,7 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/kalmhq/kalm/controller/api/v1alpha1"
 	appV1 "k8s.io/api/apps/v1"
+	autoscalingV2beta2 "k8s.io/api/autoscaling/v2beta2"
 	coreV1 "k8s.io/api/core/v1"
 	rbacV1 "k8s.io/api/rbac/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -39,6 +40,7 @@ type ResourceChannels struct {
 	SecretList                 *SecretListChannel
 	IstioMetricList            *IstioMetricListChannel
 	ProtectedEndpoint          *ProtectedEndpointsChannel
+	HorizontalPodAutoscalers   *HorizontalPodAutoscalerListChannel
 }
 
 type Resources struct {
@@ -54,10 +56,11 @@ type Resources struct {
 	ComponentPluginBindings []v1alpha1.ComponentPluginBinding
 	//ApplicationPlugins        []v1alpha1.ApplicationPlugin
 	//ApplicationPluginBindings []v1alpha1.ApplicationPluginBinding
-	DockerRegistries  []v1alpha1.DockerRegistry
-	Secrets           []coreV1.Secret
-	HttpsCertIssuers  []v1alpha1.HttpsCertIssuer
-	ProtectedEndpoint []v1alpha1.ProtectedEndpoint
+	DockerRegistries         []v1alpha1.DockerRegistry
+	Secrets                  []coreV1.Secret
+	HttpsCertIssuers         []v1alpha1.HttpsCertIssuer
+	ProtectedEndpoint        []v1alpha1.ProtectedEndpoint
+	HorizontalPodAutoscalers []autoscalingV2beta2.HorizontalPodAutoscaler
 }
 
 var ListAll = metaV1.ListOptions{
@@ -175,6 +178,14 @@ func (c *ResourceChannels) ToResources() (r *Resources, err error) {
 		resources.ProtectedEndpoint = <-c.ProtectedEndpoint.List
 	}
 
+	if c.HorizontalPodAutoscalers != nil {
+		err = <-c.HorizontalPodAutoscalers.Error
+		if err != nil {
+			return nil, err
+		}
+		resources.HorizontalPodAutoscalers = <-c.HorizontalPodAutoscalers.List
+	}
+
 	return resources, nil
 }
 
@@ -1,6 +1,7 @@
 package resources
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -9,8 +10,10 @@ import (
 
 	"github.com/kalmhq/kalm/controller/api/v1alpha1"
 	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -95,6 +98,9 @@ type ComponentDetails struct {
 	IstioMetricHistories *IstioMetricHistories `json:"istioMetricHistories"`
 	Services             []ServiceStatus       `json:"services"`
 	Pods                 []PodStatus           `json:"pods"`
+
+	// state of the HorizontalPodAutoscaler, set if autoscaling is on
+	AutoscalingStatus *HorizontalPodAutoscalerStatus `json:"autoscalingStatus,omitempty"`
 }
 
 func (builder *Builder) BuildComponentDetails(
@@ -113,6 +119,7 @@ func (builder *Builder) BuildComponentDetails(
 			EventList:                  builder.GetEventListChannel(nsListOption),
 			ServiceList:                builder.GetServiceListChannel(nsListOption, belongsToComponent),
 			ComponentPluginBindingList: builder.GetComponentPluginBindingListChannel(nsListOption, belongsToComponent),
+			HorizontalPodAutoscalers:   builder.GetHorizontalPodAutoscalerListChannel(nsListOption, belongsToComponent),
 		}
 
 		resources, err = resourceChannels.ToResources()
@@ -196,6 +203,12 @@ func (builder *Builder) BuildComponentDetails(
 		Pods:                 podsStatus,
 	}
 
+	if component.Spec.Autoscaling != nil {
+		if hpa := findComponentHorizontalPodAutoscaler(resources.HorizontalPodAutoscalers, component.Name); hpa != nil {
+			details.AutoscalingStatus = BuildHorizontalPodAutoscalerStatus(hpa)
+		}
+	}
+
 	resRequirements := component.Spec.ResourceRequirements
 	if resRequirements != nil && resRequirements.Requests != nil {
 		if cpuReq, exist := resRequirements.Requests[coreV1.ResourceCPU]; exist {
@@ -220,6 +233,128 @@ func (builder *Builder) BuildComponentDetails(
 	return details, nil
 }
 
+func extractSecretEnvs(containerName string, envs []v1alpha1.EnvVar, values map[string][]byte) {
+	for i := range envs {
+		if envs[i].Type != v1alpha1.EnvVarTypeSecret {
+			continue
+		}
+
+		key := v1alpha1.ComponentSecretEnvKey(containerName, envs[i].Name)
+
+		if envs[i].Value != "" {
+			values[key] = []byte(envs[i].Value)
+		} else {
+			values[key] = nil
+		}
+
+		envs[i].Value = ""
+	}
+}
+
+// ExtractComponentSecrets removes the values of secret envs and the contents of secret pre-injected files
+// from the spec, they are never saved in the component. The values are returned by their keys in the secret
+// of the component, nil values are left empty by clients to keep the ones in the secret.
+func ExtractComponentSecrets(spec *v1alpha1.ComponentSpec) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+
+	extractSecretEnvs("", spec.Env, values)
+
+	for _, containers := range [][]v1alpha1.Container{spec.InitContainers, spec.Sidecars} {
+		for i := range containers {
+			extractSecretEnvs(containers[i].Name, containers[i].Env, values)
+		}
+	}
+
+	for i := range spec.PreInjectedFiles {
+		file := &spec.PreInjectedFiles[i]
+
+		if !file.Secret {
+			continue
+		}
+
+		key := v1alpha1.ComponentSecretFileKey(file.MountPath)
+		values[key] = nil
+
+		if file.Content != "" {
+			content := []byte(file.Content)
+
+			if file.Base64 {
+				decoded, err := base64.StdEncoding.DecodeString(file.Content)
+
+				if err != nil {
+					return nil, fmt.Errorf("content of pre-injected file %s is not base64 encoded: %s", file.MountPath, err)
+				}
+
+				content = decoded
+			}
+
+			values[key] = content
+		}
+
+		file.Content = ""
+	}
+
+	return values, nil
+}
+
+// UpdateComponentSecret writes the values returned by ExtractComponentSecrets into the secret of the component.
+// Keys no longer used by the component are removed. The secret is created, owned by the component, if the
+// component controller hasn't created it yet.
+func (builder *Builder) UpdateComponentSecret(component *v1alpha1.Component, values map[string][]byte) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	name := v1alpha1.ComponentSecretName(component.Name)
+
+	// the controller may create the secret at the same time
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}, func() error {
+		var secret coreV1.Secret
+
+		err := builder.Get(component.Namespace, name, &secret)
+
+		if errors.IsNotFound(err) {
+			secret = coreV1.Secret{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:            name,
+					Namespace:       component.Namespace,
+					OwnerReferences: []metaV1.OwnerReference{*metaV1.NewControllerRef(component, v1alpha1.GroupVersion.WithKind("Component"))},
+				},
+				Type: coreV1.SecretTypeOpaque,
+				Data: getComponentSecretData(values, nil),
+			}
+
+			return builder.Create(&secret)
+		} else if err != nil {
+			return err
+		}
+
+		if !metaV1.IsControlledBy(&secret, component) {
+			return fmt.Errorf("secret %s already exists and is not owned by the component", name)
+		}
+
+		secret.Data = getComponentSecretData(values, secret.Data)
+
+		return builder.Update(&secret)
+	})
+}
+
+func getComponentSecretData(values map[string][]byte, existing map[string][]byte) map[string][]byte {
+	data := make(map[string][]byte)
+
+	for key, value := range values {
+		if value != nil {
+			data[key] = value
+		} else if v, exist := existing[key]; exist {
+			data[key] = v
+		}
+	}
+
+	return data
+}
+
 func getComponentAndNSNameFromSvcName(svcName string) (string, string) {
 	parts := strings.Split(svcName, ".")
 	if len(parts) < 2 {
@@ -251,6 +386,7 @@ func (builder *Builder) BuildComponentDetailsResponse(
 		EventList:                  builder.GetEventListChannel(nsListOption),
 		ServiceList:                builder.GetServiceListChannel(nsListOption),
 		ComponentPluginBindingList: builder.GetComponentPluginBindingListChannel(nsListOption),
+		HorizontalPodAutoscalers:   builder.GetHorizontalPodAutoscalerListChannel(nsListOption),
 	}
 
 	resources, err := resourceChannels.ToResources()
@@ -1,9 +1,15 @@
 package resources
 
 import (
+	"context"
 	"encoding/json"
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
 	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"testing"
 )
 
@@ -22,3 +28,78 @@ func TestBuilder_MarshalOfComponentDetails(t *testing.T) {
 	expected := `{"name":"","image":"","enableHeadlessService":false,"cpuRequest":"100m","memoryRequest":"107374183","metrics":{"cpu":null,"memory":null},"istioMetricHistories":null,"services":null,"pods":null}`
 	assert.Equal(t, expected, string(marshalRst))
 }
+
+func TestExtractComponentSecrets(t *testing.T) {
+	spec := v1alpha1.ComponentSpec{
+		Env: []v1alpha1.EnvVar{
+			{Name: "MODE", Value: "prod", Type: v1alpha1.EnvVarTypeStatic},
+			{Name: "DB_PASSWORD", Value: "s3cret", Type: v1alpha1.EnvVarTypeSecret},
+			{Name: "API_TOKEN", Type: v1alpha1.EnvVarTypeSecret},
+		},
+		Sidecars: []v1alpha1.Container{
+			{Name: "proxy", Env: []v1alpha1.EnvVar{{Name: "DB_PASSWORD", Value: "other", Type: v1alpha1.EnvVarTypeSecret}}},
+		},
+		PreInjectedFiles: []v1alpha1.PreInjectFile{
+			{MountPath: "/etc/app/config.yaml", Content: "plain"},
+			{MountPath: "/etc/tls/tls.key", Content: "a2V5", Base64: true, Secret: true},
+		},
+	}
+
+	values, err := ExtractComponentSecrets(&spec)
+	assert.Nil(t, err)
+
+	keyFile := v1alpha1.ComponentSecretFileKey("/etc/tls/tls.key")
+
+	assert.Equal(t, map[string][]byte{
+		"DB_PASSWORD":       []byte("s3cret"),
+		"API_TOKEN":         nil,
+		"proxy.DB_PASSWORD": []byte("other"),
+		keyFile:             []byte("key"),
+	}, values)
+
+	// values are never saved in the component
+	assert.Equal(t, "prod", spec.Env[0].Value)
+	assert.Equal(t, "plain", spec.PreInjectedFiles[0].Content)
+
+	bts, _ := json.Marshal(spec)
+	assert.NotContains(t, string(bts), "s3cret")
+	assert.NotContains(t, string(bts), "a2V5")
+
+	// unchanged values are kept, keys no longer used are removed
+	assert.Equal(t, map[string][]byte{
+		"DB_PASSWORD":       []byte("s3cret"),
+		"API_TOKEN":         []byte("token"),
+		"proxy.DB_PASSWORD": []byte("other"),
+		keyFile:             []byte("key"),
+	}, getComponentSecretData(values, map[string][]byte{
+		"API_TOKEN": []byte("token"),
+		"REMOVED":   []byte("removed"),
+	}))
+
+	_, err = ExtractComponentSecrets(&v1alpha1.ComponentSpec{
+		PreInjectedFiles: []v1alpha1.PreInjectFile{{MountPath: "/etc/tls/tls.key", Content: "not base64!", Base64: true, Secret: true}},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestUpdateComponentSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, coreV1.AddToScheme(scheme))
+	assert.Nil(t, v1alpha1.AddToScheme(scheme))
+
+	builder := &Builder{ctx: context.Background(), Client: fake.NewFakeClientWithScheme(scheme)}
+
+	component := &v1alpha1.Component{ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "default", UID: "web-uid"}}
+
+	assert.Nil(t, builder.UpdateComponentSecret(component, map[string][]byte{"DB_PASSWORD": []byte("s3cret")}))
+	assert.Nil(t, builder.UpdateComponentSecret(component, map[string][]byte{"DB_PASSWORD": nil, "API_TOKEN": []byte("token")}))
+
+	var secret coreV1.Secret
+	assert.Nil(t, builder.Get("default", "web-secret", &secret))
+	assert.True(t, metaV1.IsControlledBy(&secret, component))
+	assert.Equal(t, map[string][]byte{"DB_PASSWORD": []byte("s3cret"), "API_TOKEN": []byte("token")}, secret.Data)
+
+	// secrets not created for the component are left alone
+	other := &v1alpha1.Component{ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "default", UID: "other-uid"}}
+	assert.NotNil(t, builder.UpdateComponentSecret(other, map[string][]byte{"DB_PASSWORD": []byte("changed")}))
+}
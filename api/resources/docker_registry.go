@@ -51,6 +51,23 @@ type DockerRegistry struct {
 	Name                           string `json:"name"`
 	Username                       string `json:"username"`
 	Password                       string `json:"password"`
+
+	// other keys of the authentication secret, such as a token, a .dockerconfigjson or the ones of credential helpers.
+	// Like the password, they are never returned.
+	Credentials map[string]string `json:"credentials,omitempty"`
+}
+
+func (registry *DockerRegistry) getSecretData() map[string][]byte {
+	data := map[string][]byte{
+		"username": []byte(registry.Username),
+		"password": []byte(registry.Password),
+	}
+
+	for key, value := range registry.Credentials {
+		data[key] = []byte(value)
+	}
+
+	return data
 }
 
 func (builder *Builder) GetDockerRegistry(name string) (*DockerRegistry, error) {
@@ -143,10 +160,7 @@ func (builder *Builder) CreateDockerRegistry(registry *DockerRegistry) (*DockerR
 			Name:      controllers.GetRegistryAuthenticationName(registry.Name),
 			Namespace: "kalm-system",
 		},
-		Data: map[string][]byte{
-			"username": []byte(registry.Username),
-			"password": []byte(registry.Password),
-		},
+		Data: registry.getSecretData(),
 	}
 
 	var err error
@@ -192,10 +206,7 @@ func (builder *Builder) UpdateDockerRegistry(registry *DockerRegistry) (*DockerR
 		}
 	}
 
-	secret.Data = map[string][]byte{
-		"username": []byte(registry.Username),
-		"password": []byte(registry.Password),
-	}
+	secret.Data = registry.getSecretData()
 
 	if registry.DockerRegistrySpec != nil {
 		dockerRegistry.Spec = *registry.DockerRegistrySpec
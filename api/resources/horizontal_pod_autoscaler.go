@@ -0,0 +1,88 @@
+package resources
+
+import (
+	autoscalingV2beta2 "k8s.io/api/autoscaling/v2beta2"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type HorizontalPodAutoscalerListChannel struct {
+	List  chan []autoscalingV2beta2.HorizontalPodAutoscaler
+	Error chan error
+}
+
+type HorizontalPodAutoscalerCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type HorizontalPodAutoscalerStatus struct {
+	MinReplicas     int32                              `json:"minReplicas"`
+	MaxReplicas     int32                              `json:"maxReplicas"`
+	CurrentReplicas int32                              `json:"currentReplicas"`
+	DesiredReplicas int32                              `json:"desiredReplicas"`
+	LastScaleTime   *metaV1.Time                       `json:"lastScaleTime,omitempty"`
+	CurrentMetrics  []autoscalingV2beta2.MetricStatus  `json:"currentMetrics,omitempty"`
+	Conditions      []HorizontalPodAutoscalerCondition `json:"conditions,omitempty"`
+}
+
+func (builder *Builder) GetHorizontalPodAutoscalerListChannel(opts ...client.ListOption) *HorizontalPodAutoscalerListChannel {
+	channel := &HorizontalPodAutoscalerListChannel{
+		List:  make(chan []autoscalingV2beta2.HorizontalPodAutoscaler, 1),
+		Error: make(chan error, 1),
+	}
+
+	go func() {
+		var list autoscalingV2beta2.HorizontalPodAutoscalerList
+		err := builder.List(&list, opts...)
+
+		if err != nil {
+			channel.List <- nil
+			channel.Error <- err
+			return
+		}
+
+		channel.List <- list.Items
+		channel.Error <- nil
+	}()
+
+	return channel
+}
+
+func BuildHorizontalPodAutoscalerStatus(hpa *autoscalingV2beta2.HorizontalPodAutoscaler) *HorizontalPodAutoscalerStatus {
+	status := &HorizontalPodAutoscalerStatus{
+		MinReplicas:     1,
+		MaxReplicas:     hpa.Spec.MaxReplicas,
+		CurrentReplicas: hpa.Status.CurrentReplicas,
+		DesiredReplicas: hpa.Status.DesiredReplicas,
+		LastScaleTime:   hpa.Status.LastScaleTime,
+		CurrentMetrics:  hpa.Status.CurrentMetrics,
+	}
+
+	if hpa.Spec.MinReplicas != nil {
+		status.MinReplicas = *hpa.Spec.MinReplicas
+	}
+
+	for _, cond := range hpa.Status.Conditions {
+		status.Conditions = append(status.Conditions, HorizontalPodAutoscalerCondition{
+			Type:    string(cond.Type),
+			Status:  string(cond.Status),
+			Reason:  cond.Reason,
+			Message: cond.Message,
+		})
+	}
+
+	return status
+}
+
+func findComponentHorizontalPodAutoscaler(list []autoscalingV2beta2.HorizontalPodAutoscaler, componentName string) *autoscalingV2beta2.HorizontalPodAutoscaler {
+	for i := range list {
+		if list[i].Name == componentName && list[i].Labels["kalm-component"] == componentName {
+			return &list[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package resources
+
+import (
+	"fmt"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+const LokiPort = 3100
+
+var NoLokiLogSystemError = fmt.Errorf("no LogSystem with loki is installed")
+
+// GetLokiAddress returns the base url of the loki service deployed by a LogSystem.
+func (builder *Builder) GetLokiAddress() (string, error) {
+	var logSystems v1alpha1.LogSystemList
+
+	if err := builder.List(&logSystems); err != nil {
+		return "", err
+	}
+
+	for _, logSystem := range logSystems.Items {
+		if logSystem.DeletionTimestamp != nil {
+			continue
+		}
+
+		switch logSystem.Spec.Stack {
+		case v1alpha1.LogSystemStackPLGMonolithic:
+			// the loki component is named after the LogSystem, see the LogSystem controller
+			return fmt.Sprintf("http://%s-loki.%s.svc.cluster.local:%d", logSystem.Name, logSystem.Namespace, LokiPort), nil
+		case v1alpha1.LogSystemStackPLGDistributed:
+			// queries of distributed lokis go through the query frontend
+			return fmt.Sprintf("http://%s-loki-query-frontend.%s.svc.cluster.local:%d", logSystem.Name, logSystem.Namespace, LokiPort), nil
+		}
+	}
+
+	return "", NoLokiLogSystemError
+}
+
+// FilterLogReadableNamespaces returns namespaces in which the current user can read pod logs.
+func (builder *Builder) FilterLogReadableNamespaces(namespaces []string) ([]string, error) {
+	res := make([]string, 0, len(namespaces))
+
+	for _, namespace := range namespaces {
+		review := &authorizationV1.SelfSubjectAccessReview{
+			Spec: authorizationV1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationV1.ResourceAttributes{
+					Namespace:   namespace,
+					Resource:    "pods",
+					Subresource: "log",
+					Verb:        "get",
+				},
+			},
+		}
+
+		if err := builder.Create(review); err != nil {
+			return nil, err
+		}
+
+		if review.Status.Allowed {
+			res = append(res, namespace)
+		}
+	}
+
+	return res, nil
+}
+
+// ListAllNamespaceNames lists names of all namespaces that are not being deleted.
+func (builder *Builder) ListAllNamespaceNames() ([]string, error) {
+	var nsList coreV1.NamespaceList
+
+	if err := builder.List(&nsList); err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(nsList.Items))
+
+	for _, item := range nsList.Items {
+		if item.DeletionTimestamp == nil {
+			res = append(res, item.Name)
+		}
+	}
+
+	return res, nil
+}
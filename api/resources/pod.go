@@ -1,6 +1,9 @@
 package resources
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/kalmhq/kalm/controller/api/v1alpha1"
 	coreV1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -76,3 +79,76 @@ func (builder *Builder) GetPodListChannel(opts ...client.ListOption) *PodListCha
 
 	return channel
 }
+
+type ContainerType string
+
+const (
+	ContainerTypeMain    ContainerType = "main"
+	ContainerTypeSidecar ContainerType = "sidecar"
+	ContainerTypeInit    ContainerType = "init"
+)
+
+// getContainerType tells the main container of a component from its sidecars
+func getContainerType(pod coreV1.Pod, containerName string, isInitContainer bool) ContainerType {
+	if isInitContainer {
+		return ContainerTypeInit
+	}
+
+	componentName := pod.Labels["kalm-component"]
+
+	// pods of a canary deployment are labeled with <component>-canary
+	if canaryOf, exist := pod.Labels["kalm-canary-of"]; exist {
+		componentName = canaryOf
+	}
+
+	if containerName == componentName {
+		return ContainerTypeMain
+	}
+
+	return ContainerTypeSidecar
+}
+
+func getContainerState(state coreV1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "Running"
+	case state.Waiting != nil && state.Waiting.Reason != "":
+		return "Waiting: " + state.Waiting.Reason
+	case state.Waiting != nil:
+		return "Waiting"
+	case state.Terminated != nil && state.Terminated.Reason != "":
+		return "Terminated: " + state.Terminated.Reason
+	case state.Terminated != nil:
+		return fmt.Sprintf("Terminated: ExitCode:%d", state.Terminated.ExitCode)
+	}
+
+	return ""
+}
+
+func buildContainerStatus(pod coreV1.Pod, container coreV1.ContainerStatus, isInitContainer bool) ContainerStatus {
+	status := ContainerStatus{
+		Name:         container.Name,
+		Type:         getContainerType(pod, container.Name, isInitContainer),
+		Image:        container.Image,
+		State:        getContainerState(container.State),
+		RestartCount: container.RestartCount,
+		Ready:        container.Ready,
+		Started:      container.Started != nil && *container.Started == true,
+	}
+
+	if container.State.Running != nil {
+		status.StartedAt = container.State.Running.StartedAt.UnixNano() / int64(time.Millisecond)
+	}
+
+	return status
+}
+
+func getInitContainerStatuses(pod coreV1.Pod) []ContainerStatus {
+	res := make([]ContainerStatus, 0, len(pod.Status.InitContainerStatuses))
+
+	for _, container := range pod.Status.InitContainerStatuses {
+		res = append(res, buildContainerStatus(pod, container, true))
+	}
+
+	return res
+}
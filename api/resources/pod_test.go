@@ -3,6 +3,8 @@ package resources
 import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
 )
 
@@ -49,3 +51,33 @@ func TestUnmarshalPromResp(t *testing.T) {
 	err := json.Unmarshal([]byte(resp), &rsts)
 	assert.Nil(t, err)
 }
+
+func TestBuildContainerStatus(t *testing.T) {
+	pod := coreV1.Pod{
+		ObjectMeta: metaV1.ObjectMeta{
+			Labels: map[string]string{"kalm-component": "web"},
+		},
+	}
+
+	main := buildContainerStatus(pod, coreV1.ContainerStatus{
+		Name:  "web",
+		Image: "web:v2",
+		State: coreV1.ContainerState{Waiting: &coreV1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+	}, false)
+	assert.Equal(t, ContainerTypeMain, main.Type)
+	assert.Equal(t, "Waiting: ImagePullBackOff", main.State)
+
+	sidecar := buildContainerStatus(pod, coreV1.ContainerStatus{Name: "log-shipper"}, false)
+	assert.Equal(t, ContainerTypeSidecar, sidecar.Type)
+
+	initContainer := buildContainerStatus(pod, coreV1.ContainerStatus{
+		Name:  "migrate",
+		State: coreV1.ContainerState{Terminated: &coreV1.ContainerStateTerminated{ExitCode: 1}},
+	}, true)
+	assert.Equal(t, ContainerTypeInit, initContainer.Type)
+	assert.Equal(t, "Terminated: ExitCode:1", initContainer.State)
+
+	// the main container of a canary pod is named after the component
+	pod.Labels = map[string]string{"kalm-component": "web-canary", "kalm-canary-of": "web"}
+	assert.Equal(t, ContainerTypeMain, getContainerType(pod, "web", false))
+}
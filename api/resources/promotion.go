@@ -0,0 +1,119 @@
+package resources
+
+import (
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type Promotion struct {
+	*v1alpha1.PromotionSpec `json:",inline"`
+	Name                    string                    `json:"name"`
+	Namespace               string                    `json:"namespace"`
+	Status                  *v1alpha1.PromotionStatus `json:"status,omitempty"`
+}
+
+func BuildPromotionFromResource(promotion *v1alpha1.Promotion) *Promotion {
+	return &Promotion{
+		PromotionSpec: &promotion.Spec,
+		Name:          promotion.Name,
+		Namespace:     promotion.Namespace,
+		Status:        &promotion.Status,
+	}
+}
+
+func (builder *Builder) GetPromotions(namespace string) ([]*Promotion, error) {
+	var promotions v1alpha1.PromotionList
+
+	if err := builder.List(&promotions, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	res := make([]*Promotion, len(promotions.Items))
+
+	for i := range promotions.Items {
+		res[i] = BuildPromotionFromResource(&promotions.Items[i])
+	}
+
+	return res, nil
+}
+
+func (builder *Builder) GetPromotion(namespace, name string) (*Promotion, error) {
+	var promotion v1alpha1.Promotion
+
+	if err := builder.Get(namespace, name, &promotion); err != nil {
+		return nil, err
+	}
+
+	return BuildPromotionFromResource(&promotion), nil
+}
+
+// CheckPromotionSource makes sure the current user can read the resources to promote.
+// The controller copies them with its own permissions.
+func (builder *Builder) CheckPromotionSource(spec *v1alpha1.PromotionSpec) error {
+	check := func(names []string, obj runtime.Object) error {
+		for _, name := range names {
+			if err := builder.Get(spec.SourceNamespace, name, obj); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := check(spec.Components, &v1alpha1.Component{}); err != nil {
+		return err
+	}
+
+	if err := check(spec.HttpRoutes, &v1alpha1.HttpRoute{}); err != nil {
+		return err
+	}
+
+	return check(spec.ProtectedEndpoints, &v1alpha1.ProtectedEndpoint{})
+}
+
+func (builder *Builder) CreatePromotion(promotion *Promotion) (*Promotion, error) {
+	if err := builder.CheckPromotionSource(promotion.PromotionSpec); err != nil {
+		return nil, err
+	}
+
+	res := &v1alpha1.Promotion{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      promotion.Name,
+			Namespace: promotion.Namespace,
+		},
+		Spec: *promotion.PromotionSpec,
+	}
+
+	if err := builder.Create(res); err != nil {
+		return nil, err
+	}
+
+	return BuildPromotionFromResource(res), nil
+}
+
+// UpdatePromotion changes the spec of a promotion, which promotes the resources again.
+func (builder *Builder) UpdatePromotion(promotion *Promotion) (*Promotion, error) {
+	if err := builder.CheckPromotionSource(promotion.PromotionSpec); err != nil {
+		return nil, err
+	}
+
+	res := &v1alpha1.Promotion{}
+
+	if err := builder.Get(promotion.Namespace, promotion.Name, res); err != nil {
+		return nil, err
+	}
+
+	res.Spec = *promotion.PromotionSpec
+
+	if err := builder.Update(res); err != nil {
+		return nil, err
+	}
+
+	return BuildPromotionFromResource(res), nil
+}
+
+func (builder *Builder) DeletePromotion(namespace, name string) error {
+	return builder.Delete(&v1alpha1.Promotion{ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: namespace}})
+}
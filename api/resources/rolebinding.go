@@ -281,7 +281,18 @@ func (builder *Builder) createReaderRole(namespace string) (err error) {
 					"list", "get", "watch",
 				},
 				Resources: []string{
-					"applications",
+					"horizontalpodautoscalers",
+				},
+				APIGroups: []string{
+					"autoscaling",
+				},
+			},
+			{
+				Verbs: []string{
+					"list", "get", "watch",
+				},
+				Resources: []string{
+					"applications", "promotions",
 				},
 				APIGroups: []string{
 					"core.kalm.dev",
@@ -349,12 +360,23 @@ func (builder *Builder) createWriterRole(namespace string) (err error) {
 					"apps",
 				},
 			},
+			{
+				Verbs: []string{
+					"list", "get", "watch",
+				},
+				Resources: []string{
+					"horizontalpodautoscalers",
+				},
+				APIGroups: []string{
+					"autoscaling",
+				},
+			},
 			{
 				Verbs: []string{
 					"list", "get", "watch", "update", "create", "patch", "delete",
 				},
 				Resources: []string{
-					"applications",
+					"applications", "promotions",
 				},
 				APIGroups: []string{
 					"core.kalm.dev",
@@ -84,6 +84,9 @@ type ProtectedEndpoint struct {
 	Ports                       []uint32 `json:"ports"`
 	Groups                      []string `json:"groups"`
 	AllowToPassIfHasBearerToken bool     `json:"allowToPassIfHasBearerToken,omitempty"`
+	AllowCredentials            bool     `json:"allowCredentials,omitempty"`
+
+	AuthorizationRules []v1alpha1.AuthorizationRule `json:"authorizationRules,omitempty"`
 }
 
 type SSOConfig struct {
@@ -150,6 +153,8 @@ func ProtectedEndpointCRDToProtectedEndpoint(endpoint *v1alpha1.ProtectedEndpoin
 		Ports:                       endpoint.Spec.Ports,
 		Groups:                      endpoint.Spec.Groups,
 		AllowToPassIfHasBearerToken: endpoint.Spec.AllowToPassIfHasBearerToken,
+		AllowCredentials:            endpoint.Spec.AllowCredentials,
+		AuthorizationRules:          endpoint.Spec.AuthorizationRules,
 	}
 
 	// import for frontend
@@ -199,6 +204,8 @@ func (builder *Builder) CreateProtectedEndpoint(ep *ProtectedEndpoint) (*Protect
 			Ports:                       ep.Ports,
 			Groups:                      ep.Groups,
 			AllowToPassIfHasBearerToken: ep.AllowToPassIfHasBearerToken,
+			AllowCredentials:            ep.AllowCredentials,
+			AuthorizationRules:          ep.AuthorizationRules,
 		},
 	}
 
@@ -226,6 +233,8 @@ func (builder *Builder) UpdateProtectedEndpoint(ep *ProtectedEndpoint) (*Protect
 			Ports:                       ep.Ports,
 			Groups:                      ep.Groups,
 			AllowToPassIfHasBearerToken: ep.AllowToPassIfHasBearerToken,
+			AllowCredentials:            ep.AllowCredentials,
+			AuthorizationRules:          ep.AuthorizationRules,
 		},
 	}
 
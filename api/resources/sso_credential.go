@@ -0,0 +1,110 @@
+package resources
+
+import (
+	"github.com/kalmhq/kalm/api/auth_proxy"
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/kalmhq/kalm/controller/controllers"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SSOCredentials are kept in the dex namespace, only their hashes are saved.
+type SSOCredential struct {
+	Name              string                     `json:"name"`
+	Type              v1alpha1.SSOCredentialType `json:"type"`
+	Scopes            []string                   `json:"scopes"`
+	ExpiresAt         *metaV1.Time               `json:"expiresAt,omitempty"`
+	Creator           string                     `json:"creator,omitempty"`
+	LastUsedTimestamp int                        `json:"lastUsedTimestamp"`
+	UsedCount         int                        `json:"usedCount"`
+
+	// Secrets are only returned once when the credential is created
+	APIKey       string `json:"apiKey,omitempty"`
+	ClientID     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
+
+// SSOCredentialRequest is the body of creating a credential, the creator is set from the authenticated user.
+type SSOCredentialRequest struct {
+	Name      string                     `json:"name"`
+	Type      v1alpha1.SSOCredentialType `json:"type"`
+	Scopes    []string                   `json:"scopes"`
+	ExpiresAt *metaV1.Time               `json:"expiresAt,omitempty"`
+}
+
+func BuildSSOCredentialFromResource(credential *v1alpha1.SSOCredential) *SSOCredential {
+	return &SSOCredential{
+		Name:              credential.Name,
+		Type:              credential.Spec.Type,
+		Scopes:            credential.Spec.Scopes,
+		ExpiresAt:         credential.Spec.ExpiresAt,
+		Creator:           credential.Spec.Creator,
+		LastUsedTimestamp: credential.Status.LastUsedTimestamp,
+		UsedCount:         credential.Status.UsedCount,
+	}
+}
+
+func (builder *Builder) GetSSOCredentials() ([]SSOCredential, error) {
+	var credentialList v1alpha1.SSOCredentialList
+
+	if err := builder.List(&credentialList, client.InNamespace(controllers.KALM_DEX_NAMESPACE)); err != nil {
+		return nil, err
+	}
+
+	rst := make([]SSOCredential, len(credentialList.Items))
+
+	for i := range credentialList.Items {
+		rst[i] = *BuildSSOCredentialFromResource(&credentialList.Items[i])
+	}
+
+	return rst, nil
+}
+
+func (builder *Builder) CreateSSOCredential(credential *SSOCredentialRequest, creator string) (*SSOCredential, error) {
+	secret, secretHash, err := auth_proxy.GenerateCredentialSecret()
+
+	if err != nil {
+		return nil, err
+	}
+
+	resCredential := &v1alpha1.SSOCredential{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      credential.Name,
+			Namespace: controllers.KALM_DEX_NAMESPACE,
+		},
+		Spec: v1alpha1.SSOCredentialSpec{
+			Type:       credential.Type,
+			Scopes:     credential.Scopes,
+			SecretHash: secretHash,
+			ExpiresAt:  credential.ExpiresAt,
+			Creator:    creator,
+		},
+	}
+
+	if err := builder.Create(resCredential); err != nil {
+		return nil, err
+	}
+
+	rst := BuildSSOCredentialFromResource(resCredential)
+
+	switch resCredential.Spec.Type {
+	case v1alpha1.SSOCredentialTypeAPIKey:
+		rst.APIKey = auth_proxy.FormatAPIKey(resCredential.Name, secret)
+	case v1alpha1.SSOCredentialTypeClientCredentials:
+		rst.ClientID = resCredential.Name
+		rst.ClientSecret = secret
+	}
+
+	return rst, nil
+}
+
+func (builder *Builder) DeleteSSOCredential(name string) error {
+	return builder.Delete(
+		&v1alpha1.SSOCredential{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      name,
+				Namespace: controllers.KALM_DEX_NAMESPACE,
+			},
+		},
+	)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	"net"
 	"net/http"
+	"net/url"
 )
 
 func isTest() bool {
@@ -61,10 +62,26 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 	return cv.Validator.Struct(i)
 }
 
+// webhook receivers accept tokens in the query, which are never logged
+func getLoggedURI(u *url.URL) string {
+	query := u.Query()
+
+	if query.Get("token") == "" {
+		return u.String()
+	}
+
+	query.Set("token", "REDACTED")
+
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+
+	return redacted.String()
+}
+
 func middlewareLogging(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		if c != nil {
-			log.Info("receive request", "method", c.Request().Method, "uri", c.Request().URL.String(), "ip", c.RealIP())
+			log.Info("receive request", "method", c.Request().Method, "uri", getLoggedURI(c.Request().URL), "ip", c.RealIP())
 		} else {
 			log.Info("receive request bad request")
 		}
@@ -13,6 +13,7 @@ const (
 	EnvVarTypeLinked   EnvVarType = "linked"
 	EnvVarTypeFieldRef EnvVarType = "fieldref"
 	EnvVarTypeBuiltin  EnvVarType = "builtin"
+	EnvVarTypeSecret   EnvVarType = "secret"
 
 	EnvVarBuiltinHost      string = "host"
 	EnvVarBuiltinPodName   string = "podName"
@@ -39,9 +40,10 @@ type EnvVar struct {
 	// +kubebuilder:validation:MinLength=1
 	Name string `json:"name"`
 
+	// For secret type, the value must be empty, it is stored in the secret of the component.
 	Value string `json:"value,omitempty"`
 
-	// +kubebuilder:validation:Enum=static;external;linked;fieldref;builtin
+	// +kubebuilder:validation:Enum=static;external;linked;fieldref;builtin;secret
 	Type EnvVarType `json:"type,omitempty"`
 
 	Prefix string `json:"prefix,omitempty"`
@@ -0,0 +1,66 @@
+package v1alpha1
+
+import (
+	"crypto/md5"
+	"fmt"
+)
+
+// The values of secret envs and the contents of secret pre-injected files are never saved in the component.
+// They are kept in a secret owned by the component, clients write them there directly.
+
+// ComponentSecretName returns the name of the secret of the component.
+func ComponentSecretName(componentName string) string {
+	return componentName + "-secret"
+}
+
+// ComponentSecretEnvKey returns the key of a secret env in the secret of the component.
+// Envs of the main container (containerName is empty) use their names, so they can be managed out of band easily.
+func ComponentSecretEnvKey(containerName, envName string) string {
+	if containerName == "" {
+		return envName
+	}
+
+	return fmt.Sprintf("%s.%s", containerName, envName)
+}
+
+// ComponentSecretFileKey returns the key of a secret pre-injected file in the secret of the component.
+func ComponentSecretFileKey(mountPath string) string {
+	return fmt.Sprintf("file.%x", md5.Sum([]byte(mountPath)))
+}
+
+func hasSecretEnv(envs []EnvVar) bool {
+	for _, env := range envs {
+		if env.Type == EnvVarTypeSecret {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasSecretPreInjectedFile(files []PreInjectFile) bool {
+	for _, file := range files {
+		if file.Secret {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsComponentSecretNeeded returns true if any secret env or secret pre-injected file of the component is kept in its secret.
+func IsComponentSecretNeeded(component *Component) bool {
+	if hasSecretEnv(component.Spec.Env) || hasSecretPreInjectedFile(component.Spec.PreInjectedFiles) {
+		return true
+	}
+
+	for _, containers := range [][]Container{component.Spec.InitContainers, component.Spec.Sidecars} {
+		for _, container := range containers {
+			if hasSecretEnv(container.Env) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -18,6 +18,7 @@ package v1alpha1
 import (
 	apps1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -36,6 +37,177 @@ type PreInjectFile struct {
 	Readonly bool `json:"readonly,omitempty"`
 
 	Runnable bool `json:"runnable"`
+
+	// If true, the content must be empty, the file is stored in the secret of the component.
+	Secret bool `json:"secret,omitempty"`
+}
+
+type ContainerPort struct {
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:validation:Minimum=1
+	ContainerPort uint32 `json:"containerPort"`
+
+	// +kubebuilder:validation:Enum=http;https;http2;grpc;grpc-web;tcp;udp;unknown
+	Protocol PortProtocol `json:"protocol,omitempty"`
+}
+
+type ContainerVolumeMount struct {
+	// Path of the volume in spec.volumes to mount.
+	// +kubebuilder:validation:MinLength=1
+	Volume string `json:"volume"`
+
+	// Where to mount the volume in the container, defaults to the path of the volume.
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	ReadOnly bool `json:"readOnly,omitempty"`
+}
+
+// Container is an init container or a sidecar running next to the main container of a component.
+type Container struct {
+	// Must be unique in the pod, and not the same as the component name.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:MinLength=1
+	Image string `json:"image"`
+
+	// Same as the command of the component, a command with spaces is run by sh -c.
+	Command string `json:"command,omitempty"`
+
+	Env []EnvVar `json:"env,omitempty"`
+
+	Ports []ContainerPort `json:"ports,omitempty"`
+
+	// Not supported by init containers.
+	// +optional
+	LivenessProbe *v1.Probe `json:"livenessProbe,omitempty"`
+
+	// Not supported by init containers.
+	// +optional
+	ReadinessProbe *v1.Probe `json:"readinessProbe,omitempty"`
+
+	// +optional
+	ResourceRequirements *v1.ResourceRequirements `json:"resourceRequirements,omitempty"`
+
+	// +optional
+	VolumeMounts []ContainerVolumeMount `json:"volumeMounts,omitempty"`
+}
+
+const (
+	// Run the new version in a canary deployment next to the stable one,
+	// and shift traffic to it step by step.
+	RestartStrategyCanary apps1.DeploymentStrategyType = "Canary"
+
+	// Bring up the new version completely, then switch all traffic to it at once.
+	RestartStrategyBlueGreen apps1.DeploymentStrategyType = "BlueGreen"
+)
+
+type RolloutStep struct {
+	// Percentage of the traffic routed to the canary during this step.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int `json:"weight"`
+
+	// How long to stay at this step before moving on to the next one.
+	// +kubebuilder:validation:Minimum=0
+	PauseSeconds int `json:"pauseSeconds"`
+}
+
+type ProgressiveRollout struct {
+	// Traffic shifting schedule, the new version is promoted after the last step.
+	// BlueGreen only uses the pause of the first step, all traffic is switched at once.
+	// +optional
+	Steps []RolloutStep `json:"steps,omitempty"`
+
+	// Replicas of the canary deployment. BlueGreen always uses the replicas of the component.
+	// +optional
+	CanaryReplicas *int32 `json:"canaryReplicas,omitempty"`
+
+	// The rollout is aborted if the canary is not ready within this deadline.
+	// +optional
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+
+	// Set to true to abort the current rollout and shift all traffic back to the stable version.
+	// While it is set, new rollouts are aborted as well.
+	// +optional
+	Abort bool `json:"abort,omitempty"`
+}
+
+type AutoRollback struct {
+	// Roll back if the percentage of requests not answered with a 5xx status drops below this value.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MinSuccessRate *int `json:"minSuccessRate,omitempty"`
+
+	// Roll back if the 99th percentile latency exceeds this value.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxLatencyMilliseconds *int `json:"maxLatencyMilliseconds,omitempty"`
+
+	// How long the metrics are watched after the image is changed, 600 by default.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	AnalysisSeconds *int32 `json:"analysisSeconds,omitempty"`
+
+	// Thresholds are not checked while the component receives fewer requests than this,
+	// so a handful of failed requests doesn't trigger a rollback.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinRequestsPerMinute int `json:"minRequestsPerMinute,omitempty"`
+}
+
+type ImageUpdatePolicyType string
+
+const (
+	// the highest version tag in the range
+	ImageUpdatePolicyTypeSemver ImageUpdatePolicyType = "semver"
+	// the most recently pushed tag matching the regular expression
+	ImageUpdatePolicyTypeRegex ImageUpdatePolicyType = "regex"
+	// the most recently pushed tag
+	ImageUpdatePolicyTypeLatest ImageUpdatePolicyType = "latest"
+)
+
+type ImageUpdatePolicy struct {
+	// +kubebuilder:validation:Enum=semver;regex;latest
+	Type ImageUpdatePolicyType `json:"type"`
+
+	// A range like ">=1.2.0 <2.0.0" or "^1.2" for semver type, a regular expression for regex type.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+}
+
+type AutoscalingMetric struct {
+	// Name of a per pod metric served by the custom metrics API, e.g. http_requests_per_second.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Target value of the metric averaged across all pods, e.g. 100 or 500m.
+	TargetAverageValue resource.Quantity `json:"targetAverageValue"`
+}
+
+type Autoscaling struct {
+	// Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// Target average cpu usage, in percentage of the cpu request.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// Target average memory usage, in percentage of the memory request.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+
+	// +optional
+	CustomMetrics []AutoscalingMetric `json:"customMetrics,omitempty"`
 }
 
 // ComponentSpec defines the desired state of Component
@@ -52,8 +224,13 @@ type ComponentSpec struct {
 	// +kubebuilder:validation:MinLength=1
 	Image string `json:"image"`
 
+	// Ignored while autoscaling is set.
 	Replicas *int32 `json:"replicas,omitempty"`
 
+	// Scale the replicas of a server component with a HorizontalPodAutoscaler.
+	// +optional
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+
 	NodeSelectorLabels map[string]string `json:"nodeSelectorLabels,omitempty"`
 	PreferNotCoLocated bool              `json:"preferNotCoLocated,omitempty"`
 
@@ -98,12 +275,39 @@ type ComponentSpec struct {
 	// +kubebuilder:validation:Enum=Always;OnFailure;Never
 	RestartPolicy v1.RestartPolicy `json:"restartPolicy,omitempty"`
 
-	// +kubebuilder:validation:Enum=Recreate;RollingUpdate
+	// +kubebuilder:validation:Enum=Recreate;RollingUpdate;Canary;BlueGreen
 	RestartStrategy apps1.DeploymentStrategyType `json:"restartStrategy,omitempty"`
 
+	// Schedule of a Canary or BlueGreen rollout, ignored by other restart strategies.
+	// +optional
+	ProgressiveRollout *ProgressiveRollout `json:"progressiveRollout,omitempty"`
+
+	// Revert the image automatically if the istio metrics of the new image breach these thresholds.
+	// +optional
+	AutoRollback *AutoRollback `json:"autoRollback,omitempty"`
+
+	// Move the image forward when a qualifying tag is pushed to the repository of the image.
+	// The repository is polled by the DockerRegistry of its host.
+	// +optional
+	ImageUpdatePolicy *ImageUpdatePolicy `json:"imageUpdatePolicy,omitempty"`
+
+	// Run the image by the digest its tag points to when it's deployed, so pushing the tag again doesn't
+	// change pods started later. The digest is resolved with the credentials of the DockerRegistry of its host,
+	// and again when the spec is changed or the component is deployed by a webhook.
+	// +optional
+	PinImageDigest bool `json:"pinImageDigest,omitempty"`
+
 	// +optional
 	Volumes []Volume `json:"volumes,omitempty"`
 
+	// Run in order before the main container is started, e.g. to migrate a database.
+	// +optional
+	InitContainers []Container `json:"initContainers,omitempty"`
+
+	// Run next to the main container in the same pod, e.g. a log shipper.
+	// +optional
+	Sidecars []Container `json:"sidecars,omitempty"`
+
 	RunnerPermission *RunnerPermission `json:"runnerPermission,omitempty"`
 
 	PreInjectedFiles []PreInjectFile `json:"preInjectedFiles,omitempty"`
@@ -118,13 +322,158 @@ type ComponentSpec struct {
 
 // ComponentStatus defines the observed state of Component
 type ComponentStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// The generation of the component spec that this status was computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	Conditions []ComponentCondition `json:"conditions,omitempty"`
+
+	// The digest of the image running in the most recently started pod, e.g. sha256:...
+	// +optional
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// +optional
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// Error of the last reconciliation, empty if the last reconciliation succeeded.
+	// +optional
+	LastReconcileError string `json:"lastReconcileError,omitempty"`
+
+	// State of the current, or last, Canary or BlueGreen rollout.
+	// +optional
+	Rollout *ComponentRolloutStatus `json:"rollout,omitempty"`
+
+	// State of the metrics analysis of spec.autoRollback.
+	// +optional
+	AutoRollback *ComponentAutoRollbackStatus `json:"autoRollback,omitempty"`
+
+	// The digest spec.image is pinned to by spec.pinImageDigest.
+	// +optional
+	PinnedImage *ComponentPinnedImage `json:"pinnedImage,omitempty"`
+}
+
+type ComponentPinnedImage struct {
+	// spec.image the digest is resolved from
+	Image string `json:"image"`
+
+	// e.g. sha256:...
+	Digest string `json:"digest"`
+
+	// The generation and the last-updated-by-webhook annotation of the component when the digest is resolved.
+	// It's resolved again if either of them changes.
+	Generation int64 `json:"generation"`
+
+	// +optional
+	WebhookUpdatedAt string `json:"webhookUpdatedAt,omitempty"`
+
+	ResolvedAt metav1.Time `json:"resolvedAt"`
+}
+
+type ComponentAutoRollbackStatus struct {
+	// The image under analysis, or the last image which passed the analysis.
+	Image string `json:"image,omitempty"`
+
+	// The image to revert to if the analysis of the current image fails.
+	// +optional
+	PreviousImage string `json:"previousImage,omitempty"`
+
+	// Set while the current image is being analysed.
+	// The analysis starts once all pods of the new revision are available.
+	// +optional
+	AnalysisStartedAt *metav1.Time `json:"analysisStartedAt,omitempty"`
+
+	// The image which was reverted by the last rollback.
+	// Cleared once a new image passes the analysis.
+	// +optional
+	RolledBackImage string `json:"rolledBackImage,omitempty"`
+
+	// +optional
+	RolledBackAt *metav1.Time `json:"rolledBackAt,omitempty"`
+
+	// Why the image was rolled back, e.g. which threshold was breached.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+type RolloutPhase string
+
+const (
+	RolloutPhaseProgressing RolloutPhase = "Progressing"
+	RolloutPhasePromoting   RolloutPhase = "Promoting"
+	RolloutPhaseSucceeded   RolloutPhase = "Succeeded"
+	RolloutPhaseAborted     RolloutPhase = "Aborted"
+)
+
+type ComponentRolloutStatus struct {
+	Phase RolloutPhase `json:"phase"`
+
+	// Hash of the pod template running in the stable deployment.
+	StableRevision string `json:"stableRevision,omitempty"`
+
+	// Hash of the pod template running in the canary deployment.
+	CanaryRevision string `json:"canaryRevision,omitempty"`
+
+	// Index of the current step in spec.progressiveRollout.steps.
+	CurrentStep int `json:"currentStep"`
+
+	// Percentage of the traffic currently routed to the canary.
+	CanaryWeight int `json:"canaryWeight"`
+
+	// +optional
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+
+	// +optional
+	StepStartedAt *metav1.Time `json:"stepStartedAt,omitempty"`
+
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+type ComponentConditionType string
+
+const (
+	// All desired replicas are updated and available.
+	ComponentConditionReady ComponentConditionType = "Ready"
+	// A rollout of the workload is in progress.
+	ComponentConditionProgressing ComponentConditionType = "Progressing"
+	// The workload can't make progress, or the last reconciliation failed.
+	ComponentConditionDegraded ComponentConditionType = "Degraded"
+	// The image was reverted because the metrics of the new image breached spec.autoRollback.
+	ComponentConditionRolledBack ComponentConditionType = "RolledBack"
+)
+
+type ComponentCondition struct {
+	// Type of the condition, one of ('Ready', 'Progressing', 'Degraded', 'RolledBack').
+	Type ComponentConditionType `json:"type"`
+
+	// Status of the condition, one of ('True', 'False', 'Unknown').
+	Status v1.ConditionStatus `json:"status"`
+
+	// Last time the condition transitioned from one status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a brief machine readable explanation for the condition's last
+	// transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the details of the last
+	// transition, complementing reason.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Workload",type="string",JSONPath=".spec.workloadType"
 // +kubebuilder:printcolumn:name="Image",type="string",JSONPath=".spec.image"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Ready Replicas",type="integer",JSONPath=".status.readyReplicas"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // Component is the Schema for the components API
@@ -18,11 +18,13 @@ package v1alpha1
 import (
 	//rbacvalidation "k8s.io/kubernetes/pkg/apis/rbac/validation"
 	"fmt"
+	"github.com/kalmhq/kalm/controller/utils/semver"
 	"github.com/robfig/cron"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	apimachineryval "k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"regexp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -33,6 +35,8 @@ import (
 var componentlog = logf.Log.WithName("component-resource")
 
 func (r *Component) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	imagePolicyReader = mgr.GetAPIReader()
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -77,16 +81,18 @@ var _ webhook.Validator = &Component{}
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type
 func (r *Component) ValidateCreate() error {
 	componentlog.Info("validate create", "name", r.Name)
-	return r.validate()
+	return r.validate(nil)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Component) ValidateUpdate(old runtime.Object) error {
 	componentlog.Info("validate update", "name", r.Name)
-	return r.validate()
+	oldComponent, _ := old.(*Component)
+	return r.validate(oldComponent)
 }
 
-func (r *Component) validate() error {
+// old is the component before the update, nil for creations
+func (r *Component) validate(old *Component) error {
 	var rst KalmValidateErrorList
 
 	rst = append(rst, r.validateEnvVarList()...)
@@ -97,6 +103,12 @@ func (r *Component) validate() error {
 	rst = append(rst, r.validateVolumeOfComponent()...)
 	rst = append(rst, r.validateRunnerPermission()...)
 	rst = append(rst, r.validatePreInjectedFiles()...)
+	rst = append(rst, r.validateProgressiveRollout()...)
+	rst = append(rst, r.validateAutoRollback()...)
+	rst = append(rst, r.validateImageUpdatePolicy()...)
+	rst = append(rst, r.validateAutoscaling()...)
+	rst = append(rst, r.validateExtraContainers()...)
+	rst = append(rst, r.validateImagePolicies(old)...)
 
 	if len(rst) == 0 {
 		return nil
@@ -197,11 +209,24 @@ func (r *Component) validateEnvVarList() (rst KalmValidateErrorList) {
 				Path: fmt.Sprintf(".spec.env[%d]", i),
 			})
 		}
+
+		rst = append(rst, validateEnvValue(env, fmt.Sprintf(".spec.env[%d].value", i))...)
 	}
 
 	return rst
 }
 
+func validateEnvValue(env EnvVar, path string) KalmValidateErrorList {
+	if env.Type == EnvVarTypeSecret && env.Value != "" {
+		return KalmValidateErrorList{{
+			Err:  "the value of a secret env should be written into the secret of the component, not the component",
+			Path: path,
+		}}
+	}
+
+	return nil
+}
+
 func (r *Component) validateResRequirement() (rst KalmValidateErrorList) {
 	resRequirement := r.Spec.ResourceRequirements
 	if resRequirement == nil {
@@ -238,8 +263,328 @@ func (r *Component) validatePreInjectedFiles() (rst KalmValidateErrorList) {
 				Path: fmt.Sprintf(".spec.preInjectedFiles[%d]", i),
 			})
 		}
+
+		if preInjectFile.Secret && preInjectFile.Content != "" {
+			rst = append(rst, KalmValidateError{
+				Err:  "the content of a secret file should be written into the secret of the component, not the component",
+				Path: fmt.Sprintf(".spec.preInjectedFiles[%d].content", i),
+			})
+		}
+	}
+
+	return rst
+}
+
+func (r *Component) validateProgressiveRollout() (rst KalmValidateErrorList) {
+	strategy := r.Spec.RestartStrategy
+	if strategy != RestartStrategyCanary && strategy != RestartStrategyBlueGreen {
+		return nil
+	}
+
+	if r.Spec.WorkloadType != WorkloadTypeServer && r.Spec.WorkloadType != "" {
+		rst = append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("restart strategy %s is only supported by server workload", strategy),
+			Path: ".spec.restartStrategy",
+		})
+	}
+
+	if r.Spec.ProgressiveRollout == nil {
+		return rst
+	}
+
+	for i, step := range r.Spec.ProgressiveRollout.Steps {
+		if step.Weight < 0 || step.Weight > 100 {
+			rst = append(rst, KalmValidateError{
+				Err:  "weight should be between 0 and 100",
+				Path: fmt.Sprintf(".spec.progressiveRollout.steps[%d].weight", i),
+			})
+		}
+
+		if step.PauseSeconds < 0 {
+			rst = append(rst, KalmValidateError{
+				Err:  isNegativeErrorMsg,
+				Path: fmt.Sprintf(".spec.progressiveRollout.steps[%d].pauseSeconds", i),
+			})
+		}
+	}
+
+	if replicas := r.Spec.ProgressiveRollout.CanaryReplicas; replicas != nil && *replicas < 1 {
+		rst = append(rst, KalmValidateError{
+			Err:  isNotPositiveErrorMsg,
+			Path: ".spec.progressiveRollout.canaryReplicas",
+		})
+	}
+
+	return rst
+}
+
+func (r *Component) validateAutoRollback() (rst KalmValidateErrorList) {
+	autoRollback := r.Spec.AutoRollback
+	if autoRollback == nil {
+		return nil
+	}
+
+	if autoRollback.MinSuccessRate == nil && autoRollback.MaxLatencyMilliseconds == nil {
+		rst = append(rst, KalmValidateError{
+			Err:  "at least one of minSuccessRate and maxLatencyMilliseconds should be set",
+			Path: ".spec.autoRollback",
+		})
+	}
+
+	// the metrics are collected by istio from the traffic of the component service
+	if len(r.Spec.Ports) == 0 {
+		rst = append(rst, KalmValidateError{
+			Err:  "auto rollback needs at least one port to collect metrics",
+			Path: ".spec.autoRollback",
+		})
+	}
+
+	if rate := autoRollback.MinSuccessRate; rate != nil && (*rate < 0 || *rate > 100) {
+		rst = append(rst, KalmValidateError{
+			Err:  "minSuccessRate should be between 0 and 100",
+			Path: ".spec.autoRollback.minSuccessRate",
+		})
+	}
+
+	if latency := autoRollback.MaxLatencyMilliseconds; latency != nil && *latency < 1 {
+		rst = append(rst, KalmValidateError{
+			Err:  isNotPositiveErrorMsg,
+			Path: ".spec.autoRollback.maxLatencyMilliseconds",
+		})
+	}
+
+	if seconds := autoRollback.AnalysisSeconds; seconds != nil && *seconds < 1 {
+		rst = append(rst, KalmValidateError{
+			Err:  isNotPositiveErrorMsg,
+			Path: ".spec.autoRollback.analysisSeconds",
+		})
+	}
+
+	if autoRollback.MinRequestsPerMinute < 0 {
+		rst = append(rst, KalmValidateError{
+			Err:  isNegativeErrorMsg,
+			Path: ".spec.autoRollback.minRequestsPerMinute",
+		})
+	}
+
+	return rst
+}
+
+func (r *Component) validateImageUpdatePolicy() (rst KalmValidateErrorList) {
+	policy := r.Spec.ImageUpdatePolicy
+	if policy == nil {
+		return nil
+	}
+
+	var err error
+
+	switch policy.Type {
+	case ImageUpdatePolicyTypeSemver:
+		_, err = semver.ParseRange(policy.Pattern)
+	case ImageUpdatePolicyTypeRegex:
+		if policy.Pattern == "" {
+			err = fmt.Errorf("pattern should not be empty")
+		} else {
+			_, err = regexp.Compile(policy.Pattern)
+		}
+	case ImageUpdatePolicyTypeLatest:
+	default:
+		rst = append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("unknown policy type: %s", policy.Type),
+			Path: ".spec.imageUpdatePolicy.type",
+		})
+	}
+
+	if err != nil {
+		rst = append(rst, KalmValidateError{
+			Err:  err.Error(),
+			Path: ".spec.imageUpdatePolicy.pattern",
+		})
+	}
+
+	return rst
+}
+
+func (r *Component) validateAutoscaling() (rst KalmValidateErrorList) {
+	autoscaling := r.Spec.Autoscaling
+	if autoscaling == nil {
+		return nil
+	}
+
+	if r.Spec.WorkloadType != WorkloadTypeServer && r.Spec.WorkloadType != "" {
+		rst = append(rst, KalmValidateError{
+			Err:  "autoscaling is only supported by server workload",
+			Path: ".spec.autoscaling",
+		})
+	}
+
+	if autoscaling.MaxReplicas < 1 {
+		rst = append(rst, KalmValidateError{
+			Err:  isNotPositiveErrorMsg,
+			Path: ".spec.autoscaling.maxReplicas",
+		})
+	}
+
+	if minReplicas := autoscaling.MinReplicas; minReplicas != nil {
+		if *minReplicas < 1 {
+			rst = append(rst, KalmValidateError{
+				Err:  isNotPositiveErrorMsg,
+				Path: ".spec.autoscaling.minReplicas",
+			})
+		} else if *minReplicas > autoscaling.MaxReplicas {
+			rst = append(rst, KalmValidateError{
+				Err:  "minReplicas should not be greater than maxReplicas",
+				Path: ".spec.autoscaling.minReplicas",
+			})
+		}
+	}
+
+	if target := autoscaling.TargetCPUUtilizationPercentage; target != nil && *target < 1 {
+		rst = append(rst, KalmValidateError{
+			Err:  isNotPositiveErrorMsg,
+			Path: ".spec.autoscaling.targetCPUUtilizationPercentage",
+		})
+	}
+
+	if target := autoscaling.TargetMemoryUtilizationPercentage; target != nil && *target < 1 {
+		rst = append(rst, KalmValidateError{
+			Err:  isNotPositiveErrorMsg,
+			Path: ".spec.autoscaling.targetMemoryUtilizationPercentage",
+		})
+	}
+
+	for i, metric := range autoscaling.CustomMetrics {
+		if metric.Name == "" {
+			rst = append(rst, KalmValidateError{
+				Err:  "metric name should not be empty",
+				Path: fmt.Sprintf(".spec.autoscaling.customMetrics[%d].name", i),
+			})
+		}
+
+		if metric.TargetAverageValue.Sign() <= 0 {
+			rst = append(rst, KalmValidateError{
+				Err:  isNotPositiveErrorMsg,
+				Path: fmt.Sprintf(".spec.autoscaling.customMetrics[%d].targetAverageValue", i),
+			})
+		}
+	}
+
+	return rst
+}
+
+// names of containers added to the pod by kalm and istio
+var reservedContainerNames = map[string]bool{
+	"inject-files": true,
+	"istio-init":   true,
+	"istio-proxy":  true,
+}
+
+func (r *Component) validateExtraContainers() (rst KalmValidateErrorList) {
+	volumePaths := make(map[string]bool)
+	for _, vol := range r.Spec.Volumes {
+		volumePaths[vol.Path] = true
+	}
+
+	names := map[string]bool{r.Name: true}
+
+	validateContainers := func(containers []Container, basePath string, isInitContainer bool) {
+		for i, container := range containers {
+			path := fmt.Sprintf("%s[%d]", basePath, i)
+
+			for _, err := range apimachineryval.IsDNS1123Label(container.Name) {
+				rst = append(rst, KalmValidateError{
+					Err:  err,
+					Path: path + ".name",
+				})
+			}
+
+			if names[container.Name] || reservedContainerNames[container.Name] {
+				rst = append(rst, KalmValidateError{
+					Err:  fmt.Sprintf("container name %s is already used", container.Name),
+					Path: path + ".name",
+				})
+			}
+			names[container.Name] = true
+
+			if container.Image == "" {
+				rst = append(rst, KalmValidateError{
+					Err:  "image should not be empty",
+					Path: path + ".image",
+				})
+			}
+
+			for j, env := range container.Env {
+				for _, err := range apimachineryval.IsCIdentifier(env.Name) {
+					rst = append(rst, KalmValidateError{
+						Err:  err,
+						Path: fmt.Sprintf("%s.env[%d]", path, j),
+					})
+				}
+
+				rst = append(rst, validateEnvValue(env, fmt.Sprintf("%s.env[%d].value", path, j))...)
+			}
+
+			for j, port := range container.Ports {
+				if port.ContainerPort < 1 || port.ContainerPort > 65535 {
+					rst = append(rst, KalmValidateError{
+						Err:  "containerPort should be between 1 and 65535",
+						Path: fmt.Sprintf("%s.ports[%d].containerPort", path, j),
+					})
+				}
+			}
+
+			if isInitContainer {
+				if container.LivenessProbe != nil || container.ReadinessProbe != nil {
+					rst = append(rst, KalmValidateError{
+						Err:  "probes are not supported by init containers",
+						Path: path,
+					})
+				}
+			} else {
+				if container.LivenessProbe != nil {
+					errs := validateProbe(container.LivenessProbe, field.NewPath(path+".livenessProbe"))
+					rst = append(rst, toKalmValidateErrors(errs)...)
+				}
+
+				if container.ReadinessProbe != nil {
+					errs := validateProbe(container.ReadinessProbe, field.NewPath(path+".readinessProbe"))
+					rst = append(rst, toKalmValidateErrors(errs)...)
+				}
+			}
+
+			if resRequirement := container.ResourceRequirements; resRequirement != nil {
+				for resName, quantity := range resRequirement.Limits {
+					errs := ValidateResourceQuantityValue(quantity, field.NewPath(path+".resourceRequirements.limits."+string(resName)), false)
+					rst = append(rst, toKalmValidateErrors(errs)...)
+				}
+
+				for resName, quantity := range resRequirement.Requests {
+					errs := ValidateResourceQuantityValue(quantity, field.NewPath(path+".resourceRequirements.requests."+string(resName)), false)
+					rst = append(rst, toKalmValidateErrors(errs)...)
+				}
+			}
+
+			for j, mount := range container.VolumeMounts {
+				if !volumePaths[mount.Volume] {
+					rst = append(rst, KalmValidateError{
+						Err:  fmt.Sprintf("volume %s is not defined in .spec.volumes", mount.Volume),
+						Path: fmt.Sprintf("%s.volumeMounts[%d].volume", path, j),
+					})
+				}
+
+				if mount.MountPath != "" && !strings.HasPrefix(mount.MountPath, "/") {
+					rst = append(rst, KalmValidateError{
+						Err:  "should start with: /",
+						Path: fmt.Sprintf("%s.volumeMounts[%d].mountPath", path, j),
+					})
+				}
+			}
+		}
 	}
 
+	validateContainers(r.Spec.InitContainers, ".spec.initContainers", true)
+	validateContainers(r.Spec.Sidecars, ".spec.sidecars", false)
+
 	return rst
 }
 
@@ -2,6 +2,8 @@ package v1alpha1
 
 import (
 	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"testing"
 )
@@ -27,7 +29,226 @@ func TestComponentValidate(t *testing.T) {
 
 	component.Default()
 
-	if component.validate() != nil {
+	if component.validate(nil) != nil {
 		t.Fatalf("component should be valid")
 	}
 }
+
+func TestComponentValidateProgressiveRollout(t *testing.T) {
+	component := Component{
+		ObjectMeta: ctrl.ObjectMeta{
+			Namespace: "kalm-system",
+			Name:      "kalm",
+		},
+		Spec: ComponentSpec{
+			Image:           "foo:bar",
+			RestartStrategy: RestartStrategyCanary,
+			ProgressiveRollout: &ProgressiveRollout{
+				Steps: []RolloutStep{
+					{Weight: 20, PauseSeconds: 60},
+					{Weight: 120, PauseSeconds: -1},
+				},
+			},
+		},
+	}
+
+	component.Default()
+
+	errs, ok := component.validate(nil).(KalmValidateErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expect 2 errors, got %v", errs)
+	}
+
+	component.Spec.ProgressiveRollout.Steps = component.Spec.ProgressiveRollout.Steps[:1]
+	if component.validate(nil) != nil {
+		t.Fatalf("component should be valid")
+	}
+
+	component.Spec.WorkloadType = WorkloadTypeCronjob
+	component.Spec.Schedule = "*/5 * * * *"
+	if component.validate(nil) == nil {
+		t.Fatalf("canary is not supported by cronjob")
+	}
+}
+
+func TestComponentValidateAutoRollback(t *testing.T) {
+	component := Component{
+		ObjectMeta: ctrl.ObjectMeta{
+			Namespace: "kalm-system",
+			Name:      "kalm",
+		},
+		Spec: ComponentSpec{
+			Image:        "foo:bar",
+			AutoRollback: &AutoRollback{},
+		},
+	}
+
+	component.Default()
+
+	errs, ok := component.validate(nil).(KalmValidateErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expect 2 errors, got %v", errs)
+	}
+
+	minSuccessRate := 95
+	component.Spec.AutoRollback.MinSuccessRate = &minSuccessRate
+	component.Spec.Ports = []Port{{ContainerPort: 8080, ServicePort: 80}}
+	if component.validate(nil) != nil {
+		t.Fatalf("component should be valid")
+	}
+
+	minSuccessRate = 101
+	if component.validate(nil) == nil {
+		t.Fatalf("minSuccessRate should be at most 100")
+	}
+}
+
+func TestComponentValidateImageUpdatePolicy(t *testing.T) {
+	component := Component{
+		ObjectMeta: ctrl.ObjectMeta{
+			Namespace: "kalm-system",
+			Name:      "kalm",
+		},
+		Spec: ComponentSpec{
+			Image:             "foo:1.0.0",
+			ImageUpdatePolicy: &ImageUpdatePolicy{Type: ImageUpdatePolicyTypeSemver, Pattern: "^1.0"},
+		},
+	}
+
+	component.Default()
+
+	if component.validate(nil) != nil {
+		t.Fatalf("component should be valid")
+	}
+
+	component.Spec.ImageUpdatePolicy.Pattern = ">=one"
+	if component.validate(nil) == nil {
+		t.Fatalf("semver range should be invalid")
+	}
+
+	component.Spec.ImageUpdatePolicy = &ImageUpdatePolicy{Type: ImageUpdatePolicyTypeRegex, Pattern: "^release-("}
+	if component.validate(nil) == nil {
+		t.Fatalf("regular expression should be invalid")
+	}
+
+	component.Spec.ImageUpdatePolicy = &ImageUpdatePolicy{Type: ImageUpdatePolicyTypeLatest}
+	if component.validate(nil) != nil {
+		t.Fatalf("component should be valid")
+	}
+}
+
+func TestComponentValidateAutoscaling(t *testing.T) {
+	minReplicas := int32(3)
+
+	component := Component{
+		ObjectMeta: ctrl.ObjectMeta{
+			Namespace: "kalm-system",
+			Name:      "kalm",
+		},
+		Spec: ComponentSpec{
+			Image: "foo:bar",
+			Autoscaling: &Autoscaling{
+				MinReplicas: &minReplicas,
+				MaxReplicas: 2,
+				CustomMetrics: []AutoscalingMetric{
+					{Name: "http_requests_per_second"},
+				},
+			},
+		},
+	}
+
+	component.Default()
+
+	errs, ok := component.validate(nil).(KalmValidateErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expect 2 errors, got %v", errs)
+	}
+
+	component.Spec.Autoscaling.MaxReplicas = 5
+	component.Spec.Autoscaling.CustomMetrics[0].TargetAverageValue = resource.MustParse("100")
+	if component.validate(nil) != nil {
+		t.Fatalf("component should be valid")
+	}
+
+	component.Spec.WorkloadType = WorkloadTypeDaemonSet
+	if component.validate(nil) == nil {
+		t.Fatalf("autoscaling is not supported by daemonset")
+	}
+}
+
+func TestComponentValidateExtraContainers(t *testing.T) {
+	component := Component{
+		ObjectMeta: ctrl.ObjectMeta{
+			Namespace: "kalm-system",
+			Name:      "kalm",
+		},
+		Spec: ComponentSpec{
+			Image: "foo:bar",
+			Volumes: []Volume{
+				{Path: "/data", Type: VolumeTypeTemporaryDisk, Size: resource.MustParse("1Gi")},
+			},
+			InitContainers: []Container{
+				{
+					Name:           "migrate",
+					Image:          "foo:bar",
+					ReadinessProbe: &v1.Probe{},
+				},
+			},
+			Sidecars: []Container{
+				{
+					Name:  "kalm",
+					Image: "fluent-bit",
+					VolumeMounts: []ContainerVolumeMount{
+						{Volume: "/logs"},
+					},
+				},
+			},
+		},
+	}
+
+	component.Default()
+
+	errs, ok := component.validate(nil).(KalmValidateErrorList)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expect 3 errors, got %v", errs)
+	}
+
+	component.Spec.InitContainers[0].ReadinessProbe = nil
+	component.Spec.Sidecars[0].Name = "log-shipper"
+	component.Spec.Sidecars[0].VolumeMounts[0] = ContainerVolumeMount{Volume: "/data", MountPath: "/var/log/app", ReadOnly: true}
+	if errs := component.validate(nil); errs != nil {
+		t.Fatalf("component should be valid, got %v", errs)
+	}
+}
+
+func TestComponentValidateSecretValues(t *testing.T) {
+	component := Component{
+		ObjectMeta: ctrl.ObjectMeta{
+			Namespace: "kalm-system",
+			Name:      "kalm",
+		},
+		Spec: ComponentSpec{
+			Image: "foo:bar",
+			Env: []EnvVar{
+				{Name: "DB_PASSWORD", Value: "s3cret", Type: EnvVarTypeSecret},
+			},
+			PreInjectedFiles: []PreInjectFile{
+				{MountPath: "/etc/tls/tls.key", Content: "a2V5", Base64: true, Secret: true},
+			},
+		},
+	}
+
+	component.Default()
+
+	errs, ok := component.validate(nil).(KalmValidateErrorList)
+	if !ok || len(errs) != 2 || errs[0].Path != ".spec.env[0].value" || errs[1].Path != ".spec.preInjectedFiles[0].content" {
+		t.Fatalf("expect 2 secret value errors, got %v", errs)
+	}
+
+	// values are kept in the secret of the component
+	component.Spec.Env[0].Value = ""
+	component.Spec.PreInjectedFiles[0].Content = ""
+	if errs := component.validate(nil); errs != nil {
+		t.Fatalf("component should be valid, got %v", errs)
+	}
+}
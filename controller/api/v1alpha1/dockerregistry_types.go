@@ -19,10 +19,26 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// +kubebuilder:validation:Enum=ecr;gcr;acr
+type DockerRegistryCredentialHelper string
+
+const (
+	// exchanges awsAccessKeyId and awsSecretAccessKey for an ECR authorization token
+	DockerRegistryCredentialHelperECR DockerRegistryCredentialHelper = "ecr"
+	// exchanges the serviceAccountKey json for a google oauth2 access token
+	DockerRegistryCredentialHelperGCR DockerRegistryCredentialHelper = "gcr"
+	// exchanges tenantId, clientId and clientSecret of a service principal for an ACR refresh token
+	DockerRegistryCredentialHelperACR DockerRegistryCredentialHelper = "acr"
+)
+
 // DockerRegistrySpec defines the desired state of DockerRegistry
 type DockerRegistrySpec struct {
 	Host                   string `json:"host,omitempty"`
 	PoolingIntervalSeconds *int   `json:"poolingIntervalSeconds,omitempty"`
+
+	// Credentials in the authentication secret are exchanged for short-lived ones by the helper.
+	// Without it, the secret has a .dockerconfigjson, a token, or a username and a password.
+	CredentialHelper DockerRegistryCredentialHelper `json:"credentialHelper,omitempty"`
 }
 
 type RepositoryTag struct {
@@ -41,6 +57,9 @@ type Repository struct {
 type DockerRegistryStatus struct {
 	AuthenticationVerified bool          `json:"authenticationVerified,omitempty"`
 	Repositories           []*Repository `json:"repositories,omitempty"`
+
+	// short-lived credentials of the credential helper are refreshed before this time
+	CredentialsExpireAt *metav1.Time `json:"credentialsExpireAt,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -72,6 +72,14 @@ func (r *DockerRegistry) validate() error {
 		}
 	}
 
+	// tokens are issued for a specific registry
+	if r.Spec.CredentialHelper != "" && r.Spec.Host == "" {
+		rst = append(rst, KalmValidateError{
+			Err:  "host is required by the credential helper",
+			Path: "spec.host",
+		})
+	}
+
 	intervalSec := r.Spec.PoolingIntervalSeconds
 	if intervalSec != nil {
 		if *intervalSec <= 0 {
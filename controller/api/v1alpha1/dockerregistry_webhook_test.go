@@ -21,4 +21,12 @@ func TestDockerRegistry_Validate(t *testing.T) {
 	// invalid registry url
 	dockerRegistry.Spec.Host = "/invalid/url"
 	assert.NotNil(t, dockerRegistry.validate())
+
+	// credential helper without host
+	dockerRegistry.Spec.Host = ""
+	dockerRegistry.Spec.CredentialHelper = DockerRegistryCredentialHelperECR
+	assert.NotNil(t, dockerRegistry.validate())
+
+	dockerRegistry.Spec.Host = "https://123456789012.dkr.ecr.us-west-2.amazonaws.com"
+	assert.Nil(t, dockerRegistry.validate())
 }
@@ -0,0 +1,108 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GitSourceSpec defines the desired state of GitSource
+type GitSourceSpec struct {
+	// https://, ssh:// or git@host:path url of the repository
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// +optional
+	Branch string `json:"branch,omitempty"`
+
+	// directory in the repository to read resources from, the root if empty
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// name of a secret in kalm-system namespace.
+	// It has sshPrivateKey and knownHosts keys for ssh urls, knownHosts is required to check the host key.
+	// Or username and password keys for https urls.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Minimum=10
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+
+	// delete resources that are removed from the repository
+	// +optional
+	Prune bool `json:"prune,omitempty"`
+}
+
+// GitSourceResource is a resource applied from the repository.
+type GitSourceResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// GitSourceStatus defines the observed state of GitSource
+type GitSourceStatus struct {
+	// the last synced commit
+	// +optional
+	Revision string `json:"revision,omitempty"`
+
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// error of the last sync, empty if it succeeded
+	// +optional
+	Error string `json:"error,omitempty"`
+
+	// resources applied by the last successful sync
+	// +optional
+	Resources []GitSourceResource `json:"resources,omitempty"`
+
+	// resources that were changed in the cluster since the last sync, and are restored
+	// +optional
+	Drifted []GitSourceResource `json:"drifted,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="URL",type="string",JSONPath=".spec.url"
+// +kubebuilder:printcolumn:name="Revision",type="string",JSONPath=".status.revision"
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.error"
+
+// GitSource is the Schema for the gitsources API
+type GitSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GitSourceSpec   `json:"spec,omitempty"`
+	Status GitSourceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// GitSourceList contains a list of GitSource
+type GitSourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GitSource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GitSource{}, &GitSourceList{})
+}
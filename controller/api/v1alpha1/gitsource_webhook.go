@@ -0,0 +1,175 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var gitsourcelog = logf.Log.WithName("gitsource-resource")
+
+func (r *GitSource) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-core-kalm-dev-v1alpha1-gitsource,mutating=true,failurePolicy=fail,groups=core.kalm.dev,resources=gitsources,verbs=create;update,versions=v1alpha1,name=mgitsource.kb.io
+
+var _ webhook.Defaulter = &GitSource{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *GitSource) Default() {
+	gitsourcelog.Info("default", "name", r.Name)
+
+	if r.Spec.Branch == "" {
+		r.Spec.Branch = "master"
+	}
+
+	if r.Spec.IntervalSeconds == 0 {
+		r.Spec.IntervalSeconds = 60
+	}
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-core-kalm-dev-v1alpha1-gitsource,mutating=false,failurePolicy=fail,groups=core.kalm.dev,resources=gitsources,versions=v1alpha1,name=vgitsource.kb.io
+
+var _ webhook.Validator = &GitSource{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *GitSource) ValidateCreate() error {
+	gitsourcelog.Info("validate create", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *GitSource) ValidateUpdate(old runtime.Object) error {
+	gitsourcelog.Info("validate update", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *GitSource) ValidateDelete() error {
+	gitsourcelog.Info("validate delete", "name", r.Name)
+	return nil
+}
+
+// user@host:path, the user and the host can't start with "-", or ssh takes them as options
+var scpLikeGitURLRegex = regexp.MustCompile(`^[\w.][\w.-]*@[\w.][\w.-]*:[^\s]+$`)
+
+// IsValidGitURL only allows remote repositories. file://, ext:: and local paths are rejected,
+// they read files of the controller or run commands on it.
+func IsValidGitURL(url string) bool {
+	for _, prefix := range []string{"https://", "http://", "ssh://"} {
+		if !strings.HasPrefix(url, prefix) || len(url) == len(prefix) {
+			continue
+		}
+
+		rest := url[len(prefix):]
+
+		// ssh://-oProxyCommand=... is taken as an option of ssh
+		return !strings.HasPrefix(rest, "-") && strings.IndexFunc(rest, isGitInvalidChar) < 0
+	}
+
+	return scpLikeGitURLRegex.MatchString(url)
+}
+
+func isGitInvalidChar(c rune) bool {
+	return c <= ' ' || c == 0x7f
+}
+
+// IsValidGitBranch follows the rules of git check-ref-format --branch,
+// and rejects names starting with "-", which git takes as options.
+func IsValidGitBranch(branch string) bool {
+	if branch == "" || branch == "@" || strings.HasPrefix(branch, "-") {
+		return false
+	}
+
+	if strings.HasPrefix(branch, "/") || strings.HasSuffix(branch, "/") || strings.HasSuffix(branch, ".") {
+		return false
+	}
+
+	for _, seq := range []string{"..", "//", "@{"} {
+		if strings.Contains(branch, seq) {
+			return false
+		}
+	}
+
+	if strings.IndexFunc(branch, func(c rune) bool {
+		return isGitInvalidChar(c) || strings.ContainsRune("~^:?*[\\", c)
+	}) >= 0 {
+		return false
+	}
+
+	for _, part := range strings.Split(branch, "/") {
+		if strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *GitSource) validate() error {
+	var rst KalmValidateErrorList
+
+	if !IsValidGitURL(r.Spec.URL) {
+		rst = append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("invalid git url: %s, only https://, http://, ssh:// and user@host:path urls are allowed", r.Spec.URL),
+			Path: "spec.url",
+		})
+	}
+
+	if r.Spec.Branch != "" && !IsValidGitBranch(r.Spec.Branch) {
+		rst = append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("invalid branch: %s", r.Spec.Branch),
+			Path: "spec.branch",
+		})
+	}
+
+	for _, part := range strings.Split(r.Spec.Path, "/") {
+		if part == ".." {
+			rst = append(rst, KalmValidateError{
+				Err:  "should be in the repository",
+				Path: "spec.path",
+			})
+
+			break
+		}
+	}
+
+	if r.Spec.IntervalSeconds < 0 {
+		rst = append(rst, KalmValidateError{
+			Err:  isNegativeErrorMsg,
+			Path: "spec.intervalSeconds",
+		})
+	}
+
+	if len(rst) == 0 {
+		return nil
+	}
+
+	return rst
+}
@@ -0,0 +1,67 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestGitSource_webhook(t *testing.T) {
+	source := GitSource{
+		ObjectMeta: ctrl.ObjectMeta{
+			Name: "apps",
+		},
+		Spec: GitSourceSpec{
+			URL:  "git@github.com:kalmhq/apps.git",
+			Path: "production",
+		},
+	}
+
+	source.Default()
+	assert.Equal(t, "master", source.Spec.Branch)
+	assert.Equal(t, 60, source.Spec.IntervalSeconds)
+	assert.Nil(t, source.validate())
+
+	for _, url := range []string{"https://github.com/kalmhq/apps.git", "ssh://git@github.com/kalmhq/apps.git"} {
+		source.Spec.URL = url
+		assert.Nil(t, source.validate(), url)
+	}
+
+	for _, url := range []string{
+		"", "github.com/kalmhq/apps", "https://",
+		// local repositories and commands
+		"file:///srv/git/apps.git", "/srv/git/apps.git", "ext::sh -c touch% /tmp/pwned",
+		// options of ssh
+		"ssh://-oProxyCommand=touch /tmp/pwned/apps.git", "-oProxyCommand=touch@host:apps.git", "git@-oProxyCommand=touch:apps.git",
+	} {
+		source.Spec.URL = url
+		assert.NotNil(t, source.validate(), url)
+	}
+
+	source.Spec.URL = "https://github.com/kalmhq/apps.git"
+
+	for _, branch := range []string{"master", "release/v1.0", "feature-x"} {
+		source.Spec.Branch = branch
+		assert.Nil(t, source.validate(), branch)
+	}
+
+	for _, branch := range []string{
+		"--upload-pack=touch /tmp/PWNED; git-upload-pack", "-x",
+		"a..b", "a b", "a:b", "refs/heads/*", ".hidden", "a.lock", "a/", "a//b", "a@{1}", "@",
+	} {
+		source.Spec.Branch = branch
+		errs, ok := source.validate().(KalmValidateErrorList)
+		assert.True(t, ok, branch)
+		assert.Equal(t, "spec.branch", errs[0].Path)
+	}
+
+	source.Spec.Branch = "master"
+
+	source.Spec.URL = "https://github.com/kalmhq/apps.git"
+	source.Spec.Path = "production/../../etc"
+	errs, ok := source.validate().(KalmValidateErrorList)
+	assert.True(t, ok)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.path", errs[0].Path)
+}
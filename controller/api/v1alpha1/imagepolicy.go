@@ -0,0 +1,335 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultImageScannerTimeoutSeconds = 5
+
+	// All scans of an admission request are done in this time, admission webhooks time out in 30 seconds.
+	imageScanTotalTimeout = 15 * time.Second
+)
+
+// +kubebuilder:rbac:groups=core.kalm.dev,resources=imagepolicies,verbs=get;list;watch
+
+// set up with the component webhook. Without it, image policies are not checked.
+var imagePolicyReader client.Reader
+
+var imageScannerClient = &http.Client{}
+
+var imageVulnerabilitySeverityRanks = map[ImageVulnerabilitySeverity]int{
+	ImageVulnerabilitySeverityNone:     -1,
+	ImageVulnerabilitySeverityLow:      1,
+	ImageVulnerabilitySeverityMedium:   2,
+	ImageVulnerabilitySeverityHigh:     3,
+	ImageVulnerabilitySeverityCritical: 4,
+}
+
+// ImageVulnerability is a vulnerability in the scan report of an image.
+type ImageVulnerability struct {
+	ID       string `json:"id"`
+	Package  string `json:"package,omitempty"`
+	Severity string `json:"severity"`
+}
+
+type ImageScanReport struct {
+	Vulnerabilities []ImageVulnerability `json:"vulnerabilities"`
+}
+
+// unknown and negligible ones are ranked 0
+func getImageVulnerabilitySeverityRank(severity string) int {
+	rank := imageVulnerabilitySeverityRanks[ImageVulnerabilitySeverity(strings.ToLower(severity))]
+
+	if rank < 0 {
+		return 0
+	}
+
+	return rank
+}
+
+func (p *ImagePolicy) appliesTo(namespace string) bool {
+	if len(p.Spec.Namespaces) == 0 {
+		return true
+	}
+
+	for _, ns := range p.Spec.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAllowedRegistry returns whether the image is in one of the allowed registries.
+// Names are compared after normalization, so nginx is in docker.io and docker.io/library.
+func (p *ImagePolicy) isAllowedRegistry(named reference.Named) bool {
+	if len(p.Spec.AllowedRegistries) == 0 {
+		return true
+	}
+
+	name := named.Name()
+
+	for _, registry := range p.Spec.AllowedRegistries {
+		if u, err := url.Parse(registry); err == nil && u.Host != "" {
+			registry = u.Host + u.Path
+		}
+
+		registry = strings.TrimSuffix(registry, "/")
+
+		if name == registry || strings.HasPrefix(name, registry+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fetchImageScanReport(ctx context.Context, scanner *ImageScanner, image string) (*ImageScanReport, error) {
+	timeout := scanner.TimeoutSeconds
+
+	if timeout <= 0 {
+		timeout = defaultImageScannerTimeoutSeconds
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	u, err := url.Parse(scanner.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	query.Set("image", image)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := imageScannerClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scanner responds status %d", resp.StatusCode)
+	}
+
+	var report ImageScanReport
+
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("invalid scan report: %s", err)
+	}
+
+	return &report, nil
+}
+
+// checkSeverity returns the error of vulnerabilities more severe than the max severity.
+func (p *ImagePolicy) checkSeverity(ctx context.Context, image string) string {
+	if p.Spec.MaxSeverity == "" || p.Spec.Scanner == nil {
+		return ""
+	}
+
+	report, err := fetchImageScanReport(ctx, p.Spec.Scanner, image)
+
+	if err != nil {
+		if p.Spec.Scanner.FailClosed {
+			return fmt.Sprintf("image scanner of image policy %s is not available: %s", p.Name, err)
+		}
+
+		componentlog.Info("image scanner is not available, the image is allowed", "policy", p.Name, "image", image, "error", err.Error())
+
+		return ""
+	}
+
+	maxRank := imageVulnerabilitySeverityRanks[p.Spec.MaxSeverity]
+
+	var ids []string
+
+	for _, vulnerability := range report.Vulnerabilities {
+		if getImageVulnerabilitySeverityRank(vulnerability.Severity) > maxRank {
+			ids = append(ids, fmt.Sprintf("%s (%s)", vulnerability.ID, strings.ToLower(vulnerability.Severity)))
+		}
+	}
+
+	if len(ids) == 0 {
+		return ""
+	}
+
+	examples := ids
+
+	if len(examples) > 3 {
+		examples = examples[:3]
+	}
+
+	return fmt.Sprintf(
+		"image has %d vulnerabilities more severe than %s, such as %s, by image policy %s",
+		len(ids), p.Spec.MaxSeverity, strings.Join(examples, ", "), p.Name,
+	)
+}
+
+// check returns violations of the image, which is at the path of a component.
+func (p *ImagePolicy) check(ctx context.Context, image, path string) (rst KalmValidateErrorList) {
+	named, err := reference.ParseNormalizedNamed(image)
+
+	if err != nil {
+		// invalid images are reported by other validations
+		return nil
+	}
+
+	if !p.isAllowedRegistry(named) {
+		rst = append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("registry of %s is not allowed by image policy %s", named.Name(), p.Name),
+			Path: path,
+		})
+	}
+
+	_, isTagged := named.(reference.Tagged)
+	_, isDigested := named.(reference.Digested)
+
+	if p.Spec.DenyLatestTag && !isDigested && (!isTagged || named.(reference.Tagged).Tag() == "latest") {
+		rst = append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("latest tag is not allowed by image policy %s", p.Name),
+			Path: path,
+		})
+	}
+
+	if p.Spec.RequireDigest && !isDigested {
+		rst = append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("digest is required by image policy %s", p.Name),
+			Path: path,
+		})
+	}
+
+	// images not allowed anyway are not scanned
+	if len(rst) > 0 {
+		return rst
+	}
+
+	if msg := p.checkSeverity(ctx, image); msg != "" {
+		rst = append(rst, KalmValidateError{
+			Err:  msg,
+			Path: path,
+		})
+	}
+
+	return rst
+}
+
+type componentImageField struct {
+	image string
+	path  string
+}
+
+func (r *Component) getImageFields() []componentImageField {
+	images := []componentImageField{{r.Spec.Image, ".spec.image"}}
+
+	for i, container := range r.Spec.InitContainers {
+		images = append(images, componentImageField{container.Image, fmt.Sprintf(".spec.initContainers[%d].image", i)})
+	}
+
+	for i, container := range r.Spec.Sidecars {
+		images = append(images, componentImageField{container.Image, fmt.Sprintf(".spec.sidecars[%d].image", i)})
+	}
+
+	return images
+}
+
+// validateImagePolicies checks the images of the component, old is the component before the update, nil for creations.
+// Images in the old component are not checked again, the component can be updated after policies change.
+// Scans of all images run in parallel in imageScanTotalTimeout.
+func (r *Component) validateImagePolicies(old *Component) (rst KalmValidateErrorList) {
+	if imagePolicyReader == nil {
+		return nil
+	}
+
+	oldImages := make(map[string]bool)
+
+	if old != nil {
+		for _, field := range old.getImageFields() {
+			oldImages[field.image] = true
+		}
+	}
+
+	var images []componentImageField
+
+	for _, field := range r.getImageFields() {
+		if field.image != "" && !oldImages[field.image] {
+			images = append(images, field)
+		}
+	}
+
+	if len(images) == 0 {
+		return nil
+	}
+
+	var policyList ImagePolicyList
+
+	if err := imagePolicyReader.List(context.Background(), &policyList); err != nil {
+		return KalmValidateErrorList{{
+			Err:  fmt.Sprintf("list image policies failed: %s", err),
+			Path: ".spec.image",
+		}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), imageScanTotalTimeout)
+	defer cancel()
+
+	type imageCheck struct {
+		policy *ImagePolicy
+		field  componentImageField
+	}
+
+	var checks []imageCheck
+
+	for i := range policyList.Items {
+		policy := &policyList.Items[i]
+
+		if !policy.appliesTo(r.Namespace) {
+			continue
+		}
+
+		for _, field := range images {
+			checks = append(checks, imageCheck{policy, field})
+		}
+	}
+
+	results := make([]KalmValidateErrorList, len(checks))
+	var wg sync.WaitGroup
+
+	for i := range checks {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			results[i] = checks[i].policy.check(ctx, checks[i].field.image, checks[i].field.path)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, errs := range results {
+		rst = append(rst, errs...)
+	}
+
+	return rst
+}
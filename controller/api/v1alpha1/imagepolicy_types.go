@@ -0,0 +1,107 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:Enum=none;low;medium;high;critical
+type ImageVulnerabilitySeverity string
+
+const (
+	// no vulnerability is allowed
+	ImageVulnerabilitySeverityNone     ImageVulnerabilitySeverity = "none"
+	ImageVulnerabilitySeverityLow      ImageVulnerabilitySeverity = "low"
+	ImageVulnerabilitySeverityMedium   ImageVulnerabilitySeverity = "medium"
+	ImageVulnerabilitySeverityHigh     ImageVulnerabilitySeverity = "high"
+	ImageVulnerabilitySeverityCritical ImageVulnerabilitySeverity = "critical"
+)
+
+// ImageScanner is an http endpoint serving scan reports of images.
+// It's called with GET <url>?image=<image>, and responds a json like
+//
+//	{"vulnerabilities": [{"id": "CVE-2020-1234", "package": "openssl", "severity": "HIGH"}]}
+type ImageScanner struct {
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// scans of an admission request take 15 seconds at most in total
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+
+	// reject images when the scanner is not available, they are allowed by default
+	// +optional
+	FailClosed bool `json:"failClosed,omitempty"`
+}
+
+// ImagePolicySpec defines the desired state of ImagePolicy
+type ImagePolicySpec struct {
+	// namespaces of components the policy applies to, all namespaces if empty
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// registries, or repository prefixes in them, images can be pulled from. Any registry if empty.
+	// e.g. docker.io/kalmhq, gcr.io, localhost:5000/team
+	// +optional
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+
+	// reject images with the latest tag, or without a tag
+	// +optional
+	DenyLatestTag bool `json:"denyLatestTag,omitempty"`
+
+	// reject images without a digest, such as nginx@sha256:...
+	// +optional
+	RequireDigest bool `json:"requireDigest,omitempty"`
+
+	// reject images with vulnerabilities more severe than it in the scan report
+	// +optional
+	MaxSeverity ImageVulnerabilitySeverity `json:"maxSeverity,omitempty"`
+
+	// required by maxSeverity
+	// +optional
+	Scanner *ImageScanner `json:"scanner,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Deny-Latest",type="boolean",JSONPath=".spec.denyLatestTag"
+// +kubebuilder:printcolumn:name="Require-Digest",type="boolean",JSONPath=".spec.requireDigest"
+// +kubebuilder:printcolumn:name="Max-Severity",type="string",JSONPath=".spec.maxSeverity"
+
+// ImagePolicy is the Schema for the imagepolicies API.
+// Components are checked against all policies when they are created or updated.
+type ImagePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ImagePolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ImagePolicyList contains a list of ImagePolicy
+type ImagePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ImagePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ImagePolicy{}, &ImagePolicyList{})
+}
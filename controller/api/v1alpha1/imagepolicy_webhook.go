@@ -0,0 +1,92 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var imagepolicylog = logf.Log.WithName("imagepolicy-resource")
+
+func (r *ImagePolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-core-kalm-dev-v1alpha1-imagepolicy,mutating=false,failurePolicy=fail,groups=core.kalm.dev,resources=imagepolicies,versions=v1alpha1,name=vimagepolicy.kb.io
+
+var _ webhook.Validator = &ImagePolicy{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ImagePolicy) ValidateCreate() error {
+	imagepolicylog.Info("validate create", "name", r.Name)
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ImagePolicy) ValidateUpdate(old runtime.Object) error {
+	imagepolicylog.Info("validate update", "name", r.Name)
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ImagePolicy) ValidateDelete() error {
+	imagepolicylog.Info("validate delete", "name", r.Name)
+	return nil
+}
+
+func (r *ImagePolicy) validate() error {
+	var rst KalmValidateErrorList
+
+	for i, registry := range r.Spec.AllowedRegistries {
+		if registry == "" {
+			rst = append(rst, KalmValidateError{
+				Err:  "should not be empty",
+				Path: fmt.Sprintf(".spec.allowedRegistries[%d]", i),
+			})
+		}
+	}
+
+	if r.Spec.MaxSeverity != "" && r.Spec.Scanner == nil {
+		rst = append(rst, KalmValidateError{
+			Err:  "scanner is required by maxSeverity",
+			Path: ".spec.scanner",
+		})
+	}
+
+	if r.Spec.Scanner != nil {
+		if u, err := url.Parse(r.Spec.Scanner.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			rst = append(rst, KalmValidateError{
+				Err:  "should be a http or https url",
+				Path: ".spec.scanner.url",
+			})
+		}
+	}
+
+	if len(rst) == 0 {
+		return nil
+	}
+
+	return rst
+}
@@ -0,0 +1,180 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newImageScannerStub() *httptest.Server {
+	reports := map[string]ImageScanReport{
+		"nginx:1.19": {Vulnerabilities: []ImageVulnerability{
+			{ID: "CVE-2020-0001", Severity: "LOW"},
+			{ID: "CVE-2020-0002", Severity: "HIGH"},
+		}},
+		"nginx:1.20": {},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, exist := reports[r.URL.Query().Get("image")]
+
+		if !exist {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(report)
+	}))
+}
+
+func TestImagePolicy_Validate(t *testing.T) {
+	policy := ImagePolicy{
+		ObjectMeta: ctrl.ObjectMeta{Name: "test"},
+	}
+
+	assert.Nil(t, policy.validate())
+
+	policy.Spec.MaxSeverity = ImageVulnerabilitySeverityHigh
+	assert.NotNil(t, policy.validate())
+
+	policy.Spec.Scanner = &ImageScanner{URL: "scanner"}
+	assert.NotNil(t, policy.validate())
+
+	policy.Spec.Scanner.URL = "http://scanner.kalm-system/report"
+	assert.Nil(t, policy.validate())
+
+	policy.Spec.AllowedRegistries = []string{""}
+	assert.NotNil(t, policy.validate())
+}
+
+func TestImagePolicy_Check(t *testing.T) {
+	policy := ImagePolicy{
+		ObjectMeta: ctrl.ObjectMeta{Name: "test"},
+		Spec: ImagePolicySpec{
+			AllowedRegistries: []string{"docker.io/library", "https://gcr.io/kalm/", "localhost:5000"},
+			DenyLatestTag:     true,
+		},
+	}
+
+	assert.Len(t, policy.check(context.Background(), "nginx:1.19", ".spec.image"), 0)
+	assert.Len(t, policy.check(context.Background(), "gcr.io/kalm/echo:v1", ".spec.image"), 0)
+	assert.Len(t, policy.check(context.Background(), "localhost:5000/echo:v1", ".spec.image"), 0)
+	assert.Len(t, policy.check(context.Background(), "gcr.io/kalmhq/echo:v1", ".spec.image"), 1)
+	assert.Len(t, policy.check(context.Background(), "kalmhq/echo:v1", ".spec.image"), 1)
+
+	errs := policy.check(context.Background(), "nginx", ".spec.sidecars[0].image")
+	assert.Len(t, errs, 1)
+	assert.Equal(t, ".spec.sidecars[0].image", errs[0].Path)
+	assert.Len(t, policy.check(context.Background(), "nginx:latest", ".spec.image"), 1)
+	assert.Len(t, policy.check(context.Background(), "nginx@sha256:4f1ca21c0c4cf3a14b3f1e4e2b1f8c3c5e9f6d2e0b8e3f1c9d6a5b4c3d2e1f0a", ".spec.image"), 0)
+
+	policy.Spec.RequireDigest = true
+	assert.Len(t, policy.check(context.Background(), "nginx:1.19", ".spec.image"), 1)
+	assert.Len(t, policy.check(context.Background(), "nginx:1.19@sha256:4f1ca21c0c4cf3a14b3f1e4e2b1f8c3c5e9f6d2e0b8e3f1c9d6a5b4c3d2e1f0a", ".spec.image"), 0)
+}
+
+func TestImagePolicy_CheckSeverity(t *testing.T) {
+	server := newImageScannerStub()
+	defer server.Close()
+
+	policy := ImagePolicy{
+		ObjectMeta: ctrl.ObjectMeta{Name: "test"},
+		Spec: ImagePolicySpec{
+			MaxSeverity: ImageVulnerabilitySeverityMedium,
+			Scanner:     &ImageScanner{URL: server.URL + "/report"},
+		},
+	}
+
+	errs := policy.check(context.Background(), "nginx:1.19", ".spec.image")
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Err, "CVE-2020-0002 (high)")
+	assert.NotContains(t, errs[0].Err, "CVE-2020-0001")
+
+	assert.Len(t, policy.check(context.Background(), "nginx:1.20", ".spec.image"), 0)
+
+	policy.Spec.MaxSeverity = ImageVulnerabilitySeverityHigh
+	assert.Len(t, policy.check(context.Background(), "nginx:1.19", ".spec.image"), 0)
+
+	policy.Spec.MaxSeverity = ImageVulnerabilitySeverityNone
+	assert.Len(t, policy.check(context.Background(), "nginx:1.19", ".spec.image"), 1)
+
+	// no report
+	assert.Len(t, policy.check(context.Background(), "nginx:1.18", ".spec.image"), 0)
+
+	policy.Spec.Scanner.FailClosed = true
+	assert.Len(t, policy.check(context.Background(), "nginx:1.18", ".spec.image"), 1)
+}
+
+func TestComponentValidateImagePolicies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, AddToScheme(scheme))
+
+	imagePolicyReader = fake.NewFakeClientWithScheme(scheme, &ImagePolicy{
+		ObjectMeta: ctrl.ObjectMeta{Name: "production"},
+		Spec: ImagePolicySpec{
+			Namespaces:    []string{"production"},
+			DenyLatestTag: true,
+		},
+	})
+
+	defer func() {
+		imagePolicyReader = nil
+	}()
+
+	component := Component{
+		ObjectMeta: ctrl.ObjectMeta{Namespace: "production", Name: "web"},
+		Spec: ComponentSpec{
+			Image:    "nginx:1.19",
+			Sidecars: []Container{{Name: "proxy", Image: "envoyproxy/envoy"}},
+		},
+	}
+
+	errs := component.validateImagePolicies(nil)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, ".spec.sidecars[0].image", errs[0].Path)
+
+	// images not changed by updates are not checked again
+	old := component.DeepCopy()
+	component.Spec.Image = "nginx:1.20"
+	assert.Len(t, component.validateImagePolicies(old), 0)
+
+	component.Spec.InitContainers = []Container{{Name: "init", Image: "busybox"}}
+	errs = component.validateImagePolicies(old)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, ".spec.initContainers[0].image", errs[0].Path)
+
+	component.Namespace = "staging"
+	assert.Len(t, component.validateImagePolicies(nil), 0)
+}
+
+func TestComponentValidateImagePoliciesTimeout(t *testing.T) {
+	// the scanner never responds in time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	policy := ImagePolicy{
+		ObjectMeta: ctrl.ObjectMeta{Name: "test"},
+		Spec: ImagePolicySpec{
+			MaxSeverity: ImageVulnerabilitySeverityMedium,
+			Scanner:     &ImageScanner{URL: server.URL, TimeoutSeconds: 10, FailClosed: true},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	errs := policy.check(ctx, "nginx:1.19", ".spec.image")
+	assert.Len(t, errs, 1)
+	assert.True(t, time.Since(start) < time.Second)
+}
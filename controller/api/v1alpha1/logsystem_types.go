@@ -16,6 +16,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -23,13 +24,18 @@ import (
 type LogSystemStack string
 
 const (
-	LogSystemStackPLGMonolithic LogSystemStack = "plg-monolithic"
+	LogSystemStackPLGMonolithic  LogSystemStack = "plg-monolithic"
+	LogSystemStackPLGDistributed LogSystemStack = "plg-distributed"
+	LogSystemStackExternal       LogSystemStack = "external"
 
-	LokiImage     string = "grafana/loki:1.6.0"
-	GrafanaImage  string = "grafana/grafana:6.7.0"
-	PromtailImage string = "grafana/promtail:1.6.0"
+	LokiImage      string = "grafana/loki:1.6.0"
+	GrafanaImage   string = "grafana/grafana:6.7.0"
+	PromtailImage  string = "grafana/promtail:1.6.0"
+	FluentBitImage string = "fluent/fluent-bit:1.6.2"
 
 	DefaultLokiDiskSize = "10Gi"
+
+	DefaultLokiIngesterReplicas = 3
 )
 
 type LokiConfig struct {
@@ -44,14 +50,52 @@ type LokiConfig struct {
 	//   https://grafana.com/docs/loki/latest/operations/storage/retention/
 	RetentionDays uint32 `json:"retentionDays"`
 
-	// only works when stack is plg-monolithic
+	// Disk of loki for plg-monolithic stacks, or disk of each ingester for plg-distributed stacks.
 	DiskSize *resource.Quantity `json:"diskSize,omitempty"`
 
-	// only works when stack is plg-monolithic
+	// only works when stack is plg-*
 	StorageClass *string `json:"storageClass,omitempty"`
 
 	// lock the image, which make loki will not update unexpectedly after kalm is upgraded.
 	Image string `json:"image"`
+
+	// only works when stack is plg-distributed
+	Distributed *LokiDistributedConfig `json:"distributed,omitempty"`
+}
+
+// LokiObjectStorageConfig is an s3 compatible storage of the chunks and the index of loki.
+type LokiObjectStorageConfig struct {
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+
+	// +kubebuilder:validation:MinLength=1
+	Region string `json:"region"`
+
+	// for S3 compatible storages, e.g. https://minio.example.com
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// name of a secret in the LogSystem namespace with accessKeyID and secretAccessKey keys.
+	// If empty, the credentials of the node or the service account are used.
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// LokiDistributedConfig runs each target of loki (distributor, ingester, querier, query frontend and table manager)
+// in its own workload. They share the ring through memberlist, and store chunks and the index in the object storage.
+type LokiDistributedConfig struct {
+	ObjectStorage *LokiObjectStorageConfig `json:"objectStorage"`
+
+	// Logs are replicated to at most 3 ingesters.
+	// +kubebuilder:validation:Minimum=1
+	IngesterReplicas int32 `json:"ingesterReplicas,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	DistributorReplicas int32 `json:"distributorReplicas,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	QuerierReplicas int32 `json:"querierReplicas,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	QueryFrontendReplicas int32 `json:"queryFrontendReplicas,omitempty"`
 }
 
 type GrafanaConfig struct {
@@ -71,25 +115,219 @@ type PLGConfig struct {
 	Promtail *PromtailConfig `json:"promtail"`
 }
 
+type LogSinkType string
+
+const (
+	// works for both Elasticsearch and OpenSearch
+	LogSinkTypeElasticsearch LogSinkType = "elasticsearch"
+	LogSinkTypeHTTP          LogSinkType = "http"
+	LogSinkTypeS3            LogSinkType = "s3"
+	LogSinkTypeLoki          LogSinkType = "loki"
+)
+
+type ElasticsearchSinkConfig struct {
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:validation:Minimum=1
+	Port uint32 `json:"port"`
+
+	TLS bool `json:"tls,omitempty"`
+
+	// logs are written to daily indices named <index>-YYYY.MM.DD, kalm if empty
+	Index string `json:"index,omitempty"`
+
+	// name of a secret in the LogSystem namespace with username and password keys
+	SecretName string `json:"secretName,omitempty"`
+}
+
+type HTTPSinkConfig struct {
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:validation:Minimum=1
+	Port uint32 `json:"port"`
+
+	// path of the request, / if empty
+	URI string `json:"uri,omitempty"`
+
+	TLS bool `json:"tls,omitempty"`
+
+	// name of a secret in the LogSystem namespace with username and password keys for basic auth,
+	// or a token key sent as a bearer token
+	SecretName string `json:"secretName,omitempty"`
+}
+
+type S3SinkConfig struct {
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+
+	// +kubebuilder:validation:MinLength=1
+	Region string `json:"region"`
+
+	// for S3 compatible storages, e.g. https://minio.example.com
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// prefix of the object keys, kalm-logs if empty
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+
+	// name of a secret in the LogSystem namespace with accessKeyID and secretAccessKey keys.
+	// If empty, the credentials of the node or the service account are used.
+	SecretName string `json:"secretName,omitempty"`
+}
+
+type LokiSinkConfig struct {
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:validation:Minimum=1
+	Port uint32 `json:"port"`
+
+	TLS bool `json:"tls,omitempty"`
+
+	// X-Scope-OrgID header for multi-tenant lokis
+	TenantID string `json:"tenantID,omitempty"`
+
+	// name of a secret in the LogSystem namespace with username and password keys
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// LogSink is an external storage logs are shipped to.
+// The config of the sink type must exist.
+type LogSink struct {
+	// unique in the LogSystem
+	// +kubebuilder:validation:Pattern=^[a-z0-9]([-a-z0-9]*[a-z0-9])?$
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Enum=elasticsearch;http;s3;loki
+	Type LogSinkType `json:"type"`
+
+	Elasticsearch *ElasticsearchSinkConfig `json:"elasticsearch,omitempty"`
+	HTTP          *HTTPSinkConfig          `json:"http,omitempty"`
+	S3            *S3SinkConfig            `json:"s3,omitempty"`
+	Loki          *LokiSinkConfig          `json:"loki,omitempty"`
+}
+
+type FluentBitConfig struct {
+	// lock the image, which make the image will not update unexpectedly after kalm is upgraded.
+	Image string `json:"image"`
+}
+
+// A fluent bit daemonset is deployed to ship logs to the sinks.
+type ExternalLogSystemConfig struct {
+	FluentBit *FluentBitConfig `json:"fluentBit"`
+
+	// +kubebuilder:validation:MinItems=1
+	Sinks []LogSink `json:"sinks"`
+}
+
 // LogSystemSpec defines the desired state oLogSystemf
 type LogSystemSpec struct {
-	// +kubebuilder:validation:Enum=plg-monolithic
+	// +kubebuilder:validation:Enum=plg-monolithic;plg-distributed;external
 	Stack LogSystemStack `json:"stack"`
 
 	// Need to exist if the stack is plg-*
 	PLGConfig *PLGConfig `json:"plgConfig,omitempty"`
 
+	// Need to exist if the stack is external
+	ExternalConfig *ExternalLogSystemConfig `json:"externalConfig,omitempty"`
+
 	// This sc will be used in pvc template if a disk is required. This value can be overwrite from deeper struct attribute.
 	StorageClass *string `json:"storageClass,omitempty"`
 }
 
 // LogSystemStatus defines the observed state oLogSystemf
 type LogSystemStatus struct {
+	// The generation of the logsystem spec that this status was computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	Conditions []LogSystemCondition `json:"conditions,omitempty"`
+
+	// Address of grafana after `kubectl port-forward -n <namespace> deployment/<name>-grafana 3000`, only set for plg stacks.
+	// Grafana is not exposed by a service, anonymous users are admins.
+	// +optional
+	GrafanaURL string `json:"grafanaURL,omitempty"`
+
+	// Only set for plg stacks.
+	// +optional
+	Loki *LogSystemLokiStatus `json:"loki,omitempty"`
+
+	// Error of the last reconciliation, empty if the last reconciliation succeeded.
+	// +optional
+	LastReconcileError string `json:"lastReconcileError,omitempty"`
+}
+
+type LogSystemLokiStatus struct {
+	// The retention_period in the config of loki, e.g. 144h.
+	// Empty means retention is disabled, logs are kept until the disk is full.
+	// +optional
+	RetentionPeriod string `json:"retentionPeriod,omitempty"`
+
+	// Size of the filesystem of the loki pvc, reported together with diskUsed.
+	// +optional
+	DiskCapacity *resource.Quantity `json:"diskCapacity,omitempty"`
+
+	// Used bytes of the loki pvc, from the volume stats of kubelet scraped by prometheus.
+	// +optional
+	DiskUsed *resource.Quantity `json:"diskUsed,omitempty"`
+
+	// +optional
+	DiskUsageUpdatedAt *metav1.Time `json:"diskUsageUpdatedAt,omitempty"`
+}
+
+type LogSystemConditionType string
+
+const (
+	// All components of the stack are ready.
+	LogSystemConditionReady LogSystemConditionType = "Ready"
+	// The last reconciliation failed.
+	LogSystemConditionDegraded LogSystemConditionType = "Degraded"
+
+	LogSystemConditionLokiReady      LogSystemConditionType = "LokiReady"
+	LogSystemConditionGrafanaReady   LogSystemConditionType = "GrafanaReady"
+	LogSystemConditionPromtailReady  LogSystemConditionType = "PromtailReady"
+	LogSystemConditionFluentBitReady LogSystemConditionType = "FluentBitReady"
+
+	// targets of loki in plg-distributed stacks
+	LogSystemConditionLokiDistributorReady   LogSystemConditionType = "LokiDistributorReady"
+	LogSystemConditionLokiIngesterReady      LogSystemConditionType = "LokiIngesterReady"
+	LogSystemConditionLokiQuerierReady       LogSystemConditionType = "LokiQuerierReady"
+	LogSystemConditionLokiQueryFrontendReady LogSystemConditionType = "LokiQueryFrontendReady"
+	LogSystemConditionLokiTableManagerReady  LogSystemConditionType = "LokiTableManagerReady"
+)
+
+type LogSystemCondition struct {
+	// Type of the condition, one of ('Ready', 'Degraded'), or '<Component>Ready' for each component of the stack.
+	Type LogSystemConditionType `json:"type"`
+
+	// Status of the condition, one of ('True', 'False', 'Unknown').
+	Status corev1.ConditionStatus `json:"status"`
+
+	// Last time the condition transitioned from one status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a brief machine readable explanation for the condition's last
+	// transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the details of the last
+	// transition, complementing reason.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Stack",type="string",JSONPath=".spec.stack"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Loki Disk Used",type="string",JSONPath=".status.loki.diskUsed",priority=1
 
 // LogSystem is the Schema for the deploykeys API
 type LogSystem struct {
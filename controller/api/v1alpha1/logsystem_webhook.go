@@ -17,8 +17,14 @@ package v1alpha1
 
 import (
 	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -42,7 +48,7 @@ func (r *LogSystem) Default() {
 	logsystemlog.Info("default", "name", r.Name)
 
 	switch r.Spec.Stack {
-	case LogSystemStackPLGMonolithic:
+	case LogSystemStackPLGMonolithic, LogSystemStackPLGDistributed:
 		if r.Spec.PLGConfig == nil {
 			r.Spec.PLGConfig = &PLGConfig{}
 		}
@@ -85,6 +91,46 @@ func (r *LogSystem) Default() {
 		if r.Spec.PLGConfig.Promtail.Image == "" {
 			r.Spec.PLGConfig.Promtail.Image = PromtailImage
 		}
+
+		if r.Spec.Stack == LogSystemStackPLGDistributed {
+			r.defaultLokiDistributedConfig()
+		}
+	case LogSystemStackExternal:
+		if r.Spec.ExternalConfig == nil {
+			r.Spec.ExternalConfig = &ExternalLogSystemConfig{}
+		}
+
+		if r.Spec.ExternalConfig.FluentBit == nil {
+			r.Spec.ExternalConfig.FluentBit = &FluentBitConfig{}
+		}
+
+		if r.Spec.ExternalConfig.FluentBit.Image == "" {
+			r.Spec.ExternalConfig.FluentBit.Image = FluentBitImage
+		}
+	}
+}
+
+func (r *LogSystem) defaultLokiDistributedConfig() {
+	if r.Spec.PLGConfig.Loki.Distributed == nil {
+		r.Spec.PLGConfig.Loki.Distributed = &LokiDistributedConfig{}
+	}
+
+	config := r.Spec.PLGConfig.Loki.Distributed
+
+	if config.IngesterReplicas == 0 {
+		config.IngesterReplicas = DefaultLokiIngesterReplicas
+	}
+
+	if config.DistributorReplicas == 0 {
+		config.DistributorReplicas = 1
+	}
+
+	if config.QuerierReplicas == 0 {
+		config.QuerierReplicas = 1
+	}
+
+	if config.QueryFrontendReplicas == 0 {
+		config.QueryFrontendReplicas = 1
 	}
 }
 
@@ -116,7 +162,7 @@ func (r *LogSystem) validate() error {
 	var rst KalmValidateErrorList
 
 	switch r.Spec.Stack {
-	case LogSystemStackPLGMonolithic:
+	case LogSystemStackPLGMonolithic, LogSystemStackPLGDistributed:
 		if r.Spec.PLGConfig == nil {
 			rst = append(rst, KalmValidateError{
 				Err:  fmt.Sprintf("plg config can't be blank when using %s stack", r.Spec.Stack),
@@ -181,6 +227,13 @@ func (r *LogSystem) validate() error {
 			break
 		}
 
+		if r.Spec.Stack == LogSystemStackPLGDistributed {
+			rst = append(rst, r.validateLokiDistributedConfig()...)
+		}
+
+	case LogSystemStackExternal:
+		rst = append(rst, r.validateExternalConfig()...)
+
 	default:
 		rst = append(rst, KalmValidateError{
 			Err:  fmt.Sprintf("unknown stack: %s", r.Spec.Stack),
@@ -194,3 +247,249 @@ func (r *LogSystem) validate() error {
 
 	return rst
 }
+
+func (r *LogSystem) validateExternalConfig() (rst KalmValidateErrorList) {
+	config := r.Spec.ExternalConfig
+
+	if config == nil {
+		return append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("external config can't be blank when using %s stack", r.Spec.Stack),
+			Path: "spec.externalConfig",
+		})
+	}
+
+	if config.FluentBit == nil || config.FluentBit.Image == "" {
+		rst = append(rst, KalmValidateError{
+			Err:  "fluent bit image can't be blank",
+			Path: "spec.externalConfig.fluentBit.image",
+		})
+	}
+
+	if len(config.Sinks) == 0 {
+		rst = append(rst, KalmValidateError{
+			Err:  "at least one sink is required",
+			Path: "spec.externalConfig.sinks",
+		})
+	}
+
+	names := make(map[string]bool)
+	var s3SinksWithSecret int
+
+	for i, sink := range config.Sinks {
+		path := fmt.Sprintf("spec.externalConfig.sinks[%d]", i)
+
+		if names[sink.Name] {
+			rst = append(rst, KalmValidateError{
+				Err:  fmt.Sprintf("duplicate sink name %s", sink.Name),
+				Path: path + ".name",
+			})
+		}
+
+		names[sink.Name] = true
+
+		var missing bool
+
+		switch sink.Type {
+		case LogSinkTypeElasticsearch:
+			missing = sink.Elasticsearch == nil
+		case LogSinkTypeHTTP:
+			missing = sink.HTTP == nil
+		case LogSinkTypeS3:
+			missing = sink.S3 == nil
+
+			// fluent bit reads s3 credentials from the aws envs, which are shared by all s3 outputs
+			if !missing && sink.S3.SecretName != "" {
+				s3SinksWithSecret++
+
+				if s3SinksWithSecret > 1 {
+					rst = append(rst, KalmValidateError{
+						Err:  "only one s3 sink can have a secret",
+						Path: path + ".s3.secretName",
+					})
+				}
+			}
+		case LogSinkTypeLoki:
+			missing = sink.Loki == nil
+		default:
+			rst = append(rst, KalmValidateError{
+				Err:  fmt.Sprintf("unknown sink type: %s", sink.Type),
+				Path: path + ".type",
+			})
+			continue
+		}
+
+		if missing {
+			rst = append(rst, KalmValidateError{
+				Err:  fmt.Sprintf("%s config can't be blank for %s sink", sink.Type, sink.Type),
+				Path: fmt.Sprintf("%s.%s", path, sink.Type),
+			})
+			continue
+		}
+
+		rst = append(rst, validateLogSinkValues(sink, path)...)
+	}
+
+	return rst
+}
+
+func (r *LogSystem) validateLokiDistributedConfig() (rst KalmValidateErrorList) {
+	config := r.Spec.PLGConfig.Loki.Distributed
+	path := "spec.plgConfig.loki.distributed"
+
+	if config == nil {
+		return append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("distributed config of loki can't be blank when using %s stack", r.Spec.Stack),
+			Path: path,
+		})
+	}
+
+	replicas := []struct {
+		field string
+		value int32
+	}{
+		{"ingesterReplicas", config.IngesterReplicas},
+		{"distributorReplicas", config.DistributorReplicas},
+		{"querierReplicas", config.QuerierReplicas},
+		{"queryFrontendReplicas", config.QueryFrontendReplicas},
+	}
+
+	for _, r := range replicas {
+		if r.value < 1 {
+			rst = append(rst, KalmValidateError{
+				Err:  "should be at least 1",
+				Path: fmt.Sprintf("%s.%s", path, r.field),
+			})
+		}
+	}
+
+	storage := config.ObjectStorage
+
+	if storage == nil {
+		return append(rst, KalmValidateError{
+			Err:  "object storage can't be blank, it's shared by all targets of loki",
+			Path: path + ".objectStorage",
+		})
+	}
+
+	// the values are rendered in the config of loki
+	if !s3BucketRegex.MatchString(storage.Bucket) {
+		rst = append(rst, KalmValidateError{
+			Err:  "invalid bucket name",
+			Path: path + ".objectStorage.bucket",
+		})
+	}
+
+	if !s3RegionRegex.MatchString(storage.Region) {
+		rst = append(rst, KalmValidateError{
+			Err:  "invalid region",
+			Path: path + ".objectStorage.region",
+		})
+	}
+
+	if storage.Endpoint != "" && !isValidS3Endpoint(storage.Endpoint) {
+		rst = append(rst, KalmValidateError{
+			Err:  "should be a http or https url",
+			Path: path + ".objectStorage.endpoint",
+		})
+	}
+
+	if storage.SecretName != "" && len(validation.IsDNS1123Subdomain(storage.SecretName)) > 0 {
+		rst = append(rst, KalmValidateError{
+			Err:  "invalid secret name",
+			Path: path + ".objectStorage.secretName",
+		})
+	}
+
+	return rst
+}
+
+var s3BucketRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+var s3RegionRegex = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// validateLogSinkValues checks the values rendered in the fluent bit config. Line breaks would start new sections,
+// whitespaces would be parsed as separators, and ${} would be expanded to envs of fluent bit, which has the secrets.
+func validateLogSinkValues(sink LogSink, path string) (rst KalmValidateErrorList) {
+	check := func(value, field string, validate func(string) string) {
+		if value == "" {
+			return
+		}
+
+		msg := ""
+
+		if strings.IndexFunc(value, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+			msg = "whitespaces and control characters are not allowed"
+		} else if strings.Contains(value, "$") {
+			msg = "$ is not allowed"
+		} else if validate != nil {
+			msg = validate(value)
+		}
+
+		if msg != "" {
+			rst = append(rst, KalmValidateError{
+				Err:  msg,
+				Path: fmt.Sprintf("%s.%s.%s", path, sink.Type, field),
+			})
+		}
+	}
+
+	switch sink.Type {
+	case LogSinkTypeElasticsearch:
+		check(sink.Elasticsearch.Host, "host", validateLogSinkHost)
+		check(sink.Elasticsearch.Index, "index", nil)
+	case LogSinkTypeHTTP:
+		check(sink.HTTP.Host, "host", validateLogSinkHost)
+		check(sink.HTTP.URI, "uri", func(uri string) string {
+			if !strings.HasPrefix(uri, "/") {
+				return "should start with /"
+			}
+
+			return ""
+		})
+	case LogSinkTypeS3:
+		check(sink.S3.Bucket, "bucket", func(bucket string) string {
+			if !s3BucketRegex.MatchString(bucket) {
+				return "invalid bucket name"
+			}
+
+			return ""
+		})
+		check(sink.S3.Region, "region", func(region string) string {
+			if !s3RegionRegex.MatchString(region) {
+				return "invalid region"
+			}
+
+			return ""
+		})
+		check(sink.S3.Endpoint, "endpoint", func(endpoint string) string {
+			if !isValidS3Endpoint(endpoint) {
+				return "should be a http or https url"
+			}
+
+			return ""
+		})
+		check(sink.S3.KeyPrefix, "keyPrefix", nil)
+	case LogSinkTypeLoki:
+		check(sink.Loki.Host, "host", validateLogSinkHost)
+		check(sink.Loki.TenantID, "tenantID", nil)
+	}
+
+	return rst
+}
+
+func isValidS3Endpoint(endpoint string) bool {
+	if strings.IndexFunc(endpoint, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return false
+	}
+
+	u, err := url.Parse(endpoint)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validateLogSinkHost(host string) string {
+	if validation.IsValidIP(host) == nil || len(validation.IsDNS1123Subdomain(host)) == 0 {
+		return ""
+	}
+
+	return "should be a hostname or an ip address"
+}
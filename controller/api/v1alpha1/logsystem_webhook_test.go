@@ -77,3 +77,133 @@ func TestExistingLogSystemDefaultWebhook(t *testing.T) {
 		t.Fatalf("the logsystem should be vaild after default mutating. Err: %+v", err)
 	}
 }
+
+func TestExternalLogSystemWebhook(t *testing.T) {
+	logSystem := LogSystem{
+		ObjectMeta: ctrl.ObjectMeta{
+			Name:      "test",
+			Namespace: "test",
+		},
+		Spec: LogSystemSpec{
+			Stack: LogSystemStackExternal,
+			ExternalConfig: &ExternalLogSystemConfig{
+				Sinks: []LogSink{
+					{
+						Name: "es",
+						Type: LogSinkTypeElasticsearch,
+						Elasticsearch: &ElasticsearchSinkConfig{
+							Host: "es.example.com",
+							Port: 9200,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	logSystem.Default()
+
+	if logSystem.Spec.ExternalConfig.FluentBit.Image != FluentBitImage {
+		t.Fatalf("should set fluent bit default image")
+	}
+
+	if err := logSystem.validate(); err != nil {
+		t.Fatalf("the logsystem should be vaild after default mutating. Err: %+v", err)
+	}
+
+	logSystem.Spec.ExternalConfig.Sinks = append(logSystem.Spec.ExternalConfig.Sinks, LogSink{
+		Name: "es",
+		Type: LogSinkTypeHTTP,
+	})
+
+	if err := logSystem.validate(); err == nil {
+		t.Fatalf("should reject duplicated sink names and sinks without config")
+	}
+}
+
+func TestExternalLogSystemWebhookSinkValues(t *testing.T) {
+	newLogSystem := func(sink LogSink) *LogSystem {
+		sink.Name = "sink"
+
+		return &LogSystem{
+			ObjectMeta: ctrl.ObjectMeta{Name: "test", Namespace: "test"},
+			Spec: LogSystemSpec{
+				Stack: LogSystemStackExternal,
+				ExternalConfig: &ExternalLogSystemConfig{
+					FluentBit: &FluentBitConfig{Image: FluentBitImage},
+					Sinks:     []LogSink{sink},
+				},
+			},
+		}
+	}
+
+	valid := []LogSink{
+		{Type: LogSinkTypeElasticsearch, Elasticsearch: &ElasticsearchSinkConfig{Host: "es.example.com", Port: 9200, Index: "logs"}},
+		{Type: LogSinkTypeHTTP, HTTP: &HTTPSinkConfig{Host: "10.0.0.1", Port: 80, URI: "/ingest?source=kalm"}},
+		{Type: LogSinkTypeS3, S3: &S3SinkConfig{Bucket: "my.logs", Region: "us-east-1", Endpoint: "https://minio.example.com"}},
+		{Type: LogSinkTypeLoki, Loki: &LokiSinkConfig{Host: "loki", Port: 3100, TenantID: "kalm"}},
+	}
+
+	for _, sink := range valid {
+		if err := newLogSystem(sink).validate(); err != nil {
+			t.Fatalf("sink %+v should be valid. Err: %+v", sink, err)
+		}
+	}
+
+	invalid := []LogSink{
+		{Type: LogSinkTypeElasticsearch, Elasticsearch: &ElasticsearchSinkConfig{Host: "es.example.com\n[OUTPUT]", Port: 9200}},
+		{Type: LogSinkTypeElasticsearch, Elasticsearch: &ElasticsearchSinkConfig{Host: "es.example.com", Port: 9200, Index: "logs-${AWS_SECRET_ACCESS_KEY}"}},
+		{Type: LogSinkTypeHTTP, HTTP: &HTTPSinkConfig{Host: "https://logs.example.com", Port: 443}},
+		{Type: LogSinkTypeHTTP, HTTP: &HTTPSinkConfig{Host: "logs.example.com", Port: 443, URI: "ingest"}},
+		{Type: LogSinkTypeS3, S3: &S3SinkConfig{Bucket: "logs\r\n", Region: "us-east-1"}},
+		{Type: LogSinkTypeS3, S3: &S3SinkConfig{Bucket: "logs", Region: "us-east-1", Endpoint: "minio.example.com"}},
+		{Type: LogSinkTypeLoki, Loki: &LokiSinkConfig{Host: "loki", Port: 3100, TenantID: "a\tb"}},
+	}
+
+	for _, sink := range invalid {
+		if err := newLogSystem(sink).validate(); err == nil {
+			t.Fatalf("sink %+v should be invalid", sink)
+		}
+	}
+}
+
+func TestPLGDistributedLogSystemWebhook(t *testing.T) {
+	logSystem := LogSystem{
+		ObjectMeta: ctrl.ObjectMeta{
+			Name:      "test",
+			Namespace: "test",
+		},
+		Spec: LogSystemSpec{
+			Stack: LogSystemStackPLGDistributed,
+		},
+	}
+
+	logSystem.Default()
+
+	distributed := logSystem.Spec.PLGConfig.Loki.Distributed
+
+	if distributed == nil || distributed.IngesterReplicas != DefaultLokiIngesterReplicas || distributed.QuerierReplicas != 1 {
+		t.Fatalf("should set default replicas of loki targets")
+	}
+
+	if err := logSystem.validate(); err == nil {
+		t.Fatalf("should require the object storage")
+	}
+
+	distributed.ObjectStorage = &LokiObjectStorageConfig{
+		Bucket:     "kalm-logs",
+		Region:     "us-east-1",
+		Endpoint:   "http://minio.minio:9000",
+		SecretName: "minio-credentials",
+	}
+
+	if err := logSystem.validate(); err != nil {
+		t.Fatalf("the logsystem should be vaild. Err: %+v", err)
+	}
+
+	distributed.ObjectStorage.Endpoint = "http://minio.minio:9000\n  insecure: true"
+
+	if err := logSystem.validate(); err == nil {
+		t.Fatalf("should reject endpoints breaking the config of loki")
+	}
+}
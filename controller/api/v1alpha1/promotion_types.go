@@ -0,0 +1,141 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PromotionComponentOverride changes a component after it is copied into the target application.
+type PromotionComponentOverride struct {
+	// name of a promoted component
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// envs replace the ones with the same name, or are appended
+	// +optional
+	Env []EnvVar `json:"env,omitempty"`
+}
+
+// PromotionHostOverride replaces a host of the promoted HttpRoutes.
+type PromotionHostOverride struct {
+	// +kubebuilder:validation:MinLength=1
+	From string `json:"from"`
+
+	// +kubebuilder:validation:MinLength=1
+	To string `json:"to"`
+}
+
+// PromotionSpec defines the desired state of Promotion.
+// A Promotion lives in the target application, and copies resources from the source application
+// each time its spec is changed.
+type PromotionSpec struct {
+	// the application to promote from
+	// +kubebuilder:validation:MinLength=1
+	SourceNamespace string `json:"sourceNamespace"`
+
+	// names of the components to promote, their plugin bindings are promoted too
+	// +kubebuilder:validation:MinItems=1
+	Components []string `json:"components"`
+
+	// names of the HttpRoutes to promote
+	// +optional
+	HttpRoutes []string `json:"httpRoutes,omitempty"`
+
+	// names of the ProtectedEndpoints to promote
+	// +optional
+	ProtectedEndpoints []string `json:"protectedEndpoints,omitempty"`
+
+	// +optional
+	ComponentOverrides []PromotionComponentOverride `json:"componentOverrides,omitempty"`
+
+	// +optional
+	HostOverrides []PromotionHostOverride `json:"hostOverrides,omitempty"`
+}
+
+type PromotionPhase string
+
+const (
+	PromotionPhaseSucceeded PromotionPhase = "Succeeded"
+	PromotionPhaseFailed    PromotionPhase = "Failed"
+)
+
+type PromotedComponent struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// PromotionRecord is what a successful promotion copied.
+type PromotionRecord struct {
+	PromotedAt metav1.Time `json:"promotedAt"`
+
+	// the generation of the spec that was promoted
+	Generation int64 `json:"generation"`
+
+	Components              []PromotedComponent `json:"components,omitempty"`
+	HttpRoutes              []string            `json:"httpRoutes,omitempty"`
+	ProtectedEndpoints      []string            `json:"protectedEndpoints,omitempty"`
+	ComponentPluginBindings []string            `json:"componentPluginBindings,omitempty"`
+}
+
+// PromotionStatus defines the observed state of Promotion
+type PromotionStatus struct {
+	// +optional
+	Phase PromotionPhase `json:"phase,omitempty"`
+
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// the generation of the spec that was last promoted
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// successful promotions, the latest one goes last
+	// +optional
+	History []PromotionRecord `json:"history,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Source",type="string",JSONPath=".spec.sourceNamespace"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Promotion is the Schema for the promotions API
+type Promotion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PromotionSpec   `json:"spec,omitempty"`
+	Status PromotionStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PromotionList contains a list of Promotion
+type PromotionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Promotion `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Promotion{}, &PromotionList{})
+}
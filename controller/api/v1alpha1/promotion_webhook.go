@@ -0,0 +1,364 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionV1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationV1 "k8s.io/api/authentication/v1"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var promotionlog = logf.Log.WithName("promotion-resource")
+
+const promotionValidatePath = "/validate-core-kalm-dev-v1alpha1-promotion"
+
+func (r *Promotion) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// registered before the builder, which skips the validating webhook of a handled path
+	mgr.GetWebhookServer().Register(promotionValidatePath, &webhook.Admission{Handler: &promotionValidator{}})
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-core-kalm-dev-v1alpha1-promotion,mutating=true,failurePolicy=fail,groups=core.kalm.dev,resources=promotions,verbs=create;update,versions=v1alpha1,name=mpromotion.kb.io
+
+var _ webhook.Defaulter = &Promotion{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Promotion) Default() {
+	promotionlog.Info("default", "name", r.Name)
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-core-kalm-dev-v1alpha1-promotion,mutating=false,failurePolicy=fail,groups=core.kalm.dev,resources=promotions,versions=v1alpha1,name=vpromotion.kb.io
+
+var _ webhook.Validator = &Promotion{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Promotion) ValidateCreate() error {
+	promotionlog.Info("validate create", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Promotion) ValidateUpdate(old runtime.Object) error {
+	promotionlog.Info("validate update", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Promotion) ValidateDelete() error {
+	promotionlog.Info("validate delete", "name", r.Name)
+	return nil
+}
+
+func (r *Promotion) validate() error {
+	var rst KalmValidateErrorList
+
+	if errs := apimachineryvalidation.ValidateNamespaceName(r.Spec.SourceNamespace, false); len(errs) != 0 {
+		rst = append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("invalid namespace: %s", r.Spec.SourceNamespace),
+			Path: "spec.sourceNamespace",
+		})
+	} else if r.Spec.SourceNamespace == r.Namespace {
+		rst = append(rst, KalmValidateError{
+			Err:  "should not be the namespace of the promotion",
+			Path: "spec.sourceNamespace",
+		})
+	}
+
+	if len(r.Spec.Components) == 0 {
+		rst = append(rst, KalmValidateError{
+			Err:  "at least 1 component to promote",
+			Path: "spec.components",
+		})
+	}
+
+	components := make(map[string]bool)
+
+	for i, name := range r.Spec.Components {
+		if !isValidResourceName(name) {
+			rst = append(rst, KalmValidateError{
+				Err:  fmt.Sprintf("invalid component name: %s", name),
+				Path: fmt.Sprintf("spec.components[%d]", i),
+			})
+		}
+
+		components[name] = true
+	}
+
+	for i, override := range r.Spec.ComponentOverrides {
+		path := fmt.Sprintf("spec.componentOverrides[%d]", i)
+
+		if !components[override.Name] {
+			rst = append(rst, KalmValidateError{
+				Err:  fmt.Sprintf("component %s is not promoted", override.Name),
+				Path: path + ".name",
+			})
+		}
+
+		if override.Replicas != nil && *override.Replicas < 0 {
+			rst = append(rst, KalmValidateError{
+				Err:  isNegativeErrorMsg,
+				Path: path + ".replicas",
+			})
+		}
+	}
+
+	for i, override := range r.Spec.HostOverrides {
+		if override.From == "" || override.To == "" {
+			rst = append(rst, KalmValidateError{
+				Err:  "from and to should not be empty",
+				Path: fmt.Sprintf("spec.hostOverrides[%d]", i),
+			})
+		}
+	}
+
+	if len(rst) == 0 {
+		return nil
+	}
+
+	return rst
+}
+
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// promotionValidator validates promotions as the Validator does, and makes sure the user creating or updating
+// a promotion can read the resources to promote, and write them in the namespace of the promotion.
+// The promotion controller copies them with its own permissions.
+type promotionValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &promotionValidator{}
+
+func (v *promotionValidator) InjectClient(c client.Client) error {
+	v.client = c
+	return nil
+}
+
+func (v *promotionValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+func (v *promotionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionV1beta1.Create && req.Operation != admissionV1beta1.Update {
+		return admission.Allowed("")
+	}
+
+	var promotion Promotion
+
+	if err := v.decoder.Decode(req, &promotion); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	promotionlog.Info("validate", "name", promotion.Name, "operation", req.Operation)
+
+	if err := promotion.validate(); err != nil {
+		return admission.Denied(err.Error())
+	}
+
+	attributesList := append(
+		getPromotionSourceAttributes(&promotion.Spec),
+		getPromotionTargetAttributes(promotion.Namespace, &promotion.Spec)...,
+	)
+
+	secretAttributes, err := v.getPromotionSecretAttributes(ctx, &promotion)
+
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	for _, attributes := range append(attributesList, secretAttributes...) {
+		allowed, err := v.canAccess(ctx, req.UserInfo, attributes)
+
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+
+		if !allowed {
+			return admission.Denied(fmt.Sprintf(
+				"user %s can't %s %s %s in namespace %s",
+				req.UserInfo.Username, attributes.Verb, attributes.Resource, attributes.Name, attributes.Namespace,
+			))
+		}
+	}
+
+	return admission.Allowed("")
+}
+
+// getPromotionSourceAttributes returns what the promotion controller reads in the source namespace.
+func getPromotionSourceAttributes(spec *PromotionSpec) []authorizationV1.ResourceAttributes {
+	var rst []authorizationV1.ResourceAttributes
+
+	for _, resource := range []struct {
+		name  string
+		names []string
+	}{
+		{"components", spec.Components},
+		{"httproutes", spec.HttpRoutes},
+		{"protectedendpoints", spec.ProtectedEndpoints},
+	} {
+		for _, name := range resource.names {
+			rst = append(rst, authorizationV1.ResourceAttributes{
+				Namespace: spec.SourceNamespace,
+				Verb:      "get",
+				Group:     GroupVersion.Group,
+				Resource:  resource.name,
+				Name:      name,
+			})
+		}
+	}
+
+	// plugin bindings of the components are promoted as well
+	if len(spec.Components) > 0 {
+		rst = append(rst, authorizationV1.ResourceAttributes{
+			Namespace: spec.SourceNamespace,
+			Verb:      "list",
+			Group:     GroupVersion.Group,
+			Resource:  "componentpluginbindings",
+		})
+	}
+
+	return rst
+}
+
+// getPromotionTargetAttributes returns what the promotion controller writes in the namespace of the promotion.
+// The controller writes with its own permissions, the user has to be allowed to do the same.
+func getPromotionTargetAttributes(namespace string, spec *PromotionSpec) []authorizationV1.ResourceAttributes {
+	var rst []authorizationV1.ResourceAttributes
+
+	for _, resource := range []struct {
+		name  string
+		names []string
+	}{
+		{"components", spec.Components},
+		{"httproutes", spec.HttpRoutes},
+		{"protectedendpoints", spec.ProtectedEndpoints},
+	} {
+		for _, name := range resource.names {
+			for _, verb := range []string{"create", "update"} {
+				rst = append(rst, authorizationV1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      verb,
+					Group:     GroupVersion.Group,
+					Resource:  resource.name,
+					Name:      name,
+				})
+			}
+		}
+	}
+
+	if len(spec.Components) > 0 {
+		for _, verb := range []string{"create", "update"} {
+			rst = append(rst, authorizationV1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     GroupVersion.Group,
+				Resource:  "componentpluginbindings",
+			})
+		}
+	}
+
+	return rst
+}
+
+// getPromotionSecretAttributes returns the access to the secrets of the promoted components,
+// values of secret envs and secret files are copied from the source secrets.
+func (v *promotionValidator) getPromotionSecretAttributes(ctx context.Context, promotion *Promotion) ([]authorizationV1.ResourceAttributes, error) {
+	var rst []authorizationV1.ResourceAttributes
+
+	for _, name := range promotion.Spec.Components {
+		var component Component
+
+		err := v.client.Get(ctx, types.NamespacedName{Namespace: promotion.Spec.SourceNamespace, Name: name}, &component)
+
+		// the promotion fails in the controller
+		if errors.IsNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !IsComponentSecretNeeded(&component) {
+			continue
+		}
+
+		secretName := ComponentSecretName(name)
+
+		rst = append(rst, authorizationV1.ResourceAttributes{
+			Namespace: promotion.Spec.SourceNamespace,
+			Verb:      "get",
+			Resource:  "secrets",
+			Name:      secretName,
+		})
+
+		for _, verb := range []string{"create", "update"} {
+			rst = append(rst, authorizationV1.ResourceAttributes{
+				Namespace: promotion.Namespace,
+				Verb:      verb,
+				Resource:  "secrets",
+				Name:      secretName,
+			})
+		}
+	}
+
+	return rst, nil
+}
+
+func (v *promotionValidator) canAccess(ctx context.Context, user authenticationV1.UserInfo, attributes authorizationV1.ResourceAttributes) (bool, error) {
+	extra := make(map[string]authorizationV1.ExtraValue, len(user.Extra))
+
+	for k, v := range user.Extra {
+		extra[k] = authorizationV1.ExtraValue(v)
+	}
+
+	review := &authorizationV1.SubjectAccessReview{
+		Spec: authorizationV1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+			User:               user.Username,
+			Groups:             user.Groups,
+			UID:                user.UID,
+			Extra:              extra,
+		},
+	}
+
+	if err := v.client.Create(ctx, review); err != nil {
+		return false, err
+	}
+
+	return review.Status.Allowed, nil
+}
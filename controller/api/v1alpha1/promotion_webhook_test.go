@@ -0,0 +1,145 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionV1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationV1 "k8s.io/api/authentication/v1"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestPromotion_webhook(t *testing.T) {
+	replicas := int32(3)
+
+	promotion := Promotion{
+		ObjectMeta: ctrl.ObjectMeta{
+			Namespace: "staging",
+			Name:      "dev-to-staging",
+		},
+		Spec: PromotionSpec{
+			SourceNamespace: "dev",
+			Components:      []string{"web", "worker"},
+			ComponentOverrides: []PromotionComponentOverride{
+				{Name: "web", Replicas: &replicas},
+			},
+			HostOverrides: []PromotionHostOverride{
+				{From: "dev.example.com", To: "staging.example.com"},
+			},
+		},
+	}
+
+	promotion.Default()
+	assert.Nil(t, promotion.validate())
+
+	// promote into the source itself
+	promotion.Spec.SourceNamespace = "staging"
+	assert.NotNil(t, promotion.validate())
+	promotion.Spec.SourceNamespace = "dev"
+
+	// override of a component which is not promoted
+	promotion.Spec.ComponentOverrides[0].Name = "api"
+	errs, ok := promotion.validate().(KalmValidateErrorList)
+	assert.True(t, ok)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.componentOverrides[0].name", errs[0].Path)
+}
+
+// fakeAccessReviewClient allows users to access the namespaces they own, secrets are only allowed for the secret owners.
+type fakeAccessReviewClient struct {
+	client.Client
+	namespaces   map[string][]string
+	secretOwners []string
+}
+
+func (c *fakeAccessReviewClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	review := obj.(*authorizationV1.SubjectAccessReview)
+	users := c.namespaces[review.Spec.ResourceAttributes.Namespace]
+
+	if review.Spec.ResourceAttributes.Resource == "secrets" {
+		users = c.secretOwners
+	}
+
+	for _, user := range users {
+		if user == review.Spec.User {
+			review.Status.Allowed = true
+		}
+	}
+
+	return nil
+}
+
+func TestPromotionValidatorChecksAccess(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, AddToScheme(scheme))
+
+	decoder, err := admission.NewDecoder(scheme)
+	assert.Nil(t, err)
+
+	validator := &promotionValidator{
+		client: &fakeAccessReviewClient{
+			Client: fake.NewFakeClientWithScheme(scheme, &Component{
+				ObjectMeta: ctrl.ObjectMeta{Namespace: "dev", Name: "api"},
+				Spec: ComponentSpec{
+					Env: []EnvVar{{Name: "TOKEN", Type: EnvVarTypeSecret}},
+				},
+			}),
+			namespaces: map[string][]string{
+				"dev":         {"alice", "bob"},
+				"staging":     {"alice"},
+				"kalm-system": {"admin"},
+			},
+			secretOwners: []string{"alice"},
+		},
+		decoder: decoder,
+	}
+
+	handle := func(username, sourceNamespace string, components ...string) admission.Response {
+		raw, err := json.Marshal(&Promotion{
+			TypeMeta:   ctrl.TypeMeta{APIVersion: GroupVersion.String(), Kind: "Promotion"},
+			ObjectMeta: ctrl.ObjectMeta{Namespace: "staging", Name: "promotion"},
+			Spec: PromotionSpec{
+				SourceNamespace: sourceNamespace,
+				Components:      components,
+			},
+		})
+		assert.Nil(t, err)
+
+		return validator.Handle(context.Background(), admission.Request{AdmissionRequest: admissionV1beta1.AdmissionRequest{
+			Operation: admissionV1beta1.Create,
+			Namespace: "staging",
+			Object:    runtime.RawExtension{Raw: raw},
+			UserInfo:  authenticationV1.UserInfo{Username: username},
+		}})
+	}
+
+	assert.True(t, handle("alice", "dev", "web").Allowed)
+
+	// writers of the target namespace can't copy resources of namespaces they can't read
+	res := handle("alice", "kalm-system", "web")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "user alice can't get components web in namespace kalm-system", string(res.Result.Reason))
+
+	// readers of the source namespace can't write the target namespace through the controller
+	res = handle("bob", "dev", "web")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "user bob can't create components web in namespace staging", string(res.Result.Reason))
+
+	// secret values of the component are copied
+	assert.True(t, handle("alice", "dev", "api").Allowed)
+
+	validator.client.(*fakeAccessReviewClient).secretOwners = nil
+	res = handle("alice", "dev", "api")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "user alice can't get secrets api-secret in namespace dev", string(res.Result.Reason))
+
+	// invalid promotions are denied before any review
+	assert.False(t, handle("alice", "staging", "web").Allowed)
+}
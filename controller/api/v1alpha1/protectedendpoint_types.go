@@ -16,6 +16,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -33,6 +34,45 @@ const (
 	TypeHttpRoute ProtectedEndpointType = "HttpRoute"
 )
 
+// +kubebuilder:validation:Enum=Any;All
+type ClaimMatchMode string
+
+const (
+	// The rule is satisfied if any of the conditions holds
+	ClaimMatchAny ClaimMatchMode = "Any"
+
+	// The rule is satisfied if all of the conditions hold
+	ClaimMatchAll ClaimMatchMode = "All"
+)
+
+type ClaimCondition struct {
+	// Name of a top level claim of the id token, e.g. email, sub, groups or a custom claim
+	// +kubebuilder:validation:MinLength=1
+	Claim string `json:"claim"`
+
+	// The condition holds if the claim matches any of the values. For list claims, e.g. groups,
+	// it holds if any item matches. A value matches by prefix if it ends with *, by suffix if
+	// it starts with *, e.g. "*@example.com" matches the emails of a domain. "*" matches any value.
+	// +kubebuilder:validation:MinItems=1
+	Values []string `json:"values"`
+}
+
+// AuthorizationRule restricts the requests to some paths and methods to the users with matched claims.
+type AuthorizationRule struct {
+	// Paths the rule applies to. A prefix matches the path equals to it, or under it, e.g. /admin matches /admin and /admin/users.
+	// Empty means all paths. Paths are the ones received by the workload, after the rewrites of routes.
+	PathPrefixes []string `json:"pathPrefixes,omitempty"`
+
+	// HTTP methods the rule applies to, empty means all methods.
+	Methods []string `json:"methods,omitempty"`
+
+	// Default to Any
+	Match ClaimMatchMode `json:"match,omitempty"`
+
+	// +kubebuilder:validation:MinItems=1
+	Conditions []ClaimCondition `json:"conditions"`
+}
+
 // ProtectedEndpointSpec defines the desired state of ProtectedEndpoint
 type ProtectedEndpointSpec struct {
 	// +kubebuilder:validation:MinLength=1
@@ -46,14 +86,81 @@ type ProtectedEndpointSpec struct {
 	// This flag should be set carefully. Please make sure that the upstream can handle the token correctly.
 	// Otherwise, client can bypass kalm sso by sending a not empty bearer token.
 	AllowToPassIfHasBearerToken bool `json:"allowToPassIfHasBearerToken,omitempty"`
+
+	// Allow services to access the endpoint with the api keys and the access tokens of the client credentials
+	// issued by kalm, the SSOCredentials need to have the endpoint in their scopes.
+	AllowCredentials bool `json:"allowCredentials,omitempty"`
+
+	// A request has to satisfy all the rules applying to its path and method, in addition to the groups.
+	// Requests with bearer tokens let pass by the auth proxy are checked by an istio AuthorizationPolicy
+	// with the same rules, their tokens have to be id tokens issued by the sso.
+	AuthorizationRules []AuthorizationRule `json:"authorizationRules,omitempty"`
 }
 
 // ProtectedEndpointStatus defines the observed state of ProtectedEndpoint
 type ProtectedEndpointStatus struct {
+	// The generation of the protected endpoint spec that this status was computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	Conditions []ProtectedEndpointCondition `json:"conditions,omitempty"`
+
+	// Issuer of the id tokens accepted by the endpoint, from the sso config.
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+
+	// Workloads of the protected component, in the format of Kind/name.
+	// +optional
+	MatchedWorkloads []string `json:"matchedWorkloads,omitempty"`
+
+	// Ports the envoy filter applies to. All ports of the containers if no port is set in the spec.
+	// +optional
+	ProtectedPorts []uint32 `json:"protectedPorts,omitempty"`
+
+	// Running pods of the protected component.
+	MatchedPods int `json:"matchedPods"`
+
+	// Running pods carrying the envoy filter. Pods without the istio sidecar are not protected.
+	ProtectedPods int `json:"protectedPods"`
+}
+
+type ProtectedEndpointConditionType string
+
+const (
+	// The filter is applied, and all running pods carry it.
+	ProtectedEndpointConditionReady ProtectedEndpointConditionType = "Ready"
+	// The sso config is missing, or the istio resources failed to apply.
+	ProtectedEndpointConditionError ProtectedEndpointConditionType = "Error"
+)
+
+type ProtectedEndpointCondition struct {
+	// Type of the condition, one of ('Ready', 'Error').
+	Type ProtectedEndpointConditionType `json:"type"`
+
+	// Status of the condition, one of ('True', 'False', 'Unknown').
+	Status corev1.ConditionStatus `json:"status"`
+
+	// Last time the condition transitioned from one status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a brief machine readable explanation for the condition's last
+	// transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the details of the last
+	// transition, complementing reason.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Type",type="string",JSONPath=".spec.type"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Protected Pods",type="integer",JSONPath=".status.protectedPods"
 
 // ProtectedEndpoint is the Schema for the protectedendpoints API
 type ProtectedEndpoint struct {
@@ -21,6 +21,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"strings"
 )
 
 // log is for logging in this package.
@@ -73,9 +74,73 @@ func (r *ProtectedEndpoint) validate() error {
 		}
 	}
 
+	for i, rule := range r.Spec.AuthorizationRules {
+		rst = append(rst, validateAuthorizationRule(rule, fmt.Sprintf("spec.authorizationRules[%d]", i))...)
+	}
+
 	if len(rst) == 0 {
 		return nil
 	}
 
 	return rst
 }
+
+var validAuthorizationRuleMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+// the rules are also rendered into istio AuthorizationPolicies, values must be valid there
+func validateAuthorizationRule(rule AuthorizationRule, path string) (rst KalmValidateErrorList) {
+	for i, prefix := range rule.PathPrefixes {
+		if !strings.HasPrefix(prefix, "/") || strings.Contains(prefix, "*") {
+			rst = append(rst, KalmValidateError{
+				Err:  "path prefix should start with / and not contain *",
+				Path: fmt.Sprintf("%s.pathPrefixes[%d]", path, i),
+			})
+		}
+	}
+
+	for i, method := range rule.Methods {
+		if !validAuthorizationRuleMethods[method] {
+			rst = append(rst, KalmValidateError{
+				Err:  "invalid method, should be an upper case HTTP method",
+				Path: fmt.Sprintf("%s.methods[%d]", path, i),
+			})
+		}
+	}
+
+	if len(rule.Conditions) == 0 {
+		rst = append(rst, KalmValidateError{
+			Err:  "at least one condition is required",
+			Path: path + ".conditions",
+		})
+	}
+
+	for i, condition := range rule.Conditions {
+		if condition.Claim == "" || strings.ContainsAny(condition.Claim, "[] ") {
+			rst = append(rst, KalmValidateError{
+				Err:  "claim should be a top level claim name",
+				Path: fmt.Sprintf("%s.conditions[%d].claim", path, i),
+			})
+		}
+
+		if len(condition.Values) == 0 {
+			rst = append(rst, KalmValidateError{
+				Err:  "at least one value is required",
+				Path: fmt.Sprintf("%s.conditions[%d].values", path, i),
+			})
+		}
+
+		for j, value := range condition.Values {
+			if value == "" {
+				rst = append(rst, KalmValidateError{
+					Err:  "value should not be empty",
+					Path: fmt.Sprintf("%s.conditions[%d].values[%d]", path, i, j),
+				})
+			}
+		}
+	}
+
+	return rst
+}
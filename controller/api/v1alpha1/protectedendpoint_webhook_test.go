@@ -30,4 +30,33 @@ func TestProtectedEndpoint_Validate(t *testing.T) {
 	protectedEndpoint.Spec.EndpointName = "valid-ep-name"
 	protectedEndpoint.Spec.Ports = []uint32{0}
 	assert.NotNil(t, protectedEndpoint.validate())
+
+	// invalid authorization rules
+	protectedEndpoint.Spec.Ports = []uint32{8080}
+	protectedEndpoint.Spec.AuthorizationRules = []AuthorizationRule{
+		{
+			PathPrefixes: []string{"/admin"},
+			Methods:      []string{"POST", "DELETE"},
+			Match:        ClaimMatchAll,
+			Conditions: []ClaimCondition{
+				{Claim: "email", Values: []string{"*@example.com"}},
+				{Claim: "groups", Values: []string{"admin"}},
+			},
+		},
+	}
+	assert.Nil(t, protectedEndpoint.validate())
+
+	protectedEndpoint.Spec.AuthorizationRules[0].PathPrefixes = []string{"admin*"}
+	assert.NotNil(t, protectedEndpoint.validate())
+
+	protectedEndpoint.Spec.AuthorizationRules[0].PathPrefixes = nil
+	protectedEndpoint.Spec.AuthorizationRules[0].Methods = []string{"post"}
+	assert.NotNil(t, protectedEndpoint.validate())
+
+	protectedEndpoint.Spec.AuthorizationRules[0].Methods = nil
+	protectedEndpoint.Spec.AuthorizationRules[0].Conditions[0].Claim = "user[email]"
+	assert.NotNil(t, protectedEndpoint.validate())
+
+	protectedEndpoint.Spec.AuthorizationRules[0].Conditions = nil
+	assert.NotNil(t, protectedEndpoint.validate())
 }
@@ -65,6 +65,18 @@ type SingleSignOnConfigSpec struct {
 
 	// Create service entry if the ext_authz service is running out of istio mesh
 	ExternalEnvoyExtAuthz *ExtAuthzEndpoint `json:"externalEnvoyExtAuthz,omitempty"`
+
+	// Replicas of the internal auth proxy, default to 1.
+	// With more than one replica, refreshes of tokens are coordinated through leases in the dex namespace.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	AuthProxyReplicas *int32 `json:"authProxyReplicas,omitempty"`
+
+	// Where the internal auth proxy keeps sessions. By default, tokens are kept in cookies and sessions can't be revoked.
+	// With "secret", each session is saved as a secret in the kalm-sso-sessions namespace, and can be listed and revoked by admins.
+	// +kubebuilder:validation:Enum=secret
+	// +optional
+	AuthProxySessionStore string `json:"authProxySessionStore,omitempty"`
 }
 
 // SingleSignOnConfigStatus defines the observed state of SingleSignOnConfig
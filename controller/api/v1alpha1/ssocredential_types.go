@@ -0,0 +1,93 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:Enum=apiKey;clientCredentials
+type SSOCredentialType string
+
+const (
+	// The key is sent as the bearer token of requests
+	SSOCredentialTypeAPIKey SSOCredentialType = "apiKey"
+
+	// The credential name and secret are the client id and client secret of the oauth2 client credentials grant,
+	// the access tokens issued by the auth proxy are sent as bearer tokens
+	SSOCredentialTypeClientCredentials SSOCredentialType = "clientCredentials"
+)
+
+// SSOCredentialSpec defines the desired state of SSOCredential
+type SSOCredentialSpec struct {
+	Type SSOCredentialType `json:"type"`
+
+	// Protected endpoints the credential can access, in the format of namespace/name, name is the name of the protected component.
+	// namespace/* means all protected endpoints in the namespace.
+	// +kubebuilder:validation:MinItems=1
+	Scopes []string `json:"scopes"`
+
+	// Hex encoded sha256 of the secret. The secret is only returned once when the credential is created by kalm.
+	// +kubebuilder:validation:Pattern=^[0-9a-f]{64}$
+	SecretHash string `json:"secretHash"`
+
+	// The credential is rejected after this time, never expires if not set
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// +optional
+	Creator string `json:"creator,omitempty"`
+}
+
+// SSOCredentialStatus defines the observed state of SSOCredential
+type SSOCredentialStatus struct {
+	LastUsedTimestamp int `json:"lastUsedTimestamp"`
+	UsedCount         int `json:"usedCount"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Type",type="string",JSONPath=".spec.type"
+// +kubebuilder:printcolumn:name="Scopes",type="string",JSONPath=".spec.scopes"
+// +kubebuilder:printcolumn:name="Expires At",type="date",JSONPath=".spec.expiresAt"
+// +kubebuilder:printcolumn:name="Used Count",type="integer",JSONPath=".status.usedCount"
+
+// SSOCredential is the Schema for the ssocredentials API.
+// Credentials let services access protected endpoints without logging in. They are only read from the dex namespace.
+type SSOCredential struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SSOCredentialSpec   `json:"spec,omitempty"`
+	Status SSOCredentialStatus `json:"status,omitempty"`
+}
+
+func (c *SSOCredential) IsExpired() bool {
+	return c.Spec.ExpiresAt != nil && metav1.Now().After(c.Spec.ExpiresAt.Time)
+}
+
+// +kubebuilder:object:root=true
+
+// SSOCredentialList contains a list of SSOCredential
+type SSOCredentialList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SSOCredential `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SSOCredential{}, &SSOCredentialList{})
+}
@@ -0,0 +1,124 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var ssocredentiallog = logf.Log.WithName("ssocredential-resource")
+
+var ssoCredentialSecretHashRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func (r *SSOCredential) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-core-kalm-dev-v1alpha1-ssocredential,mutating=false,failurePolicy=fail,groups=core.kalm.dev,resources=ssocredentials,versions=v1alpha1,name=vssocredential.kb.io
+
+var _ webhook.Validator = &SSOCredential{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *SSOCredential) ValidateCreate() error {
+	ssocredentiallog.Info("validate create", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *SSOCredential) ValidateUpdate(old runtime.Object) error {
+	ssocredentiallog.Info("validate update", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *SSOCredential) ValidateDelete() error {
+	ssocredentiallog.Info("validate delete", "name", r.Name)
+	return nil
+}
+
+func (r *SSOCredential) validate() error {
+	var rst KalmValidateErrorList
+
+	switch r.Spec.Type {
+	case SSOCredentialTypeAPIKey, SSOCredentialTypeClientCredentials:
+	default:
+		rst = append(rst, KalmValidateError{
+			Err:  fmt.Sprintf("unknown type: %s", r.Spec.Type),
+			Path: "spec.type",
+		})
+	}
+
+	if !ssoCredentialSecretHashRegex.MatchString(r.Spec.SecretHash) {
+		rst = append(rst, KalmValidateError{
+			Err:  "secretHash should be a hex encoded sha256",
+			Path: "spec.secretHash",
+		})
+	}
+
+	if len(r.Spec.Scopes) == 0 {
+		rst = append(rst, KalmValidateError{
+			Err:  "at lease 1 namespace/name for SSOCredential",
+			Path: "spec.scopes",
+		})
+	}
+
+	for i, scope := range r.Spec.Scopes {
+		pair := strings.Split(scope, "/")
+		if len(pair) != 2 {
+			rst = append(rst, KalmValidateError{
+				Err:  fmt.Sprintf("invalid namespace/name: %s", scope),
+				Path: fmt.Sprintf("spec.scopes[%d]", i),
+			})
+			continue
+		}
+
+		ns := pair[0]
+		errs := apimachineryvalidation.ValidateNamespaceName(ns, false)
+		if len(errs) != 0 {
+			rst = append(rst, KalmValidateError{
+				Err:  fmt.Sprintf("invalid namespace: %s", ns),
+				Path: fmt.Sprintf("spec.scopes[%d]", i),
+			})
+		}
+
+		name := pair[1]
+		if name != "*" && !isValidResourceName(name) {
+			rst = append(rst, KalmValidateError{
+				Err:  fmt.Sprintf("invalid protected endpoint name: %s", name),
+				Path: fmt.Sprintf("spec.scopes[%d]", i),
+			})
+		}
+	}
+
+	if len(rst) == 0 {
+		return nil
+	}
+
+	return rst
+}
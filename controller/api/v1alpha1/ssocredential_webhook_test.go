@@ -0,0 +1,51 @@
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestSSOCredential_Validate(t *testing.T) {
+	credential := SSOCredential{
+		ObjectMeta: ctrl.ObjectMeta{
+			Namespace: "kalm-system",
+			Name:      "ci",
+		},
+		Spec: SSOCredentialSpec{
+			Type:       SSOCredentialTypeAPIKey,
+			Scopes:     []string{"default/web", "staging/*"},
+			SecretHash: strings.Repeat("a1", 32),
+		},
+	}
+
+	assert.Nil(t, credential.validate())
+
+	credential.Spec.Type = SSOCredentialTypeClientCredentials
+	assert.Nil(t, credential.validate())
+
+	// unknown type
+	credential.Spec.Type = "password"
+	assert.NotNil(t, credential.validate())
+
+	// invalid secret hash
+	credential.Spec.Type = SSOCredentialTypeAPIKey
+	credential.Spec.SecretHash = "not-a-hash"
+	assert.NotNil(t, credential.validate())
+
+	// invalid scopes
+	credential.Spec.SecretHash = strings.Repeat("a1", 32)
+	credential.Spec.Scopes = nil
+	assert.NotNil(t, credential.validate())
+
+	credential.Spec.Scopes = []string{"web"}
+	assert.NotNil(t, credential.validate())
+
+	credential.Spec.Scopes = []string{"Default/web"}
+	assert.NotNil(t, credential.validate())
+
+	credential.Spec.Scopes = []string{"default/web*"}
+	assert.NotNil(t, credential.validate())
+}
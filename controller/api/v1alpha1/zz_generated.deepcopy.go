@@ -40,6 +40,121 @@ func (in *ACMECloudFlareIssuer) DeepCopy() *ACMECloudFlareIssuer {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthorizationRule) DeepCopyInto(out *AuthorizationRule) {
+	*out = *in
+	if in.PathPrefixes != nil {
+		in, out := &in.PathPrefixes, &out.PathPrefixes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Methods != nil {
+		in, out := &in.Methods, &out.Methods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ClaimCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthorizationRule.
+func (in *AuthorizationRule) DeepCopy() *AuthorizationRule {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthorizationRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoRollback) DeepCopyInto(out *AutoRollback) {
+	*out = *in
+	if in.MinSuccessRate != nil {
+		in, out := &in.MinSuccessRate, &out.MinSuccessRate
+		*out = new(int)
+		**out = **in
+	}
+	if in.MaxLatencyMilliseconds != nil {
+		in, out := &in.MaxLatencyMilliseconds, &out.MaxLatencyMilliseconds
+		*out = new(int)
+		**out = **in
+	}
+	if in.AnalysisSeconds != nil {
+		in, out := &in.AnalysisSeconds, &out.AnalysisSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoRollback.
+func (in *AutoRollback) DeepCopy() *AutoRollback {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoRollback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Autoscaling) DeepCopyInto(out *Autoscaling) {
+	*out = *in
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetCPUUtilizationPercentage != nil {
+		in, out := &in.TargetCPUUtilizationPercentage, &out.TargetCPUUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetMemoryUtilizationPercentage != nil {
+		in, out := &in.TargetMemoryUtilizationPercentage, &out.TargetMemoryUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CustomMetrics != nil {
+		in, out := &in.CustomMetrics, &out.CustomMetrics
+		*out = make([]AutoscalingMetric, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Autoscaling.
+func (in *Autoscaling) DeepCopy() *Autoscaling {
+	if in == nil {
+		return nil
+	}
+	out := new(Autoscaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalingMetric) DeepCopyInto(out *AutoscalingMetric) {
+	*out = *in
+	out.TargetAverageValue = in.TargetAverageValue.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingMetric.
+func (in *AutoscalingMetric) DeepCopy() *AutoscalingMetric {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingMetric)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CAForTestIssuer) DeepCopyInto(out *CAForTestIssuer) {
 	*out = *in
@@ -55,13 +170,33 @@ func (in *CAForTestIssuer) DeepCopy() *CAForTestIssuer {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClaimCondition) DeepCopyInto(out *ClaimCondition) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClaimCondition.
+func (in *ClaimCondition) DeepCopy() *ClaimCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ClaimCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Component) DeepCopyInto(out *Component) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Component.
@@ -82,6 +217,45 @@ func (in *Component) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentAutoRollbackStatus) DeepCopyInto(out *ComponentAutoRollbackStatus) {
+	*out = *in
+	if in.AnalysisStartedAt != nil {
+		in, out := &in.AnalysisStartedAt, &out.AnalysisStartedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.RolledBackAt != nil {
+		in, out := &in.RolledBackAt, &out.RolledBackAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentAutoRollbackStatus.
+func (in *ComponentAutoRollbackStatus) DeepCopy() *ComponentAutoRollbackStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentAutoRollbackStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentCondition) DeepCopyInto(out *ComponentCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentCondition.
+func (in *ComponentCondition) DeepCopy() *ComponentCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComponentList) DeepCopyInto(out *ComponentList) {
 	*out = *in
@@ -114,6 +288,22 @@ func (in *ComponentList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentPinnedImage) DeepCopyInto(out *ComponentPinnedImage) {
+	*out = *in
+	in.ResolvedAt.DeepCopyInto(&out.ResolvedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentPinnedImage.
+func (in *ComponentPinnedImage) DeepCopy() *ComponentPinnedImage {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentPinnedImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComponentPlugin) DeepCopyInto(out *ComponentPlugin) {
 	*out = *in
@@ -307,6 +497,29 @@ func (in *ComponentPluginStatus) DeepCopy() *ComponentPluginStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentRolloutStatus) DeepCopyInto(out *ComponentRolloutStatus) {
+	*out = *in
+	if in.StartedAt != nil {
+		in, out := &in.StartedAt, &out.StartedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.StepStartedAt != nil {
+		in, out := &in.StepStartedAt, &out.StepStartedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentRolloutStatus.
+func (in *ComponentRolloutStatus) DeepCopy() *ComponentRolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentRolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComponentSpec) DeepCopyInto(out *ComponentSpec) {
 	*out = *in
@@ -334,6 +547,11 @@ func (in *ComponentSpec) DeepCopyInto(out *ComponentSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(Autoscaling)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.NodeSelectorLabels != nil {
 		in, out := &in.NodeSelectorLabels, &out.NodeSelectorLabels
 		*out = make(map[string]string, len(*in))
@@ -386,6 +604,21 @@ func (in *ComponentSpec) DeepCopyInto(out *ComponentSpec) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.ProgressiveRollout != nil {
+		in, out := &in.ProgressiveRollout, &out.ProgressiveRollout
+		*out = new(ProgressiveRollout)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AutoRollback != nil {
+		in, out := &in.AutoRollback, &out.AutoRollback
+		*out = new(AutoRollback)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImageUpdatePolicy != nil {
+		in, out := &in.ImageUpdatePolicy, &out.ImageUpdatePolicy
+		*out = new(ImageUpdatePolicy)
+		**out = **in
+	}
 	if in.Volumes != nil {
 		in, out := &in.Volumes, &out.Volumes
 		*out = make([]Volume, len(*in))
@@ -393,6 +626,20 @@ func (in *ComponentSpec) DeepCopyInto(out *ComponentSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.InitContainers != nil {
+		in, out := &in.InitContainers, &out.InitContainers
+		*out = make([]Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Sidecars != nil {
+		in, out := &in.Sidecars, &out.Sidecars
+		*out = make([]Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.RunnerPermission != nil {
 		in, out := &in.RunnerPermission, &out.RunnerPermission
 		*out = new(RunnerPermission)
@@ -430,6 +677,28 @@ func (in *ComponentSpec) DeepCopy() *ComponentSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComponentStatus) DeepCopyInto(out *ComponentStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ComponentCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(ComponentRolloutStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AutoRollback != nil {
+		in, out := &in.AutoRollback, &out.AutoRollback
+		*out = new(ComponentAutoRollbackStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PinnedImage != nil {
+		in, out := &in.PinnedImage, &out.PinnedImage
+		*out = new(ComponentPinnedImage)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentStatus.
@@ -579,6 +848,81 @@ func (in *Config) DeepCopy() *Config {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Container) DeepCopyInto(out *Container) {
+	*out = *in
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]EnvVar, len(*in))
+		copy(*out, *in)
+	}
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]ContainerPort, len(*in))
+		copy(*out, *in)
+	}
+	if in.LivenessProbe != nil {
+		in, out := &in.LivenessProbe, &out.LivenessProbe
+		*out = new(corev1.Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadinessProbe != nil {
+		in, out := &in.ReadinessProbe, &out.ReadinessProbe
+		*out = new(corev1.Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResourceRequirements != nil {
+		in, out := &in.ResourceRequirements, &out.ResourceRequirements
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VolumeMounts != nil {
+		in, out := &in.VolumeMounts, &out.VolumeMounts
+		*out = make([]ContainerVolumeMount, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Container.
+func (in *Container) DeepCopy() *Container {
+	if in == nil {
+		return nil
+	}
+	out := new(Container)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerPort) DeepCopyInto(out *ContainerPort) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerPort.
+func (in *ContainerPort) DeepCopy() *ContainerPort {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerPort)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerVolumeMount) DeepCopyInto(out *ContainerVolumeMount) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerVolumeMount.
+func (in *ContainerVolumeMount) DeepCopy() *ContainerVolumeMount {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerVolumeMount)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DeployKey) DeepCopyInto(out *DeployKey) {
 	*out = *in
@@ -801,6 +1145,10 @@ func (in *DockerRegistryStatus) DeepCopyInto(out *DockerRegistryStatus) {
 			}
 		}
 	}
+	if in.CredentialsExpireAt != nil {
+		in, out := &in.CredentialsExpireAt, &out.CredentialsExpireAt
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DockerRegistryStatus.
@@ -813,6 +1161,21 @@ func (in *DockerRegistryStatus) DeepCopy() *DockerRegistryStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ElasticsearchSinkConfig) DeepCopyInto(out *ElasticsearchSinkConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ElasticsearchSinkConfig.
+func (in *ElasticsearchSinkConfig) DeepCopy() *ElasticsearchSinkConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ElasticsearchSinkConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvVar) DeepCopyInto(out *EnvVar) {
 	*out = *in
@@ -844,22 +1207,182 @@ func (in *ExtAuthzEndpoint) DeepCopy() *ExtAuthzEndpoint {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GrafanaConfig) DeepCopyInto(out *GrafanaConfig) {
+func (in *ExternalLogSystemConfig) DeepCopyInto(out *ExternalLogSystemConfig) {
 	*out = *in
+	if in.FluentBit != nil {
+		in, out := &in.FluentBit, &out.FluentBit
+		*out = new(FluentBitConfig)
+		**out = **in
+	}
+	if in.Sinks != nil {
+		in, out := &in.Sinks, &out.Sinks
+		*out = make([]LogSink, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaConfig.
-func (in *GrafanaConfig) DeepCopy() *GrafanaConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalLogSystemConfig.
+func (in *ExternalLogSystemConfig) DeepCopy() *ExternalLogSystemConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(GrafanaConfig)
+	out := new(ExternalLogSystemConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *HTTP01Issuer) DeepCopyInto(out *HTTP01Issuer) {
+func (in *FluentBitConfig) DeepCopyInto(out *FluentBitConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FluentBitConfig.
+func (in *FluentBitConfig) DeepCopy() *FluentBitConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(FluentBitConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitSource) DeepCopyInto(out *GitSource) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitSource.
+func (in *GitSource) DeepCopy() *GitSource {
+	if in == nil {
+		return nil
+	}
+	out := new(GitSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *GitSource) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitSourceList) DeepCopyInto(out *GitSourceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]GitSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitSourceList.
+func (in *GitSourceList) DeepCopy() *GitSourceList {
+	if in == nil {
+		return nil
+	}
+	out := new(GitSourceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *GitSourceList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitSourceResource) DeepCopyInto(out *GitSourceResource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitSourceResource.
+func (in *GitSourceResource) DeepCopy() *GitSourceResource {
+	if in == nil {
+		return nil
+	}
+	out := new(GitSourceResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitSourceSpec) DeepCopyInto(out *GitSourceSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitSourceSpec.
+func (in *GitSourceSpec) DeepCopy() *GitSourceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GitSourceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitSourceStatus) DeepCopyInto(out *GitSourceStatus) {
+	*out = *in
+	if in.LastSyncTime != nil {
+		in, out := &in.LastSyncTime, &out.LastSyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]GitSourceResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.Drifted != nil {
+		in, out := &in.Drifted, &out.Drifted
+		*out = make([]GitSourceResource, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitSourceStatus.
+func (in *GitSourceStatus) DeepCopy() *GitSourceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GitSourceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GrafanaConfig) DeepCopyInto(out *GrafanaConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaConfig.
+func (in *GrafanaConfig) DeepCopy() *GrafanaConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(GrafanaConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTP01Issuer) DeepCopyInto(out *HTTP01Issuer) {
 	*out = *in
 }
 
@@ -873,6 +1396,21 @@ func (in *HTTP01Issuer) DeepCopy() *HTTP01Issuer {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPSinkConfig) DeepCopyInto(out *HTTPSinkConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPSinkConfig.
+func (in *HTTPSinkConfig) DeepCopy() *HTTPSinkConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPSinkConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HttpRoute) DeepCopyInto(out *HttpRoute) {
 	*out = *in
@@ -1374,60 +1912,25 @@ func (in *HttpsCertStatus) DeepCopy() *HttpsCertStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KalmValidateError) DeepCopyInto(out *KalmValidateError) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KalmValidateError.
-func (in *KalmValidateError) DeepCopy() *KalmValidateError {
-	if in == nil {
-		return nil
-	}
-	out := new(KalmValidateError)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in KalmValidateErrorList) DeepCopyInto(out *KalmValidateErrorList) {
-	{
-		in := &in
-		*out = make(KalmValidateErrorList, len(*in))
-		copy(*out, *in)
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KalmValidateErrorList.
-func (in KalmValidateErrorList) DeepCopy() KalmValidateErrorList {
-	if in == nil {
-		return nil
-	}
-	out := new(KalmValidateErrorList)
-	in.DeepCopyInto(out)
-	return *out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *LogSystem) DeepCopyInto(out *LogSystem) {
+func (in *ImagePolicy) DeepCopyInto(out *ImagePolicy) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystem.
-func (in *LogSystem) DeepCopy() *LogSystem {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePolicy.
+func (in *ImagePolicy) DeepCopy() *ImagePolicy {
 	if in == nil {
 		return nil
 	}
-	out := new(LogSystem)
+	out := new(ImagePolicy)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *LogSystem) DeepCopyObject() runtime.Object {
+func (in *ImagePolicy) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -1435,31 +1938,31 @@ func (in *LogSystem) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *LogSystemList) DeepCopyInto(out *LogSystemList) {
+func (in *ImagePolicyList) DeepCopyInto(out *ImagePolicyList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]LogSystem, len(*in))
+		*out = make([]ImagePolicy, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystemList.
-func (in *LogSystemList) DeepCopy() *LogSystemList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePolicyList.
+func (in *ImagePolicyList) DeepCopy() *ImagePolicyList {
 	if in == nil {
 		return nil
 	}
-	out := new(LogSystemList)
+	out := new(ImagePolicyList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *LogSystemList) DeepCopyObject() runtime.Object {
+func (in *ImagePolicyList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -1467,122 +1970,427 @@ func (in *LogSystemList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *LogSystemSpec) DeepCopyInto(out *LogSystemSpec) {
+func (in *ImagePolicySpec) DeepCopyInto(out *ImagePolicySpec) {
 	*out = *in
-	if in.PLGConfig != nil {
-		in, out := &in.PLGConfig, &out.PLGConfig
-		*out = new(PLGConfig)
-		(*in).DeepCopyInto(*out)
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
 	}
-	if in.StorageClass != nil {
-		in, out := &in.StorageClass, &out.StorageClass
-		*out = new(string)
+	if in.AllowedRegistries != nil {
+		in, out := &in.AllowedRegistries, &out.AllowedRegistries
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Scanner != nil {
+		in, out := &in.Scanner, &out.Scanner
+		*out = new(ImageScanner)
 		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystemSpec.
-func (in *LogSystemSpec) DeepCopy() *LogSystemSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePolicySpec.
+func (in *ImagePolicySpec) DeepCopy() *ImagePolicySpec {
 	if in == nil {
 		return nil
 	}
-	out := new(LogSystemSpec)
+	out := new(ImagePolicySpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *LogSystemStatus) DeepCopyInto(out *LogSystemStatus) {
+func (in *ImageScanner) DeepCopyInto(out *ImageScanner) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystemStatus.
-func (in *LogSystemStatus) DeepCopy() *LogSystemStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageScanner.
+func (in *ImageScanner) DeepCopy() *ImageScanner {
 	if in == nil {
 		return nil
 	}
-	out := new(LogSystemStatus)
+	out := new(ImageScanner)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *LokiConfig) DeepCopyInto(out *LokiConfig) {
+func (in *ImageUpdatePolicy) DeepCopyInto(out *ImageUpdatePolicy) {
 	*out = *in
-	if in.DiskSize != nil {
-		in, out := &in.DiskSize, &out.DiskSize
-		x := (*in).DeepCopy()
-		*out = &x
-	}
-	if in.StorageClass != nil {
-		in, out := &in.StorageClass, &out.StorageClass
-		*out = new(string)
-		**out = **in
-	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LokiConfig.
-func (in *LokiConfig) DeepCopy() *LokiConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageUpdatePolicy.
+func (in *ImageUpdatePolicy) DeepCopy() *ImageUpdatePolicy {
 	if in == nil {
 		return nil
 	}
-	out := new(LokiConfig)
+	out := new(ImageUpdatePolicy)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PLGConfig) DeepCopyInto(out *PLGConfig) {
+func (in *KalmValidateError) DeepCopyInto(out *KalmValidateError) {
 	*out = *in
-	if in.Loki != nil {
-		in, out := &in.Loki, &out.Loki
-		*out = new(LokiConfig)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.Grafana != nil {
-		in, out := &in.Grafana, &out.Grafana
-		*out = new(GrafanaConfig)
-		**out = **in
-	}
-	if in.Promtail != nil {
-		in, out := &in.Promtail, &out.Promtail
-		*out = new(PromtailConfig)
-		**out = **in
-	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PLGConfig.
-func (in *PLGConfig) DeepCopy() *PLGConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KalmValidateError.
+func (in *KalmValidateError) DeepCopy() *KalmValidateError {
 	if in == nil {
 		return nil
 	}
-	out := new(PLGConfig)
+	out := new(KalmValidateError)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PluginIngress) DeepCopyInto(out *PluginIngress) {
-	*out = *in
-	if in.Hosts != nil {
-		in, out := &in.Hosts, &out.Hosts
-		*out = make([]string, len(*in))
+func (in KalmValidateErrorList) DeepCopyInto(out *KalmValidateErrorList) {
+	{
+		in := &in
+		*out = make(KalmValidateErrorList, len(*in))
 		copy(*out, *in)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginIngress.
-func (in *PluginIngress) DeepCopy() *PluginIngress {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KalmValidateErrorList.
+func (in KalmValidateErrorList) DeepCopy() KalmValidateErrorList {
 	if in == nil {
 		return nil
 	}
-	out := new(PluginIngress)
+	out := new(KalmValidateErrorList)
 	in.DeepCopyInto(out)
-	return out
+	return *out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PluginManualScaler) DeepCopyInto(out *PluginManualScaler) {
+func (in *LogSink) DeepCopyInto(out *LogSink) {
+	*out = *in
+	if in.Elasticsearch != nil {
+		in, out := &in.Elasticsearch, &out.Elasticsearch
+		*out = new(ElasticsearchSinkConfig)
+		**out = **in
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPSinkConfig)
+		**out = **in
+	}
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(S3SinkConfig)
+		**out = **in
+	}
+	if in.Loki != nil {
+		in, out := &in.Loki, &out.Loki
+		*out = new(LokiSinkConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSink.
+func (in *LogSink) DeepCopy() *LogSink {
+	if in == nil {
+		return nil
+	}
+	out := new(LogSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogSystem) DeepCopyInto(out *LogSystem) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystem.
+func (in *LogSystem) DeepCopy() *LogSystem {
+	if in == nil {
+		return nil
+	}
+	out := new(LogSystem)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LogSystem) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogSystemCondition) DeepCopyInto(out *LogSystemCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystemCondition.
+func (in *LogSystemCondition) DeepCopy() *LogSystemCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(LogSystemCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogSystemList) DeepCopyInto(out *LogSystemList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LogSystem, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystemList.
+func (in *LogSystemList) DeepCopy() *LogSystemList {
+	if in == nil {
+		return nil
+	}
+	out := new(LogSystemList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LogSystemList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogSystemLokiStatus) DeepCopyInto(out *LogSystemLokiStatus) {
+	*out = *in
+	if in.DiskCapacity != nil {
+		in, out := &in.DiskCapacity, &out.DiskCapacity
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.DiskUsed != nil {
+		in, out := &in.DiskUsed, &out.DiskUsed
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.DiskUsageUpdatedAt != nil {
+		in, out := &in.DiskUsageUpdatedAt, &out.DiskUsageUpdatedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystemLokiStatus.
+func (in *LogSystemLokiStatus) DeepCopy() *LogSystemLokiStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LogSystemLokiStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogSystemSpec) DeepCopyInto(out *LogSystemSpec) {
+	*out = *in
+	if in.PLGConfig != nil {
+		in, out := &in.PLGConfig, &out.PLGConfig
+		*out = new(PLGConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExternalConfig != nil {
+		in, out := &in.ExternalConfig, &out.ExternalConfig
+		*out = new(ExternalLogSystemConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StorageClass != nil {
+		in, out := &in.StorageClass, &out.StorageClass
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystemSpec.
+func (in *LogSystemSpec) DeepCopy() *LogSystemSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LogSystemSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogSystemStatus) DeepCopyInto(out *LogSystemStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]LogSystemCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Loki != nil {
+		in, out := &in.Loki, &out.Loki
+		*out = new(LogSystemLokiStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogSystemStatus.
+func (in *LogSystemStatus) DeepCopy() *LogSystemStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LogSystemStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LokiConfig) DeepCopyInto(out *LokiConfig) {
+	*out = *in
+	if in.DiskSize != nil {
+		in, out := &in.DiskSize, &out.DiskSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.StorageClass != nil {
+		in, out := &in.StorageClass, &out.StorageClass
+		*out = new(string)
+		**out = **in
+	}
+	if in.Distributed != nil {
+		in, out := &in.Distributed, &out.Distributed
+		*out = new(LokiDistributedConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LokiConfig.
+func (in *LokiConfig) DeepCopy() *LokiConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LokiConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LokiDistributedConfig) DeepCopyInto(out *LokiDistributedConfig) {
+	*out = *in
+	if in.ObjectStorage != nil {
+		in, out := &in.ObjectStorage, &out.ObjectStorage
+		*out = new(LokiObjectStorageConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LokiDistributedConfig.
+func (in *LokiDistributedConfig) DeepCopy() *LokiDistributedConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LokiDistributedConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LokiObjectStorageConfig) DeepCopyInto(out *LokiObjectStorageConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LokiObjectStorageConfig.
+func (in *LokiObjectStorageConfig) DeepCopy() *LokiObjectStorageConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LokiObjectStorageConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LokiSinkConfig) DeepCopyInto(out *LokiSinkConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LokiSinkConfig.
+func (in *LokiSinkConfig) DeepCopy() *LokiSinkConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LokiSinkConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PLGConfig) DeepCopyInto(out *PLGConfig) {
+	*out = *in
+	if in.Loki != nil {
+		in, out := &in.Loki, &out.Loki
+		*out = new(LokiConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Grafana != nil {
+		in, out := &in.Grafana, &out.Grafana
+		*out = new(GrafanaConfig)
+		**out = **in
+	}
+	if in.Promtail != nil {
+		in, out := &in.Promtail, &out.Promtail
+		*out = new(PromtailConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PLGConfig.
+func (in *PLGConfig) DeepCopy() *PLGConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PLGConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PluginIngress) DeepCopyInto(out *PluginIngress) {
+	*out = *in
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginIngress.
+func (in *PluginIngress) DeepCopy() *PluginIngress {
+	if in == nil {
+		return nil
+	}
+	out := new(PluginIngress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PluginManualScaler) DeepCopyInto(out *PluginManualScaler) {
 	*out = *in
 }
 
@@ -1591,37 +2399,281 @@ func (in *PluginManualScaler) DeepCopy() *PluginManualScaler {
 	if in == nil {
 		return nil
 	}
-	out := new(PluginManualScaler)
+	out := new(PluginManualScaler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Port) DeepCopyInto(out *Port) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Port.
+func (in *Port) DeepCopy() *Port {
+	if in == nil {
+		return nil
+	}
+	out := new(Port)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreInjectFile) DeepCopyInto(out *PreInjectFile) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreInjectFile.
+func (in *PreInjectFile) DeepCopy() *PreInjectFile {
+	if in == nil {
+		return nil
+	}
+	out := new(PreInjectFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProgressiveRollout) DeepCopyInto(out *ProgressiveRollout) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]RolloutStep, len(*in))
+		copy(*out, *in)
+	}
+	if in.CanaryReplicas != nil {
+		in, out := &in.CanaryReplicas, &out.CanaryReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ProgressDeadlineSeconds != nil {
+		in, out := &in.ProgressDeadlineSeconds, &out.ProgressDeadlineSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProgressiveRollout.
+func (in *ProgressiveRollout) DeepCopy() *ProgressiveRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(ProgressiveRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PromotedComponent) DeepCopyInto(out *PromotedComponent) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotedComponent.
+func (in *PromotedComponent) DeepCopy() *PromotedComponent {
+	if in == nil {
+		return nil
+	}
+	out := new(PromotedComponent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Promotion) DeepCopyInto(out *Promotion) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Promotion.
+func (in *Promotion) DeepCopy() *Promotion {
+	if in == nil {
+		return nil
+	}
+	out := new(Promotion)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Promotion) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Port) DeepCopyInto(out *Port) {
+func (in *PromotionComponentOverride) DeepCopyInto(out *PromotionComponentOverride) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]EnvVar, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotionComponentOverride.
+func (in *PromotionComponentOverride) DeepCopy() *PromotionComponentOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(PromotionComponentOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PromotionHostOverride) DeepCopyInto(out *PromotionHostOverride) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Port.
-func (in *Port) DeepCopy() *Port {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotionHostOverride.
+func (in *PromotionHostOverride) DeepCopy() *PromotionHostOverride {
 	if in == nil {
 		return nil
 	}
-	out := new(Port)
+	out := new(PromotionHostOverride)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PreInjectFile) DeepCopyInto(out *PreInjectFile) {
+func (in *PromotionList) DeepCopyInto(out *PromotionList) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Promotion, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreInjectFile.
-func (in *PreInjectFile) DeepCopy() *PreInjectFile {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotionList.
+func (in *PromotionList) DeepCopy() *PromotionList {
 	if in == nil {
 		return nil
 	}
-	out := new(PreInjectFile)
+	out := new(PromotionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PromotionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PromotionRecord) DeepCopyInto(out *PromotionRecord) {
+	*out = *in
+	in.PromotedAt.DeepCopyInto(&out.PromotedAt)
+	if in.Components != nil {
+		in, out := &in.Components, &out.Components
+		*out = make([]PromotedComponent, len(*in))
+		copy(*out, *in)
+	}
+	if in.HttpRoutes != nil {
+		in, out := &in.HttpRoutes, &out.HttpRoutes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ProtectedEndpoints != nil {
+		in, out := &in.ProtectedEndpoints, &out.ProtectedEndpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ComponentPluginBindings != nil {
+		in, out := &in.ComponentPluginBindings, &out.ComponentPluginBindings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotionRecord.
+func (in *PromotionRecord) DeepCopy() *PromotionRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(PromotionRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PromotionSpec) DeepCopyInto(out *PromotionSpec) {
+	*out = *in
+	if in.Components != nil {
+		in, out := &in.Components, &out.Components
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HttpRoutes != nil {
+		in, out := &in.HttpRoutes, &out.HttpRoutes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ProtectedEndpoints != nil {
+		in, out := &in.ProtectedEndpoints, &out.ProtectedEndpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ComponentOverrides != nil {
+		in, out := &in.ComponentOverrides, &out.ComponentOverrides
+		*out = make([]PromotionComponentOverride, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HostOverrides != nil {
+		in, out := &in.HostOverrides, &out.HostOverrides
+		*out = make([]PromotionHostOverride, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotionSpec.
+func (in *PromotionSpec) DeepCopy() *PromotionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PromotionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PromotionStatus) DeepCopyInto(out *PromotionStatus) {
+	*out = *in
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]PromotionRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromotionStatus.
+func (in *PromotionStatus) DeepCopy() *PromotionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PromotionStatus)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -1647,7 +2699,7 @@ func (in *ProtectedEndpoint) DeepCopyInto(out *ProtectedEndpoint) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProtectedEndpoint.
@@ -1668,6 +2720,22 @@ func (in *ProtectedEndpoint) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProtectedEndpointCondition) DeepCopyInto(out *ProtectedEndpointCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProtectedEndpointCondition.
+func (in *ProtectedEndpointCondition) DeepCopy() *ProtectedEndpointCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ProtectedEndpointCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProtectedEndpointList) DeepCopyInto(out *ProtectedEndpointList) {
 	*out = *in
@@ -1713,6 +2781,13 @@ func (in *ProtectedEndpointSpec) DeepCopyInto(out *ProtectedEndpointSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.AuthorizationRules != nil {
+		in, out := &in.AuthorizationRules, &out.AuthorizationRules
+		*out = make([]AuthorizationRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProtectedEndpointSpec.
@@ -1728,6 +2803,23 @@ func (in *ProtectedEndpointSpec) DeepCopy() *ProtectedEndpointSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProtectedEndpointStatus) DeepCopyInto(out *ProtectedEndpointStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ProtectedEndpointCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MatchedWorkloads != nil {
+		in, out := &in.MatchedWorkloads, &out.MatchedWorkloads
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ProtectedPorts != nil {
+		in, out := &in.ProtectedPorts, &out.ProtectedPorts
+		*out = make([]uint32, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProtectedEndpointStatus.
@@ -1775,6 +2867,21 @@ func (in *RepositoryTag) DeepCopy() *RepositoryTag {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStep) DeepCopyInto(out *RolloutStep) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStep.
+func (in *RolloutStep) DeepCopy() *RolloutStep {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RunnerPermission) DeepCopyInto(out *RunnerPermission) {
 	*out = *in
@@ -1797,6 +2904,119 @@ func (in *RunnerPermission) DeepCopy() *RunnerPermission {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3SinkConfig) DeepCopyInto(out *S3SinkConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3SinkConfig.
+func (in *S3SinkConfig) DeepCopy() *S3SinkConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(S3SinkConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSOCredential) DeepCopyInto(out *SSOCredential) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSOCredential.
+func (in *SSOCredential) DeepCopy() *SSOCredential {
+	if in == nil {
+		return nil
+	}
+	out := new(SSOCredential)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SSOCredential) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSOCredentialList) DeepCopyInto(out *SSOCredentialList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SSOCredential, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSOCredentialList.
+func (in *SSOCredentialList) DeepCopy() *SSOCredentialList {
+	if in == nil {
+		return nil
+	}
+	out := new(SSOCredentialList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SSOCredentialList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSOCredentialSpec) DeepCopyInto(out *SSOCredentialSpec) {
+	*out = *in
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSOCredentialSpec.
+func (in *SSOCredentialSpec) DeepCopy() *SSOCredentialSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SSOCredentialSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSOCredentialStatus) DeepCopyInto(out *SSOCredentialStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSOCredentialStatus.
+func (in *SSOCredentialStatus) DeepCopy() *SSOCredentialStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SSOCredentialStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SingleSignOnConfig) DeepCopyInto(out *SingleSignOnConfig) {
 	*out = *in
@@ -1881,6 +3101,11 @@ func (in *SingleSignOnConfigSpec) DeepCopyInto(out *SingleSignOnConfigSpec) {
 		*out = new(ExtAuthzEndpoint)
 		**out = **in
 	}
+	if in.AuthProxyReplicas != nil {
+		in, out := &in.AuthProxyReplicas, &out.AuthProxyReplicas
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SingleSignOnConfigSpec.
@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultAutoRollbackAnalysisSeconds = 600
+
+	autoRollbackPollInterval = 30 * time.Second
+
+	// rates need a few scrapes, and are averaged over at most the last 5 minutes
+	minAutoRollbackMetricsWindow = time.Minute
+	maxAutoRollbackMetricsWindow = 5 * time.Minute
+)
+
+// same prometheus as the one used by the dashboard of kalm api
+var istioPrometheusAPIAddress string
+
+func init() {
+	if os.Getenv("KALM_ISTIO_PROMETHEUS_API_ADDRESS") != "" {
+		istioPrometheusAPIAddress = os.Getenv("KALM_ISTIO_PROMETHEUS_API_ADDRESS")
+	} else {
+		istioPrometheusAPIAddress = "http://prometheus.istio-system:9090"
+	}
+}
+
+// istioServiceMetrics are the metrics of a service over a window since the analysis started.
+// A nil field means prometheus has no data for it.
+type istioServiceMetrics struct {
+	requestsPerSecond      *float64
+	resp5xxPerSecond       *float64
+	p99LatencyMilliseconds *float64
+}
+
+func getAutoRollbackAnalysisDuration(autoRollback *corev1alpha1.AutoRollback) time.Duration {
+	if autoRollback.AnalysisSeconds != nil {
+		return time.Duration(*autoRollback.AnalysisSeconds) * time.Second
+	}
+
+	return defaultAutoRollbackAnalysisSeconds * time.Second
+}
+
+// checkAutoRollbackThresholds returns why the metrics breach the thresholds,
+// or an empty string if they don't.
+func checkAutoRollbackThresholds(autoRollback *corev1alpha1.AutoRollback, metrics istioServiceMetrics) string {
+	if metrics.requestsPerSecond == nil || *metrics.requestsPerSecond == 0 {
+		return ""
+	}
+
+	requestsPerSecond := *metrics.requestsPerSecond
+
+	if requestsPerSecond*60 < float64(autoRollback.MinRequestsPerMinute) {
+		return ""
+	}
+
+	if autoRollback.MinSuccessRate != nil {
+		var resp5xxPerSecond float64
+
+		if metrics.resp5xxPerSecond != nil {
+			resp5xxPerSecond = *metrics.resp5xxPerSecond
+		}
+
+		successRate := (1 - resp5xxPerSecond/requestsPerSecond) * 100
+
+		if successRate < float64(*autoRollback.MinSuccessRate) {
+			return fmt.Sprintf("success rate %.2f%% is lower than %d%%", successRate, *autoRollback.MinSuccessRate)
+		}
+	}
+
+	if autoRollback.MaxLatencyMilliseconds != nil && metrics.p99LatencyMilliseconds != nil {
+		latency := *metrics.p99LatencyMilliseconds
+
+		if !math.IsNaN(latency) && latency > float64(*autoRollback.MaxLatencyMilliseconds) {
+			return fmt.Sprintf("p99 latency %.0fms is higher than %dms", latency, *autoRollback.MaxLatencyMilliseconds)
+		}
+	}
+
+	return ""
+}
+
+// getAutoRollbackAnalysisHost returns the istio destination service which runs the new image.
+// During a Canary or BlueGreen rollout, that is the canary service.
+func (r *ComponentReconcilerTask) getAutoRollbackAnalysisHost() string {
+	name := r.component.Name
+
+	if r.rollout != nil && (r.rollout.Phase == corev1alpha1.RolloutPhaseProgressing || r.rollout.Phase == corev1alpha1.RolloutPhasePromoting) {
+		name = getCanaryName(name)
+	}
+
+	return fmt.Sprintf("%s.%s.svc.cluster.local", name, r.component.Namespace)
+}
+
+// isAutoRollbackImageAvailable returns whether all pods of the workload analysed run the image and are available.
+// During a Canary or BlueGreen rollout, that is the canary deployment.
+func (r *ComponentReconcilerTask) isAutoRollbackImageAvailable(image string) bool {
+	var template *coreV1.PodTemplateSpec
+	var state workloadRolloutState
+
+	switch {
+	case r.rollout != nil && (r.rollout.Phase == corev1alpha1.RolloutPhaseProgressing || r.rollout.Phase == corev1alpha1.RolloutPhasePromoting):
+		if r.canaryDeployment == nil {
+			return false
+		}
+
+		template, state = &r.canaryDeployment.Spec.Template, getDeploymentRolloutState(r.canaryDeployment)
+	case r.deployment != nil:
+		template, state = &r.deployment.Spec.Template, getDeploymentRolloutState(r.deployment)
+	case r.statefulSet != nil:
+		template, state = &r.statefulSet.Spec.Template, getStatefulSetRolloutState(r.statefulSet)
+	case r.daemonSet != nil:
+		template, state = &r.daemonSet.Spec.Template, getDaemonSetRolloutState(r.daemonSet)
+	default:
+		return false
+	}
+
+	if state.progressing || state.ready < state.desired {
+		return false
+	}
+
+	// the image of the main container may be pinned to a digest
+	for _, container := range template.Spec.Containers {
+		if container.Name == r.component.Name {
+			return container.Image == image || strings.HasPrefix(container.Image, image+"@")
+		}
+	}
+
+	return false
+}
+
+// ReconcileAutoRollback watches the istio metrics of the component for a while after its image
+// is changed, and reverts the image if the thresholds of spec.autoRollback are breached.
+func (r *ComponentReconcilerTask) ReconcileAutoRollback() error {
+	autoRollback := r.component.Spec.AutoRollback
+
+	if autoRollback == nil {
+		r.autoRollback = nil
+		return nil
+	}
+
+	image := r.component.Spec.Image
+	now := metaV1.Now()
+
+	if r.autoRollback == nil {
+		// nothing is known about the previous image, there is nothing to revert to.
+		r.autoRollback = &corev1alpha1.ComponentAutoRollbackStatus{Image: image}
+		return nil
+	}
+
+	state := r.autoRollback
+
+	if state.Image != image {
+		// if the last image didn't finish its analysis, keep reverting to the one before it.
+		if state.PreviousImage == "" {
+			state.PreviousImage = state.Image
+		}
+
+		state.Image = image
+		state.AnalysisStartedAt = nil
+	}
+
+	if state.PreviousImage == "" || state.PreviousImage == image {
+		state.AnalysisStartedAt = nil
+		state.PreviousImage = ""
+		return nil
+	}
+
+	// the analysis starts once the new revision is available,
+	// so requests served by the previous image or by starting pods are not counted.
+	if state.AnalysisStartedAt == nil {
+		if !r.isAutoRollbackImageAvailable(image) {
+			r.RequeueAfter(autoRollbackPollInterval)
+			return nil
+		}
+
+		state.AnalysisStartedAt = &now
+	}
+
+	deadline := state.AnalysisStartedAt.Add(getAutoRollbackAnalysisDuration(autoRollback))
+
+	if !now.Time.Before(deadline) {
+		state.AnalysisStartedAt = nil
+		state.PreviousImage = ""
+		state.RolledBackImage = ""
+		state.RolledBackAt = nil
+		state.Message = ""
+		r.NormalEvent("AnalysisPassed", "Image %s passed the metrics analysis.", image)
+		return nil
+	}
+
+	r.RequeueAfter(autoRollbackPollInterval)
+
+	if remaining := deadline.Sub(now.Time); remaining < autoRollbackPollInterval {
+		r.RequeueAfter(remaining)
+	}
+
+	window := now.Sub(state.AnalysisStartedAt.Time)
+
+	if window < minAutoRollbackMetricsWindow {
+		return nil
+	}
+
+	if window > maxAutoRollbackMetricsWindow {
+		window = maxAutoRollbackMetricsWindow
+	}
+
+	metrics, err := queryIstioServiceMetrics(r.getAutoRollbackAnalysisHost(), window)
+
+	if err != nil {
+		// metrics being unavailable is not a reason to roll back, nor to fail the reconciliation
+		r.Log.Error(err, "query istio metrics error, skip this analysis round.", "component", r.component.Name)
+		return nil
+	}
+
+	reason := checkAutoRollbackThresholds(autoRollback, metrics)
+
+	if reason == "" {
+		return nil
+	}
+
+	return r.rollbackImage(reason)
+}
+
+func (r *ComponentReconcilerTask) rollbackImage(reason string) error {
+	state := r.autoRollback
+	badImage := state.Image
+
+	componentCopy := r.component.DeepCopy()
+	componentCopy.Spec.Image = state.PreviousImage
+
+	if err := r.Patch(r.ctx, componentCopy, client.MergeFrom(r.component)); err != nil {
+		r.WarningEvent(err, "rollback image of component error.")
+		return err
+	}
+
+	r.component = componentCopy
+
+	now := metaV1.Now()
+	state.Image = state.PreviousImage
+	state.PreviousImage = ""
+	state.AnalysisStartedAt = nil
+	state.RolledBackImage = badImage
+	state.RolledBackAt = &now
+	state.Message = fmt.Sprintf("Image %s was rolled back to %s, %s.", badImage, state.Image, reason)
+
+	r.Recorder.Event(r.component, coreV1.EventTypeWarning, "RolledBack", state.Message)
+
+	return nil
+}
+
+// queryIstioServiceMetrics returns the rates over the window, which doesn't reach back before the analysis started.
+// The recording rules of istio metrics are averaged over 5 minutes, so the raw metrics are queried.
+func queryIstioServiceMetrics(host string, window time.Duration) (istioServiceMetrics, error) {
+	var metrics istioServiceMetrics
+	var err error
+
+	seconds := int(window.Seconds())
+
+	metrics.requestsPerSecond, err = queryPrometheusScalar(
+		fmt.Sprintf(`sum(rate(istio_requests_total{destination_service="%s"}[%ds]))`, host, seconds),
+	)
+
+	if err != nil {
+		return metrics, err
+	}
+
+	metrics.resp5xxPerSecond, err = queryPrometheusScalar(
+		fmt.Sprintf(`sum(rate(istio_requests_total{destination_service="%s",response_code=~"5.*"}[%ds]))`, host, seconds),
+	)
+
+	if err != nil {
+		return metrics, err
+	}
+
+	metrics.p99LatencyMilliseconds, err = queryPrometheusScalar(
+		fmt.Sprintf(`histogram_quantile(0.99, sum by (le) (rate(istio_request_duration_milliseconds_bucket{destination_service="%s"}[%ds])))`, host, seconds),
+	)
+
+	return metrics, err
+}
+
+type promVectorResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// queryPrometheusScalar runs an instant query which returns at most one sample.
+// It returns nil if the query has no result.
+func queryPrometheusScalar(query string) (*float64, error) {
+	api := fmt.Sprintf("%s/api/v1/query?query=%s", istioPrometheusAPIAddress, url.QueryEscape(query))
+
+	httpClient := http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Get(api)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var promResp promVectorResponse
+
+	if err := json.Unmarshal(body, &promResp); err != nil {
+		return nil, fmt.Errorf("fail to parse prometheus response, status code %d: %s", resp.StatusCode, err)
+	}
+
+	if promResp.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %s", promResp.Error)
+	}
+
+	if len(promResp.Data.Result) == 0 || len(promResp.Data.Result[0].Value) != 2 {
+		return nil, nil
+	}
+
+	valInStr, ok := promResp.Data.Result[0].Value[1].(string)
+
+	if !ok {
+		return nil, fmt.Errorf("unexpected prometheus sample value: %v", promResp.Data.Result[0].Value[1])
+	}
+
+	val, err := strconv.ParseFloat(valInStr, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &val, nil
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestCheckAutoRollbackThresholds(t *testing.T) {
+	minSuccessRate := 95
+	maxLatency := 500
+
+	autoRollback := &v1alpha1.AutoRollback{
+		MinSuccessRate:         &minSuccessRate,
+		MaxLatencyMilliseconds: &maxLatency,
+		MinRequestsPerMinute:   60,
+	}
+
+	value := func(v float64) *float64 { return &v }
+
+	// no traffic, no data
+	assert.Equal(t, "", checkAutoRollbackThresholds(autoRollback, istioServiceMetrics{}))
+
+	// too few requests
+	assert.Equal(t, "", checkAutoRollbackThresholds(autoRollback, istioServiceMetrics{
+		requestsPerSecond: value(0.5),
+		resp5xxPerSecond:  value(0.5),
+	}))
+
+	assert.Equal(t, "", checkAutoRollbackThresholds(autoRollback, istioServiceMetrics{
+		requestsPerSecond:      value(10),
+		resp5xxPerSecond:       value(0.2),
+		p99LatencyMilliseconds: value(120),
+	}))
+
+	assert.Equal(t, "success rate 90.00% is lower than 95%", checkAutoRollbackThresholds(autoRollback, istioServiceMetrics{
+		requestsPerSecond: value(10),
+		resp5xxPerSecond:  value(1),
+	}))
+
+	assert.Equal(t, "p99 latency 750ms is higher than 500ms", checkAutoRollbackThresholds(autoRollback, istioServiceMetrics{
+		requestsPerSecond:      value(10),
+		p99LatencyMilliseconds: value(750),
+	}))
+}
+
+func TestQueryIstioServiceMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+
+		assert.Equal(t, "/api/v1/query", r.URL.Path)
+		assert.Contains(t, query, `destination_service="web.ns.svc.cluster.local"`)
+		assert.Contains(t, query, "[120s]")
+
+		var value string
+
+		switch {
+		case strings.Contains(query, `response_code=~"5.*"`):
+			// no 5xx responses, prometheus returns an empty vector
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+			return
+		case strings.Contains(query, "histogram_quantile"):
+			value = "230.5"
+		default:
+			value = "12"
+		}
+
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1600000000.123,"%s"]}]}}`, value)
+	}))
+	defer server.Close()
+
+	address := istioPrometheusAPIAddress
+	istioPrometheusAPIAddress = server.URL
+	defer func() { istioPrometheusAPIAddress = address }()
+
+	metrics, err := queryIstioServiceMetrics("web.ns.svc.cluster.local", 2*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 12.0, *metrics.requestsPerSecond)
+	assert.Nil(t, metrics.resp5xxPerSecond)
+	assert.Equal(t, 230.5, *metrics.p99LatencyMilliseconds)
+}
+
+func TestReconcileAutoRollbackWaitsForNewRevision(t *testing.T) {
+	replicas := int32(2)
+
+	deployment := &appsV1.Deployment{
+		Spec: appsV1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: coreV1.PodTemplateSpec{
+				Spec: coreV1.PodSpec{Containers: []coreV1.Container{{Name: "web", Image: "web:v1"}}},
+			},
+		},
+		Status: appsV1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2, AvailableReplicas: 2},
+	}
+
+	task := &ComponentReconcilerTask{
+		ComponentReconciler: &ComponentReconciler{&BaseReconciler{Recorder: record.NewFakeRecorder(10)}},
+		component: &v1alpha1.Component{
+			ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "ns"},
+			Spec: v1alpha1.ComponentSpec{
+				Image:        "web:v2",
+				AutoRollback: &v1alpha1.AutoRollback{},
+			},
+		},
+		deployment:   deployment,
+		autoRollback: &v1alpha1.ComponentAutoRollbackStatus{Image: "web:v1"},
+	}
+
+	// the deployment still runs the previous image
+	assert.Nil(t, task.ReconcileAutoRollback())
+	assert.Equal(t, "web:v1", task.autoRollback.PreviousImage)
+	assert.Equal(t, "web:v2", task.autoRollback.Image)
+	assert.Nil(t, task.autoRollback.AnalysisStartedAt)
+
+	// the new revision is rolling out
+	deployment.Spec.Template.Spec.Containers[0].Image = "web:v2@sha256:abc"
+	deployment.Status.UpdatedReplicas = 1
+	assert.Nil(t, task.ReconcileAutoRollback())
+	assert.Nil(t, task.autoRollback.AnalysisStartedAt)
+
+	// the image is changed again before the analysis starts, the last analysed image is kept
+	task.component.Spec.Image = "web:v3"
+	deployment.Spec.Template.Spec.Containers[0].Image = "web:v3"
+	deployment.Status.UpdatedReplicas = 2
+	assert.Nil(t, task.ReconcileAutoRollback())
+	assert.Equal(t, "web:v1", task.autoRollback.PreviousImage)
+	assert.NotNil(t, task.autoRollback.AnalysisStartedAt)
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	autoscalingV2beta2 "k8s.io/api/autoscaling/v2beta2"
+	coreV1 "k8s.io/api/core/v1"
+	apiEquality "k8s.io/apimachinery/pkg/api/equality"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func getAutoscalingMinReplicas(autoscaling *corev1alpha1.Autoscaling) *int32 {
+	if autoscaling.MinReplicas != nil {
+		return autoscaling.MinReplicas
+	}
+
+	minReplicas := int32(1)
+	return &minReplicas
+}
+
+func getHorizontalPodAutoscalerSpec(component *corev1alpha1.Component) autoscalingV2beta2.HorizontalPodAutoscalerSpec {
+	autoscaling := component.Spec.Autoscaling
+
+	spec := autoscalingV2beta2.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: autoscalingV2beta2.CrossVersionObjectReference{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       component.Name,
+		},
+		MinReplicas: getAutoscalingMinReplicas(autoscaling),
+		MaxReplicas: autoscaling.MaxReplicas,
+	}
+
+	resourceTargets := []struct {
+		name   coreV1.ResourceName
+		target *int32
+	}{
+		{coreV1.ResourceCPU, autoscaling.TargetCPUUtilizationPercentage},
+		{coreV1.ResourceMemory, autoscaling.TargetMemoryUtilizationPercentage},
+	}
+
+	for _, resourceTarget := range resourceTargets {
+		if resourceTarget.target == nil {
+			continue
+		}
+
+		utilization := *resourceTarget.target
+
+		spec.Metrics = append(spec.Metrics, autoscalingV2beta2.MetricSpec{
+			Type: autoscalingV2beta2.ResourceMetricSourceType,
+			Resource: &autoscalingV2beta2.ResourceMetricSource{
+				Name: resourceTarget.name,
+				Target: autoscalingV2beta2.MetricTarget{
+					Type:               autoscalingV2beta2.UtilizationMetricType,
+					AverageUtilization: &utilization,
+				},
+			},
+		})
+	}
+
+	for _, metric := range autoscaling.CustomMetrics {
+		averageValue := metric.TargetAverageValue.DeepCopy()
+
+		spec.Metrics = append(spec.Metrics, autoscalingV2beta2.MetricSpec{
+			Type: autoscalingV2beta2.PodsMetricSourceType,
+			Pods: &autoscalingV2beta2.PodsMetricSource{
+				Metric: autoscalingV2beta2.MetricIdentifier{
+					Name: metric.Name,
+				},
+				Target: autoscalingV2beta2.MetricTarget{
+					Type:         autoscalingV2beta2.AverageValueMetricType,
+					AverageValue: &averageValue,
+				},
+			},
+		})
+	}
+
+	return spec
+}
+
+// ReconcileHorizontalPodAutoscaler keeps the HorizontalPodAutoscaler of the deployment in sync
+// with spec.autoscaling, and deletes it once autoscaling is turned off.
+func (r *ComponentReconcilerTask) ReconcileHorizontalPodAutoscaler() error {
+	if r.component.Spec.Autoscaling == nil {
+		return r.DeleteHorizontalPodAutoscaler()
+	}
+
+	spec := getHorizontalPodAutoscalerSpec(r.component)
+
+	hpa := r.hpa
+	isNew := hpa == nil
+
+	if isNew {
+		hpa = &autoscalingV2beta2.HorizontalPodAutoscaler{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      r.component.Name,
+				Namespace: r.component.Namespace,
+				Labels:    r.GetLabels(),
+			},
+			Spec: spec,
+		}
+
+		if err := ctrl.SetControllerReference(r.component, hpa, r.Scheme); err != nil {
+			r.WarningEvent(err, "unable to set owner for HorizontalPodAutoscaler")
+			return err
+		}
+
+		if err := r.Create(r.ctx, hpa); err != nil {
+			r.WarningEvent(err, "unable to create HorizontalPodAutoscaler for Component")
+			return err
+		}
+
+		r.NormalEvent("HorizontalPodAutoscalerCreated", hpa.Name+" is created.")
+	} else if !apiEquality.Semantic.DeepEqual(hpa.Spec, spec) {
+		hpa.Spec = spec
+
+		if err := r.Update(r.ctx, hpa); err != nil {
+			r.WarningEvent(err, "unable to update HorizontalPodAutoscaler for Component")
+			return err
+		}
+
+		r.NormalEvent("HorizontalPodAutoscalerUpdated", hpa.Name+" is updated.")
+	}
+
+	r.hpa = hpa
+
+	return nil
+}
+
+func (r *ComponentReconcilerTask) DeleteHorizontalPodAutoscaler() error {
+	if r.hpa == nil {
+		return nil
+	}
+
+	if err := r.Delete(r.ctx, r.hpa); client.IgnoreNotFound(err) != nil {
+		r.WarningEvent(err, "delete HorizontalPodAutoscaler error.")
+		return err
+	}
+
+	r.NormalEvent("HorizontalPodAutoscalerDeleted", r.hpa.Name+" is deleted.")
+	r.hpa = nil
+
+	return nil
+}
+
+func (r *ComponentReconcilerTask) LoadHorizontalPodAutoscaler() error {
+	var hpa autoscalingV2beta2.HorizontalPodAutoscaler
+	err := r.LoadItem(&hpa)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.hpa = &hpa
+	return nil
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	autoscalingV2beta2 "k8s.io/api/autoscaling/v2beta2"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetHorizontalPodAutoscalerSpec(t *testing.T) {
+	cpu := int32(70)
+
+	component := &v1alpha1.Component{
+		ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "ns"},
+		Spec: v1alpha1.ComponentSpec{
+			Autoscaling: &v1alpha1.Autoscaling{
+				MaxReplicas:                    10,
+				TargetCPUUtilizationPercentage: &cpu,
+				CustomMetrics: []v1alpha1.AutoscalingMetric{
+					{Name: "http_requests_per_second", TargetAverageValue: resource.MustParse("100")},
+				},
+			},
+		},
+	}
+
+	spec := getHorizontalPodAutoscalerSpec(component)
+
+	assert.Equal(t, "Deployment", spec.ScaleTargetRef.Kind)
+	assert.Equal(t, "web", spec.ScaleTargetRef.Name)
+	assert.Equal(t, int32(1), *spec.MinReplicas)
+	assert.Equal(t, int32(10), spec.MaxReplicas)
+	assert.Len(t, spec.Metrics, 2)
+
+	assert.Equal(t, autoscalingV2beta2.ResourceMetricSourceType, spec.Metrics[0].Type)
+	assert.Equal(t, coreV1.ResourceCPU, spec.Metrics[0].Resource.Name)
+	assert.Equal(t, int32(70), *spec.Metrics[0].Resource.Target.AverageUtilization)
+
+	assert.Equal(t, autoscalingV2beta2.PodsMetricSourceType, spec.Metrics[1].Type)
+	assert.Equal(t, "http_requests_per_second", spec.Metrics[1].Pods.Metric.Name)
+	assert.Equal(t, int64(100), spec.Metrics[1].Pods.Target.AverageValue.Value())
+}
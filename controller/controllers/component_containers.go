@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// a command with spaces is run by a shell
+func getContainerCommand(command string) ([]string, []string) {
+	if strings.Contains(command, " ") {
+		return []string{"sh"}, []string{"-c", command}
+	}
+
+	return []string{command}, nil
+}
+
+// containerName is empty for the main container
+func (r *ComponentReconcilerTask) getContainerEnvs(containerName string, envVars []corev1alpha1.EnvVar) (envs []coreV1.EnvVar, err error) {
+	for _, env := range envVars {
+		var value string
+		var valueFrom *coreV1.EnvVarSource
+
+		switch env.Type {
+		case "", corev1alpha1.EnvVarTypeStatic:
+			value = env.Value
+		case corev1alpha1.EnvVarTypeExternal:
+			//value, err = r.FindShareEnvValue(env.Value)
+			//
+			////  if the env can't be found in sharedEnv, ignore it
+			//if err != nil {
+			//	continue
+			//}
+		case corev1alpha1.EnvVarTypeLinked:
+			value, err = r.getValueOfLinkedEnv(env)
+			if err != nil {
+				return nil, err
+			}
+		case corev1alpha1.EnvVarTypeFieldRef:
+			valueFrom = &coreV1.EnvVarSource{
+				FieldRef: &coreV1.ObjectFieldSelector{
+					FieldPath: env.Value,
+				},
+			}
+		case corev1alpha1.EnvVarTypeSecret:
+			valueFrom = &coreV1.EnvVarSource{
+				SecretKeyRef: &coreV1.SecretKeySelector{
+					LocalObjectReference: coreV1.LocalObjectReference{
+						Name: corev1alpha1.ComponentSecretName(r.component.Name),
+					},
+					Key: corev1alpha1.ComponentSecretEnvKey(containerName, env.Name),
+				},
+			}
+		case corev1alpha1.EnvVarTypeBuiltin:
+			switch env.Value {
+			case corev1alpha1.EnvVarBuiltinHost:
+				valueFrom = &coreV1.EnvVarSource{
+					FieldRef: &coreV1.ObjectFieldSelector{
+						APIVersion: "v1",
+						FieldPath:  "spec.nodeName",
+					},
+				}
+			case corev1alpha1.EnvVarBuiltinNamespace:
+				valueFrom = &coreV1.EnvVarSource{
+					FieldRef: &coreV1.ObjectFieldSelector{
+						APIVersion: "v1",
+						FieldPath:  "metadata.namespace",
+					},
+				}
+			case corev1alpha1.EnvVarBuiltinPodName:
+				valueFrom = &coreV1.EnvVarSource{
+					FieldRef: &coreV1.ObjectFieldSelector{
+						APIVersion: "v1",
+						FieldPath:  "metadata.name",
+					},
+				}
+			}
+		}
+
+		envs = append(envs, coreV1.EnvVar{
+			Name:      env.Name,
+			Value:     value,
+			ValueFrom: valueFrom,
+		})
+	}
+
+	return envs, nil
+}
+
+func getContainerPorts(ports []corev1alpha1.ContainerPort) []coreV1.ContainerPort {
+	var res []coreV1.ContainerPort
+
+	for _, port := range ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = corev1alpha1.PortProtocolTCP
+		}
+
+		containerPort := coreV1.ContainerPort{
+			// istio picks the protocol from the port name prefix
+			Name:          fmt.Sprintf("%s-%d", protocol, port.ContainerPort),
+			ContainerPort: int32(port.ContainerPort),
+			Protocol:      coreV1.ProtocolTCP,
+		}
+
+		if protocol == corev1alpha1.PortProtocolUDP {
+			containerPort.Protocol = coreV1.ProtocolUDP
+		}
+
+		res = append(res, containerPort)
+	}
+
+	return res
+}
+
+func (r *ComponentReconcilerTask) getExtraContainer(container corev1alpha1.Container, isInitContainer bool) (coreV1.Container, error) {
+	res := coreV1.Container{
+		Name:  container.Name,
+		Image: container.Image,
+		Ports: getContainerPorts(container.Ports),
+		Resources: coreV1.ResourceRequirements{
+			Requests: make(map[coreV1.ResourceName]resource.Quantity),
+			Limits:   make(map[coreV1.ResourceName]resource.Quantity),
+		},
+	}
+
+	if container.Command != "" {
+		res.Command, res.Args = getContainerCommand(container.Command)
+	}
+
+	if !isInitContainer {
+		res.ReadinessProbe = r.FixProbe(container.ReadinessProbe)
+		res.LivenessProbe = r.FixProbe(container.LivenessProbe)
+	}
+
+	if container.ResourceRequirements != nil {
+		res.Resources = *container.ResourceRequirements
+	}
+
+	envs, err := r.getContainerEnvs(container.Name, container.Env)
+	if err != nil {
+		return res, fmt.Errorf("container %s: %s", container.Name, err)
+	}
+	res.Env = envs
+
+	return res, nil
+}
+
+// appendExtraContainers adds the init containers and sidecars of the component to the pod template.
+// Their volume mounts are set later by mountVolumesForExtraContainers, once the volumes are known.
+func (r *ComponentReconcilerTask) appendExtraContainers(template *coreV1.PodTemplateSpec) error {
+	for _, container := range r.component.Spec.InitContainers {
+		initContainer, err := r.getExtraContainer(container, true)
+		if err != nil {
+			return err
+		}
+
+		template.Spec.InitContainers = append(template.Spec.InitContainers, initContainer)
+	}
+
+	for _, container := range r.component.Spec.Sidecars {
+		sidecar, err := r.getExtraContainer(container, false)
+		if err != nil {
+			return err
+		}
+
+		template.Spec.Containers = append(template.Spec.Containers, sidecar)
+	}
+
+	return nil
+}
+
+// mountVolumesForExtraContainers mounts component volumes into init containers and sidecars.
+// volNames maps the path of each volume in spec.volumes to its volume name in the pod.
+func (r *ComponentReconcilerTask) mountVolumesForExtraContainers(template *coreV1.PodTemplateSpec, volNames map[string]string) error {
+	mounts := make(map[string][]coreV1.VolumeMount)
+
+	for _, containers := range [][]corev1alpha1.Container{r.component.Spec.InitContainers, r.component.Spec.Sidecars} {
+		for _, container := range containers {
+			for _, mount := range container.VolumeMounts {
+				volName, exist := volNames[mount.Volume]
+				if !exist {
+					return fmt.Errorf("container %s: volume %s is not defined in the component", container.Name, mount.Volume)
+				}
+
+				mountPath := mount.MountPath
+				if mountPath == "" {
+					mountPath = mount.Volume
+				}
+
+				mounts[container.Name] = append(mounts[container.Name], coreV1.VolumeMount{
+					Name:      volName,
+					MountPath: mountPath,
+					ReadOnly:  mount.ReadOnly,
+				})
+			}
+		}
+	}
+
+	for i := range template.Spec.InitContainers {
+		if volumeMounts, exist := mounts[template.Spec.InitContainers[i].Name]; exist {
+			template.Spec.InitContainers[i].VolumeMounts = volumeMounts
+		}
+	}
+
+	// skip the main container, its volumes are mounted by the caller
+	for i := 1; i < len(template.Spec.Containers); i++ {
+		if volumeMounts, exist := mounts[template.Spec.Containers[i].Name]; exist {
+			template.Spec.Containers[i].VolumeMounts = volumeMounts
+		}
+	}
+
+	return nil
+}
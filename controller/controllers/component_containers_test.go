@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+func TestGetContainerCommand(t *testing.T) {
+	command, args := getContainerCommand("./server")
+	assert.Equal(t, []string{"./server"}, command)
+	assert.Nil(t, args)
+
+	command, args = getContainerCommand("./migrate up")
+	assert.Equal(t, []string{"sh"}, command)
+	assert.Equal(t, []string{"-c", "./migrate up"}, args)
+}
+
+func TestGetContainerPorts(t *testing.T) {
+	ports := getContainerPorts([]v1alpha1.ContainerPort{
+		{ContainerPort: 9090},
+		{ContainerPort: 8125, Protocol: v1alpha1.PortProtocolUDP},
+	})
+
+	assert.Equal(t, []coreV1.ContainerPort{
+		{Name: "tcp-9090", ContainerPort: 9090, Protocol: coreV1.ProtocolTCP},
+		{Name: "udp-8125", ContainerPort: 8125, Protocol: coreV1.ProtocolUDP},
+	}, ports)
+}
+
+func TestMountVolumesForExtraContainers(t *testing.T) {
+	task := &ComponentReconcilerTask{
+		component: &v1alpha1.Component{
+			Spec: v1alpha1.ComponentSpec{
+				InitContainers: []v1alpha1.Container{
+					{Name: "migrate", VolumeMounts: []v1alpha1.ContainerVolumeMount{{Volume: "/data"}}},
+				},
+				Sidecars: []v1alpha1.Container{
+					{Name: "log-shipper", VolumeMounts: []v1alpha1.ContainerVolumeMount{{Volume: "/data", MountPath: "/logs", ReadOnly: true}}},
+				},
+			},
+		},
+	}
+
+	template := &coreV1.PodTemplateSpec{
+		Spec: coreV1.PodSpec{
+			InitContainers: []coreV1.Container{{Name: "inject-files"}, {Name: "migrate"}},
+			Containers:     []coreV1.Container{{Name: "web"}, {Name: "log-shipper"}},
+		},
+	}
+
+	err := task.mountVolumesForExtraContainers(template, map[string]string{"/data": "web-data"})
+	assert.Nil(t, err)
+
+	assert.Nil(t, template.Spec.InitContainers[0].VolumeMounts)
+	assert.Equal(t, []coreV1.VolumeMount{{Name: "web-data", MountPath: "/data"}}, template.Spec.InitContainers[1].VolumeMounts)
+	assert.Nil(t, template.Spec.Containers[0].VolumeMounts)
+	assert.Equal(t, []coreV1.VolumeMount{{Name: "web-data", MountPath: "/logs", ReadOnly: true}}, template.Spec.Containers[1].VolumeMounts)
+
+	err = task.mountVolumesForExtraContainers(template, map[string]string{})
+	assert.NotNil(t, err)
+}
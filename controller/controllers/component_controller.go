@@ -28,6 +28,7 @@ import (
 	v1alpha32 "istio.io/api/networking/v1alpha3"
 	"istio.io/client-go/pkg/apis/networking/v1alpha3"
 	appsV1 "k8s.io/api/apps/v1"
+	autoscalingV2beta2 "k8s.io/api/autoscaling/v2beta2"
 	batchV1 "k8s.io/api/batch/v1"
 	batchV1Beta1 "k8s.io/api/batch/v1beta1"
 	coreV1 "k8s.io/api/core/v1"
@@ -45,6 +46,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 	"strconv"
 	"strings"
+	"time"
 
 	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
 )
@@ -72,7 +74,23 @@ type ComponentReconcilerTask struct {
 	deployment      *appsV1.Deployment
 	daemonSet       *appsV1.DaemonSet
 	statefulSet     *appsV1.StatefulSet
+	hpa             *autoscalingV2beta2.HorizontalPodAutoscaler
+	secret          *coreV1.Secret
 	pluginBindings  *corev1alpha1.ComponentPluginBindingList
+
+	// canary resources of a Canary or BlueGreen rollout
+	canaryDeployment *appsV1.Deployment
+	canaryService    *coreV1.Service
+	rollout          *corev1alpha1.ComponentRolloutStatus
+
+	// metrics analysis state of spec.autoRollback
+	autoRollback *corev1alpha1.ComponentAutoRollbackStatus
+
+	// digest of spec.image resolved by spec.pinImageDigest
+	pinnedImage *corev1alpha1.ComponentPinnedImage
+
+	// if not zero, the component will be reconciled again after this duration
+	requeueAfter time.Duration
 }
 
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=components,verbs=get;list;watch;create;update;patch;delete
@@ -84,11 +102,13 @@ type ComponentReconcilerTask struct {
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=persistentvolume,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.istio.io,resources=destinationrules,verbs=*
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
 
 func (r *ComponentReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	r.Log.Info("reconciling component", "req", req)
@@ -98,7 +118,16 @@ func (r *ComponentReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		ctx:                 context.Background(),
 	}
 
-	return ctrl.Result{}, task.Run(req)
+	err := task.Run(req)
+
+	return ctrl.Result{RequeueAfter: task.requeueAfter}, err
+}
+
+// RequeueAfter makes sure the component is reconciled again within the duration.
+func (r *ComponentReconcilerTask) RequeueAfter(duration time.Duration) {
+	if r.requeueAfter == 0 || duration < r.requeueAfter {
+		r.requeueAfter = duration
+	}
 }
 
 func (r *ComponentReconcilerTask) WarningEvent(err error, msg string, args ...interface{}) {
@@ -214,6 +243,8 @@ func (r *ComponentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&appsV1.DaemonSet{}).
 		Owns(&appsV1.StatefulSet{}).
 		Owns(&coreV1.Service{}).
+		Owns(&autoscalingV2beta2.HorizontalPodAutoscaler{}).
+		Owns(&coreV1.Secret{}).
 		Complete(r)
 }
 func (r *ComponentReconcilerTask) Run(req ctrl.Request) error {
@@ -234,6 +265,30 @@ func (r *ComponentReconcilerTask) Run(req ctrl.Request) error {
 		return nil
 	}
 
+	reconcileErr := r.ReconcileResources()
+
+	if err := r.UpdateStatus(reconcileErr); err != nil {
+		r.WarningEvent(err, "update component status error.")
+
+		if reconcileErr == nil {
+			return err
+		}
+	}
+
+	return reconcileErr
+}
+
+func (r *ComponentReconcilerTask) ReconcileResources() error {
+	// a rollback changes the image, so it goes before the workload is reconciled
+	if err := r.ReconcileAutoRollback(); err != nil {
+		return err
+	}
+
+	// the image may be rolled back, so the digest is resolved after it
+	if err := r.ReconcileImagePinning(); err != nil {
+		return err
+	}
+
 	if err := r.ReconcileService(); err != nil {
 		return err
 	}
@@ -242,6 +297,11 @@ func (r *ComponentReconcilerTask) Run(req ctrl.Request) error {
 		return err
 	}
 
+	// pods can't start without the secret, so it goes before the workload
+	if err := r.ReconcileSecret(); err != nil {
+		return err
+	}
+
 	if err := r.ReconcileWorkload(); err != nil {
 		return err
 	}
@@ -412,30 +472,7 @@ func (r *ComponentReconcilerTask) ReconcileService() (err error) {
 			}
 		}
 
-		var ps []coreV1.ServicePort
-		for _, port := range r.component.Spec.Ports {
-			// if service port is missing, set it same as containerPort
-			if port.ServicePort == 0 && port.ContainerPort != 0 {
-				port.ServicePort = port.ContainerPort
-			}
-
-			// https://istio.io/latest/docs/ops/configuration/traffic-management/protocol-selection/
-			serverPortName := fmt.Sprintf("%s-%d", port.Protocol, port.ServicePort)
-
-			sp := coreV1.ServicePort{
-				Name:       serverPortName,
-				TargetPort: intstr.FromInt(int(port.ContainerPort)),
-				Port:       int32(port.ServicePort),
-			}
-
-			if port.Protocol == corev1alpha1.PortProtocolUDP {
-				sp.Protocol = coreV1.ProtocolUDP
-			} else {
-				sp.Protocol = coreV1.ProtocolTCP
-			}
-
-			ps = append(ps, sp)
-		}
+		ps := r.getServicePorts()
 
 		// TODO service ComponentPlugin call
 		r.service.Spec.Ports = ps
@@ -587,6 +624,35 @@ func (r *ComponentReconcilerTask) ReconcileService() (err error) {
 	return r.LoadService()
 }
 
+func (r *ComponentReconcilerTask) getServicePorts() []coreV1.ServicePort {
+	var ps []coreV1.ServicePort
+	for _, port := range r.component.Spec.Ports {
+		// if service port is missing, set it same as containerPort
+		if port.ServicePort == 0 && port.ContainerPort != 0 {
+			port.ServicePort = port.ContainerPort
+		}
+
+		// https://istio.io/latest/docs/ops/configuration/traffic-management/protocol-selection/
+		serverPortName := fmt.Sprintf("%s-%d", port.Protocol, port.ServicePort)
+
+		sp := coreV1.ServicePort{
+			Name:       serverPortName,
+			TargetPort: intstr.FromInt(int(port.ContainerPort)),
+			Port:       int32(port.ServicePort),
+		}
+
+		if port.Protocol == corev1alpha1.PortProtocolUDP {
+			sp.Protocol = coreV1.ProtocolUDP
+		} else {
+			sp.Protocol = coreV1.ProtocolTCP
+		}
+
+		ps = append(ps, sp)
+	}
+
+	return ps
+}
+
 func getNameForHeadlessService(componentName string) string {
 	return fmt.Sprintf("%s-headless", componentName)
 }
@@ -612,24 +678,32 @@ func (r *ComponentReconcilerTask) ReconcileWorkload() (err error) {
 			if err := r.Delete(r.ctx, r.deployment); err != nil {
 				return err
 			}
+			r.deployment = nil
 		}
 		if r.cronJob != nil {
 			if err := r.Delete(r.ctx, r.cronJob); err != nil {
 				return err
 			}
+			r.cronJob = nil
 		}
 		if r.daemonSet != nil {
 			if err := r.Delete(r.ctx, r.daemonSet); err != nil {
 				return err
 			}
+			r.daemonSet = nil
 		}
 		if r.statefulSet != nil {
 			if err := r.Delete(r.ctx, r.statefulSet); err != nil {
 				return err
 			}
+			r.statefulSet = nil
 		}
 
-		return
+		if err := r.DeleteHorizontalPodAutoscaler(); err != nil {
+			return err
+		}
+
+		return r.deleteCanaryResources()
 	}
 
 	if err := r.reconcileDirectConfigs(); err != nil {
@@ -645,13 +719,33 @@ func (r *ComponentReconcilerTask) ReconcileWorkload() (err error) {
 		return err
 	}
 
+	if !isServer(r.component) {
+		if err := r.DeleteHorizontalPodAutoscaler(); err != nil {
+			return err
+		}
+	}
+
 	switch r.component.Spec.WorkloadType {
 	case corev1alpha1.WorkloadTypeServer, "":
 		if err := r.prepareVolsForSimpleWorkload(template); err != nil {
 			return err
 		}
 
-		return r.ReconcileDeployment(template)
+		if isProgressiveRollout(r.component) {
+			if err := r.ReconcileProgressiveRollout(template); err != nil {
+				return err
+			}
+		} else {
+			if err := r.retireCanary("The restart strategy is no longer progressive."); err != nil {
+				return err
+			}
+
+			if err := r.ReconcileDeployment(template); err != nil {
+				return err
+			}
+		}
+
+		return r.ReconcileHorizontalPodAutoscaler()
 	case corev1alpha1.WorkloadTypeCronjob:
 		if err := r.prepareVolsForSimpleWorkload(template); err != nil {
 			return err
@@ -710,7 +804,7 @@ func (r *ComponentReconcilerTask) ReconcileDeployment(podTemplateSpec *coreV1.Po
 		deployment.Annotations[AnnoLastUpdatedByWebhook] = v
 	}
 
-	if component.Spec.RestartStrategy != "" {
+	if component.Spec.RestartStrategy != "" && !isProgressiveRollout(component) {
 		deployment.Spec.Strategy = appsV1.DeploymentStrategy{
 			Type: component.Spec.RestartStrategy,
 		}
@@ -721,7 +815,12 @@ func (r *ComponentReconcilerTask) ReconcileDeployment(podTemplateSpec *coreV1.Po
 	}
 
 	// TODO consider to move to plugin
-	if component.Spec.Replicas != nil {
+	if component.Spec.Autoscaling != nil {
+		// the replicas are owned by the HorizontalPodAutoscaler, they are only set on creation
+		if isNewDeployment {
+			deployment.Spec.Replicas = getAutoscalingMinReplicas(component.Spec.Autoscaling)
+		}
+	} else if component.Spec.Replicas != nil {
 		deployment.Spec.Replicas = component.Spec.Replicas
 	} else {
 		deployment.Spec.Replicas = nil
@@ -774,6 +873,8 @@ func (r *ComponentReconcilerTask) ReconcileDeployment(podTemplateSpec *coreV1.Po
 		r.NormalEvent("DeploymentUpdated", deployment.Name+" is updated.")
 	}
 
+	r.deployment = deployment
+
 	// apply plugins
 	//for _, pluginDef := range app.Spec.Components[0].Plugins {
 	//	plugin := corev1alpha1.GetPlugin(pluginDef)
@@ -836,6 +937,8 @@ func (r *ComponentReconcilerTask) ReconcileDaemonSet(podTemplateSpec *coreV1.Pod
 		r.NormalEvent("DaemonSetUpdated", daemonSet.Name+" is updated.")
 	}
 
+	r.daemonSet = daemonSet
+
 	return nil
 }
 
@@ -907,6 +1010,8 @@ func (r *ComponentReconcilerTask) ReconcileCronJob(podTemplateSpec *coreV1.PodTe
 		r.NormalEvent("CronJobUpdated", cj.Name+" is updated.")
 	}
 
+	r.cronJob = cj
+
 	return nil
 }
 
@@ -975,6 +1080,8 @@ func (r *ComponentReconcilerTask) ReconcileStatefulSet(
 		r.NormalEvent("StatefulSetUpdated", sts.Name+" is updated.")
 	}
 
+	r.statefulSet = sts
+
 	return nil
 }
 
@@ -1012,7 +1119,7 @@ func (r *ComponentReconcilerTask) GetPodTemplateWithoutVols() (template *coreV1.
 			Containers: []coreV1.Container{
 				{
 					Name:  component.Name,
-					Image: component.Spec.Image,
+					Image: r.getMainContainerImage(),
 					Env:   []coreV1.EnvVar{},
 					Resources: coreV1.ResourceRequirements{
 						Requests: make(map[coreV1.ResourceName]resource.Quantity),
@@ -1039,6 +1146,10 @@ func (r *ComponentReconcilerTask) GetPodTemplateWithoutVols() (template *coreV1.
 		template.ObjectMeta.Annotations[AnnoLastUpdatedByWebhook] = v
 	}
 
+	if r.secret != nil {
+		template.ObjectMeta.Annotations[AnnoComponentSecretHash] = getSecretDataHash(r.secret.Data)
+	}
+
 	mainContainer := &template.Spec.Containers[0]
 
 	if component.Spec.TerminationGracePeriodSeconds != nil {
@@ -1046,12 +1157,7 @@ func (r *ComponentReconcilerTask) GetPodTemplateWithoutVols() (template *coreV1.
 	}
 
 	if component.Spec.Command != "" {
-		if strings.Contains(component.Spec.Command, " ") {
-			mainContainer.Command = []string{"sh"}
-			mainContainer.Args = []string{"-c", component.Spec.Command}
-		} else {
-			mainContainer.Command = []string{component.Spec.Command}
-		}
+		mainContainer.Command, mainContainer.Args = getContainerCommand(component.Spec.Command)
 	}
 
 	var pullImageSecrets coreV1.SecretList
@@ -1092,66 +1198,16 @@ func (r *ComponentReconcilerTask) GetPodTemplateWithoutVols() (template *coreV1.
 	}
 
 	// apply envs
-	var envs []coreV1.EnvVar
-	for _, env := range component.Spec.Env {
-		var value string
-		var valueFrom *coreV1.EnvVarSource
-
-		switch env.Type {
-		case "", corev1alpha1.EnvVarTypeStatic:
-			value = env.Value
-		case corev1alpha1.EnvVarTypeExternal:
-			//value, err = r.FindShareEnvValue(env.Value)
-			//
-			////  if the env can't be found in sharedEnv, ignore it
-			//if err != nil {
-			//	continue
-			//}
-		case corev1alpha1.EnvVarTypeLinked:
-			value, err = r.getValueOfLinkedEnv(env)
-			if err != nil {
-				return nil, err
-			}
-		case corev1alpha1.EnvVarTypeFieldRef:
-			valueFrom = &coreV1.EnvVarSource{
-				FieldRef: &coreV1.ObjectFieldSelector{
-					FieldPath: env.Value,
-				},
-			}
-		case corev1alpha1.EnvVarTypeBuiltin:
-			switch env.Value {
-			case corev1alpha1.EnvVarBuiltinHost:
-				valueFrom = &coreV1.EnvVarSource{
-					FieldRef: &coreV1.ObjectFieldSelector{
-						APIVersion: "v1",
-						FieldPath:  "spec.nodeName",
-					},
-				}
-			case corev1alpha1.EnvVarBuiltinNamespace:
-				valueFrom = &coreV1.EnvVarSource{
-					FieldRef: &coreV1.ObjectFieldSelector{
-						APIVersion: "v1",
-						FieldPath:  "metadata.namespace",
-					},
-				}
-			case corev1alpha1.EnvVarBuiltinPodName:
-				valueFrom = &coreV1.EnvVarSource{
-					FieldRef: &coreV1.ObjectFieldSelector{
-						APIVersion: "v1",
-						FieldPath:  "metadata.name",
-					},
-				}
-			}
-		}
-
-		envs = append(envs, coreV1.EnvVar{
-			Name:      env.Name,
-			Value:     value,
-			ValueFrom: valueFrom,
-		})
+	envs, err := r.getContainerEnvs("", component.Spec.Env)
+	if err != nil {
+		return nil, err
 	}
 	mainContainer.Env = envs
 
+	if err := r.appendExtraContainers(template); err != nil {
+		return nil, err
+	}
+
 	err = r.runPlugins(ComponentPluginMethodAfterPodTemplateGeneration, component, template, template)
 	if err != nil {
 		r.WarningEvent(err, "run "+ComponentPluginMethodAfterPodTemplateGeneration+" save plugin error")
@@ -1514,6 +1570,9 @@ func (r *ComponentReconcilerTask) SetupAttributes(req ctrl.Request) (err error)
 		return err
 	}
 	r.component = &component
+	r.rollout = component.Status.Rollout.DeepCopy()
+	r.autoRollback = component.Status.AutoRollback.DeepCopy()
+	r.pinnedImage = component.Status.PinnedImage.DeepCopy()
 
 	var ns coreV1.Namespace
 	err = r.Reader.Get(r.ctx, types.NamespacedName{
@@ -1563,6 +1622,18 @@ func (r *ComponentReconcilerTask) DeleteResources() (err error) {
 		}
 	}
 
+	if r.hpa != nil {
+		if err := r.DeleteItem(r.hpa); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	if r.secret != nil {
+		if err := r.DeleteItem(r.secret); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
 	var bindingList corev1alpha1.ComponentPluginBindingList
 
 	if err := r.Reader.List(r.ctx, &bindingList, client.MatchingLabels{
@@ -1604,8 +1675,21 @@ func (r *ComponentReconcilerTask) LoadResources() (err error) {
 		return err
 	}
 
+	// loaded for any workload type, so it can be deleted after the workload type changes
+	if err := r.LoadHorizontalPodAutoscaler(); err != nil {
+		return err
+	}
+
+	if err := r.LoadSecret(); err != nil {
+		return err
+	}
+
 	switch r.component.Spec.WorkloadType {
 	case corev1alpha1.WorkloadTypeServer, "":
+		if err := r.LoadCanaryResources(); err != nil {
+			return err
+		}
+
 		return r.LoadDeployment()
 	case corev1alpha1.WorkloadTypeCronjob:
 		return r.LoadCronJob()
@@ -1750,6 +1834,10 @@ func isStatefulSet(component *corev1alpha1.Component) bool {
 	return component.Spec.WorkloadType == corev1alpha1.WorkloadTypeStatefulSet
 }
 
+func isServer(component *corev1alpha1.Component) bool {
+	return component.Spec.WorkloadType == corev1alpha1.WorkloadTypeServer || component.Spec.WorkloadType == ""
+}
+
 func (r *ComponentReconcilerTask) preparePreInjectedFiles(
 	template *coreV1.PodTemplateSpec,
 	volumes *[]coreV1.Volume,
@@ -1757,7 +1845,17 @@ func (r *ComponentReconcilerTask) preparePreInjectedFiles(
 ) error {
 	component := r.component
 
-	if len(component.Spec.PreInjectedFiles) <= 0 {
+	r.prepareSecretPreInjectedFiles(volumes, volumeMounts)
+
+	var files []corev1alpha1.PreInjectFile
+
+	for _, file := range component.Spec.PreInjectedFiles {
+		if !file.Secret {
+			files = append(files, file)
+		}
+	}
+
+	if len(files) <= 0 {
 		return nil
 	}
 
@@ -1773,7 +1871,7 @@ func (r *ComponentReconcilerTask) preparePreInjectedFiles(
 	}
 
 	var injectCommands []string
-	for _, file := range component.Spec.PreInjectedFiles {
+	for _, file := range files {
 		content := file.Content
 
 		if !file.Base64 {
@@ -1798,12 +1896,13 @@ func (r *ComponentReconcilerTask) preparePreInjectedFiles(
 		})
 	}
 
-	template.Spec.InitContainers = append(template.Spec.InitContainers, coreV1.Container{
+	// files are injected before the init containers of the component run
+	template.Spec.InitContainers = append([]coreV1.Container{{
 		Name:         "inject-files",
 		Image:        "busybox",
 		Command:      []string{"sh", "-c", fmt.Sprintf("%s", strings.Join(injectCommands, " && "))},
 		VolumeMounts: []coreV1.VolumeMount{{MountPath: "/files", Name: "pre-injected-files-volume"}},
-	})
+	}}, template.Spec.InitContainers...)
 
 	return nil
 }
@@ -1818,6 +1917,7 @@ func (r *ComponentReconcilerTask) prepareVolsForSTS(template *coreV1.PodTemplate
 	var volumes []coreV1.Volume
 	var volumeMounts []coreV1.VolumeMount
 	var volClaimTemplates []coreV1.PersistentVolumeClaim
+	volNames := make(map[string]string)
 
 	if err := r.preparePreInjectedFiles(template, &volumes, &volumeMounts); err != nil {
 		return nil, err
@@ -1893,6 +1993,7 @@ func (r *ComponentReconcilerTask) prepareVolsForSTS(template *coreV1.PodTemplate
 			Name:      volName,
 			MountPath: disk.Path,
 		})
+		volNames[disk.Path] = volName
 	}
 
 	// set volumes & volMounts for podTemplate of STS
@@ -1901,6 +2002,10 @@ func (r *ComponentReconcilerTask) prepareVolsForSTS(template *coreV1.PodTemplate
 	mainContainer := &template.Spec.Containers[0]
 	mainContainer.VolumeMounts = volumeMounts
 
+	if err := r.mountVolumesForExtraContainers(template, volNames); err != nil {
+		return nil, err
+	}
+
 	// for STS, pvc is not in podTemplate but in volumeClaimTemplate
 	return volClaimTemplates, nil
 }
@@ -1912,6 +2017,7 @@ func (r *ComponentReconcilerTask) prepareVolsForSimpleWorkload(template *coreV1.
 
 	var volumes []coreV1.Volume
 	var volumeMounts []coreV1.VolumeMount
+	volNames := make(map[string]string)
 
 	if err := r.preparePreInjectedFiles(template, &volumes, &volumeMounts); err != nil {
 		return err
@@ -2029,6 +2135,7 @@ func (r *ComponentReconcilerTask) prepareVolsForSimpleWorkload(template *coreV1.
 			Name:      volName,
 			MountPath: disk.Path,
 		})
+		volNames[disk.Path] = volName
 	}
 
 	template.Spec.Volumes = volumes
@@ -2036,6 +2143,10 @@ func (r *ComponentReconcilerTask) prepareVolsForSimpleWorkload(template *coreV1.
 	mainContainer := &template.Spec.Containers[0]
 	mainContainer.VolumeMounts = volumeMounts
 
+	if err := r.mountVolumesForExtraContainers(template, volNames); err != nil {
+		return err
+	}
+
 	return nil
 }
 
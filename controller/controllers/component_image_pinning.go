@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/docker/distribution/reference"
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/opencontainers/go-digest"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ReconcileImagePinning resolves the digest of spec.image if spec.pinImageDigest is set.
+// A resolved digest is kept until the spec changes or the component is deployed by a webhook,
+// so pushing the tag again doesn't change the image of pods started later.
+func (r *ComponentReconcilerTask) ReconcileImagePinning() error {
+	component := r.component
+
+	if !component.Spec.PinImageDigest {
+		r.pinnedImage = nil
+		return nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(component.Spec.Image)
+
+	if err != nil {
+		return fmt.Errorf("invalid image %s: %s", component.Spec.Image, err)
+	}
+
+	// the digest in the image is used as it is
+	if _, isDigested := named.(reference.Digested); isDigested {
+		r.pinnedImage = nil
+		return nil
+	}
+
+	webhookUpdatedAt := component.Annotations[AnnoLastUpdatedByWebhook]
+
+	if r.pinnedImage != nil &&
+		r.pinnedImage.Image == component.Spec.Image &&
+		r.pinnedImage.Generation == component.Generation &&
+		r.pinnedImage.WebhookUpdatedAt == webhookUpdatedAt {
+		return nil
+	}
+
+	tag := "latest"
+
+	if tagged, isTagged := named.(reference.Tagged); isTagged {
+		tag = tagged.Tag()
+	}
+
+	// the workload keeps running the previously pinned image until the digest is resolved
+	imageDigest, err := r.resolveImageDigest(named, tag)
+
+	if err != nil {
+		return fmt.Errorf("resolve digest of image %s failed: %s", component.Spec.Image, err)
+	}
+
+	if r.pinnedImage == nil || r.pinnedImage.Digest != imageDigest.String() {
+		r.NormalEvent("ImagePinned", "Image %s is pinned to %s.", component.Spec.Image, imageDigest)
+	}
+
+	r.pinnedImage = &corev1alpha1.ComponentPinnedImage{
+		Image:            component.Spec.Image,
+		Digest:           imageDigest.String(),
+		Generation:       component.Generation,
+		WebhookUpdatedAt: webhookUpdatedAt,
+		ResolvedAt:       metaV1.Now(),
+	}
+
+	return nil
+}
+
+// resolveImageDigest asks the registry of the image for the digest of the tag, with the credentials of
+// the DockerRegistry of its host. Images in registries without a DockerRegistry are resolved anonymously.
+func (r *ComponentReconcilerTask) resolveImageDigest(named reference.Named, tag string) (digest.Digest, error) {
+	domain := reference.Domain(named)
+	host := getRegistryURL(domain)
+	credentials := &RegistryCredentials{}
+
+	if domain == getRegistryDomain("") {
+		host = dockerHubRegistryHost
+	}
+
+	var registryList corev1alpha1.DockerRegistryList
+
+	if err := r.Reader.List(r.ctx, &registryList); err != nil {
+		return "", err
+	}
+
+	for i := range registryList.Items {
+		registry := &registryList.Items[i]
+
+		if getRegistryDomain(registry.Spec.Host) != domain {
+			continue
+		}
+
+		secret, err := r.getRegistrySecret(registry)
+
+		if err != nil {
+			return "", err
+		}
+
+		credentials, err = getRegistryCredentials(r.ctx, registry, secret)
+
+		if err != nil {
+			return "", err
+		}
+
+		host = getRegistryHost(registry)
+		break
+	}
+
+	hub, err := newRegistryClient(host, credentials)
+
+	if err != nil {
+		return "", err
+	}
+
+	return newRegistryCatalogClient(hub).ManifestDigest(reference.Path(named), tag)
+}
+
+// getRegistrySecret returns the authentication secret of the registry, nil if it doesn't exist.
+func (r *ComponentReconcilerTask) getRegistrySecret(registry *corev1alpha1.DockerRegistry) (*coreV1.Secret, error) {
+	var secret coreV1.Secret
+
+	err := r.Reader.Get(r.ctx, types.NamespacedName{
+		Namespace: "kalm-system",
+		Name:      GetRegistryAuthenticationName(registry.Name),
+	}, &secret)
+
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &secret, nil
+}
+
+// getMainContainerImage returns the image of the main container, with the pinned digest if there is one.
+func (r *ComponentReconcilerTask) getMainContainerImage() string {
+	if r.pinnedImage == nil || r.pinnedImage.Image != r.component.Spec.Image {
+		return r.component.Spec.Image
+	}
+
+	return r.component.Spec.Image + "@" + r.pinnedImage.Digest
+}
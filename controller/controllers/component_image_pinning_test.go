@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileImagePinning(t *testing.T) {
+	digests := map[string]string{
+		"v1": "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "kalm" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path == "/v2/" {
+			return
+		}
+
+		tag := strings.TrimPrefix(r.URL.Path, "/v2/kalm/echo/manifests/")
+
+		if r.Method != http.MethodHead || digests[tag] == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Docker-Content-Digest", digests[tag])
+	}))
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme))
+	assert.Nil(t, corev1alpha1.AddToScheme(scheme))
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme,
+		&corev1alpha1.DockerRegistry{
+			ObjectMeta: metaV1.ObjectMeta{Name: "local"},
+			Spec:       corev1alpha1.DockerRegistrySpec{Host: server.URL},
+		},
+		&coreV1.Secret{
+			ObjectMeta: metaV1.ObjectMeta{Namespace: "kalm-system", Name: GetRegistryAuthenticationName("local")},
+			Data: map[string][]byte{
+				RegistrySecretUsername: []byte("kalm"),
+				RegistrySecretPassword: []byte("pass"),
+			},
+		},
+	)
+
+	image := getRegistryDomain(server.URL) + "/kalm/echo:v1"
+
+	task := &ComponentReconcilerTask{
+		ComponentReconciler: &ComponentReconciler{&BaseReconciler{
+			Client:   fakeClient,
+			Reader:   fakeClient,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}},
+		ctx: context.Background(),
+		component: &corev1alpha1.Component{
+			ObjectMeta: metaV1.ObjectMeta{Namespace: "ns", Name: "echo", Generation: 1},
+			Spec:       corev1alpha1.ComponentSpec{Image: image},
+		},
+	}
+
+	// not enabled
+	assert.Nil(t, task.ReconcileImagePinning())
+	assert.Nil(t, task.pinnedImage)
+	assert.Equal(t, image, task.getMainContainerImage())
+
+	task.component.Spec.PinImageDigest = true
+	assert.Nil(t, task.ReconcileImagePinning())
+	assert.Equal(t, digests["v1"], task.pinnedImage.Digest)
+	assert.Equal(t, image+"@"+digests["v1"], task.getMainContainerImage())
+
+	// the tag is pushed again, but the pinned digest is kept
+	digests["v1"] = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	assert.Nil(t, task.ReconcileImagePinning())
+	assert.Equal(t, image+"@sha256:1111111111111111111111111111111111111111111111111111111111111111", task.getMainContainerImage())
+
+	// deployed by a webhook
+	task.component.Annotations = map[string]string{AnnoLastUpdatedByWebhook: "1600000000"}
+	assert.Nil(t, task.ReconcileImagePinning())
+	assert.Equal(t, image+"@"+digests["v1"], task.getMainContainerImage())
+
+	// the new tag doesn't exist, the workload is not updated and the previous digest is kept in status
+	task.component.Spec.Image = strings.Replace(image, "v1", "v2", 1)
+	task.component.Generation = 2
+	assert.NotNil(t, task.ReconcileImagePinning())
+	assert.Equal(t, image, task.pinnedImage.Image)
+	assert.Equal(t, task.component.Spec.Image, task.getMainContainerImage())
+
+	// digests in the spec are used as they are
+	task.component.Spec.Image = image + "@" + digests["v1"]
+	assert.Nil(t, task.ReconcileImagePinning())
+	assert.Nil(t, task.pinnedImage)
+	assert.Equal(t, task.component.Spec.Image, task.getMainContainerImage())
+}
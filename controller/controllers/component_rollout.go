@@ -0,0 +1,453 @@
+package controllers
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// the component a canary deployment belongs to
+	KalmLabelCanaryOfKey = "kalm-canary-of"
+
+	// hash of a pod template, used to tell the stable version from the canary one
+	KalmAnnoPodTemplateRevision = "kalm-pod-template-revision"
+
+	defaultRolloutProgressDeadlineSeconds = 600
+	defaultRolloutStepPauseSeconds        = 60
+
+	// how long to wait after the traffic is shifted back to the stable deployment
+	// before the canary is deleted, so the http routes have time to catch up.
+	canaryRetireDelay = 30 * time.Second
+
+	rolloutPollInterval = 10 * time.Second
+)
+
+func isProgressiveRollout(component *corev1alpha1.Component) bool {
+	strategy := component.Spec.RestartStrategy
+	return strategy == corev1alpha1.RestartStrategyCanary || strategy == corev1alpha1.RestartStrategyBlueGreen
+}
+
+func getCanaryName(componentName string) string {
+	return fmt.Sprintf("%s-canary", componentName)
+}
+
+func podTemplateRevision(template *coreV1.PodTemplateSpec) string {
+	bts, _ := json.Marshal(template)
+	return fmt.Sprintf("%x", md5.Sum(bts))
+}
+
+// getRolloutSteps returns the schedule of the rollout with defaults applied.
+func getRolloutSteps(component *corev1alpha1.Component) []corev1alpha1.RolloutStep {
+	var steps []corev1alpha1.RolloutStep
+
+	if component.Spec.ProgressiveRollout != nil {
+		steps = component.Spec.ProgressiveRollout.Steps
+	}
+
+	if component.Spec.RestartStrategy == corev1alpha1.RestartStrategyBlueGreen {
+		pauseSeconds := defaultRolloutStepPauseSeconds
+
+		if len(steps) > 0 {
+			pauseSeconds = steps[0].PauseSeconds
+		}
+
+		return []corev1alpha1.RolloutStep{{Weight: 100, PauseSeconds: pauseSeconds}}
+	}
+
+	if len(steps) == 0 {
+		return []corev1alpha1.RolloutStep{
+			{Weight: 10, PauseSeconds: defaultRolloutStepPauseSeconds},
+			{Weight: 50, PauseSeconds: defaultRolloutStepPauseSeconds},
+		}
+	}
+
+	return steps
+}
+
+func getRolloutProgressDeadline(component *corev1alpha1.Component) time.Duration {
+	if component.Spec.ProgressiveRollout != nil && component.Spec.ProgressiveRollout.ProgressDeadlineSeconds != nil {
+		return time.Duration(*component.Spec.ProgressiveRollout.ProgressDeadlineSeconds) * time.Second
+	}
+
+	return defaultRolloutProgressDeadlineSeconds * time.Second
+}
+
+func isDeploymentAvailable(deployment *appsV1.Deployment) bool {
+	if deployment == nil {
+		return false
+	}
+
+	state := getDeploymentRolloutState(deployment)
+
+	return !state.progressing && state.ready >= state.desired
+}
+
+func (r *ComponentReconcilerTask) GetCanaryLabels() map[string]string {
+	labels := r.GetLabels()
+	labels[KalmLabelComponentKey] = getCanaryName(r.component.Name)
+	labels[KalmLabelCanaryOfKey] = r.component.Name
+	return labels
+}
+
+// ReconcileProgressiveRollout moves a Canary or BlueGreen rollout forward.
+//
+// The stable deployment keeps running the last promoted pod template, while the
+// canary deployment runs the desired one. Traffic is shifted to the canary following
+// spec.progressiveRollout.steps, through the weighted destinations of http routes.
+// After the last step, the stable deployment is updated to the desired pod template,
+// the traffic is shifted back and the canary is deleted.
+func (r *ComponentReconcilerTask) ReconcileProgressiveRollout(template *coreV1.PodTemplateSpec) error {
+	desiredRevision := podTemplateRevision(template)
+	template.ObjectMeta.Annotations[KalmAnnoPodTemplateRevision] = desiredRevision
+
+	// first deployment, or the component was using another restart strategy.
+	if r.deployment == nil || r.deployment.Spec.Template.Annotations[KalmAnnoPodTemplateRevision] == "" {
+		return r.ReconcileDeployment(template)
+	}
+
+	stableRevision := r.deployment.Spec.Template.Annotations[KalmAnnoPodTemplateRevision]
+
+	if stableRevision == desiredRevision {
+		if err := r.ReconcileDeployment(template); err != nil {
+			return err
+		}
+
+		if r.rollout == nil || r.rollout.Phase != corev1alpha1.RolloutPhasePromoting {
+			return r.retireCanary("The spec is reverted to the stable version.")
+		}
+
+		if !isDeploymentAvailable(r.deployment) {
+			r.rollout.Message = "Waiting for the stable deployment to be updated."
+			r.RequeueAfter(rolloutPollInterval)
+			return nil
+		}
+
+		r.rollout.Phase = corev1alpha1.RolloutPhaseSucceeded
+		r.rollout.StableRevision = desiredRevision
+		r.rollout.Message = "The new version is promoted."
+		r.NormalEvent("RolloutSucceeded", "The new version is promoted, traffic is shifted back to the stable deployment.")
+
+		return r.retireCanary("")
+	}
+
+	now := metaV1.Now()
+
+	if r.rollout == nil || r.rollout.CanaryRevision != desiredRevision {
+		r.rollout = &corev1alpha1.ComponentRolloutStatus{
+			Phase:          corev1alpha1.RolloutPhaseProgressing,
+			StableRevision: stableRevision,
+			CanaryRevision: desiredRevision,
+			StartedAt:      &now,
+		}
+
+		r.NormalEvent("RolloutStarted", "%s rollout of revision %s is started.", r.component.Spec.RestartStrategy, desiredRevision)
+	}
+
+	// the stable deployment keeps running the last promoted version during the rollout.
+	stableTemplate := r.deployment.Spec.Template.DeepCopy()
+	if err := r.ReconcileDeployment(stableTemplate); err != nil {
+		return err
+	}
+
+	if r.rollout.Phase == corev1alpha1.RolloutPhaseAborted {
+		return r.retireCanary("")
+	}
+
+	if r.component.Spec.ProgressiveRollout != nil && r.component.Spec.ProgressiveRollout.Abort {
+		return r.abortRollout("The rollout is aborted by spec.progressiveRollout.abort.")
+	}
+
+	if err := r.reconcileCanaryDeployment(template); err != nil {
+		return err
+	}
+
+	if err := r.reconcileCanaryService(); err != nil {
+		return err
+	}
+
+	if !isDeploymentAvailable(r.canaryDeployment) {
+		deadline := getRolloutProgressDeadline(r.component)
+
+		if now.Sub(r.rollout.StartedAt.Time) > deadline {
+			return r.abortRollout(fmt.Sprintf("The canary is not ready within %s.", deadline))
+		}
+
+		r.rollout.Message = "Waiting for the canary to be ready."
+		r.RequeueAfter(rolloutPollInterval)
+		return nil
+	}
+
+	steps := getRolloutSteps(r.component)
+
+	if r.rollout.StepStartedAt == nil {
+		r.setRolloutStep(0, steps[0], now)
+		r.RequeueAfter(time.Duration(steps[0].PauseSeconds) * time.Second)
+		return nil
+	}
+
+	// the schedule may have been changed during the rollout
+	if r.rollout.CurrentStep >= len(steps) {
+		r.rollout.CurrentStep = len(steps) - 1
+	}
+
+	step := steps[r.rollout.CurrentStep]
+	pause := time.Duration(step.PauseSeconds) * time.Second
+
+	if elapsed := now.Sub(r.rollout.StepStartedAt.Time); elapsed < pause {
+		r.RequeueAfter(pause - elapsed)
+		return nil
+	}
+
+	if r.rollout.CurrentStep+1 < len(steps) {
+		next := r.rollout.CurrentStep + 1
+		r.setRolloutStep(next, steps[next], now)
+		r.RequeueAfter(time.Duration(steps[next].PauseSeconds) * time.Second)
+		return nil
+	}
+
+	// all steps passed, promote the canary
+	r.rollout.Phase = corev1alpha1.RolloutPhasePromoting
+	r.rollout.Message = "Updating the stable deployment to the new version."
+	r.NormalEvent("RolloutPromoting", "All rollout steps passed, promoting revision %s.", desiredRevision)
+	r.RequeueAfter(rolloutPollInterval)
+
+	return r.ReconcileDeployment(template)
+}
+
+func (r *ComponentReconcilerTask) setRolloutStep(index int, step corev1alpha1.RolloutStep, now metaV1.Time) {
+	r.rollout.CurrentStep = index
+	r.rollout.CanaryWeight = step.Weight
+	r.rollout.StepStartedAt = &now
+	r.rollout.Message = fmt.Sprintf("%d%% of the traffic goes to the canary.", step.Weight)
+
+	r.NormalEvent("RolloutStep", "Rollout step %d, %d%% of the traffic goes to the canary.", index, step.Weight)
+}
+
+func (r *ComponentReconcilerTask) abortRollout(reason string) error {
+	r.rollout.Phase = corev1alpha1.RolloutPhaseAborted
+	r.rollout.Message = reason
+	r.WarningEvent(fmt.Errorf(reason), "Rollout of revision %s is aborted.", r.rollout.CanaryRevision)
+
+	return r.retireCanary("")
+}
+
+// retireCanary shifts all traffic back to the stable deployment and deletes the canary
+// resources once the http routes had time to catch up.
+// If a rollout is still running, it is aborted with the given reason.
+func (r *ComponentReconcilerTask) retireCanary(abortReason string) error {
+	if r.rollout != nil && (r.rollout.Phase == corev1alpha1.RolloutPhaseProgressing || r.rollout.Phase == corev1alpha1.RolloutPhasePromoting) {
+		return r.abortRollout(abortReason)
+	}
+
+	if r.canaryDeployment == nil && r.canaryService == nil {
+		if r.rollout != nil {
+			r.rollout.CanaryWeight = 0
+		}
+
+		return nil
+	}
+
+	now := metaV1.Now()
+
+	if r.rollout != nil && r.rollout.CanaryWeight != 0 {
+		r.rollout.CanaryWeight = 0
+		r.rollout.StepStartedAt = &now
+		r.RequeueAfter(canaryRetireDelay)
+		return nil
+	}
+
+	if r.rollout != nil && r.rollout.StepStartedAt != nil {
+		if elapsed := now.Sub(r.rollout.StepStartedAt.Time); elapsed < canaryRetireDelay {
+			r.RequeueAfter(canaryRetireDelay - elapsed)
+			return nil
+		}
+	}
+
+	return r.deleteCanaryResources()
+}
+
+func (r *ComponentReconcilerTask) deleteCanaryResources() error {
+	if r.canaryDeployment != nil {
+		if err := r.Delete(r.ctx, r.canaryDeployment); client.IgnoreNotFound(err) != nil {
+			r.WarningEvent(err, "unable to delete canary Deployment for Component")
+			return err
+		}
+
+		r.canaryDeployment = nil
+	}
+
+	if r.canaryService != nil {
+		if err := r.Delete(r.ctx, r.canaryService); client.IgnoreNotFound(err) != nil {
+			r.WarningEvent(err, "unable to delete canary Service for Component")
+			return err
+		}
+
+		r.canaryService = nil
+	}
+
+	return nil
+}
+
+func (r *ComponentReconcilerTask) reconcileCanaryDeployment(template *coreV1.PodTemplateSpec) error {
+	labels := r.GetCanaryLabels()
+
+	canaryTemplate := template.DeepCopy()
+	for k, v := range labels {
+		canaryTemplate.ObjectMeta.Labels[k] = v
+	}
+	canaryTemplate.ObjectMeta.Labels["version"] = "canary"
+
+	replicas := int32(1)
+
+	if r.component.Spec.RestartStrategy == corev1alpha1.RestartStrategyBlueGreen {
+		if r.component.Spec.Autoscaling != nil {
+			// run as many replicas as the autoscaler currently wants for the stable version
+			if r.deployment != nil && r.deployment.Spec.Replicas != nil {
+				replicas = *r.deployment.Spec.Replicas
+			} else {
+				replicas = *getAutoscalingMinReplicas(r.component.Spec.Autoscaling)
+			}
+		} else if r.component.Spec.Replicas != nil {
+			replicas = *r.component.Spec.Replicas
+		}
+	} else if r.component.Spec.ProgressiveRollout != nil && r.component.Spec.ProgressiveRollout.CanaryReplicas != nil {
+		replicas = *r.component.Spec.ProgressiveRollout.CanaryReplicas
+	}
+
+	deployment := r.canaryDeployment
+	isNew := deployment == nil
+
+	if isNew {
+		deployment = &appsV1.Deployment{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:        getCanaryName(r.component.Name),
+				Namespace:   r.component.Namespace,
+				Labels:      labels,
+				Annotations: r.GetAnnotations(),
+			},
+			Spec: appsV1.DeploymentSpec{
+				Selector: &metaV1.LabelSelector{
+					MatchLabels: labels,
+				},
+			},
+		}
+
+		if err := ctrl.SetControllerReference(r.component, deployment, r.Scheme); err != nil {
+			r.WarningEvent(err, "unable to set owner for canary deployment")
+			return err
+		}
+	}
+
+	deployment.Spec.Template = *canaryTemplate
+	deployment.Spec.Replicas = &replicas
+
+	if isNew {
+		if err := r.Create(r.ctx, deployment); err != nil {
+			r.WarningEvent(err, "unable to create canary Deployment for Component")
+			return err
+		}
+
+		r.NormalEvent("CanaryDeploymentCreated", deployment.Name+" is created.")
+	} else {
+		if err := r.Update(r.ctx, deployment); err != nil {
+			r.WarningEvent(err, "unable to update canary Deployment for Component")
+			return err
+		}
+	}
+
+	r.canaryDeployment = deployment
+
+	return nil
+}
+
+// The canary service is the destination http routes shift traffic to.
+func (r *ComponentReconcilerTask) reconcileCanaryService() error {
+	if len(r.component.Spec.Ports) == 0 {
+		if r.canaryService != nil {
+			if err := r.Delete(r.ctx, r.canaryService); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+
+			r.canaryService = nil
+		}
+
+		return nil
+	}
+
+	labels := r.GetCanaryLabels()
+
+	service := r.canaryService
+	isNew := service == nil
+
+	if isNew {
+		service = &coreV1.Service{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      getCanaryName(r.component.Name),
+				Namespace: r.component.Namespace,
+				Labels:    labels,
+			},
+		}
+
+		if err := ctrl.SetControllerReference(r.component, service, r.Scheme); err != nil {
+			r.WarningEvent(err, "unable to set owner for canary Service")
+			return err
+		}
+	}
+
+	service.Spec.Selector = labels
+	service.Spec.Ports = r.getServicePorts()
+
+	if isNew {
+		if err := r.Create(r.ctx, service); err != nil {
+			r.WarningEvent(err, "unable to create canary Service for Component")
+			return err
+		}
+	} else {
+		if err := r.Update(r.ctx, service); err != nil {
+			r.WarningEvent(err, "unable to update canary Service for Component")
+			return err
+		}
+	}
+
+	r.canaryService = service
+
+	return nil
+}
+
+func (r *ComponentReconcilerTask) LoadCanaryResources() error {
+	key := types.NamespacedName{
+		Namespace: r.component.Namespace,
+		Name:      getCanaryName(r.component.Name),
+	}
+
+	// resources with the same name may belong to another component called <name>-canary
+	var deployment appsV1.Deployment
+	if err := r.Reader.Get(r.ctx, key, &deployment); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	} else if deployment.Labels[KalmLabelCanaryOfKey] == r.component.Name {
+		r.canaryDeployment = &deployment
+	}
+
+	var service coreV1.Service
+	if err := r.Reader.Get(r.ctx, key, &service); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	} else if service.Labels[KalmLabelCanaryOfKey] == r.component.Name {
+		r.canaryService = &service
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetRolloutSteps(t *testing.T) {
+	component := &v1alpha1.Component{
+		Spec: v1alpha1.ComponentSpec{
+			RestartStrategy: v1alpha1.RestartStrategyCanary,
+		},
+	}
+
+	assert.True(t, isProgressiveRollout(component))
+	assert.Len(t, getRolloutSteps(component), 2)
+
+	component.Spec.ProgressiveRollout = &v1alpha1.ProgressiveRollout{
+		Steps: []v1alpha1.RolloutStep{
+			{Weight: 5, PauseSeconds: 30},
+			{Weight: 25, PauseSeconds: 30},
+			{Weight: 75, PauseSeconds: 60},
+		},
+	}
+	assert.Equal(t, component.Spec.ProgressiveRollout.Steps, getRolloutSteps(component))
+
+	component.Spec.RestartStrategy = v1alpha1.RestartStrategyBlueGreen
+	assert.Equal(t, []v1alpha1.RolloutStep{{Weight: 100, PauseSeconds: 30}}, getRolloutSteps(component))
+
+	component.Spec.RestartStrategy = "RollingUpdate"
+	assert.False(t, isProgressiveRollout(component))
+}
+
+func TestPodTemplateRevision(t *testing.T) {
+	template := &coreV1.PodTemplateSpec{
+		ObjectMeta: metaV1.ObjectMeta{
+			Labels: map[string]string{"a": "1", "b": "2"},
+		},
+		Spec: coreV1.PodSpec{
+			Containers: []coreV1.Container{{Name: "foo", Image: "foo:v1"}},
+		},
+	}
+
+	revision := podTemplateRevision(template)
+	assert.Equal(t, revision, podTemplateRevision(template.DeepCopy()))
+
+	template.Spec.Containers[0].Image = "foo:v2"
+	assert.NotEqual(t, revision, podTemplateRevision(template))
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"crypto/md5"
+	"fmt"
+	"sort"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// the hash of the secret data in pod template, pods are restarted once a secret value changes
+	AnnoComponentSecretHash = "core.kalm.dev/secret-hash"
+
+	preInjectedSecretFilesVolumeName = "pre-injected-secret-files-volume"
+)
+
+func getSecretDataHash(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+
+	for key := range data {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	hash := md5.New()
+
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write(data[key])
+		hash.Write([]byte{0})
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// ReconcileSecret creates the secret owned by the component, clients write the values of secret envs
+// and secret pre-injected files into it. The data is never touched here, values are not in the component.
+// The secret is deleted once nothing uses it.
+func (r *ComponentReconcilerTask) ReconcileSecret() error {
+	if !corev1alpha1.IsComponentSecretNeeded(r.component) {
+		return r.DeleteSecret()
+	}
+
+	if r.secret != nil {
+		return nil
+	}
+
+	secret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      corev1alpha1.ComponentSecretName(r.component.Name),
+			Namespace: r.component.Namespace,
+			Labels:    r.GetLabels(),
+		},
+		Type: coreV1.SecretTypeOpaque,
+	}
+
+	if err := ctrl.SetControllerReference(r.component, secret, r.Scheme); err != nil {
+		r.WarningEvent(err, "unable to set owner for secret")
+		return err
+	}
+
+	if err := r.Create(r.ctx, secret); err != nil {
+		r.WarningEvent(err, "unable to create secret for Component")
+		return err
+	}
+
+	r.NormalEvent("SecretCreated", secret.Name+" is created.")
+	r.secret = secret
+
+	return nil
+}
+
+func (r *ComponentReconcilerTask) DeleteSecret() error {
+	if r.secret == nil {
+		return nil
+	}
+
+	if err := r.Delete(r.ctx, r.secret); client.IgnoreNotFound(err) != nil {
+		r.WarningEvent(err, "delete secret error.")
+		return err
+	}
+
+	r.NormalEvent("SecretDeleted", r.secret.Name+" is deleted.")
+	r.secret = nil
+
+	return nil
+}
+
+func (r *ComponentReconcilerTask) LoadSecret() error {
+	var secret coreV1.Secret
+
+	if err := r.Reader.Get(
+		r.ctx,
+		types.NamespacedName{
+			Namespace: r.component.Namespace,
+			Name:      corev1alpha1.ComponentSecretName(r.component.Name),
+		},
+		&secret,
+	); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	// a secret with the same name which is not created for the component is left alone,
+	// creating the secret will fail if the component needs it.
+	if !metaV1.IsControlledBy(&secret, r.component) {
+		return nil
+	}
+
+	r.secret = &secret
+
+	return nil
+}
+
+// prepareSecretPreInjectedFiles mounts the secret pre-injected files from the secret of the component.
+func (r *ComponentReconcilerTask) prepareSecretPreInjectedFiles(
+	volumes *[]coreV1.Volume,
+	volumeMounts *[]coreV1.VolumeMount,
+) {
+	var items []coreV1.KeyToPath
+
+	for _, file := range r.component.Spec.PreInjectedFiles {
+		if !file.Secret {
+			continue
+		}
+
+		key := corev1alpha1.ComponentSecretFileKey(file.MountPath)
+		mode := int32(0644)
+
+		if file.Runnable {
+			mode = 0755
+		}
+
+		items = append(items, coreV1.KeyToPath{
+			Key:  key,
+			Path: key,
+			Mode: &mode,
+		})
+
+		*volumeMounts = append(*volumeMounts, coreV1.VolumeMount{
+			Name:      preInjectedSecretFilesVolumeName,
+			MountPath: file.MountPath,
+			SubPath:   key,
+			ReadOnly:  file.Readonly,
+		})
+	}
+
+	if len(items) == 0 {
+		return
+	}
+
+	*volumes = append(*volumes, coreV1.Volume{
+		Name: preInjectedSecretFilesVolumeName,
+		VolumeSource: coreV1.VolumeSource{
+			Secret: &coreV1.SecretVolumeSource{
+				SecretName: corev1alpha1.ComponentSecretName(r.component.Name),
+				Items:      items,
+			},
+		},
+	})
+}
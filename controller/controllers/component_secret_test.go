@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsComponentSecretNeeded(t *testing.T) {
+	component := &v1alpha1.Component{
+		Spec: v1alpha1.ComponentSpec{
+			Env: []v1alpha1.EnvVar{
+				{Name: "MODE", Value: "prod", Type: v1alpha1.EnvVarTypeStatic},
+			},
+			PreInjectedFiles: []v1alpha1.PreInjectFile{
+				{MountPath: "/etc/app/config.yaml", Content: "plain"},
+			},
+		},
+	}
+
+	assert.False(t, v1alpha1.IsComponentSecretNeeded(component))
+
+	component.Spec.Sidecars = []v1alpha1.Container{
+		{Name: "proxy", Env: []v1alpha1.EnvVar{{Name: "DB_PASSWORD", Type: v1alpha1.EnvVarTypeSecret}}},
+	}
+
+	assert.True(t, v1alpha1.IsComponentSecretNeeded(component))
+
+	component.Spec.Sidecars = nil
+	component.Spec.PreInjectedFiles[0].Secret = true
+
+	assert.True(t, v1alpha1.IsComponentSecretNeeded(component))
+}
+
+func TestSecretEnvsAndFiles(t *testing.T) {
+	task := &ComponentReconcilerTask{
+		component: &v1alpha1.Component{
+			ObjectMeta: metaV1.ObjectMeta{Name: "web"},
+			Spec: v1alpha1.ComponentSpec{
+				PreInjectedFiles: []v1alpha1.PreInjectFile{
+					{MountPath: "/bin/entrypoint.sh", Runnable: true, Secret: true},
+				},
+			},
+		},
+	}
+
+	envs, err := task.getContainerEnvs("proxy", []v1alpha1.EnvVar{{Name: "DB_PASSWORD", Type: v1alpha1.EnvVarTypeSecret}})
+	assert.Nil(t, err)
+	assert.Equal(t, "web-secret", envs[0].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "proxy.DB_PASSWORD", envs[0].ValueFrom.SecretKeyRef.Key)
+	assert.Equal(t, "", envs[0].Value)
+
+	var volumes []coreV1.Volume
+	var volumeMounts []coreV1.VolumeMount
+
+	err = task.preparePreInjectedFiles(&coreV1.PodTemplateSpec{}, &volumes, &volumeMounts)
+	assert.Nil(t, err)
+
+	key := v1alpha1.ComponentSecretFileKey("/bin/entrypoint.sh")
+
+	assert.Len(t, volumes, 1)
+	assert.Equal(t, "web-secret", volumes[0].Secret.SecretName)
+	assert.Equal(t, int32(0755), *volumes[0].Secret.Items[0].Mode)
+	assert.Equal(t, []coreV1.VolumeMount{{Name: preInjectedSecretFilesVolumeName, MountPath: "/bin/entrypoint.sh", SubPath: key}}, volumeMounts)
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	apiEquality "k8s.io/apimachinery/pkg/api/equality"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// workloadRolloutState is a workload independent summary of a rollout,
+// used to compute the conditions of a component.
+type workloadRolloutState struct {
+	found bool
+
+	desired int32
+	ready   int32
+
+	progressing        bool
+	progressingMessage string
+
+	degraded        bool
+	degradedReason  string
+	degradedMessage string
+}
+
+// UpdateStatus writes the rollout state of the workload, and the result of
+// the reconciliation (reconcileErr), back to the component status.
+func (r *ComponentReconcilerTask) UpdateStatus(reconcileErr error) error {
+	state := r.getWorkloadRolloutState()
+
+	status := r.component.Status.DeepCopy()
+	status.ObservedGeneration = r.component.Generation
+	status.DesiredReplicas = state.desired
+	status.ReadyReplicas = state.ready
+	status.Rollout = r.rollout
+	status.AutoRollback = r.autoRollback
+	status.PinnedImage = r.pinnedImage
+
+	if reconcileErr != nil {
+		status.LastReconcileError = reconcileErr.Error()
+	} else {
+		status.LastReconcileError = ""
+	}
+
+	digest, err := r.getImageDigest()
+	if err != nil {
+		return err
+	}
+
+	if digest != "" {
+		status.ImageDigest = digest
+	}
+
+	switch {
+	case !state.found:
+		setComponentCondition(status, corev1alpha1.ComponentConditionReady, coreV1.ConditionFalse, "WorkloadNotFound", "The workload of this component doesn't exist.")
+		setComponentCondition(status, corev1alpha1.ComponentConditionProgressing, coreV1.ConditionFalse, "WorkloadNotFound", "")
+	case state.progressing:
+		setComponentCondition(status, corev1alpha1.ComponentConditionReady, coreV1.ConditionFalse, "RollingOut", state.progressingMessage)
+		setComponentCondition(status, corev1alpha1.ComponentConditionProgressing, coreV1.ConditionTrue, "RollingOut", state.progressingMessage)
+	default:
+		setComponentCondition(status, corev1alpha1.ComponentConditionReady, coreV1.ConditionTrue, "RolloutComplete", "")
+		setComponentCondition(status, corev1alpha1.ComponentConditionProgressing, coreV1.ConditionFalse, "RolloutComplete", "")
+	}
+
+	switch {
+	case reconcileErr != nil:
+		setComponentCondition(status, corev1alpha1.ComponentConditionDegraded, coreV1.ConditionTrue, "ReconcileError", reconcileErr.Error())
+	case state.degraded:
+		setComponentCondition(status, corev1alpha1.ComponentConditionDegraded, coreV1.ConditionTrue, state.degradedReason, state.degradedMessage)
+	default:
+		setComponentCondition(status, corev1alpha1.ComponentConditionDegraded, coreV1.ConditionFalse, "", "")
+	}
+
+	switch {
+	case r.autoRollback == nil:
+		removeComponentCondition(status, corev1alpha1.ComponentConditionRolledBack)
+	case r.autoRollback.RolledBackImage != "":
+		setComponentCondition(status, corev1alpha1.ComponentConditionRolledBack, coreV1.ConditionTrue, "ThresholdBreached", r.autoRollback.Message)
+	case r.autoRollback.AnalysisStartedAt != nil:
+		setComponentCondition(status, corev1alpha1.ComponentConditionRolledBack, coreV1.ConditionFalse, "Analysing", fmt.Sprintf("Watching the metrics of image %s.", r.autoRollback.Image))
+	default:
+		setComponentCondition(status, corev1alpha1.ComponentConditionRolledBack, coreV1.ConditionFalse, "AnalysisPassed", "")
+	}
+
+	if apiEquality.Semantic.DeepEqual(&r.component.Status, status) {
+		return nil
+	}
+
+	componentCopy := r.component.DeepCopy()
+	componentCopy.Status = *status
+
+	if err := r.Status().Patch(r.ctx, componentCopy, client.MergeFrom(r.component)); err != nil {
+		return err
+	}
+
+	r.component = componentCopy
+
+	return nil
+}
+
+func (r *ComponentReconcilerTask) getWorkloadRolloutState() workloadRolloutState {
+	switch r.component.Spec.WorkloadType {
+	case corev1alpha1.WorkloadTypeServer, "":
+		state := getDeploymentRolloutState(r.deployment)
+
+		if r.rollout != nil && (r.rollout.Phase == corev1alpha1.RolloutPhaseProgressing || r.rollout.Phase == corev1alpha1.RolloutPhasePromoting) {
+			state.progressing = true
+			state.progressingMessage = fmt.Sprintf("%s rollout is at step %d, %d%% of the traffic goes to the canary.", r.component.Spec.RestartStrategy, r.rollout.CurrentStep, r.rollout.CanaryWeight)
+		}
+
+		return state
+	case corev1alpha1.WorkloadTypeStatefulSet:
+		return getStatefulSetRolloutState(r.statefulSet)
+	case corev1alpha1.WorkloadTypeDaemonSet:
+		return getDaemonSetRolloutState(r.daemonSet)
+	case corev1alpha1.WorkloadTypeCronjob:
+		if r.cronJob == nil {
+			return workloadRolloutState{}
+		}
+
+		// a cronjob has no long running replicas, it is ready once it is scheduled
+		state := workloadRolloutState{found: true}
+
+		if n := len(r.cronJob.Status.Active); n > 0 {
+			state.progressing = true
+			state.progressingMessage = fmt.Sprintf("%d job(s) are running.", n)
+		}
+
+		return state
+	}
+
+	return workloadRolloutState{}
+}
+
+func getDeploymentRolloutState(deployment *appsV1.Deployment) workloadRolloutState {
+	if deployment == nil {
+		return workloadRolloutState{}
+	}
+
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+
+	state := workloadRolloutState{
+		found:   true,
+		desired: desired,
+		ready:   deployment.Status.ReadyReplicas,
+	}
+
+	for _, cond := range deployment.Status.Conditions {
+		if cond.Type == appsV1.DeploymentProgressing && cond.Status == coreV1.ConditionFalse {
+			state.degraded = true
+			state.degradedReason = cond.Reason
+			state.degradedMessage = cond.Message
+		}
+
+		if cond.Type == appsV1.DeploymentReplicaFailure && cond.Status == coreV1.ConditionTrue {
+			state.degraded = true
+			state.degradedReason = cond.Reason
+			state.degradedMessage = cond.Message
+		}
+	}
+
+	status := deployment.Status
+
+	switch {
+	case status.ObservedGeneration < deployment.Generation:
+		state.progressing = true
+		state.progressingMessage = "Waiting for the deployment spec update to be observed."
+	case status.UpdatedReplicas < desired:
+		state.progressing = true
+		state.progressingMessage = fmt.Sprintf("%d of %d replicas have been updated.", status.UpdatedReplicas, desired)
+	case status.Replicas > status.UpdatedReplicas:
+		state.progressing = true
+		state.progressingMessage = fmt.Sprintf("%d old replicas are pending termination.", status.Replicas-status.UpdatedReplicas)
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		state.progressing = true
+		state.progressingMessage = fmt.Sprintf("%d of %d updated replicas are available.", status.AvailableReplicas, status.UpdatedReplicas)
+	}
+
+	return state
+}
+
+func getStatefulSetRolloutState(sts *appsV1.StatefulSet) workloadRolloutState {
+	if sts == nil {
+		return workloadRolloutState{}
+	}
+
+	desired := int32(1)
+	if sts.Spec.Replicas != nil {
+		desired = *sts.Spec.Replicas
+	}
+
+	state := workloadRolloutState{
+		found:   true,
+		desired: desired,
+		ready:   sts.Status.ReadyReplicas,
+	}
+
+	status := sts.Status
+
+	switch {
+	case status.ObservedGeneration < sts.Generation:
+		state.progressing = true
+		state.progressingMessage = "Waiting for the statefulset spec update to be observed."
+	case status.UpdateRevision != "" && status.CurrentRevision != status.UpdateRevision:
+		state.progressing = true
+		state.progressingMessage = fmt.Sprintf("%d of %d replicas have been updated.", status.UpdatedReplicas, desired)
+	case status.ReadyReplicas < desired:
+		state.progressing = true
+		state.progressingMessage = fmt.Sprintf("%d of %d replicas are ready.", status.ReadyReplicas, desired)
+	}
+
+	return state
+}
+
+func getDaemonSetRolloutState(ds *appsV1.DaemonSet) workloadRolloutState {
+	if ds == nil {
+		return workloadRolloutState{}
+	}
+
+	status := ds.Status
+
+	state := workloadRolloutState{
+		found:   true,
+		desired: status.DesiredNumberScheduled,
+		ready:   status.NumberReady,
+	}
+
+	switch {
+	case status.ObservedGeneration < ds.Generation:
+		state.progressing = true
+		state.progressingMessage = "Waiting for the daemonset spec update to be observed."
+	case status.UpdatedNumberScheduled < status.DesiredNumberScheduled:
+		state.progressing = true
+		state.progressingMessage = fmt.Sprintf("%d of %d pods have been updated.", status.UpdatedNumberScheduled, status.DesiredNumberScheduled)
+	case status.NumberAvailable < status.DesiredNumberScheduled:
+		state.progressing = true
+		state.progressingMessage = fmt.Sprintf("%d of %d updated pods are available.", status.NumberAvailable, status.DesiredNumberScheduled)
+	}
+
+	return state
+}
+
+// getImageDigest returns the digest of the main container image in the most
+// recently started pod which runs the current spec image.
+func (r *ComponentReconcilerTask) getImageDigest() (string, error) {
+	var podList coreV1.PodList
+
+	if err := r.List(
+		r.ctx,
+		&podList,
+		client.InNamespace(r.component.Namespace),
+		client.MatchingLabels{KalmLabelComponentKey: r.component.Name},
+	); err != nil {
+		return "", err
+	}
+
+	var digest string
+	var latestStartTime *metaV1.Time
+
+	for _, pod := range podList.Items {
+		if pod.Status.StartTime == nil {
+			continue
+		}
+
+		for _, container := range pod.Spec.Containers {
+			if container.Name != r.component.Name || container.Image != r.getMainContainerImage() {
+				continue
+			}
+
+			for _, containerStatus := range pod.Status.ContainerStatuses {
+				if containerStatus.Name != container.Name {
+					continue
+				}
+
+				d := parseDigestFromImageID(containerStatus.ImageID)
+
+				if d == "" {
+					continue
+				}
+
+				if latestStartTime == nil || latestStartTime.Before(pod.Status.StartTime) {
+					latestStartTime = pod.Status.StartTime
+					digest = d
+				}
+			}
+		}
+	}
+
+	return digest, nil
+}
+
+// imageID reported by the container runtime looks like
+// docker-pullable://nginx@sha256:abc...
+func parseDigestFromImageID(imageID string) string {
+	if idx := strings.LastIndex(imageID, "@"); idx >= 0 {
+		return imageID[idx+1:]
+	}
+
+	// a bare sha256:... is the id of the local image, not a registry digest
+	return ""
+}
+
+func setComponentCondition(status *corev1alpha1.ComponentStatus, conditionType corev1alpha1.ComponentConditionType, conditionStatus coreV1.ConditionStatus, reason, message string) {
+	setStatusCondition(&status.Conditions, string(conditionType), conditionStatus, reason, message)
+}
+
+func removeComponentCondition(status *corev1alpha1.ComponentStatus, conditionType corev1alpha1.ComponentConditionType) {
+	removeStatusCondition(&status.Conditions, string(conditionType))
+}
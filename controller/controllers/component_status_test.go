@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetDeploymentRolloutState(t *testing.T) {
+	assert.False(t, getDeploymentRolloutState(nil).found)
+
+	replicas := int32(2)
+	deployment := &appsV1.Deployment{
+		ObjectMeta: metaV1.ObjectMeta{Generation: 2},
+		Spec:       appsV1.DeploymentSpec{Replicas: &replicas},
+		Status: appsV1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           3,
+			UpdatedReplicas:    2,
+			ReadyReplicas:      3,
+			AvailableReplicas:  3,
+		},
+	}
+
+	state := getDeploymentRolloutState(deployment)
+	assert.True(t, state.found)
+	assert.True(t, state.progressing, "old replicas are still running")
+	assert.Equal(t, int32(2), state.desired)
+	assert.Equal(t, int32(3), state.ready)
+
+	deployment.Status.Replicas = 2
+	deployment.Status.ReadyReplicas = 2
+	deployment.Status.AvailableReplicas = 2
+	state = getDeploymentRolloutState(deployment)
+	assert.False(t, state.progressing)
+	assert.False(t, state.degraded)
+
+	deployment.Generation = 3
+	assert.True(t, getDeploymentRolloutState(deployment).progressing)
+
+	deployment.Status.Conditions = []appsV1.DeploymentCondition{
+		{
+			Type:    appsV1.DeploymentProgressing,
+			Status:  coreV1.ConditionFalse,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: "deadline exceeded",
+		},
+	}
+	state = getDeploymentRolloutState(deployment)
+	assert.True(t, state.degraded)
+	assert.Equal(t, "ProgressDeadlineExceeded", state.degradedReason)
+}
+
+func TestGetStatefulSetAndDaemonSetRolloutState(t *testing.T) {
+	sts := &appsV1.StatefulSet{
+		Status: appsV1.StatefulSetStatus{
+			ReadyReplicas:   1,
+			CurrentRevision: "a",
+			UpdateRevision:  "b",
+		},
+	}
+
+	assert.True(t, getStatefulSetRolloutState(sts).progressing)
+	sts.Status.CurrentRevision = "b"
+	assert.False(t, getStatefulSetRolloutState(sts).progressing)
+
+	ds := &appsV1.DaemonSet{
+		Status: appsV1.DaemonSetStatus{
+			DesiredNumberScheduled: 3,
+			UpdatedNumberScheduled: 3,
+			NumberAvailable:        2,
+			NumberReady:            2,
+		},
+	}
+
+	state := getDaemonSetRolloutState(ds)
+	assert.True(t, state.progressing)
+	assert.Equal(t, int32(3), state.desired)
+	assert.Equal(t, int32(2), state.ready)
+
+	ds.Status.NumberAvailable = 3
+	assert.False(t, getDaemonSetRolloutState(ds).progressing)
+}
+
+func TestSetComponentCondition(t *testing.T) {
+	status := &v1alpha1.ComponentStatus{}
+
+	setComponentCondition(status, v1alpha1.ComponentConditionReady, coreV1.ConditionFalse, "RollingOut", "")
+	assert.Len(t, status.Conditions, 1)
+
+	transitionTime := metaV1.NewTime(metaV1.Now().Add(-60e9))
+	status.Conditions[0].LastTransitionTime = transitionTime
+
+	// same status keeps the transition time
+	setComponentCondition(status, v1alpha1.ComponentConditionReady, coreV1.ConditionFalse, "RollingOut", "1 of 2 replicas are ready.")
+	assert.Len(t, status.Conditions, 1)
+	assert.Equal(t, transitionTime, status.Conditions[0].LastTransitionTime)
+	assert.Equal(t, "1 of 2 replicas are ready.", status.Conditions[0].Message)
+
+	setComponentCondition(status, v1alpha1.ComponentConditionReady, coreV1.ConditionTrue, "RolloutComplete", "")
+	assert.NotEqual(t, transitionTime, status.Conditions[0].LastTransitionTime)
+
+	setComponentCondition(status, v1alpha1.ComponentConditionDegraded, coreV1.ConditionFalse, "", "")
+	assert.Len(t, status.Conditions, 2)
+}
+
+func TestParseDigestFromImageID(t *testing.T) {
+	assert.Equal(t, "sha256:abc", parseDigestFromImageID("docker-pullable://nginx@sha256:abc"))
+	assert.Equal(t, "sha256:abc", parseDigestFromImageID("docker.io/library/nginx@sha256:abc"))
+	assert.Equal(t, "", parseDigestFromImageID("sha256:abc"))
+	assert.Equal(t, "", parseDigestFromImageID(""))
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setStatusCondition sets the condition of the type in conditions, a pointer to the conditions of a status,
+// e.g. &status.Conditions of a ComponentStatus. Like meta.SetStatusCondition, the transition time is kept
+// if the status of the condition doesn't change.
+// Conditions are structs with Type, Status, LastTransitionTime, Reason and Message fields.
+func setStatusCondition(conditions interface{}, conditionType string, status v1.ConditionStatus, reason, message string) {
+	list := reflect.ValueOf(conditions).Elem()
+
+	newCondition := reflect.New(list.Type().Elem()).Elem()
+	newCondition.FieldByName("Type").SetString(conditionType)
+	newCondition.FieldByName("Status").SetString(string(status))
+	newCondition.FieldByName("LastTransitionTime").Set(reflect.ValueOf(metav1.Now()))
+	newCondition.FieldByName("Reason").SetString(reason)
+	newCondition.FieldByName("Message").SetString(message)
+
+	for i := 0; i < list.Len(); i++ {
+		cond := list.Index(i)
+
+		if cond.FieldByName("Type").String() != conditionType {
+			continue
+		}
+
+		if cond.FieldByName("Status").String() == string(status) {
+			newCondition.FieldByName("LastTransitionTime").Set(cond.FieldByName("LastTransitionTime"))
+		}
+
+		cond.Set(newCondition)
+		return
+	}
+
+	list.Set(reflect.Append(list, newCondition))
+}
+
+// removeStatusCondition removes the condition of the type from conditions, a pointer to the conditions of a status.
+func removeStatusCondition(conditions interface{}, conditionType string) {
+	list := reflect.ValueOf(conditions).Elem()
+
+	for i := 0; i < list.Len(); i++ {
+		if list.Index(i).FieldByName("Type").String() == conditionType {
+			list.Set(reflect.AppendSlice(list.Slice(0, i), list.Slice(i+1, list.Len())))
+			return
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetStatusCondition(t *testing.T) {
+	past := metaV1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+
+	status := &v1alpha1.ComponentStatus{
+		Conditions: []v1alpha1.ComponentCondition{
+			{Type: "Ready", Status: coreV1.ConditionTrue, LastTransitionTime: past},
+			{Type: "Degraded", Status: coreV1.ConditionFalse, LastTransitionTime: past},
+		},
+	}
+
+	// the transition time is kept if the status doesn't change
+	setComponentCondition(status, "Ready", coreV1.ConditionTrue, "Ready", "still ready")
+	assert.Equal(t, past, status.Conditions[0].LastTransitionTime)
+	assert.Equal(t, "still ready", status.Conditions[0].Message)
+
+	setComponentCondition(status, "Degraded", coreV1.ConditionTrue, "ReconcileError", "error")
+	assert.True(t, status.Conditions[1].LastTransitionTime.After(past.Time))
+	assert.Equal(t, v1alpha1.ComponentConditionType("Degraded"), status.Conditions[1].Type)
+	assert.Equal(t, "ReconcileError", status.Conditions[1].Reason)
+
+	removeComponentCondition(status, "Ready")
+	assert.Len(t, status.Conditions, 1)
+	assert.Equal(t, v1alpha1.ComponentConditionType("Degraded"), status.Conditions[0].Type)
+
+	logSystemStatus := &v1alpha1.LogSystemStatus{}
+	setLogSystemCondition(logSystemStatus, v1alpha1.LogSystemConditionReady, coreV1.ConditionFalse, "ComponentsNotReady", "loki not ready.")
+	setLogSystemCondition(logSystemStatus, v1alpha1.LogSystemConditionLokiReady, coreV1.ConditionFalse, "ComponentNotFound", "")
+	assert.Len(t, logSystemStatus.Conditions, 2)
+	assert.Equal(t, "loki not ready.", logSystemStatus.Conditions[0].Message)
+
+	removeLogSystemCondition(logSystemStatus, v1alpha1.LogSystemConditionLokiReady)
+	removeLogSystemCondition(logSystemStatus, v1alpha1.LogSystemConditionLokiReady)
+	assert.Len(t, logSystemStatus.Conditions, 1)
+
+	endpointStatus := &v1alpha1.ProtectedEndpointStatus{}
+	setProtectedEndpointCondition(endpointStatus, v1alpha1.ProtectedEndpointConditionReady, coreV1.ConditionTrue, "Protected", "")
+	assert.Len(t, endpointStatus.Conditions, 1)
+	assert.Equal(t, coreV1.ConditionTrue, endpointStatus.Conditions[0].Status)
+	assert.False(t, endpointStatus.Conditions[0].LastTransitionTime.IsZero())
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/heroku/docker-registry-client/registry"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const registryCatalogPageSize = 100
+
+// same as the one in the registry client, the angle brackets and quotes are missing in some registries
+var registryNextLinkRE = regexp.MustCompile(`^ *<?([^;>]+)>? *(?:;[^;]*)*; *rel="?next"?(?:;.*)?`)
+
+// registryCatalogClient is the registry client with fixes for discovering repositories:
+//   - next links of pages are relative paths in the distribution registry, which are resolved against the registry url
+//   - digests are the ones of v2 manifests, the same as in the image ids of pods
+type registryCatalogClient struct {
+	*registry.Registry
+}
+
+func newRegistryCatalogClient(hub *registry.Registry) *registryCatalogClient {
+	hub.Logf = registry.Quiet
+
+	return &registryCatalogClient{hub}
+}
+
+type registryPage struct {
+	Repositories []string `json:"repositories"`
+	Tags         []string `json:"tags"`
+}
+
+// getPages follows the next links from the path, and returns all names in the pages.
+func (c *registryCatalogClient) getPages(path string) ([]string, error) {
+	base, err := url.Parse(c.URL + "/")
+
+	if err != nil {
+		return nil, err
+	}
+
+	next := fmt.Sprintf("%s%s?n=%d", c.URL, path, registryCatalogPageSize)
+	visited := make(map[string]bool)
+
+	var res []string
+
+	for next != "" && !visited[next] {
+		visited[next] = true
+
+		var page registryPage
+
+		link, err := c.getPage(next, &page)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, page.Repositories...)
+		res = append(res, page.Tags...)
+
+		next = ""
+
+		if link != "" {
+			ref, err := url.Parse(link)
+
+			if err != nil {
+				return nil, err
+			}
+
+			next = base.ResolveReference(ref).String()
+		}
+	}
+
+	return res, nil
+}
+
+// checkRegistryResponse returns an error for responses other than 2xx, which are not caught by the transport of
+// every registry client. Without it, an error page would be read as an empty list of repositories or tags.
+func checkRegistryResponse(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status)
+	}
+
+	return nil
+}
+
+func (c *registryCatalogClient) getPage(pageURL string, page *registryPage) (string, error) {
+	resp, err := c.Client.Get(pageURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if err := checkRegistryResponse(resp); err != nil {
+		return "", err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(page); err != nil {
+		return "", err
+	}
+
+	for _, link := range resp.Header[http.CanonicalHeaderKey("Link")] {
+		if parts := registryNextLinkRE.FindStringSubmatch(link); parts != nil {
+			return parts[1], nil
+		}
+	}
+
+	return "", nil
+}
+
+// Repositories walks the pages of the catalog.
+func (c *registryCatalogClient) Repositories() ([]string, error) {
+	return c.getPages("/v2/_catalog")
+}
+
+func (c *registryCatalogClient) Tags(repository string) ([]string, error) {
+	return c.getPages(fmt.Sprintf("/v2/%s/tags/list", repository))
+}
+
+func (c *registryCatalogClient) ManifestDigest(repository, reference string) (digest.Digest, error) {
+	req, err := http.NewRequest(http.MethodHead, fmt.Sprintf("%s/v2/%s/manifests/%s", c.URL, repository, reference), nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	// without it, schema1 manifests are converted from v2 ones, and have different digests
+	req.Header.Set("Accept", strings.Join([]string{schema2.MediaTypeManifest, manifestlist.MediaTypeManifestList}, ", "))
+
+	resp, err := c.Client.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if err := checkRegistryResponse(resp); err != nil {
+		return "", err
+	}
+
+	return digest.Parse(resp.Header.Get("Docker-Content-Digest"))
+}
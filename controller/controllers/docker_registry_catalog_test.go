@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/heroku/docker-registry-client/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRegistryStubServer serves pages of repositories and tags as the distribution registry, with relative next links.
+func newRegistryStubServer(repositories []string, tags []string) *httptest.Server {
+	servePage := func(w http.ResponseWriter, r *http.Request, key string, names []string) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		start := 0
+
+		if last := r.URL.Query().Get("last"); last != "" {
+			for i, name := range names {
+				if name == last {
+					start = i + 1
+				}
+			}
+		}
+
+		end := start + n
+
+		if n == 0 || end > len(names) {
+			end = len(names)
+		}
+
+		if end < len(names) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?last=%s&n=%d>; rel="next"`, r.URL.Path, names[end-1], n))
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string][]string{key: names[start:end]})
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+		case r.URL.Path == "/v2/_catalog":
+			servePage(w, r, "repositories", repositories)
+		case strings.HasSuffix(r.URL.Path, "/tags/list"):
+			servePage(w, r, "tags", tags)
+		case strings.Contains(r.URL.Path, "/manifests/"):
+			if r.Header.Get("Accept") == "" || !strings.Contains(r.Header.Get("Accept"), schema2.MediaTypeManifest) {
+				w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Repeat("1", 64))
+			} else {
+				w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Repeat("2", 64))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRegistryCatalogClient(t *testing.T) {
+	var repositories, tags []string
+
+	for i := 0; i < 250; i++ {
+		repositories = append(repositories, fmt.Sprintf("kalmhq/repo-%03d", i))
+	}
+
+	for i := 0; i < 120; i++ {
+		tags = append(tags, fmt.Sprintf("v%d", i))
+	}
+
+	server := newRegistryStubServer(repositories, tags)
+	defer server.Close()
+
+	hub, err := registry.New(server.URL, "", "")
+	assert.Nil(t, err)
+
+	client := newRegistryCatalogClient(hub)
+
+	res, err := client.getPages("/v2/_catalog")
+	assert.Nil(t, err)
+	assert.Equal(t, repositories, res)
+
+	res, err = client.Tags("kalmhq/repo-000")
+	assert.Nil(t, err)
+	assert.Equal(t, tags, res)
+
+	// digest of the v2 manifest
+	d, err := client.ManifestDigest("kalmhq/repo-000", "v1")
+	assert.Nil(t, err)
+	assert.Equal(t, "sha256:"+strings.Repeat("2", 64), d.String())
+
+	_, err = client.getPages("/v2/missing")
+	assert.NotNil(t, err)
+}
+
+func TestRegistryCatalogClientErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"tags":[]}`))
+	}))
+	defer server.Close()
+
+	// without the error transport of the registry client, the status is checked by the catalog client
+	client := newRegistryCatalogClient(&registry.Registry{URL: server.URL, Client: http.DefaultClient})
+
+	_, err := client.Tags("kalmhq/echo")
+	assert.NotNil(t, err)
+
+	_, err = client.ManifestDigest("kalmhq/echo", "v1")
+	assert.NotNil(t, err)
+}
@@ -16,10 +16,7 @@ limitations under the License.
 package controllers
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"github.com/heroku/docker-registry-client/registry"
 	v1 "k8s.io/api/core/v1"
@@ -34,6 +31,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 	"strings"
+	"time"
 
 	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
 )
@@ -48,6 +46,12 @@ type DockerRegistryReconcileTask struct {
 	ctx      context.Context
 	registry *corev1alpha1.DockerRegistry
 	secret   *v1.Secret
+
+	// set when the authentication succeeds
+	hub *registry.Registry
+
+	// set when credentials are read from the secret or issued by the credential helper
+	credentials *RegistryCredentials
 }
 
 func (r *DockerRegistryReconcileTask) WarningEvent(err error, msg string, args ...interface{}) {
@@ -60,6 +64,11 @@ func (r *DockerRegistryReconcileTask) NormalEvent(reason, msg string, args ...in
 
 func (r *DockerRegistryReconcileTask) Run(req ctrl.Request) error {
 	if err := r.SetupAttributes(req); err != nil {
+		if errors.IsNotFound(err) {
+			// the registry is deleted
+			cachedRegistryCredentials.delete(req.Name)
+		}
+
 		return client.IgnoreNotFound(err)
 	}
 
@@ -82,25 +91,23 @@ func (r *DockerRegistryReconcileTask) Run(req ctrl.Request) error {
 		return err
 	}
 
+	if r.hub != nil {
+		if err := r.SyncRepositories(newRegistryCatalogClient(r.hub)); err != nil {
+			r.WarningEvent(err, "SyncRepositories error.")
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (r *DockerRegistryReconcileTask) UpdateStatus() (err error) {
-	var username, password string
+	r.credentials, err = getRegistryCredentials(r.ctx, r.registry, r.secret)
 
-	if r.secret != nil {
-		username = string(r.secret.Data["username"])
-		password = string(r.secret.Data["password"])
+	if err == nil {
+		r.hub, err = newRegistryClient(getRegistryHost(r.registry), r.credentials)
 	}
 
-	host := r.registry.Spec.Host
-
-	if host == "" {
-		host = "https://registry-1.docker.io"
-	}
-
-	_, err = registry.New(host, username, password)
-
 	if err != nil {
 		registryCopy := r.registry.DeepCopy()
 		registryCopy.Status.AuthenticationVerified = false
@@ -126,6 +133,12 @@ func (r *DockerRegistryReconcileTask) UpdateStatus() (err error) {
 	} else {
 		registryCopy := r.registry.DeepCopy()
 		registryCopy.Status.AuthenticationVerified = true
+		registryCopy.Status.CredentialsExpireAt = nil
+
+		if !r.credentials.ExpiresAt.IsZero() {
+			expireAt := metaV1.NewTime(r.credentials.ExpiresAt)
+			registryCopy.Status.CredentialsExpireAt = &expireAt
+		}
 
 		if err := r.Status().Patch(r.ctx, registryCopy, client.MergeFrom(r.registry)); err != nil {
 			r.WarningEvent(err, "Patch docker registry status error.")
@@ -133,12 +146,18 @@ func (r *DockerRegistryReconcileTask) UpdateStatus() (err error) {
 		}
 	}
 
-	r.Recorder.Eventf(r.registry, v1.EventTypeNormal, "AuthSucceed", "Authenticate docker registry successfully.")
+	// reconciled in every polling interval, the event is only for changes
+	if !r.registry.Status.AuthenticationVerified {
+		r.Recorder.Eventf(r.registry, v1.EventTypeNormal, "AuthSucceed", "Authenticate docker registry successfully.")
+	}
+
 	return nil
 }
 
+// DistributeSecrets creates or updates the image pull secrets in kalm enabled namespaces.
+// Short-lived credentials are refreshed in them each time the credential helper issues new ones.
 func (r *DockerRegistryReconcileTask) DistributeSecrets() (err error) {
-	if r.secret == nil {
+	if r.secret == nil || r.credentials == nil {
 		return nil
 	}
 
@@ -184,37 +203,7 @@ func (r *DockerRegistryReconcileTask) DistributeSecrets() (err error) {
 		secret.Labels["kalm-docker-registry"] = r.registry.Name
 		secret.Labels["kalm-docker-registry-image-pull-secret"] = "true"
 
-		auth := r.secret.Data["username"]
-		auth = append(auth, []byte(":")...)
-		auth = append(auth, r.secret.Data["password"]...)
-
-		var host = r.registry.Spec.Host
-
-		if host == "" {
-			host = "https://index.docker.io/v1/"
-		}
-
-		data := map[string]map[string]struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
-			Auth     string `json:"auth"`
-		}{
-			"auths": {
-				host: {
-					Username: string(r.secret.Data["username"]),
-					Password: string(r.secret.Data["password"]),
-					Auth:     base64.StdEncoding.EncodeToString(auth),
-				},
-			},
-		}
-
-		// Do not escape "<" or ">" or "&" char in data
-		var bts bytes.Buffer
-		encoder := json.NewEncoder(&bts)
-		encoder.SetEscapeHTML(false)
-		_ = encoder.Encode(data)
-
-		secret.Data[".dockerconfigjson"] = bts.Bytes()
+		secret.Data[v1.DockerConfigJsonKey] = r.credentials.getDockerConfigJSON(r.registry.Spec.Host)
 
 		if err := ctrl.SetControllerReference(r.registry, &secret, r.Scheme); err != nil {
 			r.WarningEvent(err, "unable to set owner for secret")
@@ -227,7 +216,7 @@ func (r *DockerRegistryReconcileTask) DistributeSecrets() (err error) {
 				return err
 			}
 
-			return nil
+			continue
 		}
 
 		if err := r.Client.Update(r.ctx, &secret); err != nil {
@@ -303,6 +292,7 @@ func (r *DockerRegistryReconcileTask) SetupAttributes(req ctrl.Request) (err err
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=dockerregistries,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=dockerregistries/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=applications,verbs=get;list
+// +kubebuilder:rbac:groups=core.kalm.dev,resources=components,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
@@ -312,7 +302,16 @@ func (r *DockerRegistryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, err
 		ctx:                      context.Background(),
 	}
 
-	return ctrl.Result{}, task.Run(req)
+	if err := task.Run(req); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if task.registry == nil {
+		return ctrl.Result{}, nil
+	}
+
+	// tags are polled again in the interval, and short-lived credentials are refreshed before they expire
+	return ctrl.Result{RequeueAfter: getRegistryRequeueAfter(task.registry, task.credentials, time.Now())}, nil
 }
 
 type TouchAllRegistriesMapper struct {
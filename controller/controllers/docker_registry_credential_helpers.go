@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	ECRSecretAccessKeyID     = "awsAccessKeyId"
+	ECRSecretSecretAccessKey = "awsSecretAccessKey"
+	ECRSecretSessionToken    = "awsSessionToken"
+
+	GCRSecretServiceAccountKey = "serviceAccountKey"
+
+	ACRSecretTenantID     = "tenantId"
+	ACRSecretClientID     = "clientId"
+	ACRSecretClientSecret = "clientSecret"
+
+	// username of ACR refresh tokens
+	acrTokenUsername = "00000000-0000-0000-0000-000000000000"
+	// username of google access tokens
+	gcrTokenUsername = "oauth2accesstoken"
+)
+
+// Requests to the cloud providers block the reconciliation of the registry, they are not expected to take this long.
+const registryCredentialsRequestTimeout = 30 * time.Second
+
+var registryCredentialsHTTPClient = &http.Client{Timeout: registryCredentialsRequestTimeout}
+
+var ecrHostRegex = regexp.MustCompile(`^(\d+)\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+func getRegistrySecretValue(secret *v1.Secret, key string) (string, error) {
+	if secret == nil || len(secret.Data[key]) == 0 {
+		return "", fmt.Errorf("%s is missing in the registry secret", key)
+	}
+
+	return string(secret.Data[key]), nil
+}
+
+func doRegistryCredentialsRequest(client *http.Client, req *http.Request, res interface{}) error {
+	if client == nil {
+		client = registryCredentialsHTTPClient
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s %s: status %d, %s", req.Method, req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, res)
+}
+
+// ECRCredentialHelper gets authorization tokens of Amazon ECR with an access key, which are valid for 12 hours.
+type ECRCredentialHelper struct {
+	Client *http.Client
+
+	// replaces the regional api endpoint, for tests
+	Endpoint string
+}
+
+func (h *ECRCredentialHelper) GetCredentials(ctx context.Context, host string, secret *v1.Secret) (*RegistryCredentials, error) {
+	u, err := url.Parse(getRegistryURL(host))
+
+	if err != nil {
+		return nil, err
+	}
+
+	matches := ecrHostRegex.FindStringSubmatch(u.Hostname())
+
+	if matches == nil {
+		return nil, fmt.Errorf("%s is not an ECR registry", host)
+	}
+
+	accountID, region := matches[1], matches[2]
+
+	accessKeyID, err := getRegistrySecretValue(secret, ECRSecretAccessKeyID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	secretAccessKey, err := getRegistrySecretValue(secret, ECRSecretSecretAccessKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := h.Endpoint
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://api.ecr.%s.amazonaws.com%s/", region, matches[3])
+	}
+
+	body, _ := json.Marshal(map[string][]string{"registryIds": {accountID}})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+
+	if token := secret.Data[ECRSecretSessionToken]; len(token) > 0 {
+		req.Header.Set("X-Amz-Security-Token", string(token))
+	}
+
+	signAWSRequest(req, body, accessKeyID, secretAccessKey, region, "ecr", time.Now())
+
+	var res struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+
+	if err := doRegistryCredentialsRequest(h.Client, req, &res); err != nil {
+		return nil, err
+	}
+
+	if len(res.AuthorizationData) == 0 {
+		return nil, fmt.Errorf("no authorization data of ECR registry %s", accountID)
+	}
+
+	auth, err := base64.StdEncoding.DecodeString(res.AuthorizationData[0].AuthorizationToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(string(auth), ":", 2)
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid authorization token of ECR registry %s", accountID)
+	}
+
+	return &RegistryCredentials{
+		Username:  parts[0],
+		Password:  parts[1],
+		ExpiresAt: time.Unix(int64(res.AuthorizationData[0].ExpiresAt), 0),
+	}, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signAWSRequest adds the signature version 4 authorization of all headers in the request.
+func signAWSRequest(req *http.Request, body []byte, accessKeyID, secretAccessKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	var names []string
+
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+	bodyHash := sha256.Sum256(body)
+
+	path := req.URL.EscapedPath()
+
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+}
+
+// GCRCredentialHelper gets google access tokens with a service account key, which are valid for an hour.
+// They work for both Container Registry and Artifact Registry.
+type GCRCredentialHelper struct{}
+
+func (h *GCRCredentialHelper) GetCredentials(ctx context.Context, host string, secret *v1.Secret) (*RegistryCredentials, error) {
+	key, err := getRegistrySecretValue(secret, GCRSecretServiceAccountKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := google.JWTConfigFromJSON([]byte(key), "https://www.googleapis.com/auth/cloud-platform")
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", GCRSecretServiceAccountKey, err)
+	}
+
+	token, err := config.TokenSource(context.WithValue(ctx, oauth2.HTTPClient, registryCredentialsHTTPClient)).Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RegistryCredentials{
+		Username:  gcrTokenUsername,
+		Password:  token.AccessToken,
+		ExpiresAt: token.Expiry,
+	}, nil
+}
+
+// ACRCredentialHelper exchanges an Azure AD token of a service principal for an ACR refresh token.
+type ACRCredentialHelper struct {
+	Client *http.Client
+
+	// replaces https://login.microsoftonline.com, for tests
+	LoginEndpoint string
+}
+
+func (h *ACRCredentialHelper) GetCredentials(ctx context.Context, host string, secret *v1.Secret) (*RegistryCredentials, error) {
+	values := make(map[string]string)
+
+	for _, key := range []string{ACRSecretTenantID, ACRSecretClientID, ACRSecretClientSecret} {
+		value, err := getRegistrySecretValue(secret, key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[key] = value
+	}
+
+	loginEndpoint := h.LoginEndpoint
+
+	if loginEndpoint == "" {
+		loginEndpoint = "https://login.microsoftonline.com"
+	}
+
+	var aadToken struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresOn   json.Number `json:"expires_on"`
+	}
+
+	err := h.postForm(ctx, fmt.Sprintf("%s/%s/oauth2/token", loginEndpoint, values[ACRSecretTenantID]), url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {values[ACRSecretClientID]},
+		"client_secret": {values[ACRSecretClientSecret]},
+		"resource":      {"https://management.azure.com/"},
+	}, &aadToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	registryURL, err := url.Parse(getRegistryURL(host))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var refreshToken struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err = h.postForm(ctx, registryURL.String()+"/oauth2/exchange", url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {registryURL.Host},
+		"tenant":       {values[ACRSecretTenantID]},
+		"access_token": {aadToken.AccessToken},
+	}, &refreshToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the refresh token lives longer than the AAD token, which is a safe estimation
+	expiresAt := time.Now().Add(time.Hour)
+
+	if expiresOn, err := aadToken.ExpiresOn.Int64(); err == nil && expiresOn > 0 {
+		expiresAt = time.Unix(expiresOn, 0)
+	}
+
+	return &RegistryCredentials{
+		Username:  acrTokenUsername,
+		Password:  refreshToken.RefreshToken,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (h *ACRCredentialHelper) postForm(ctx context.Context, endpoint string, form url.Values, res interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return doRegistryCredentialsRequest(h.Client, req, res)
+}
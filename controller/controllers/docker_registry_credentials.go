@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroku/docker-registry-client/registry"
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	RegistrySecretUsername         = "username"
+	RegistrySecretPassword         = "password"
+	RegistrySecretToken            = "token"
+	RegistrySecretDockerConfigJSON = v1.DockerConfigJsonKey
+
+	// short-lived credentials are refreshed this long before they expire
+	registryCredentialsRefreshMargin = 10 * time.Minute
+	minRegistryCredentialsRefresh    = 10 * time.Second
+
+	dockerHubRegistryHost   = "https://registry-1.docker.io"
+	dockerHubDockerAuthHost = "https://index.docker.io/v1/"
+)
+
+// RegistryCredentials authenticate to a registry, both for the registry api and for pulling images.
+type RegistryCredentials struct {
+	Username string
+	Password string
+
+	// bearer token for the registry api. Image pull secrets use it as the password,
+	// which is accepted by registries issuing access tokens, such as GitHub, GitLab and Harbor.
+	Token string
+
+	// the .dockerconfigjson in the secret, which is distributed as it is
+	DockerConfigJSON []byte
+
+	// zero for long-lived credentials
+	ExpiresAt time.Time
+}
+
+// RegistryCredentialHelper exchanges the authentication secret of a registry for short-lived credentials.
+type RegistryCredentialHelper interface {
+	GetCredentials(ctx context.Context, host string, secret *v1.Secret) (*RegistryCredentials, error)
+}
+
+var registryCredentialHelpers = map[corev1alpha1.DockerRegistryCredentialHelper]RegistryCredentialHelper{
+	corev1alpha1.DockerRegistryCredentialHelperECR: &ECRCredentialHelper{},
+	corev1alpha1.DockerRegistryCredentialHelperGCR: &GCRCredentialHelper{},
+	corev1alpha1.DockerRegistryCredentialHelperACR: &ACRCredentialHelper{},
+}
+
+// RegisterRegistryCredentialHelper adds or replaces the helper for the name in spec.credentialHelper.
+func RegisterRegistryCredentialHelper(name corev1alpha1.DockerRegistryCredentialHelper, helper RegistryCredentialHelper) {
+	registryCredentialHelpers[name] = helper
+}
+
+// getRegistryCredentials returns credentials in the secret, or the ones issued by the credential helper.
+func getRegistryCredentials(ctx context.Context, registry *corev1alpha1.DockerRegistry, secret *v1.Secret) (*RegistryCredentials, error) {
+	if registry.Spec.CredentialHelper == "" {
+		return getStaticRegistryCredentials(registry, secret)
+	}
+
+	helper, exist := registryCredentialHelpers[registry.Spec.CredentialHelper]
+
+	if !exist {
+		return nil, fmt.Errorf("unknown credential helper %s", registry.Spec.CredentialHelper)
+	}
+
+	if secret == nil {
+		return nil, fmt.Errorf("credential helper %s requires the registry secret", registry.Spec.CredentialHelper)
+	}
+
+	version := getRegistryCredentialsVersion(registry, secret)
+
+	if credentials := cachedRegistryCredentials.get(registry.Name, version); credentials != nil {
+		return credentials, nil
+	}
+
+	credentials, err := helper.GetCredentials(ctx, registry.Spec.Host, secret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cachedRegistryCredentials.set(registry.Name, version, credentials)
+
+	return credentials, nil
+}
+
+// registryCredentialsCache keeps credentials of helpers until they are about to expire,
+// so cloud apis are not called in every reconcile.
+// Entries are keyed by the registry name and removed when the registry is deleted.
+type registryCredentialsCache struct {
+	mut     sync.Mutex
+	entries map[string]registryCredentialsCacheEntry
+}
+
+type registryCredentialsCacheEntry struct {
+	// credentials of other versions of the registry or its secret are stale
+	version     string
+	credentials *RegistryCredentials
+}
+
+// shared by controllers which talk to registries
+var cachedRegistryCredentials registryCredentialsCache
+
+func getRegistryCredentialsVersion(registry *corev1alpha1.DockerRegistry, secret *v1.Secret) string {
+	return fmt.Sprintf("%s/%s/%s", registry.Spec.Host, registry.Spec.CredentialHelper, secret.ResourceVersion)
+}
+
+func (c *registryCredentialsCache) get(name, version string) *RegistryCredentials {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	entry, exist := c.entries[name]
+
+	if !exist || entry.version != version || needsRegistryCredentialsRefresh(entry.credentials, time.Now()) {
+		return nil
+	}
+
+	return entry.credentials
+}
+
+func (c *registryCredentialsCache) set(name, version string, credentials *RegistryCredentials) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]registryCredentialsCacheEntry)
+	}
+
+	c.entries[name] = registryCredentialsCacheEntry{version: version, credentials: credentials}
+}
+
+func (c *registryCredentialsCache) delete(name string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	delete(c.entries, name)
+}
+
+func needsRegistryCredentialsRefresh(credentials *RegistryCredentials, now time.Time) bool {
+	return !credentials.ExpiresAt.IsZero() && now.Add(registryCredentialsRefreshMargin).After(credentials.ExpiresAt)
+}
+
+func getRegistryHost(registry *corev1alpha1.DockerRegistry) string {
+	if registry.Spec.Host == "" {
+		return dockerHubRegistryHost
+	}
+
+	return registry.Spec.Host
+}
+
+// getRegistryURL adds the https scheme to hosts without one.
+func getRegistryURL(host string) string {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+
+	return strings.TrimSuffix(host, "/")
+}
+
+// getStaticRegistryCredentials reads the credentials stored in the secret.
+func getStaticRegistryCredentials(registry *corev1alpha1.DockerRegistry, secret *v1.Secret) (*RegistryCredentials, error) {
+	if secret == nil {
+		return &RegistryCredentials{}, nil
+	}
+
+	if config := secret.Data[RegistrySecretDockerConfigJSON]; len(config) > 0 {
+		return parseDockerConfigJSON(config, getRegistryDomain(registry.Spec.Host))
+	}
+
+	if token := secret.Data[RegistrySecretToken]; len(token) > 0 {
+		return &RegistryCredentials{
+			Username: string(secret.Data[RegistrySecretUsername]),
+			Token:    string(token),
+		}, nil
+	}
+
+	return &RegistryCredentials{
+		Username: string(secret.Data[RegistrySecretUsername]),
+		Password: string(secret.Data[RegistrySecretPassword]),
+	}, nil
+}
+
+type dockerConfigEntry struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+// parseDockerConfigJSON finds the credentials of the registry domain in the docker config.
+func parseDockerConfigJSON(config []byte, domain string) (*RegistryCredentials, error) {
+	var dockerConfig struct {
+		Auths map[string]dockerConfigEntry `json:"auths"`
+	}
+
+	if err := json.Unmarshal(config, &dockerConfig); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", RegistrySecretDockerConfigJSON, err)
+	}
+
+	for host, entry := range dockerConfig.Auths {
+		if getRegistryDomain(host) != domain {
+			continue
+		}
+
+		credentials := &RegistryCredentials{
+			Username:         entry.Username,
+			Password:         entry.Password,
+			Token:            entry.RegistryToken,
+			DockerConfigJSON: config,
+		}
+
+		if entry.Auth != "" {
+			auth, err := base64.StdEncoding.DecodeString(entry.Auth)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth of %s in %s: %s", host, RegistrySecretDockerConfigJSON, err)
+			}
+
+			parts := strings.SplitN(string(auth), ":", 2)
+
+			if len(parts) == 2 {
+				credentials.Username, credentials.Password = parts[0], parts[1]
+			}
+		}
+
+		return credentials, nil
+	}
+
+	return nil, fmt.Errorf("%s has no credentials of %s", RegistrySecretDockerConfigJSON, domain)
+}
+
+// getDockerConfigJSON returns the content of the image pull secrets of the registry.
+func (c *RegistryCredentials) getDockerConfigJSON(host string) []byte {
+	if len(c.DockerConfigJSON) > 0 {
+		return c.DockerConfigJSON
+	}
+
+	if host == "" {
+		host = dockerHubDockerAuthHost
+	}
+
+	username, password := c.Username, c.Password
+
+	if c.Token != "" {
+		password = c.Token
+
+		if username == "" {
+			username = "token"
+		}
+	}
+
+	data := map[string]map[string]dockerConfigEntry{
+		"auths": {
+			host: {
+				Username: username,
+				Password: password,
+				Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+			},
+		},
+	}
+
+	// Do not escape "<" or ">" or "&" char in data
+	var bts bytes.Buffer
+	encoder := json.NewEncoder(&bts)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(data)
+
+	return bts.Bytes()
+}
+
+type bearerTokenTransport struct {
+	Transport http.RoundTripper
+	Token     string
+}
+
+func (t *bearerTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.Token)
+
+	return t.Transport.RoundTrip(req)
+}
+
+// newRegistryClient creates a client of the registry api, and checks the credentials with it.
+func newRegistryClient(host string, credentials *RegistryCredentials) (*registry.Registry, error) {
+	if credentials.Token == "" {
+		return registry.New(host, credentials.Username, credentials.Password)
+	}
+
+	hub := &registry.Registry{
+		URL: strings.TrimSuffix(host, "/"),
+		Client: &http.Client{
+			Transport: &registry.ErrorTransport{
+				Transport: &bearerTokenTransport{Transport: http.DefaultTransport, Token: credentials.Token},
+			},
+		},
+		Logf: registry.Quiet,
+	}
+
+	if err := hub.Ping(); err != nil {
+		return nil, err
+	}
+
+	return hub, nil
+}
+
+// getRegistryRequeueAfter returns when the registry is reconciled again, to poll tags and to refresh credentials.
+func getRegistryRequeueAfter(registry *corev1alpha1.DockerRegistry, credentials *RegistryCredentials, now time.Time) time.Duration {
+	interval := getRegistryPollingInterval(registry)
+
+	if credentials == nil || credentials.ExpiresAt.IsZero() {
+		return interval
+	}
+
+	refresh := credentials.ExpiresAt.Add(-registryCredentialsRefreshMargin).Sub(now)
+
+	if refresh < minRegistryCredentialsRefresh {
+		refresh = minRegistryCredentialsRefresh
+	}
+
+	if refresh < interval {
+		return refresh
+	}
+
+	return interval
+}
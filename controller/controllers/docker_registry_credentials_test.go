@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetStaticRegistryCredentials(t *testing.T) {
+	registry := &corev1alpha1.DockerRegistry{Spec: corev1alpha1.DockerRegistrySpec{Host: "https://ghcr.io"}}
+
+	credentials, err := getStaticRegistryCredentials(registry, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &RegistryCredentials{}, credentials)
+
+	credentials, _ = getStaticRegistryCredentials(registry, &v1.Secret{Data: map[string][]byte{
+		RegistrySecretUsername: []byte("kalm"),
+		RegistrySecretPassword: []byte("pass"),
+	}})
+	assert.Equal(t, "kalm", credentials.Username)
+	assert.Equal(t, "pass", credentials.Password)
+
+	credentials, _ = getStaticRegistryCredentials(registry, &v1.Secret{Data: map[string][]byte{
+		RegistrySecretToken: []byte("abc"),
+	}})
+	assert.Equal(t, "abc", credentials.Token)
+
+	var config map[string]map[string]dockerConfigEntry
+	assert.Nil(t, json.Unmarshal(credentials.getDockerConfigJSON(registry.Spec.Host), &config))
+	assert.Equal(t, "token", config["auths"]["https://ghcr.io"].Username)
+	assert.Equal(t, "abc", config["auths"]["https://ghcr.io"].Password)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("token:abc")), config["auths"]["https://ghcr.io"].Auth)
+
+	dockerConfigJSON := []byte(`{"auths":{"quay.io":{"auth":"cXVheTpwYXNz"},"ghcr.io":{"auth":"a2FsbTpzZWNyZXQ="}}}`)
+
+	credentials, err = getStaticRegistryCredentials(registry, &v1.Secret{Data: map[string][]byte{
+		RegistrySecretDockerConfigJSON: dockerConfigJSON,
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, "kalm", credentials.Username)
+	assert.Equal(t, "secret", credentials.Password)
+	assert.Equal(t, dockerConfigJSON, credentials.getDockerConfigJSON(registry.Spec.Host))
+
+	registry.Spec.Host = "https://gcr.io"
+
+	_, err = getStaticRegistryCredentials(registry, &v1.Secret{Data: map[string][]byte{
+		RegistrySecretDockerConfigJSON: dockerConfigJSON,
+	}})
+	assert.NotNil(t, err)
+}
+
+func TestGetRegistryRequeueAfter(t *testing.T) {
+	now := time.Now()
+	registry := &corev1alpha1.DockerRegistry{}
+
+	assert.Equal(t, 300*time.Second, getRegistryRequeueAfter(registry, nil, now))
+	assert.Equal(t, 300*time.Second, getRegistryRequeueAfter(registry, &RegistryCredentials{ExpiresAt: now.Add(12 * time.Hour)}, now))
+	assert.Equal(t, 2*time.Minute, getRegistryRequeueAfter(registry, &RegistryCredentials{ExpiresAt: now.Add(12 * time.Minute)}, now))
+	assert.Equal(t, minRegistryCredentialsRefresh, getRegistryRequeueAfter(registry, &RegistryCredentials{ExpiresAt: now}, now))
+
+	assert.True(t, needsRegistryCredentialsRefresh(&RegistryCredentials{ExpiresAt: now.Add(5 * time.Minute)}, now))
+	assert.False(t, needsRegistryCredentialsRefresh(&RegistryCredentials{ExpiresAt: now.Add(time.Hour)}, now))
+	assert.False(t, needsRegistryCredentialsRefresh(&RegistryCredentials{}, now))
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// get-vanilla in the signature version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	now, _ := time.Parse("20060102T150405Z", "20150830T123600Z")
+
+	signAWSRequest(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", now)
+
+	assert.Equal(t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"),
+	)
+}
+
+func TestECRCredentialHelper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			r.Header.Get("X-Amz-Target") != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"authorizationData":[{"authorizationToken":"QVdTOnBhc3M=","expiresAt":1.6e9}]}`))
+	}))
+	defer server.Close()
+
+	helper := &ECRCredentialHelper{Endpoint: server.URL}
+	secret := &v1.Secret{Data: map[string][]byte{
+		ECRSecretAccessKeyID:     []byte("AKID"),
+		ECRSecretSecretAccessKey: []byte("secret"),
+	}}
+
+	credentials, err := helper.GetCredentials(context.Background(), "https://123456789012.dkr.ecr.us-west-2.amazonaws.com", secret)
+	assert.Nil(t, err)
+	assert.Equal(t, "AWS", credentials.Username)
+	assert.Equal(t, "pass", credentials.Password)
+	assert.Equal(t, int64(1600000000), credentials.ExpiresAt.Unix())
+
+	_, err = helper.GetCredentials(context.Background(), "https://gcr.io", secret)
+	assert.NotNil(t, err)
+
+	_, err = helper.GetCredentials(context.Background(), "123456789012.dkr.ecr.us-west-2.amazonaws.com", &v1.Secret{})
+	assert.NotNil(t, err)
+}
+
+func TestACRCredentialHelper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+
+		switch r.URL.Path {
+		case "/tenant/oauth2/token":
+			if r.Form.Get("client_secret") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"access_token":"aad","expires_on":"1600000000"}`))
+		case "/oauth2/exchange":
+			if r.Form.Get("access_token") != "aad" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"refresh_token":"refresh"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	helper := &ACRCredentialHelper{LoginEndpoint: server.URL}
+	secret := &v1.Secret{Data: map[string][]byte{
+		ACRSecretTenantID:     []byte("tenant"),
+		ACRSecretClientID:     []byte("client"),
+		ACRSecretClientSecret: []byte("secret"),
+	}}
+
+	credentials, err := helper.GetCredentials(context.Background(), server.URL, secret)
+	assert.Nil(t, err)
+	assert.Equal(t, acrTokenUsername, credentials.Username)
+	assert.Equal(t, "refresh", credentials.Password)
+	assert.Equal(t, int64(1600000000), credentials.ExpiresAt.Unix())
+
+	secret.Data[ACRSecretClientSecret] = []byte("wrong")
+	_, err = helper.GetCredentials(context.Background(), server.URL, secret)
+	assert.NotNil(t, err)
+}
+
+func TestNewRegistryClientWithToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	_, err := newRegistryClient(server.URL, &RegistryCredentials{Token: "abc"})
+	assert.Nil(t, err)
+
+	_, err = newRegistryClient(server.URL, &RegistryCredentials{Token: "wrong"})
+	assert.NotNil(t, err)
+}
+
+func TestRegistryCredentialsCache(t *testing.T) {
+	var cache registryCredentialsCache
+
+	cache.set("a", "1", &RegistryCredentials{Password: "a", ExpiresAt: time.Now().Add(time.Hour)})
+	cache.set("b", "1", &RegistryCredentials{Password: "b", ExpiresAt: time.Now().Add(time.Minute)})
+
+	assert.NotNil(t, cache.get("a", "1"))
+	assert.Nil(t, cache.get("a", "2"))
+	assert.Nil(t, cache.get("b", "1"))
+	assert.Nil(t, cache.get("c", "1"))
+
+	// a new version replaces the entry of the registry
+	cache.set("a", "2", &RegistryCredentials{Password: "a2", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Nil(t, cache.get("a", "1"))
+	assert.Equal(t, "a2", cache.get("a", "2").Password)
+	assert.Len(t, cache.entries, 2)
+
+	cache.delete("a")
+	assert.Nil(t, cache.get("a", "2"))
+	assert.Len(t, cache.entries, 1)
+}
+
+func TestDistributeRegistrySecrets(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme))
+	assert.Nil(t, corev1alpha1.AddToScheme(scheme))
+
+	newNamespace := func(name string, enabled bool) *v1.Namespace {
+		ns := &v1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: name}}
+
+		if enabled {
+			ns.Labels = map[string]string{KalmEnableLabelName: "true"}
+		}
+
+		return ns
+	}
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme,
+		newNamespace("ns1", true),
+		newNamespace("ns2", true),
+		newNamespace("ns3", true),
+		newNamespace("disabled", false),
+	)
+
+	task := &DockerRegistryReconcileTask{
+		DockerRegistryReconciler: &DockerRegistryReconciler{&BaseReconciler{
+			Client:   fakeClient,
+			Reader:   fakeClient,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}},
+		ctx:         context.Background(),
+		registry:    &corev1alpha1.DockerRegistry{ObjectMeta: metaV1.ObjectMeta{Name: "local", UID: "local-uid"}},
+		secret:      &v1.Secret{},
+		credentials: &RegistryCredentials{Username: "kalm", Password: "pass"},
+	}
+
+	assert.Nil(t, task.DistributeSecrets())
+
+	// the secret is created in all enabled namespaces, not only the first one
+	for _, ns := range []string{"ns1", "ns2", "ns3"} {
+		var secret v1.Secret
+		assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Namespace: ns, Name: getImagePullSecretName("local")}, &secret))
+		assert.Equal(t, v1.SecretTypeDockerConfigJson, secret.Type)
+	}
+
+	var secret v1.Secret
+	assert.NotNil(t, fakeClient.Get(task.ctx, types.NamespacedName{Namespace: "disabled", Name: getImagePullSecretName("local")}, &secret))
+}
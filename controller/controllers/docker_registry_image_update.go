@@ -0,0 +1,506 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/kalmhq/kalm/controller/utils/semver"
+	digest "github.com/opencontainers/go-digest"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultRegistryPollingIntervalSeconds = 300
+
+	// Each fetch of a tag takes up to 3 requests to the registry.
+	maxRegistryTagFetchesPerPoll = 20
+
+	// Repositories are in the status of the registry, which is limited by the size of objects in etcd.
+	maxRepositoryTags = 200
+
+	// Repositories in the catalog are listed for the image picker, at most this many.
+	// Repositories of components with an image update policy are always polled.
+	maxCatalogRepositories = 100
+)
+
+// registryTagsClient is the part of the registry client to poll repositories with.
+type registryTagsClient interface {
+	Repositories() ([]string, error)
+	Tags(repository string) ([]string, error)
+	ManifestDigest(repository, reference string) (digest.Digest, error)
+	ManifestV2(repository, reference string) (*schema2.DeserializedManifest, error)
+	DownloadBlob(repository string, digest digest.Digest) (io.ReadCloser, error)
+}
+
+// getRegistryDomain returns the domain of the images in the registry, as in their normalized names.
+func getRegistryDomain(host string) string {
+	if host == "" {
+		return "docker.io"
+	}
+
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	switch host {
+	case "registry-1.docker.io", "index.docker.io":
+		return "docker.io"
+	}
+
+	return host
+}
+
+// controller/foo:v2, v3 -> controller/foo:v3
+// localhost:5000/foo, v1 -> localhost:5000/foo:v1
+func replaceImageTag(image string, tag string) string {
+	if sepIdx := strings.Index(image, "@"); sepIdx != -1 {
+		image = image[:sepIdx]
+	}
+
+	if sepIdx := strings.LastIndex(image, ":"); sepIdx > strings.LastIndex(image, "/") {
+		image = image[:sepIdx]
+	}
+
+	return image + ":" + tag
+}
+
+// registries don't tell when a tag is pushed, it's when the tag is first seen
+func newRepositoryTag(tag string) corev1alpha1.RepositoryTag {
+	return corev1alpha1.RepositoryTag{
+		Name:           tag,
+		TimeUploadedMs: strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10),
+	}
+}
+
+// fetchRepositoryTag reads the digest and the creation time of a tag.
+// The time is unknown for images not in schema2 format.
+func fetchRepositoryTag(hub registryTagsClient, repository, tag string) (corev1alpha1.RepositoryTag, error) {
+	res := newRepositoryTag(tag)
+
+	manifestDigest, err := hub.ManifestDigest(repository, tag)
+
+	if err != nil {
+		return res, err
+	}
+
+	res.Manifest = manifestDigest.String()
+
+	manifest, err := hub.ManifestV2(repository, tag)
+
+	if err != nil || manifest.Config.Digest == "" {
+		return res, nil
+	}
+
+	blob, err := hub.DownloadBlob(repository, manifest.Config.Digest)
+
+	if err != nil {
+		return res, nil
+	}
+
+	defer blob.Close()
+
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+
+	if err := json.NewDecoder(blob).Decode(&config); err == nil && !config.Created.IsZero() {
+		res.TimeCreatedMs = strconv.FormatInt(config.Created.UnixNano()/int64(time.Millisecond), 10)
+	}
+
+	return res, nil
+}
+
+// repositoryTagFilter keeps the tags that image update policies of the components may move to, and their current tags.
+// Only the tags are recorded in the status, instead of all tags of the repository.
+type repositoryTagFilter struct {
+	current  map[string]bool
+	all      bool
+	ranges   []semver.Range
+	patterns []*regexp.Regexp
+
+	// creation times are only compared by the latest and the regex policies
+	needCreationTime bool
+}
+
+func newRepositoryTagFilter(components []*corev1alpha1.Component) *repositoryTagFilter {
+	filter := &repositoryTagFilter{current: make(map[string]bool)}
+
+	for _, component := range components {
+		if named, err := reference.ParseNormalizedNamed(component.Spec.Image); err == nil {
+			filter.current[getImageTag(named)] = true
+		}
+
+		policy := component.Spec.ImageUpdatePolicy
+
+		// invalid patterns are reported when the image is updated
+		switch policy.Type {
+		case corev1alpha1.ImageUpdatePolicyTypeSemver:
+			if rng, err := semver.ParseRange(policy.Pattern); err == nil {
+				filter.ranges = append(filter.ranges, rng)
+			}
+		case corev1alpha1.ImageUpdatePolicyTypeRegex:
+			if pattern, err := regexp.Compile(policy.Pattern); err == nil {
+				filter.patterns = append(filter.patterns, pattern)
+			}
+
+			filter.needCreationTime = true
+		default:
+			filter.all = true
+			filter.needCreationTime = true
+		}
+	}
+
+	return filter
+}
+
+// newCatalogTagFilter keeps all tags of repositories which are only listed for the image picker.
+// Creation times are not needed, no manifest is fetched for them.
+func newCatalogTagFilter() *repositoryTagFilter {
+	return &repositoryTagFilter{current: make(map[string]bool), all: true}
+}
+
+func (f *repositoryTagFilter) match(tag string) bool {
+	if f.current[tag] || f.all {
+		return true
+	}
+
+	if v, err := semver.ParseVersion(tag); err == nil {
+		for _, rng := range f.ranges {
+			if rng.Contains(v) {
+				return true
+			}
+		}
+	}
+
+	for _, pattern := range f.patterns {
+		if pattern.MatchString(tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pollRepository lists the tags of the repository, and keeps the ones matching the filter.
+// Tags in the last poll are not fetched again, and at most maxRegistryTagFetchesPerPoll new tags are fetched,
+// the others are fetched in the next polls. complete is false until all kept tags are fetched.
+func pollRepository(hub registryTagsClient, name string, last *corev1alpha1.Repository, filter *repositoryTagFilter) (res *corev1alpha1.Repository, complete bool, err error) {
+	tags, err := hub.Tags(name)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	known := make(map[string]corev1alpha1.RepositoryTag)
+
+	if last != nil {
+		for _, tag := range last.Tags {
+			known[tag.Name] = tag
+		}
+	}
+
+	res = &corev1alpha1.Repository{Name: name}
+	complete = true
+	fetches := 0
+
+	for _, tag := range tags {
+		if !filter.match(tag) {
+			continue
+		}
+
+		if len(res.Tags) >= maxRepositoryTags {
+			break
+		}
+
+		repositoryTag, exist := known[tag]
+
+		// the latest tag is moved by every push
+		if exist && (tag != "latest" || !filter.needCreationTime) {
+			res.Tags = append(res.Tags, repositoryTag)
+			continue
+		}
+
+		if !filter.needCreationTime {
+			res.Tags = append(res.Tags, newRepositoryTag(tag))
+			continue
+		}
+
+		if fetches >= maxRegistryTagFetchesPerPoll {
+			complete = false
+			continue
+		}
+
+		fetches += 1
+
+		repositoryTag, err := fetchRepositoryTag(hub, name, tag)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		res.Tags = append(res.Tags, repositoryTag)
+	}
+
+	return res, complete, nil
+}
+
+func getTagCreatedMs(tag corev1alpha1.RepositoryTag) int64 {
+	ms, _ := strconv.ParseInt(tag.TimeCreatedMs, 10, 64)
+	return ms
+}
+
+// selectImageUpdateTag returns the tag to update to, or an empty string if the current tag is the best.
+func selectImageUpdateTag(policy *corev1alpha1.ImageUpdatePolicy, current string, tags []corev1alpha1.RepositoryTag) (string, error) {
+	if policy.Type == corev1alpha1.ImageUpdatePolicyTypeSemver {
+		rng, err := semver.ParseRange(policy.Pattern)
+
+		if err != nil {
+			return "", err
+		}
+
+		best := ""
+		bestVersion, _ := semver.ParseVersion(current)
+
+		for _, tag := range tags {
+			v, err := semver.ParseVersion(tag.Name)
+
+			if err != nil || !rng.Contains(v) {
+				continue
+			}
+
+			if bestVersion == nil || bestVersion.LessThan(v) {
+				best, bestVersion = tag.Name, v
+			}
+		}
+
+		return best, nil
+	}
+
+	var pattern *regexp.Regexp
+
+	if policy.Type == corev1alpha1.ImageUpdatePolicyTypeRegex {
+		var err error
+
+		if pattern, err = regexp.Compile(policy.Pattern); err != nil {
+			return "", err
+		}
+	}
+
+	var candidates []corev1alpha1.RepositoryTag
+	var currentCreatedMs int64
+
+	for _, tag := range tags {
+		if tag.Name == current {
+			currentCreatedMs = getTagCreatedMs(tag)
+		}
+
+		if tag.Name == "latest" || getTagCreatedMs(tag) == 0 || (pattern != nil && !pattern.MatchString(tag.Name)) {
+			continue
+		}
+
+		candidates = append(candidates, tag)
+	}
+
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return getTagCreatedMs(candidates[i]) > getTagCreatedMs(candidates[j])
+	})
+
+	if best := candidates[0]; best.Name != current && getTagCreatedMs(best) > currentCreatedMs {
+		return best.Name, nil
+	}
+
+	return "", nil
+}
+
+func getImageTag(named reference.Named) string {
+	if tagged, ok := named.(reference.Tagged); ok {
+		return tagged.Tag()
+	}
+
+	return ""
+}
+
+// SyncRepositories polls the repositories in the catalog of the registry and the ones used by components,
+// records their tags in the status, and moves images of components with an image update policy to the qualifying tags.
+// Repositories of components only keep the tags their policies may move to, the others keep all tags for the image picker.
+func (r *DockerRegistryReconcileTask) SyncRepositories(hub registryTagsClient) error {
+	components, err := r.getImageUpdateComponents()
+
+	if err != nil {
+		return err
+	}
+
+	names, err := hub.Repositories()
+
+	if err != nil {
+		// some registries, such as docker hub, don't serve the catalog
+		r.Log.Info("list repositories failed, only repositories of components are polled", "registry", r.registry.Name, "error", err.Error())
+		names = nil
+	}
+
+	if len(names) > maxCatalogRepositories {
+		r.Log.Info("too many repositories in the catalog, the rest are not listed", "registry", r.registry.Name, "count", len(names))
+		names = names[:maxCatalogRepositories]
+	}
+
+	for path := range components {
+		names = append(names, path)
+	}
+
+	last := make(map[string]*corev1alpha1.Repository)
+
+	for _, repository := range r.registry.Status.Repositories {
+		last[repository.Name] = repository
+	}
+
+	registryCopy := r.registry.DeepCopy()
+	registryCopy.Status.Repositories = nil
+
+	sort.Strings(names)
+	polled := make(map[string]bool)
+
+	for _, name := range names {
+		if polled[name] {
+			continue
+		}
+
+		polled[name] = true
+
+		filter := newCatalogTagFilter()
+
+		if len(components[name]) > 0 {
+			filter = newRepositoryTagFilter(components[name])
+		}
+
+		repository, complete, err := pollRepository(hub, name, last[name], filter)
+
+		if err != nil {
+			r.WarningEvent(err, "poll repository %s error.", name)
+
+			if last[name] != nil {
+				registryCopy.Status.Repositories = append(registryCopy.Status.Repositories, last[name])
+			}
+
+			continue
+		}
+
+		registryCopy.Status.Repositories = append(registryCopy.Status.Repositories, repository)
+
+		// images would be moved to tags that are not the best, before the others are fetched
+		if !complete {
+			continue
+		}
+
+		for _, component := range components[name] {
+			if err := r.updateComponentImage(component, repository); err != nil {
+				r.WarningEvent(err, "update image of component %s/%s error.", component.Namespace, component.Name)
+			}
+		}
+	}
+
+	return r.Status().Patch(r.ctx, registryCopy, client.MergeFrom(r.registry))
+}
+
+// getImageUpdateComponents returns components with an image update policy in this registry, by repository.
+func (r *DockerRegistryReconcileTask) getImageUpdateComponents() (map[string][]*corev1alpha1.Component, error) {
+	var componentList corev1alpha1.ComponentList
+
+	if err := r.Reader.List(r.ctx, &componentList); err != nil {
+		return nil, err
+	}
+
+	domain := getRegistryDomain(r.registry.Spec.Host)
+	components := make(map[string][]*corev1alpha1.Component)
+
+	for i := range componentList.Items {
+		component := &componentList.Items[i]
+
+		if component.Spec.ImageUpdatePolicy == nil || component.DeletionTimestamp != nil {
+			continue
+		}
+
+		named, err := reference.ParseNormalizedNamed(component.Spec.Image)
+
+		if err != nil || reference.Domain(named) != domain {
+			continue
+		}
+
+		path := reference.Path(named)
+		components[path] = append(components[path], component)
+	}
+
+	return components, nil
+}
+
+func (r *DockerRegistryReconcileTask) updateComponentImage(component *corev1alpha1.Component, repository *corev1alpha1.Repository) error {
+	named, err := reference.ParseNormalizedNamed(component.Spec.Image)
+
+	if err != nil {
+		return err
+	}
+
+	current := getImageTag(named)
+
+	tag, err := selectImageUpdateTag(component.Spec.ImageUpdatePolicy, current, excludeRolledBackTag(component, repository.Tags))
+
+	if err != nil || tag == "" {
+		return err
+	}
+
+	componentCopy := component.DeepCopy()
+	componentCopy.Spec.Image = replaceImageTag(component.Spec.Image, tag)
+
+	if err := r.Patch(r.ctx, componentCopy, client.MergeFrom(component)); err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(component, v1.EventTypeNormal, "ImageUpdated",
+		"image tag is updated from %s to %s by the %s policy.", current, tag, component.Spec.ImageUpdatePolicy.Type)
+
+	return nil
+}
+
+// excludeRolledBackTag drops the tag of the image reverted by the auto rollback of the component,
+// otherwise the image would be updated to it again right after the rollback.
+// Newer tags are still picked up, pushing a fix doesn't need to clear the rollback.
+func excludeRolledBackTag(component *corev1alpha1.Component, tags []corev1alpha1.RepositoryTag) []corev1alpha1.RepositoryTag {
+	if component.Status.AutoRollback == nil || component.Status.AutoRollback.RolledBackImage == "" {
+		return tags
+	}
+
+	var res []corev1alpha1.RepositoryTag
+
+	for _, tag := range tags {
+		if replaceImageTag(component.Spec.Image, tag.Name) == component.Status.AutoRollback.RolledBackImage {
+			continue
+		}
+
+		res = append(res, tag)
+	}
+
+	return res
+}
+
+func getRegistryPollingInterval(registry *corev1alpha1.DockerRegistry) time.Duration {
+	seconds := defaultRegistryPollingIntervalSeconds
+
+	if registry.Spec.PoolingIntervalSeconds != nil && *registry.Spec.PoolingIntervalSeconds > 0 {
+		seconds = *registry.Spec.PoolingIntervalSeconds
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeRegistryTagsClient struct {
+	repositories []string
+	tags         map[string]string
+	fetched      []string
+}
+
+func (c *fakeRegistryTagsClient) Repositories() ([]string, error) {
+	return c.repositories, nil
+}
+
+func (c *fakeRegistryTagsClient) Tags(repository string) ([]string, error) {
+	var res []string
+
+	for tag := range c.tags {
+		res = append(res, tag)
+	}
+
+	return res, nil
+}
+
+func (c *fakeRegistryTagsClient) ManifestDigest(repository, reference string) (digest.Digest, error) {
+	c.fetched = append(c.fetched, reference)
+	return digest.FromString(reference), nil
+}
+
+func (c *fakeRegistryTagsClient) ManifestV2(repository, reference string) (*schema2.DeserializedManifest, error) {
+	return &schema2.DeserializedManifest{
+		Manifest: schema2.Manifest{
+			Config: distribution.Descriptor{Digest: digest.Digest(reference)},
+		},
+	}, nil
+}
+
+func (c *fakeRegistryTagsClient) DownloadBlob(repository string, digest digest.Digest) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(`{"created":"%s"}`, c.tags[string(digest)]))), nil
+}
+
+func TestGetRegistryDomain(t *testing.T) {
+	assert.Equal(t, "docker.io", getRegistryDomain(""))
+	assert.Equal(t, "docker.io", getRegistryDomain("https://registry-1.docker.io"))
+	assert.Equal(t, "gcr.io", getRegistryDomain("https://gcr.io"))
+	assert.Equal(t, "localhost:5000", getRegistryDomain("http://localhost:5000"))
+	assert.Equal(t, "quay.io", getRegistryDomain("quay.io"))
+}
+
+func TestReplaceImageTag(t *testing.T) {
+	assert.Equal(t, "nginx:1.19", replaceImageTag("nginx", "1.19"))
+	assert.Equal(t, "nginx:1.19", replaceImageTag("nginx:1.18", "1.19"))
+	assert.Equal(t, "localhost:5000/foo:v2", replaceImageTag("localhost:5000/foo:v1", "v2"))
+	assert.Equal(t, "localhost:5000/foo:v2", replaceImageTag("localhost:5000/foo@sha256:abc", "v2"))
+}
+
+func TestSelectImageUpdateTag(t *testing.T) {
+	tags := []corev1alpha1.RepositoryTag{
+		{Name: "v1.0.0", TimeCreatedMs: "1000"},
+		{Name: "v1.2.0", TimeCreatedMs: "3000"},
+		{Name: "v1.1.0", TimeCreatedMs: "4000"},
+		{Name: "v2.0.0", TimeCreatedMs: "5000"},
+		{Name: "v2.1.0-rc.1", TimeCreatedMs: "6000"},
+		{Name: "main-abc", TimeCreatedMs: "7000"},
+		{Name: "latest", TimeCreatedMs: "8000"},
+	}
+
+	semverPolicy := &corev1alpha1.ImageUpdatePolicy{Type: corev1alpha1.ImageUpdatePolicyTypeSemver, Pattern: "^1.0"}
+
+	tag, err := selectImageUpdateTag(semverPolicy, "v1.0.0", tags)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.2.0", tag)
+
+	tag, _ = selectImageUpdateTag(semverPolicy, "v1.2.0", tags)
+	assert.Equal(t, "", tag)
+
+	// never downgraded
+	tag, _ = selectImageUpdateTag(semverPolicy, "v1.5.0", tags)
+	assert.Equal(t, "", tag)
+
+	tag, _ = selectImageUpdateTag(&corev1alpha1.ImageUpdatePolicy{Type: corev1alpha1.ImageUpdatePolicyTypeSemver, Pattern: ">=1.0.0"}, "v1.0.0", tags)
+	assert.Equal(t, "v2.0.0", tag)
+
+	regexPolicy := &corev1alpha1.ImageUpdatePolicy{Type: corev1alpha1.ImageUpdatePolicyTypeRegex, Pattern: `^v1\.`}
+
+	tag, _ = selectImageUpdateTag(regexPolicy, "v1.0.0", tags)
+	assert.Equal(t, "v1.1.0", tag)
+
+	tag, _ = selectImageUpdateTag(regexPolicy, "v1.1.0", tags)
+	assert.Equal(t, "", tag)
+
+	latestPolicy := &corev1alpha1.ImageUpdatePolicy{Type: corev1alpha1.ImageUpdatePolicyTypeLatest}
+
+	tag, _ = selectImageUpdateTag(latestPolicy, "v1.0.0", tags)
+	assert.Equal(t, "main-abc", tag)
+
+	tag, _ = selectImageUpdateTag(latestPolicy, "main-abc", tags)
+	assert.Equal(t, "", tag)
+}
+
+func newImageUpdateTestComponent(image string, policyType corev1alpha1.ImageUpdatePolicyType, pattern string) *corev1alpha1.Component {
+	return &corev1alpha1.Component{
+		Spec: corev1alpha1.ComponentSpec{
+			Image:             image,
+			ImageUpdatePolicy: &corev1alpha1.ImageUpdatePolicy{Type: policyType, Pattern: pattern},
+		},
+	}
+}
+
+func TestRepositoryTagFilter(t *testing.T) {
+	filter := newRepositoryTagFilter([]*corev1alpha1.Component{
+		newImageUpdateTestComponent("kalmhq/echo:v1.0.0", corev1alpha1.ImageUpdatePolicyTypeSemver, "^1.0"),
+		newImageUpdateTestComponent("kalmhq/echo:main-abc", corev1alpha1.ImageUpdatePolicyTypeRegex, "^main-"),
+	})
+
+	assert.True(t, filter.match("v1.0.0"))
+	assert.True(t, filter.match("v1.2.0"))
+	assert.True(t, filter.match("main-def"))
+	assert.False(t, filter.match("v2.0.0"))
+	assert.False(t, filter.match("dev-abc"))
+	assert.True(t, filter.needCreationTime)
+
+	// the tags of semver policies are compared by names, nothing is fetched
+	filter = newRepositoryTagFilter([]*corev1alpha1.Component{
+		newImageUpdateTestComponent("kalmhq/echo:v1.0.0", corev1alpha1.ImageUpdatePolicyTypeSemver, "^1.0"),
+	})
+
+	hub := &fakeRegistryTagsClient{tags: map[string]string{"v1.0.0": "", "v1.1.0": "", "v2.0.0": ""}}
+
+	repository, complete, err := pollRepository(hub, "kalmhq/echo", nil, filter)
+	assert.Nil(t, err)
+	assert.True(t, complete)
+	assert.Len(t, repository.Tags, 2)
+	assert.Empty(t, hub.fetched)
+}
+
+func TestPollRepositoryFetchLimit(t *testing.T) {
+	hub := &fakeRegistryTagsClient{tags: make(map[string]string)}
+
+	for i := 0; i < maxRegistryTagFetchesPerPoll+5; i++ {
+		hub.tags[fmt.Sprintf("v%d", i)] = "2020-08-01T00:00:00Z"
+	}
+
+	filter := newRepositoryTagFilter([]*corev1alpha1.Component{
+		newImageUpdateTestComponent("kalmhq/echo:v0", corev1alpha1.ImageUpdatePolicyTypeLatest, ""),
+	})
+
+	repository, complete, err := pollRepository(hub, "kalmhq/echo", nil, filter)
+	assert.Nil(t, err)
+	assert.False(t, complete)
+	assert.Len(t, repository.Tags, maxRegistryTagFetchesPerPoll)
+
+	// the rest are fetched in the next poll
+	hub.fetched = nil
+
+	repository, complete, err = pollRepository(hub, "kalmhq/echo", repository, filter)
+	assert.Nil(t, err)
+	assert.True(t, complete)
+	assert.Len(t, repository.Tags, maxRegistryTagFetchesPerPoll+5)
+	assert.Len(t, hub.fetched, 5)
+}
+
+func TestPollRepository(t *testing.T) {
+	hub := &fakeRegistryTagsClient{
+		tags: map[string]string{
+			"v1": "2020-08-01T00:00:00Z",
+			"v2": "2020-08-02T00:00:00Z",
+		},
+	}
+
+	filter := newRepositoryTagFilter([]*corev1alpha1.Component{
+		newImageUpdateTestComponent("kalmhq/echo:v1", corev1alpha1.ImageUpdatePolicyTypeLatest, ""),
+	})
+
+	repository, complete, err := pollRepository(hub, "kalmhq/echo", nil, filter)
+	assert.Nil(t, err)
+	assert.True(t, complete)
+	assert.Len(t, repository.Tags, 2)
+	assert.Len(t, hub.fetched, 2)
+
+	for _, tag := range repository.Tags {
+		assert.Equal(t, digest.FromString(tag.Name).String(), tag.Manifest)
+
+		assert.NotEmpty(t, tag.TimeUploadedMs)
+
+		if tag.Name == "v1" {
+			assert.Equal(t, "1596240000000", tag.TimeCreatedMs)
+		}
+	}
+
+	// only the new tag is fetched
+	hub.tags["v3"] = "2020-08-03T00:00:00Z"
+	hub.fetched = nil
+
+	repository, _, err = pollRepository(hub, "kalmhq/echo", repository, filter)
+	assert.Nil(t, err)
+	assert.Len(t, repository.Tags, 3)
+	assert.Equal(t, []string{"v3"}, hub.fetched)
+}
+
+func TestSyncRepositoriesCatalog(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, corev1alpha1.AddToScheme(scheme))
+
+	registry := &corev1alpha1.DockerRegistry{
+		ObjectMeta: metaV1.ObjectMeta{Name: "local"},
+		Spec:       corev1alpha1.DockerRegistrySpec{Host: "https://registry.example.com"},
+	}
+
+	web := &corev1alpha1.Component{
+		ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: corev1alpha1.ComponentSpec{
+			Image:             "registry.example.com/kalmhq/web:v1.0.0",
+			ImageUpdatePolicy: &corev1alpha1.ImageUpdatePolicy{Type: corev1alpha1.ImageUpdatePolicyTypeSemver, Pattern: ">=1.0.0"},
+		},
+	}
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme, registry, web)
+
+	task := &DockerRegistryReconcileTask{
+		DockerRegistryReconciler: &DockerRegistryReconciler{&BaseReconciler{
+			Client:   fakeClient,
+			Reader:   fakeClient,
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}},
+		ctx:      context.Background(),
+		registry: registry,
+	}
+
+	hub := &fakeRegistryTagsClient{
+		repositories: []string{"kalmhq/api", "kalmhq/web"},
+		tags:         map[string]string{"v1.0.0": "", "v1.1.0": "", "dev": ""},
+	}
+
+	assert.Nil(t, task.SyncRepositories(hub))
+
+	var res corev1alpha1.DockerRegistry
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "local"}, &res))
+	assert.Len(t, res.Status.Repositories, 2)
+
+	tagNames := func(repository *corev1alpha1.Repository) []string {
+		var names []string
+
+		for _, tag := range repository.Tags {
+			names = append(names, tag.Name)
+		}
+
+		return names
+	}
+
+	// repositories only in the catalog keep all tags for the image picker
+	assert.Equal(t, "kalmhq/api", res.Status.Repositories[0].Name)
+	assert.ElementsMatch(t, []string{"v1.0.0", "v1.1.0", "dev"}, tagNames(res.Status.Repositories[0]))
+
+	// repositories of components keep the tags of their policies
+	assert.Equal(t, "kalmhq/web", res.Status.Repositories[1].Name)
+	assert.ElementsMatch(t, []string{"v1.0.0", "v1.1.0"}, tagNames(res.Status.Repositories[1]))
+
+	// no manifests are fetched for creation times
+	assert.Empty(t, hub.fetched)
+
+	var component corev1alpha1.Component
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "web", Namespace: "default"}, &component))
+	assert.Equal(t, "registry.example.com/kalmhq/web:v1.1.0", component.Spec.Image)
+}
+
+func TestUpdateComponentImageSkipsRolledBackImage(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, corev1alpha1.AddToScheme(scheme))
+
+	web := &corev1alpha1.Component{
+		ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: corev1alpha1.ComponentSpec{
+			Image:             "registry.example.com/kalmhq/web:v1.0.0",
+			ImageUpdatePolicy: &corev1alpha1.ImageUpdatePolicy{Type: corev1alpha1.ImageUpdatePolicyTypeSemver, Pattern: ">=1.0.0"},
+		},
+		Status: corev1alpha1.ComponentStatus{
+			AutoRollback: &corev1alpha1.ComponentAutoRollbackStatus{
+				Image:           "registry.example.com/kalmhq/web:v1.0.0",
+				RolledBackImage: "registry.example.com/kalmhq/web:v1.1.0",
+			},
+		},
+	}
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme, web)
+
+	task := &DockerRegistryReconcileTask{
+		DockerRegistryReconciler: &DockerRegistryReconciler{&BaseReconciler{
+			Client:   fakeClient,
+			Reader:   fakeClient,
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}},
+		ctx: context.Background(),
+	}
+
+	getImage := func() string {
+		var component corev1alpha1.Component
+		assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "web", Namespace: "default"}, &component))
+		return component.Spec.Image
+	}
+
+	repository := &corev1alpha1.Repository{
+		Name: "kalmhq/web",
+		Tags: []corev1alpha1.RepositoryTag{{Name: "v1.0.0"}, {Name: "v1.1.0"}},
+	}
+
+	// the rolled back image is not deployed again
+	assert.Nil(t, task.updateComponentImage(web, repository))
+	assert.Equal(t, "registry.example.com/kalmhq/web:v1.0.0", getImage())
+
+	// a newer tag is
+	repository.Tags = append(repository.Tags, corev1alpha1.RepositoryTag{Name: "v1.2.0"})
+	assert.Nil(t, task.updateComponentImage(web, repository))
+	assert.Equal(t, "registry.example.com/kalmhq/web:v1.2.0", getImage())
+}
@@ -0,0 +1,386 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// resources applied from a GitSource are labeled with its name
+	KalmLabelGitSource = "kalm-git-source"
+
+	defaultGitSourceBranch          = "master"
+	defaultGitSourceIntervalSeconds = 60
+
+	gitSourceFetchTimeout = 2 * time.Minute
+)
+
+// GitSourceReconciler reconciles a GitSource object
+type GitSourceReconciler struct {
+	*BaseReconciler
+
+	// checkouts of the repositories are kept here
+	WorkDir string
+}
+
+type GitSourceReconcilerTask struct {
+	*GitSourceReconciler
+	ctx    context.Context
+	source *corev1alpha1.GitSource
+}
+
+// +kubebuilder:rbac:groups=core.kalm.dev,resources=gitsources,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core.kalm.dev,resources=gitsources/status,verbs=get;update;patch
+
+func (r *GitSourceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	task := &GitSourceReconcilerTask{
+		GitSourceReconciler: r,
+		ctx:                 context.Background(),
+	}
+
+	return task.Run(req)
+}
+
+func (r *GitSourceReconcilerTask) Run(req ctrl.Request) (ctrl.Result, error) {
+	var source corev1alpha1.GitSource
+
+	if err := r.Get(r.ctx, req.NamespacedName, &source); err != nil {
+		if errors.IsNotFound(err) {
+			// applied resources are left in the cluster, only the checkout is removed
+			return ctrl.Result{}, os.RemoveAll(r.getRepositoryDir(req.Name))
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	r.source = &source
+
+	sourceCopy := source.DeepCopy()
+	err := r.sync(&sourceCopy.Status)
+
+	if err != nil {
+		sourceCopy.Status.Error = err.Error()
+		r.EmitWarningEvent(&source, err, "sync from %s failed.", source.Spec.URL)
+	} else {
+		sourceCopy.Status.Error = ""
+
+		if sourceCopy.Status.Revision != source.Status.Revision || len(sourceCopy.Status.Drifted) > 0 {
+			r.EmitNormalEvent(&source, "Synced", "synced revision %s, %d resources are drifted.", sourceCopy.Status.Revision, len(sourceCopy.Status.Drifted))
+		}
+	}
+
+	if err := r.Status().Patch(r.ctx, sourceCopy, client.MergeFrom(&source)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	interval := source.Spec.IntervalSeconds
+
+	if interval <= 0 {
+		interval = defaultGitSourceIntervalSeconds
+	}
+
+	// errors are retried in the next interval too, a broken repository should not be fetched in a hot loop
+	return ctrl.Result{RequeueAfter: time.Duration(interval) * time.Second}, nil
+}
+
+func (r *GitSourceReconciler) getRepositoryDir(name string) string {
+	return filepath.Join(r.WorkDir, name)
+}
+
+// sync applies the resources in the repository, and records them in the status.
+func (r *GitSourceReconcilerTask) sync(status *corev1alpha1.GitSourceStatus) error {
+	var secret *coreV1.Secret
+
+	if r.source.Spec.SecretName != "" {
+		secret = &coreV1.Secret{}
+
+		err := r.Get(r.ctx, types.NamespacedName{Namespace: NamespaceKalmSystem, Name: r.source.Spec.SecretName}, secret)
+
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("secret %s is not found in %s namespace", r.source.Spec.SecretName, NamespaceKalmSystem)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	branch := r.source.Spec.Branch
+
+	if branch == "" {
+		branch = defaultGitSourceBranch
+	}
+
+	// checked again in case the source is created while the webhook is not running
+	if !corev1alpha1.IsValidGitURL(r.source.Spec.URL) {
+		return fmt.Errorf("invalid git url: %s", r.source.Spec.URL)
+	}
+
+	if !corev1alpha1.IsValidGitBranch(branch) {
+		return fmt.Errorf("invalid branch: %s", branch)
+	}
+
+	repo := &gitRepository{
+		dir:    r.getRepositoryDir(r.source.Name),
+		url:    r.source.Spec.URL,
+		branch: branch,
+		secret: secret,
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, gitSourceFetchTimeout)
+	defer cancel()
+
+	revision, err := repo.Fetch(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	objs, err := repo.ReadResources(r.source.Spec.Path)
+
+	if err != nil {
+		return err
+	}
+
+	previous := make(map[corev1alpha1.GitSourceResource]bool)
+
+	for _, res := range status.Resources {
+		previous[res] = true
+	}
+
+	var resources, drifted []corev1alpha1.GitSourceResource
+	applied := make(map[corev1alpha1.GitSourceResource]bool)
+
+	for _, obj := range objs {
+		res := corev1alpha1.GitSourceResource{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		}
+
+		if applied[res] {
+			return fmt.Errorf("%s %s/%s is defined more than once", res.Kind, res.Namespace, res.Name)
+		}
+
+		// with a new revision, specs are replaced so removed fields are removed in the cluster too
+		changed, err := r.apply(obj, revision != status.Revision)
+
+		if err != nil {
+			return err
+		}
+
+		// with the same revision, any change is made in the cluster
+		if changed && previous[res] && revision == status.Revision {
+			drifted = append(drifted, res)
+		}
+
+		applied[res] = true
+		resources = append(resources, res)
+	}
+
+	if r.source.Spec.Prune {
+		for _, res := range status.Resources {
+			if applied[res] {
+				continue
+			}
+
+			if err := r.prune(res); err != nil {
+				return err
+			}
+		}
+	}
+
+	now := metaV1.Now()
+	status.Revision = revision
+	status.LastSyncTime = &now
+	status.Resources = resources
+	status.Drifted = drifted
+
+	return nil
+}
+
+// apply creates or updates the resource, and returns whether the spec in the cluster is changed.
+// Unless replace is true, the spec is kept if it has all fields in the repository.
+func (r *GitSourceReconcilerTask) apply(u *unstructured.Unstructured, replace bool) (bool, error) {
+	gvk := u.GroupVersionKind()
+
+	obj, err := r.Scheme.New(gvk)
+
+	if err != nil {
+		return false, err
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj); err != nil {
+		return false, fmt.Errorf("%s %s: %s", gvk.Kind, u.GetName(), err)
+	}
+
+	target, _ := r.Scheme.New(gvk)
+	targetMeta := target.(metaV1.Object)
+	targetMeta.SetNamespace(u.GetNamespace())
+	targetMeta.SetName(u.GetName())
+
+	desiredSpec := reflect.ValueOf(obj).Elem().FieldByName("Spec")
+	changed := false
+
+	_, err = controllerutil.CreateOrUpdate(r.ctx, r.Client, target, func() error {
+		if owner := targetMeta.GetLabels()[KalmLabelGitSource]; owner != "" && owner != r.source.Name {
+			return fmt.Errorf("it is managed by git source %s", owner)
+		}
+
+		targetMeta.SetLabels(mergeMap(mergeMap(targetMeta.GetLabels(), u.GetLabels()), map[string]string{
+			KalmLabelGitSource: r.source.Name,
+		}))
+
+		targetMeta.SetAnnotations(mergeMap(targetMeta.GetAnnotations(), u.GetAnnotations()))
+
+		if !desiredSpec.IsValid() {
+			return nil
+		}
+
+		spec := reflect.ValueOf(target).Elem().FieldByName("Spec")
+
+		if targetMeta.GetResourceVersion() != "" && !replace {
+			same, err := isJSONSubsetOf(desiredSpec.Interface(), spec.Interface())
+
+			if err != nil || same {
+				return err
+			}
+		}
+
+		spec.Set(desiredSpec)
+		changed = true
+
+		return nil
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("apply %s %s/%s failed: %s", gvk.Kind, u.GetNamespace(), u.GetName(), err)
+	}
+
+	return changed, nil
+}
+
+// prune deletes a resource which is removed from the repository, if it's still managed by the source.
+func (r *GitSourceReconcilerTask) prune(res corev1alpha1.GitSourceResource) error {
+	var obj unstructured.Unstructured
+	obj.SetGroupVersionKind(schema.FromAPIVersionAndKind(res.APIVersion, res.Kind))
+
+	if err := r.Get(r.ctx, types.NamespacedName{Namespace: res.Namespace, Name: res.Name}, &obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if obj.GetLabels()[KalmLabelGitSource] != r.source.Name {
+		return nil
+	}
+
+	if err := r.Delete(r.ctx, &obj); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("prune %s %s/%s failed: %s", res.Kind, res.Namespace, res.Name, err)
+	}
+
+	return nil
+}
+
+// isJSONSubsetOf returns whether the fields set in a are the same in b.
+// Fields only in b, such as the ones set by defaulting webhooks, are ignored.
+func isJSONSubsetOf(a, b interface{}) (bool, error) {
+	var aValue, bValue interface{}
+
+	for _, pair := range []struct {
+		in  interface{}
+		out *interface{}
+	}{{a, &aValue}, {b, &bValue}} {
+		bts, err := json.Marshal(pair.in)
+
+		if err != nil {
+			return false, err
+		}
+
+		if err := json.Unmarshal(bts, pair.out); err != nil {
+			return false, err
+		}
+	}
+
+	return isJSONValueSubsetOf(aValue, bValue), nil
+}
+
+func isJSONValueSubsetOf(a, b interface{}) bool {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+
+		if !ok {
+			return false
+		}
+
+		for k, v := range av {
+			if !isJSONValueSubsetOf(v, bv[k]) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+
+		for i := range av {
+			if !isJSONValueSubsetOf(av[i], bv[i]) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+func NewGitSourceReconciler(mgr ctrl.Manager) *GitSourceReconciler {
+	return &GitSourceReconciler{
+		BaseReconciler: NewBaseReconciler(mgr, "GitSource"),
+		WorkDir:        filepath.Join(os.TempDir(), "kalm-git-sources"),
+	}
+}
+
+func (r *GitSourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1alpha1.GitSource{}).
+		// status patches should not trigger another sync, the next one is scheduled by RequeueAfter
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(r)
+}
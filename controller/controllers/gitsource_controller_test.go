@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsJSONSubsetOf(t *testing.T) {
+	type spec struct {
+		Image string            `json:"image,omitempty"`
+		Ports []int             `json:"ports,omitempty"`
+		Env   map[string]string `json:"env,omitempty"`
+	}
+
+	same, err := isJSONSubsetOf(spec{Image: "nginx"}, spec{Image: "nginx", Ports: []int{80}})
+	assert.Nil(t, err)
+	assert.True(t, same)
+
+	same, _ = isJSONSubsetOf(spec{Image: "nginx", Env: map[string]string{"A": "1"}}, spec{Image: "nginx", Env: map[string]string{"A": "1", "B": "2"}})
+	assert.True(t, same)
+
+	same, _ = isJSONSubsetOf(spec{Image: "nginx:2"}, spec{Image: "nginx"})
+	assert.False(t, same)
+
+	same, _ = isJSONSubsetOf(spec{Ports: []int{80}}, spec{Ports: []int{80, 443}})
+	assert.False(t, same)
+}
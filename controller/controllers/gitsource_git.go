@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	GitSourceSecretSSHPrivateKey = "sshPrivateKey"
+	GitSourceSecretKnownHosts    = "knownHosts"
+	GitSourceSecretUsername      = "username"
+	GitSourceSecretPassword      = "password"
+)
+
+// git runs it with the prompt as the argument
+const gitAskPassScript = `#!/bin/sh
+case "$1" in
+Username*) echo "$KALM_GIT_USERNAME" ;;
+*) echo "$KALM_GIT_PASSWORD" ;;
+esac
+`
+
+// gitRepository is a local checkout of a GitSource, refreshed by fetching a single branch.
+type gitRepository struct {
+	dir    string
+	url    string
+	branch string
+	secret *coreV1.Secret
+}
+
+func (g *gitRepository) run(ctx context.Context, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(out.String()))
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+// credentialEnv returns the env for git to authenticate with the secret.
+// Files it writes are in credentialsDir, which is removed by the caller.
+func (g *gitRepository) credentialEnv(credentialsDir string) ([]string, error) {
+	if g.secret == nil {
+		return nil, nil
+	}
+
+	if key := g.secret.Data[GitSourceSecretSSHPrivateKey]; len(key) > 0 {
+		keyFile := filepath.Join(credentialsDir, "id")
+
+		if err := ioutil.WriteFile(keyFile, key, 0600); err != nil {
+			return nil, err
+		}
+
+		// the host key is always checked, a key sent to an impersonated host gives it access to the repository
+		knownHosts := g.secret.Data[GitSourceSecretKnownHosts]
+
+		if len(knownHosts) == 0 {
+			return nil, fmt.Errorf("%s is required in secret %s to check the host key", GitSourceSecretKnownHosts, g.secret.Name)
+		}
+
+		knownHostsFile := filepath.Join(credentialsDir, "known_hosts")
+
+		if err := ioutil.WriteFile(knownHostsFile, knownHosts, 0600); err != nil {
+			return nil, err
+		}
+
+		return []string{
+			fmt.Sprintf(
+				"GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes",
+				keyFile, knownHostsFile,
+			),
+		}, nil
+	}
+
+	if username := g.secret.Data[GitSourceSecretUsername]; len(username) > 0 {
+		askPassFile := filepath.Join(credentialsDir, "askpass")
+
+		if err := ioutil.WriteFile(askPassFile, []byte(gitAskPassScript), 0700); err != nil {
+			return nil, err
+		}
+
+		// passed in env instead of args or url, so they are not visible in the process list or error messages
+		return []string{
+			"GIT_ASKPASS=" + askPassFile,
+			"KALM_GIT_USERNAME=" + string(username),
+			"KALM_GIT_PASSWORD=" + string(g.secret.Data[GitSourceSecretPassword]),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// Fetch updates the checkout to the head of the branch, and returns the commit.
+func (g *gitRepository) Fetch(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(g.dir, 0700); err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); os.IsNotExist(err) {
+		if _, err := g.run(ctx, nil, "init", "-q"); err != nil {
+			return "", err
+		}
+	}
+
+	credentialsDir, err := ioutil.TempDir("", "kalm-git-credentials")
+
+	if err != nil {
+		return "", err
+	}
+
+	defer os.RemoveAll(credentialsDir)
+
+	env, err := g.credentialEnv(credentialsDir)
+
+	if err != nil {
+		return "", err
+	}
+
+	// url and branch are from the spec, "--" keeps them from being taken as options
+	if _, err := g.run(ctx, env, "fetch", "-q", "--depth", "1", "--force", "--", g.url, "refs/heads/"+g.branch); err != nil {
+		return "", err
+	}
+
+	revision, err := g.run(ctx, nil, "rev-parse", "FETCH_HEAD")
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := g.run(ctx, nil, "checkout", "-q", "--force", "--detach", revision); err != nil {
+		return "", err
+	}
+
+	if _, err := g.run(ctx, nil, "clean", "-q", "-f", "-d", "-x"); err != nil {
+		return "", err
+	}
+
+	return revision, nil
+}
+
+// ReadResources decodes the yaml and json files under path. Only kalm resources are allowed.
+func (g *gitRepository) ReadResources(path string) ([]*unstructured.Unstructured, error) {
+	// the path can't go out of the repository
+	root := filepath.Join(g.dir, filepath.Clean("/"+path))
+
+	var res []*unstructured.Unstructured
+
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		switch filepath.Ext(file) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		objs, err := decodeGitSourceFile(file)
+
+		if err != nil {
+			rel, _ := filepath.Rel(g.dir, file)
+			return fmt.Errorf("%s: %s", rel, err)
+		}
+
+		res = append(res, objs...)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func decodeGitSourceFile(file string) ([]*unstructured.Unstructured, error) {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var res []*unstructured.Unstructured
+
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+
+	for {
+		var obj map[string]interface{}
+
+		if err := decoder.Decode(&obj); err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		// empty documents
+		if len(obj) == 0 {
+			continue
+		}
+
+		u := &unstructured.Unstructured{Object: obj}
+
+		if u.GroupVersionKind().Group != v1alpha1.GroupVersion.Group {
+			return nil, fmt.Errorf("%s %s is not a kalm resource", u.GetAPIVersion(), u.GetKind())
+		}
+
+		if u.GetName() == "" {
+			return nil, fmt.Errorf("%s without name", u.GetKind())
+		}
+
+		res = append(res, u)
+	}
+
+	return res, nil
+}
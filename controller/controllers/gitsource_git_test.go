@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type GitRepositorySuite struct {
+	suite.Suite
+
+	tmpDir  string
+	bareDir string
+	workDir string
+}
+
+func (suite *GitRepositorySuite) git(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=kalm", "GIT_AUTHOR_EMAIL=kalm@example.com",
+		"GIT_COMMITTER_NAME=kalm", "GIT_COMMITTER_EMAIL=kalm@example.com",
+	)
+
+	out, err := cmd.CombinedOutput()
+	suite.Require().Nil(err, string(out))
+
+	return string(out)
+}
+
+func (suite *GitRepositorySuite) commit(files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(suite.workDir, name)
+
+		if content == "" {
+			suite.Require().Nil(os.Remove(file))
+			continue
+		}
+
+		suite.Require().Nil(os.MkdirAll(filepath.Dir(file), 0755))
+		suite.Require().Nil(ioutil.WriteFile(file, []byte(content), 0644))
+	}
+
+	suite.git(suite.workDir, "add", "-A")
+	suite.git(suite.workDir, "commit", "-q", "-m", "update")
+	suite.git(suite.workDir, "push", "-q", "origin", "HEAD:master")
+}
+
+func (suite *GitRepositorySuite) SetupTest() {
+	if _, err := exec.LookPath("git"); err != nil {
+		suite.T().Skip("git is not installed")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "kalm-git-source-test")
+	suite.Require().Nil(err)
+
+	suite.tmpDir = tmpDir
+	suite.bareDir = filepath.Join(tmpDir, "bare.git")
+	suite.workDir = filepath.Join(tmpDir, "work")
+
+	suite.git(tmpDir, "init", "-q", "--bare", suite.bareDir)
+	suite.git(tmpDir, "init", "-q", suite.workDir)
+	suite.git(suite.workDir, "remote", "add", "origin", suite.bareDir)
+}
+
+func (suite *GitRepositorySuite) TearDownTest() {
+	os.RemoveAll(suite.tmpDir)
+}
+
+func (suite *GitRepositorySuite) TestFetchAndReadResources() {
+	suite.commit(map[string]string{
+		"README.md": "# apps",
+		"production/web.yaml": `
+apiVersion: core.kalm.dev/v1alpha1
+kind: Component
+metadata:
+  name: web
+  namespace: production
+spec:
+  image: nginx
+---
+apiVersion: core.kalm.dev/v1alpha1
+kind: HttpRoute
+metadata:
+  name: web
+  namespace: production
+spec:
+  hosts:
+  - example.com
+`,
+		"staging/web.yaml": `
+apiVersion: core.kalm.dev/v1alpha1
+kind: Component
+metadata:
+  name: web
+  namespace: staging
+spec:
+  image: nginx
+`,
+	})
+
+	repo := &gitRepository{
+		dir:    filepath.Join(suite.tmpDir, "checkout"),
+		url:    "file://" + suite.bareDir,
+		branch: "master",
+	}
+
+	revision, err := repo.Fetch(context.Background())
+	suite.Nil(err)
+	suite.Equal(suite.git(suite.workDir, "rev-parse", "HEAD"), revision+"\n")
+
+	objs, err := repo.ReadResources("production")
+	suite.Nil(err)
+	suite.Len(objs, 2)
+	suite.Equal("Component", objs[0].GetKind())
+	suite.Equal("HttpRoute", objs[1].GetKind())
+
+	// the path can't escape the repository
+	objs, err = repo.ReadResources("../../production")
+	suite.Nil(err)
+	suite.Len(objs, 2)
+
+	// removed files are gone after the next fetch
+	suite.commit(map[string]string{"production/web.yaml": ""})
+
+	newRevision, err := repo.Fetch(context.Background())
+	suite.Nil(err)
+	suite.NotEqual(revision, newRevision)
+
+	objs, err = repo.ReadResources("")
+	suite.Nil(err)
+	suite.Len(objs, 1)
+	suite.Equal("staging", objs[0].GetNamespace())
+}
+
+func (suite *GitRepositorySuite) TestReadNonKalmResources() {
+	suite.commit(map[string]string{
+		"secret.yaml": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: token
+`,
+	})
+
+	repo := &gitRepository{
+		dir:    filepath.Join(suite.tmpDir, "checkout"),
+		url:    suite.bareDir,
+		branch: "master",
+	}
+
+	_, err := repo.Fetch(context.Background())
+	suite.Nil(err)
+
+	_, err = repo.ReadResources("")
+	suite.NotNil(err)
+}
+
+func (suite *GitRepositorySuite) TestFetchUnknownBranch() {
+	suite.commit(map[string]string{"README.md": "# apps"})
+
+	repo := &gitRepository{
+		dir:    filepath.Join(suite.tmpDir, "checkout"),
+		url:    suite.bareDir,
+		branch: "release",
+	}
+
+	_, err := repo.Fetch(context.Background())
+	suite.NotNil(err)
+}
+
+func (suite *GitRepositorySuite) TestFetchOptionLikeBranch() {
+	suite.commit(map[string]string{"README.md": "# apps"})
+
+	pwned := filepath.Join(suite.tmpDir, "pwned")
+
+	repo := &gitRepository{
+		dir:    filepath.Join(suite.tmpDir, "checkout"),
+		url:    suite.bareDir,
+		branch: "--upload-pack=touch " + pwned + "; git-upload-pack",
+	}
+
+	_, err := repo.Fetch(context.Background())
+	suite.NotNil(err)
+
+	_, err = os.Stat(pwned)
+	suite.True(os.IsNotExist(err))
+}
+
+func (suite *GitRepositorySuite) TestSSHRequiresKnownHosts() {
+	repo := &gitRepository{
+		dir:    filepath.Join(suite.tmpDir, "checkout"),
+		url:    "git@github.com:kalmhq/apps.git",
+		branch: "master",
+		secret: &coreV1.Secret{
+			ObjectMeta: metaV1.ObjectMeta{Name: "git"},
+			Data:       map[string][]byte{GitSourceSecretSSHPrivateKey: []byte("key")},
+		},
+	}
+
+	_, err := repo.Fetch(context.Background())
+	suite.EqualError(err, "knownHosts is required in secret git to check the host key")
+}
+
+func TestGitRepositorySuite(t *testing.T) {
+	suite.Run(t, new(GitRepositorySuite))
+}
@@ -45,12 +45,21 @@ const (
 
 const KALM_SSO_GRANTED_GROUPS_HEADER = "kalm-sso-granted-groups"
 const KALM_SSO_USERINFO_HEADER = "kalm-sso-userinfo"
+
+// base64 encoded json of the authorization rules of the protected endpoint
+const KALM_SSO_AUTHORIZATION_RULES_HEADER = "kalm-sso-authorization-rules"
 const KALM_ROUTE_HEADER = "kalm-route"
 const KALM_ALLOW_TO_PASS_IF_HAS_BEARER_TOKEN_HEADER = "allow-to-pass-if-has-bearer-token"
+const KALM_ALLOW_CREDENTIALS_HEADER = "kalm-sso-allow-credentials"
+
+// namespace/name of the protected endpoint, checked against the scopes of the sso credentials
+const KALM_SSO_PROTECTED_ENDPOINT_HEADER = "kalm-sso-protected-endpoint"
 
 var DANGEROUS_HEADERS = []string{
 	KALM_SSO_USERINFO_HEADER,
 	KALM_ALLOW_TO_PASS_IF_HAS_BEARER_TOKEN_HEADER,
+	KALM_ALLOW_CREDENTIALS_HEADER,
+	KALM_SSO_PROTECTED_ENDPOINT_HEADER,
 	KALM_ROUTE_HEADER,
 }
 
@@ -61,6 +70,9 @@ type HttpRouteReconcilerTask struct {
 	gateways                  []v1beta1.Gateway
 	virtualServices           []v1beta1.VirtualService
 	httpsRedirectEnvoyFilters []v1alpha32.EnvoyFilter
+
+	// key is namespace/componentName, value is the percentage of traffic routed to the canary
+	canaryWeights map[string]int
 }
 
 func getIstioHttpRouteName(route *corev1alpha1.HttpRoute) string {
@@ -311,6 +323,12 @@ func (r *HttpRouteReconcilerTask) Run(ctrl.Request) error {
 	}
 	r.httpsRedirectEnvoyFilters = httpsRedirectEnvoyFilters.Items
 
+	var components corev1alpha1.ComponentList
+	if err := r.Reader.List(r.ctx, &components); err != nil {
+		return err
+	}
+	r.canaryWeights = getCanaryWeights(components.Items)
+
 	// Each host will has a virtual service
 	// Kalm will order http route rules, and set them in the virtual service http field.
 	hostVirtualService := make(map[string][]*istioNetworkingV1Beta1.HTTPRoute)
@@ -634,8 +652,10 @@ func toHttpRouteDestination(destination corev1alpha1.HttpRouteDestination, weigh
 func (r *HttpRouteReconcilerTask) BuildDestinations(route *corev1alpha1.HttpRoute) []*istioNetworkingV1Beta1.HTTPRouteDestination {
 	res := make([]*istioNetworkingV1Beta1.HTTPRouteDestination, 0)
 
-	weights := adjustDestinationWeightToSumTo100(route.Spec.Destinations)
-	for i, destination := range route.Spec.Destinations {
+	destinations := splitCanaryDestinations(route.Spec.Destinations, route.Namespace, r.canaryWeights)
+
+	weights := adjustDestinationWeightToSumTo100(destinations)
+	for i, destination := range destinations {
 		weight := weights[i]
 		res = append(res, toHttpRouteDestination(destination, weight, route.Namespace))
 	}
@@ -643,6 +663,80 @@ func (r *HttpRouteReconcilerTask) BuildDestinations(route *corev1alpha1.HttpRout
 	return res
 }
 
+func getCanaryWeights(components []corev1alpha1.Component) map[string]int {
+	res := make(map[string]int)
+
+	for _, component := range components {
+		rollout := component.Status.Rollout
+
+		if !isProgressiveRollout(&component) || rollout == nil || rollout.CanaryWeight <= 0 {
+			continue
+		}
+
+		res[fmt.Sprintf("%s/%s", component.Namespace, component.Name)] = rollout.CanaryWeight
+	}
+
+	return res
+}
+
+// splitCanaryDestinations splits the destinations pointing to a component with a running canary
+// into a stable and a canary destination, the weight of the origin destination is shared between them.
+func splitCanaryDestinations(destinations []corev1alpha1.HttpRouteDestination, namespace string, canaryWeights map[string]int) []corev1alpha1.HttpRouteDestination {
+	if len(canaryWeights) == 0 {
+		return destinations
+	}
+
+	res := make([]corev1alpha1.HttpRouteDestination, 0, len(destinations))
+
+	for _, destination := range destinations {
+		componentName, componentNamespace, canaryHost := parseDestinationComponent(destination.Host, namespace)
+		canaryWeight, exist := canaryWeights[fmt.Sprintf("%s/%s", componentNamespace, componentName)]
+
+		if !exist {
+			res = append(res, destination)
+			continue
+		}
+
+		if stableWeight := destination.Weight * (100 - canaryWeight); stableWeight > 0 {
+			res = append(res, corev1alpha1.HttpRouteDestination{Host: destination.Host, Weight: stableWeight})
+		}
+
+		if weight := destination.Weight * canaryWeight; weight > 0 {
+			res = append(res, corev1alpha1.HttpRouteDestination{Host: canaryHost, Weight: weight})
+		}
+	}
+
+	// all weights are zero, keep the origin destinations
+	if len(res) == 0 {
+		return destinations
+	}
+
+	return res
+}
+
+// parseDestinationComponent finds the component behind a destination host, the host is one of
+// name[:port], name.namespace[:port] or name.namespace.svc.cluster.local[:port].
+// It also returns the host of the canary service of that component.
+func parseDestinationComponent(host, namespace string) (componentName, componentNamespace, canaryHost string) {
+	hostWithoutPort := host
+
+	if colon := strings.LastIndexByte(host, ':'); colon != -1 {
+		hostWithoutPort = host[:colon]
+	}
+
+	parts := strings.Split(hostWithoutPort, ".")
+	componentName = parts[0]
+	componentNamespace = namespace
+
+	if len(parts) > 1 {
+		componentNamespace = parts[1]
+	}
+
+	canaryHost = getCanaryName(componentName) + host[len(componentName):]
+
+	return
+}
+
 func adjustDestinationWeightToSumTo100(destinations []corev1alpha1.HttpRouteDestination) []int32 {
 	var originWeights []int
 	for _, destination := range destinations {
@@ -727,6 +821,7 @@ func NewHttpRouteReconciler(mgr ctrl.Manager) *HttpRouteReconciler {
 type WatchAllKalmGateway struct{}
 type WatchAllKalmVirtualService struct{}
 type WatchAllKalmEnvoyFilter struct{}
+type WatchKalmComponentRollout struct{}
 
 func (*WatchAllKalmGateway) Map(object handler.MapObject) []reconcile.Request {
 	gateway, ok := object.Object.(*v1beta1.Gateway)
@@ -754,6 +849,15 @@ func (*WatchAllKalmEnvoyFilter) Map(object handler.MapObject) []reconcile.Reques
 	return []reconcile.Request{{NamespacedName: types.NamespacedName{}}}
 }
 
+// canary weights of components are rendered into http routes
+func (*WatchKalmComponentRollout) Map(object handler.MapObject) []reconcile.Request {
+	component, ok := object.Object.(*corev1alpha1.Component)
+	if !ok || component.Status.Rollout == nil {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{}}}
+}
+
 func (r *HttpRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1alpha1.HttpRoute{}).
@@ -775,5 +879,11 @@ func (r *HttpRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				ToRequests: &WatchAllKalmEnvoyFilter{},
 			},
 		).
+		Watches(
+			&source.Kind{Type: &corev1alpha1.Component{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: &WatchKalmComponentRollout{},
+			},
+		).
 		Complete(r)
 }
@@ -105,3 +105,26 @@ func TestAdjustWeightToSumTo100(t *testing.T) {
 		assert.True(t, 100 == sum(rst))
 	}
 }
+
+func TestSplitCanaryDestinations(t *testing.T) {
+	destinations := []v1alpha1.HttpRouteDestination{
+		{Host: "foo:80", Weight: 1},
+		{Host: "bar.other.svc.cluster.local:80", Weight: 3},
+	}
+
+	assert.Equal(t, destinations, splitCanaryDestinations(destinations, "ns", nil))
+
+	rst := splitCanaryDestinations(destinations, "ns", map[string]int{"ns/foo": 20, "other/bar": 100})
+	assert.Equal(t, []v1alpha1.HttpRouteDestination{
+		{Host: "foo:80", Weight: 80},
+		{Host: "foo-canary:80", Weight: 20},
+		{Host: "bar-canary.other.svc.cluster.local:80", Weight: 300},
+	}, rst)
+
+	weights := adjustDestinationWeightToSumTo100(rst)
+	assert.Equal(t, []int32{20, 5, 75}, weights)
+
+	// destinations in other namespaces are not affected
+	rst = splitCanaryDestinations(destinations, "ns", map[string]int{"ns/bar": 50})
+	assert.Equal(t, destinations, rst)
+}
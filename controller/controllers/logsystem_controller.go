@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	appsV1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	rbacV1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -27,6 +28,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"strings"
 	"text/template"
 )
@@ -34,6 +37,9 @@ import (
 // LogSystemReconciler reconciles a LogSystem object
 type LogSystemReconciler struct {
 	*BaseReconciler
+
+	// used to read the disk usage of the loki pvc, nil if the usage is not reported
+	queryVolumeStats prometheusScalarQuery
 }
 
 type LogSystemReconcilerTask struct {
@@ -44,19 +50,22 @@ type LogSystemReconcilerTask struct {
 	loki      *corev1alpha1.Component
 	grafana   *corev1alpha1.Component
 	promtail  *corev1alpha1.Component
+	fluentBit *appsV1.DaemonSet
 }
 
 type LogSystemComponentNames struct {
-	Loki     string `json:"loki"`
-	Grafana  string `json:"grafana"`
-	Promtail string `json:"promtail"`
+	Loki      string `json:"loki"`
+	Grafana   string `json:"grafana"`
+	Promtail  string `json:"promtail"`
+	FluentBit string `json:"fluentBit"`
 }
 
 func (r *LogSystemReconcilerTask) getComponentNames() *LogSystemComponentNames {
 	return &LogSystemComponentNames{
-		Loki:     fmt.Sprintf("%s-loki", r.req.Name),
-		Grafana:  fmt.Sprintf("%s-grafana", r.req.Name),
-		Promtail: fmt.Sprintf("%s-promtail", r.req.Name),
+		Loki:      fmt.Sprintf("%s-loki", r.req.Name),
+		Grafana:   fmt.Sprintf("%s-grafana", r.req.Name),
+		Promtail:  fmt.Sprintf("%s-promtail", r.req.Name),
+		FluentBit: fmt.Sprintf("%s-fluent-bit", r.req.Name),
 	}
 }
 
@@ -69,6 +78,11 @@ func (r *LogSystemReconcilerTask) NameToNamespacedName(name string) types.Namesp
 
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=logsystems,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=logsystems/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 
 func (r *LogSystemReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	task := &LogSystemReconcilerTask{
@@ -78,7 +92,13 @@ func (r *LogSystemReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 
 	err := task.Run(req)
-	return ctrl.Result{}, err
+
+	if task.logSystem == nil {
+		return ctrl.Result{}, err
+	}
+
+	// components trigger reconciliations when their status change, but the disk usage doesn't
+	return ctrl.Result{RequeueAfter: logSystemStatusRefreshInterval}, err
 }
 
 func (r *LogSystemReconcilerTask) Run(req ctrl.Request) error {
@@ -90,17 +110,31 @@ func (r *LogSystemReconcilerTask) Run(req ctrl.Request) error {
 		return r.CleanResources()
 	}
 
-	if err := r.ReconcileResources(); err != nil {
-		return err
+	if !r.logSystem.DeletionTimestamp.IsZero() {
+		return r.Finalize()
 	}
 
-	return nil
+	reconcileErr := r.ReconcileResources()
+
+	if err := r.UpdateStatus(reconcileErr); err != nil {
+		r.EmitWarningEvent(r.logSystem, err, "update logsystem status error.")
+
+		if reconcileErr == nil {
+			return err
+		}
+	}
+
+	return reconcileErr
 }
 
 func (r *LogSystemReconcilerTask) ReconcileResources() error {
 	switch r.logSystem.Spec.Stack {
 	case corev1alpha1.LogSystemStackPLGMonolithic:
 		return r.ReconcilePLGMonolithic()
+	case corev1alpha1.LogSystemStackPLGDistributed:
+		return r.ReconcilePLGDistributed()
+	case corev1alpha1.LogSystemStackExternal:
+		return r.ReconcileExternal()
 	default:
 		return fmt.Errorf("This stack is not yet implemented")
 	}
@@ -148,11 +182,11 @@ func (r *LogSystemReconcilerTask) ReconcilePLGMonolithic() error {
 		return err
 	}
 
-	if err := r.ReconcilePLGMonolithicGrafana(); err != nil {
+	if err := r.ReconcilePLGGrafana(); err != nil {
 		return err
 	}
 
-	if err := r.ReconcilePLGMonolithicPromtail(); err != nil {
+	if err := r.ReconcilePLGPromtail(); err != nil {
 		return err
 	}
 
@@ -270,8 +304,9 @@ func (r *LogSystemReconcilerTask) ReconcilePLGMonolithicLoki() error {
 	return nil
 }
 
-func (r *LogSystemReconcilerTask) ReconcilePLGMonolithicGrafana() error {
+func (r *LogSystemReconcilerTask) ReconcilePLGGrafana() error {
 	names := r.getComponentNames()
+	lokiURL, _ := r.getLokiURLs()
 
 	grafanaImage := r.logSystem.Spec.PLGConfig.Grafana.Image
 
@@ -299,16 +334,9 @@ func (r *LogSystemReconcilerTask) ReconcilePLGMonolithicGrafana() error {
 
 			// Use anonymous in this version
 			// Will integrate kalm permission later.
-			// Don't open port to avoid grafana access from outside.
-
-			//Ports: []corev1alpha1.Port{
-			//
-			//	{
-			//		ContainerPort: 3000,
-			//		ServicePort:   3000,
-			//		Protocol:      corev1alpha1.PortProtocolHTTP,
-			//	},
-			//},
+			// Don't open port to avoid grafana access from outside,
+			// anonymous users are admins and can read logs of all namespaces.
+			// Use kubectl port-forward to visit grafana, see LogSystemStatus.GrafanaURL.
 			Env: []corev1alpha1.EnvVar{
 				{
 					Name:  "GF_AUTH_ANONYMOUS_ENABLED",
@@ -356,8 +384,8 @@ datasources:
     type: loki
     access: proxy
     isDefault: true
-    url: http://%s:3100
-`, names.Loki),
+    url: %s
+`, lokiURL),
 					Runnable: false,
 				},
 			},
@@ -387,8 +415,9 @@ datasources:
 	return nil
 }
 
-func (r *LogSystemReconcilerTask) ReconcilePLGMonolithicPromtail() error {
+func (r *LogSystemReconcilerTask) ReconcilePLGPromtail() error {
 	names := r.getComponentNames()
+	_, lokiURL := r.getLokiURLs()
 
 	promtailImage := r.logSystem.Spec.PLGConfig.Promtail.Image
 
@@ -415,7 +444,7 @@ func (r *LogSystemReconcilerTask) ReconcilePLGMonolithicPromtail() error {
 			},
 			Image:        promtailImage,
 			WorkloadType: corev1alpha1.WorkloadTypeDaemonSet,
-			Command:      fmt.Sprintf("promtail -log.level=debug -print-config-stderr -config.file=/etc/promtail/promtail.yaml -client.url=http://%s:3100/loki/api/v1/push", names.Loki),
+			Command:      fmt.Sprintf("promtail -log.level=debug -print-config-stderr -config.file=/etc/promtail/promtail.yaml -client.url=%s/loki/api/v1/push", lokiURL),
 			Ports: []corev1alpha1.Port{
 				{
 					ContainerPort: 3101,
@@ -904,11 +933,18 @@ func (r *LogSystemReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1alpha1.LogSystem{}).
 		Owns(&corev1alpha1.Component{}).
+		Owns(&appsV1.DaemonSet{}).
+		Owns(&appsV1.Deployment{}).
+		Owns(&appsV1.StatefulSet{}).
+		Watches(&source.Kind{Type: &v1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: LogSystemSecretMapper{r.BaseReconciler},
+		}).
 		Complete(r)
 }
 
 func NewLogSystemReconciler(mgr ctrl.Manager) *LogSystemReconciler {
 	return &LogSystemReconciler{
-		BaseReconciler: NewBaseReconciler(mgr, "LogSystem"),
+		BaseReconciler:   NewBaseReconciler(mgr, "LogSystem"),
+		queryVolumeStats: queryPrometheusScalar,
 	}
 }
@@ -0,0 +1,607 @@
+package controllers
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	appsV1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	lokiHTTPPort       = 3100
+	lokiGRPCPort       = 9095
+	lokiMemberlistPort = 7946
+	lokiConfigKey      = "loki.yaml"
+
+	annoLokiConfigHash           = "core.kalm.dev/loki-config-hash"
+	annoLokiStorageSecretVersion = "core.kalm.dev/loki-storage-secret-version"
+
+	KalmLabelLokiTarget     = "kalm-loki-target"
+	KalmLabelLokiMemberlist = "kalm-loki-memberlist"
+
+	lokiTargetDistributor   = "distributor"
+	lokiTargetIngester      = "ingester"
+	lokiTargetQuerier       = "querier"
+	lokiTargetQueryFrontend = "query-frontend"
+	lokiTargetTableManager  = "table-manager"
+)
+
+// lokiTarget is a target of loki running in its own workload in plg-distributed stacks.
+type lokiTarget struct {
+	name          string
+	conditionType corev1alpha1.LogSystemConditionType
+
+	// members of the memberlist share the rings of distributors and ingesters
+	memberlist bool
+}
+
+// ingesters are statefulsets, so they keep the write ahead logs and the unflushed index across restarts
+func (t lokiTarget) workloadKind() string {
+	if t.name == lokiTargetIngester {
+		return logSystemWorkloadStatefulSet
+	}
+
+	return logSystemWorkloadDeployment
+}
+
+var lokiDistributedTargets = []lokiTarget{
+	{name: lokiTargetDistributor, conditionType: corev1alpha1.LogSystemConditionLokiDistributorReady, memberlist: true},
+	{name: lokiTargetIngester, conditionType: corev1alpha1.LogSystemConditionLokiIngesterReady, memberlist: true},
+	{name: lokiTargetQuerier, conditionType: corev1alpha1.LogSystemConditionLokiQuerierReady, memberlist: true},
+	{name: lokiTargetQueryFrontend, conditionType: corev1alpha1.LogSystemConditionLokiQueryFrontendReady},
+	{name: lokiTargetTableManager, conditionType: corev1alpha1.LogSystemConditionLokiTableManagerReady},
+}
+
+func isPLGStack(stack corev1alpha1.LogSystemStack) bool {
+	return stack == corev1alpha1.LogSystemStackPLGMonolithic || stack == corev1alpha1.LogSystemStackPLGDistributed
+}
+
+// getLokiTargetName returns the name of the workload of a loki target, e.g. log-loki-ingester
+func (r *LogSystemReconcilerTask) getLokiTargetName(target string) string {
+	return fmt.Sprintf("%s-%s", r.getComponentNames().Loki, target)
+}
+
+func (r *LogSystemReconcilerTask) getLokiMemberlistName() string {
+	return r.getLokiTargetName("memberlist")
+}
+
+// getLokiURLs returns the address grafana queries and the one promtail pushes to.
+func (r *LogSystemReconcilerTask) getLokiURLs() (queryURL, pushURL string) {
+	if r.logSystem.Spec.Stack == corev1alpha1.LogSystemStackPLGDistributed {
+		return fmt.Sprintf("http://%s:%d", r.getLokiTargetName(lokiTargetQueryFrontend), lokiHTTPPort),
+			fmt.Sprintf("http://%s:%d", r.getLokiTargetName(lokiTargetDistributor), lokiHTTPPort)
+	}
+
+	lokiURL := fmt.Sprintf("http://%s:%d", r.getComponentNames().Loki, lokiHTTPPort)
+
+	return lokiURL, lokiURL
+}
+
+func (r *LogSystemReconcilerTask) LoadPLGDistributedResources() error {
+	names := r.getComponentNames()
+
+	var grafana corev1alpha1.Component
+	if err := r.Get(r.ctx, r.NameToNamespacedName(names.Grafana), &grafana); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	r.grafana = &grafana
+
+	var promtail corev1alpha1.Component
+	if err := r.Get(r.ctx, r.NameToNamespacedName(names.Promtail), &promtail); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	r.promtail = &promtail
+
+	return nil
+}
+
+func (r *LogSystemReconcilerTask) ReconcilePLGDistributed() error {
+	if err := r.LoadPLGDistributedResources(); err != nil {
+		return err
+	}
+
+	if err := r.ReconcilePLGDistributedLoki(); err != nil {
+		return err
+	}
+
+	if err := r.ReconcilePLGGrafana(); err != nil {
+		return err
+	}
+
+	if err := r.ReconcilePLGPromtail(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// loadLokiStorageSecretEnvs returns the envs of the aws credentials referencing the secret of the object storage,
+// and the version of the secret. Both are empty if no secret is set.
+func (r *LogSystemReconcilerTask) loadLokiStorageSecretEnvs() ([]v1.EnvVar, string, error) {
+	secretName := r.logSystem.Spec.PLGConfig.Loki.Distributed.ObjectStorage.SecretName
+
+	if secretName == "" {
+		return nil, "", nil
+	}
+
+	var secret v1.Secret
+
+	if err := r.Get(r.ctx, types.NamespacedName{Namespace: r.req.Namespace, Name: secretName}, &secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, "", fmt.Errorf("secret %s of the loki object storage is not found in %s namespace", secretName, r.req.Namespace)
+		}
+
+		return nil, "", err
+	}
+
+	var envs []v1.EnvVar
+
+	for _, key := range logSinkSecretKeys[corev1alpha1.LogSinkTypeS3] {
+		if _, exist := secret.Data[key]; !exist {
+			continue
+		}
+
+		envs = append(envs, v1.EnvVar{
+			Name: s3SecretKeyEnvs[key],
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: secretName},
+					Key:                  key,
+				},
+			},
+		})
+	}
+
+	return envs, secret.ResourceVersion, nil
+}
+
+// ReconcilePLGDistributedLoki deploys each target of loki as a workload owned by the LogSystem.
+// They read the same config, and find each other through the memberlist service.
+func (r *LogSystemReconcilerTask) ReconcilePLGDistributedLoki() error {
+	envs, secretVersion, err := r.loadLokiStorageSecretEnvs()
+
+	if err != nil {
+		r.EmitWarningEvent(r.logSystem, err, "unable to load secret of the loki object storage")
+		return err
+	}
+
+	config := r.GetPLGDistributedLokiConfig()
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.req.Namespace,
+			Name:      r.getComponentNames().Loki,
+		},
+	}
+
+	if _, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, configMap, func() error {
+		configMap.Data = map[string]string{lokiConfigKey: config}
+		return ctrl.SetControllerReference(r.logSystem, configMap, r.Scheme)
+	}); err != nil {
+		r.EmitWarningEvent(r.logSystem, err, "unable to reconcile config of loki")
+		return err
+	}
+
+	if err := r.reconcileLokiServices(); err != nil {
+		r.EmitWarningEvent(r.logSystem, err, "unable to reconcile services of loki")
+		return err
+	}
+
+	annotations := map[string]string{
+		"sidecar.istio.io/inject": "false",
+		// neither envs referencing secrets nor files mounted with sub paths are updated in running pods,
+		// restart them once the secret or the config changes
+		annoLokiStorageSecretVersion: secretVersion,
+		annoLokiConfigHash:           fmt.Sprintf("%x", md5.Sum([]byte(config))),
+	}
+
+	for _, target := range lokiDistributedTargets {
+		if err := r.reconcileLokiTarget(target, envs, annotations); err != nil {
+			r.EmitWarningEvent(r.logSystem, err, fmt.Sprintf("unable to reconcile loki %s", target.name))
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *LogSystemReconcilerTask) getLokiTargetLabels(target string) map[string]string {
+	return map[string]string{
+		KalmLabelLogSystem:  r.req.Name,
+		KalmLabelLokiTarget: target,
+	}
+}
+
+// reconcileLokiServices creates the services used by grafana, promtail and the targets of loki.
+func (r *LogSystemReconcilerTask) reconcileLokiServices() error {
+	// the query frontend is headless, so the workers of queriers connect to all of its pods
+	services := []struct {
+		name     string
+		headless bool
+		notReady bool
+		selector map[string]string
+		ports    []v1.ServicePort
+	}{
+		{
+			name:     r.getLokiTargetName(lokiTargetDistributor),
+			selector: r.getLokiTargetLabels(lokiTargetDistributor),
+			ports: []v1.ServicePort{
+				{Name: "http", Port: lokiHTTPPort, TargetPort: intstr.FromInt(lokiHTTPPort), Protocol: v1.ProtocolTCP},
+			},
+		},
+		{
+			name:     r.getLokiTargetName(lokiTargetQueryFrontend),
+			headless: true,
+			selector: r.getLokiTargetLabels(lokiTargetQueryFrontend),
+			ports: []v1.ServicePort{
+				{Name: "http", Port: lokiHTTPPort, TargetPort: intstr.FromInt(lokiHTTPPort), Protocol: v1.ProtocolTCP},
+				{Name: "grpc", Port: lokiGRPCPort, TargetPort: intstr.FromInt(lokiGRPCPort), Protocol: v1.ProtocolTCP},
+			},
+		},
+		{
+			// members join the memberlist before they are ready
+			name:     r.getLokiMemberlistName(),
+			headless: true,
+			notReady: true,
+			selector: map[string]string{KalmLabelLogSystem: r.req.Name, KalmLabelLokiMemberlist: "true"},
+			ports: []v1.ServicePort{
+				{Name: "memberlist", Port: lokiMemberlistPort, TargetPort: intstr.FromInt(lokiMemberlistPort), Protocol: v1.ProtocolTCP},
+			},
+		},
+	}
+
+	for _, s := range services {
+		service := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: r.req.Namespace,
+				Name:      s.name,
+			},
+		}
+
+		if _, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, service, func() error {
+			service.Labels = map[string]string{KalmLabelLogSystem: r.req.Name}
+
+			// the cluster ip is immutable
+			if service.CreationTimestamp.IsZero() && s.headless {
+				service.Spec.ClusterIP = v1.ClusterIPNone
+			}
+
+			service.Spec.Selector = s.selector
+			service.Spec.Ports = s.ports
+			service.Spec.PublishNotReadyAddresses = s.notReady
+
+			return ctrl.SetControllerReference(r.logSystem, service, r.Scheme)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *LogSystemReconcilerTask) getLokiTargetReplicas(target string) int32 {
+	config := r.logSystem.Spec.PLGConfig.Loki.Distributed
+
+	switch target {
+	case lokiTargetDistributor:
+		return config.DistributorReplicas
+	case lokiTargetIngester:
+		return config.IngesterReplicas
+	case lokiTargetQuerier:
+		return config.QuerierReplicas
+	case lokiTargetQueryFrontend:
+		return config.QueryFrontendReplicas
+	default:
+		// retention is applied by a single table manager
+		return 1
+	}
+}
+
+func (r *LogSystemReconcilerTask) getLokiTargetPodSpec(target lokiTarget, image string, envs []v1.EnvVar) v1.PodSpec {
+	rootID := int64(0)
+
+	ports := []v1.ContainerPort{
+		{Name: "http", ContainerPort: lokiHTTPPort, Protocol: v1.ProtocolTCP},
+		{Name: "grpc", ContainerPort: lokiGRPCPort, Protocol: v1.ProtocolTCP},
+	}
+
+	if target.memberlist {
+		ports = append(ports, v1.ContainerPort{Name: "memberlist", ContainerPort: lokiMemberlistPort, Protocol: v1.ProtocolTCP})
+	}
+
+	podSpec := v1.PodSpec{
+		// the same as plg-monolithic stacks, loki writes the data directory as root
+		SecurityContext: &v1.PodSecurityContext{RunAsUser: &rootID, RunAsGroup: &rootID},
+		Containers: []v1.Container{
+			{
+				Name:  "loki",
+				Image: image,
+				Args:  []string{"-config.file=/etc/loki/" + lokiConfigKey, "-target=" + target.name},
+				Ports: ports,
+				Env:   envs,
+				ReadinessProbe: &v1.Probe{
+					InitialDelaySeconds: 15,
+					PeriodSeconds:       10,
+					SuccessThreshold:    1,
+					TimeoutSeconds:      1,
+					FailureThreshold:    3,
+					Handler: v1.Handler{
+						HTTPGet: &v1.HTTPGetAction{
+							Path:   "/ready",
+							Port:   intstr.FromInt(lokiHTTPPort),
+							Scheme: v1.URISchemeHTTP,
+						},
+					},
+				},
+				VolumeMounts: []v1.VolumeMount{
+					{Name: "config", MountPath: "/etc/loki/" + lokiConfigKey, SubPath: lokiConfigKey, ReadOnly: true},
+					{Name: "data", MountPath: "/data"},
+				},
+			},
+		},
+		Volumes: []v1.Volume{
+			{
+				Name: "config",
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: r.getComponentNames().Loki}},
+				},
+			},
+		},
+	}
+
+	if target.workloadKind() != logSystemWorkloadStatefulSet {
+		// only the index cache of queriers and table managers lives here, ingesters use volume claim templates
+		podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+			Name:         "data",
+			VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+		})
+	}
+
+	if target.name == lokiTargetIngester {
+		// give ingesters time to flush chunks to the object storage
+		gracePeriod := int64(300)
+		podSpec.TerminationGracePeriodSeconds = &gracePeriod
+	}
+
+	return podSpec
+}
+
+func (r *LogSystemReconcilerTask) reconcileLokiTarget(target lokiTarget, envs []v1.EnvVar, annotations map[string]string) error {
+	name := r.getLokiTargetName(target.name)
+	selector := r.getLokiTargetLabels(target.name)
+	replicas := r.getLokiTargetReplicas(target.name)
+
+	labels := r.getLokiTargetLabels(target.name)
+
+	if target.memberlist {
+		labels[KalmLabelLokiMemberlist] = "true"
+	}
+
+	image := r.logSystem.Spec.PLGConfig.Loki.Image
+
+	if image == "" {
+		image = corev1alpha1.LokiImage
+	}
+
+	// Use the old image if exists
+	// make sure we won't update loki image implicitly
+	existingImage := func(podSpec v1.PodSpec) string {
+		if len(podSpec.Containers) > 0 {
+			return podSpec.Containers[0].Image
+		}
+
+		return image
+	}
+
+	if target.workloadKind() == logSystemWorkloadStatefulSet {
+		// the storage class of loki overwrites the one of the LogSystem
+		storageClass := r.logSystem.Spec.PLGConfig.Loki.StorageClass
+
+		if storageClass == nil {
+			storageClass = r.logSystem.Spec.StorageClass
+		}
+
+		statefulSet := &appsV1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: r.req.Namespace,
+				Name:      name,
+			},
+		}
+
+		_, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, statefulSet, func() error {
+			statefulSet.Labels = labels
+
+			// the selector, the service name and the volume claim templates are immutable
+			if statefulSet.CreationTimestamp.IsZero() {
+				statefulSet.Spec.Selector = &metav1.LabelSelector{MatchLabels: selector}
+				statefulSet.Spec.ServiceName = r.getLokiMemberlistName()
+				statefulSet.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{
+					{
+						ObjectMeta: metav1.ObjectMeta{Name: "data"},
+						Spec: v1.PersistentVolumeClaimSpec{
+							AccessModes:      []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+							StorageClassName: storageClass,
+							Resources: v1.ResourceRequirements{
+								Requests: v1.ResourceList{v1.ResourceStorage: *r.logSystem.Spec.PLGConfig.Loki.DiskSize},
+							},
+						},
+					},
+				}
+			}
+
+			statefulSet.Spec.Replicas = &replicas
+			statefulSet.Spec.Template.Labels = labels
+			statefulSet.Spec.Template.Annotations = annotations
+			statefulSet.Spec.Template.Spec = r.getLokiTargetPodSpec(target, existingImage(statefulSet.Spec.Template.Spec), envs)
+
+			return ctrl.SetControllerReference(r.logSystem, statefulSet, r.Scheme)
+		})
+
+		return err
+	}
+
+	deployment := &appsV1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.req.Namespace,
+			Name:      name,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, deployment, func() error {
+		deployment.Labels = labels
+
+		// the selector is immutable
+		if deployment.CreationTimestamp.IsZero() {
+			deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: selector}
+		}
+
+		deployment.Spec.Replicas = &replicas
+		deployment.Spec.Template.Labels = labels
+		deployment.Spec.Template.Annotations = annotations
+		deployment.Spec.Template.Spec = r.getLokiTargetPodSpec(target, existingImage(deployment.Spec.Template.Spec), envs)
+
+		return ctrl.SetControllerReference(r.logSystem, deployment, r.Scheme)
+	})
+
+	return err
+}
+
+// GetPLGDistributedLokiConfig returns the config shared by all targets of loki.
+// Chunks and the index are stored in the object storage through the boltdb shipper.
+func (r *LogSystemReconcilerTask) GetPLGDistributedLokiConfig() string {
+	lokiConfig := r.logSystem.Spec.PLGConfig.Loki
+	storage := lokiConfig.Distributed.ObjectStorage
+
+	var retention_deletes_enabled bool
+	var retention_period, max_look_back_period, reject_old_samples_max_age string
+
+	if lokiConfig.RetentionDays == 0 {
+		retention_deletes_enabled = false
+		retention_period = "0s"
+		max_look_back_period = "0s"
+		reject_old_samples_max_age = "0s"
+	} else {
+		days := lokiConfig.RetentionDays
+		retention_deletes_enabled = true
+		retention_period = fmt.Sprintf("%dh", days*24)
+		max_look_back_period = fmt.Sprintf("%dh", days*24)
+		reject_old_samples_max_age = fmt.Sprintf("%dh", days*24)
+	}
+
+	// logs are replicated to at most 3 ingesters
+	replicationFactor := lokiConfig.Distributed.IngesterReplicas
+
+	if replicationFactor > 3 {
+		replicationFactor = 3
+	}
+
+	// loki connects to the host of the endpoint, with https unless it's insecure
+	var endpoint string
+	var insecure bool
+
+	if storage.Endpoint != "" {
+		if u, err := url.Parse(storage.Endpoint); err == nil {
+			endpoint = u.Host
+			insecure = u.Scheme == "http"
+		}
+	}
+
+	data := map[string]interface{}{
+		"memberlist":                 fmt.Sprintf("%s:%d", r.getLokiMemberlistName(), lokiMemberlistPort),
+		"query_frontend":             fmt.Sprintf("%s:%d", r.getLokiTargetName(lokiTargetQueryFrontend), lokiGRPCPort),
+		"replication_factor":         replicationFactor,
+		"bucket":                     storage.Bucket,
+		"region":                     storage.Region,
+		"endpoint":                   endpoint,
+		"insecure":                   insecure,
+		"retention_deletes_enabled":  retention_deletes_enabled,
+		"retention_period":           retention_period,
+		"max_look_back_period":       max_look_back_period,
+		"reject_old_samples_max_age": reject_old_samples_max_age,
+	}
+
+	t := template.Must(template.New("loki-distributed-config").Parse(`auth_enabled: false
+server:
+  http_listen_port: 3100
+  grpc_listen_port: 9095
+memberlist:
+  join_members:
+    - {{ .memberlist }}
+distributor:
+  ring:
+    kvstore:
+      store: memberlist
+ingester:
+  lifecycler:
+    ring:
+      kvstore:
+        store: memberlist
+      replication_factor: {{ .replication_factor }}
+    final_sleep: 0s
+  chunk_idle_period: 5m
+  chunk_retain_period: 30s
+  max_transfer_retries: 0
+schema_config:
+  configs:
+    - from: 2020-10-01
+      store: boltdb-shipper
+      object_store: aws
+      schema: v11
+      index:
+        prefix: index_
+        period: 24h
+storage_config:
+  boltdb_shipper:
+    active_index_directory: /data/loki/index
+    cache_location: /data/loki/cache
+    shared_store: aws
+  aws:
+    bucketnames: {{ printf "%q" .bucket }}
+    region: {{ printf "%q" .region }}
+{{- if .endpoint }}
+    endpoint: {{ printf "%q" .endpoint }}
+    insecure: {{ .insecure }}
+    s3forcepathstyle: true
+{{- end }}
+frontend:
+  compress_responses: true
+frontend_worker:
+  frontend_address: {{ .query_frontend }}
+query_range:
+  split_queries_by_interval: 24h
+  align_queries_with_step: true
+  max_retries: 5
+limits_config:
+  enforce_metric_name: false
+  reject_old_samples: true
+  reject_old_samples_max_age: {{ .reject_old_samples_max_age }}
+chunk_store_config:
+  max_look_back_period: {{ .max_look_back_period }}
+table_manager:
+  retention_deletes_enabled: {{ .retention_deletes_enabled }}
+  retention_period: {{ .retention_period }}
+`))
+
+	strBuffer := &strings.Builder{}
+
+	_ = t.Execute(strBuffer, data)
+
+	return strBuffer.String()
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newPLGDistributedLogSystem() *v1alpha1.LogSystem {
+	diskSize := resource.MustParse(v1alpha1.DefaultLokiDiskSize)
+
+	return &v1alpha1.LogSystem{
+		ObjectMeta: metaV1.ObjectMeta{Name: "log", Namespace: "kalm-log"},
+		Spec: v1alpha1.LogSystemSpec{
+			Stack: v1alpha1.LogSystemStackPLGDistributed,
+			PLGConfig: &v1alpha1.PLGConfig{
+				Loki: &v1alpha1.LokiConfig{
+					RetentionDays: 7,
+					DiskSize:      &diskSize,
+					Image:         v1alpha1.LokiImage,
+					Distributed: &v1alpha1.LokiDistributedConfig{
+						ObjectStorage: &v1alpha1.LokiObjectStorageConfig{
+							Bucket:     "kalm-logs",
+							Region:     "us-east-1",
+							Endpoint:   "http://minio.minio:9000",
+							SecretName: "loki-storage",
+						},
+						IngesterReplicas:      5,
+						DistributorReplicas:   2,
+						QuerierReplicas:       2,
+						QueryFrontendReplicas: 1,
+					},
+				},
+				Grafana:  &v1alpha1.GrafanaConfig{Image: v1alpha1.GrafanaImage},
+				Promtail: &v1alpha1.PromtailConfig{Image: v1alpha1.PromtailImage},
+			},
+		},
+	}
+}
+
+func TestGetPLGDistributedLokiConfig(t *testing.T) {
+	task := &LogSystemReconcilerTask{
+		req:       &ctrl.Request{NamespacedName: types.NamespacedName{Name: "log", Namespace: "kalm-log"}},
+		logSystem: newPLGDistributedLogSystem(),
+	}
+
+	config := task.GetPLGDistributedLokiConfig()
+
+	assert.Contains(t, config, "    - log-loki-memberlist:7946\n")
+	assert.Contains(t, config, "  frontend_address: log-loki-query-frontend:9095\n")
+	// logs are replicated to at most 3 ingesters
+	assert.Contains(t, config, "      replication_factor: 3\n")
+	assert.Contains(t, config, "    bucketnames: \"kalm-logs\"\n")
+	assert.Contains(t, config, "    endpoint: \"minio.minio:9000\"\n    insecure: true\n")
+	assert.Contains(t, config, "  retention_period: 168h\n")
+
+	task.logSystem.Spec.PLGConfig.Loki.Distributed.ObjectStorage.Endpoint = ""
+	task.logSystem.Spec.PLGConfig.Loki.Distributed.IngesterReplicas = 1
+
+	config = task.GetPLGDistributedLokiConfig()
+	assert.NotContains(t, config, "endpoint:")
+	assert.Contains(t, config, "      replication_factor: 1\n")
+}
+
+func TestReconcilePLGDistributed(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme))
+	assert.Nil(t, v1alpha1.AddToScheme(scheme))
+
+	logSystem := newPLGDistributedLogSystem()
+
+	secret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: "loki-storage", Namespace: "kalm-log"},
+		Data:       map[string][]byte{"accessKeyID": []byte("id"), "secretAccessKey": []byte("s3cr3t")},
+	}
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme, logSystem, secret)
+
+	task := &LogSystemReconcilerTask{
+		LogSystemReconciler: &LogSystemReconciler{BaseReconciler: &BaseReconciler{
+			Client:   fakeClient,
+			Reader:   fakeClient,
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}},
+		ctx:       context.Background(),
+		req:       &ctrl.Request{NamespacedName: types.NamespacedName{Name: "log", Namespace: "kalm-log"}},
+		logSystem: logSystem,
+	}
+
+	assert.Nil(t, task.ReconcilePLGDistributed())
+
+	var ingester appsV1.StatefulSet
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "log-loki-ingester", Namespace: "kalm-log"}, &ingester))
+	assert.Equal(t, int32(5), *ingester.Spec.Replicas)
+	assert.Equal(t, "log-loki-memberlist", ingester.Spec.ServiceName)
+	assert.Len(t, ingester.Spec.VolumeClaimTemplates, 1)
+	assert.True(t, metaV1.IsControlledBy(&ingester, logSystem))
+
+	container := ingester.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []string{"-config.file=/etc/loki/loki.yaml", "-target=ingester"}, container.Args)
+	assert.Len(t, container.Env, 2)
+	assert.Equal(t, "AWS_SECRET_ACCESS_KEY", container.Env[1].Name)
+	assert.Equal(t, "loki-storage", container.Env[1].ValueFrom.SecretKeyRef.Name)
+
+	for _, target := range []string{"distributor", "querier", "query-frontend", "table-manager"} {
+		var deployment appsV1.Deployment
+		assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "log-loki-" + target, Namespace: "kalm-log"}, &deployment))
+		assert.Equal(t, "-target="+target, deployment.Spec.Template.Spec.Containers[0].Args[1])
+	}
+
+	var memberlist coreV1.Service
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "log-loki-memberlist", Namespace: "kalm-log"}, &memberlist))
+	assert.Equal(t, coreV1.ClusterIPNone, memberlist.Spec.ClusterIP)
+	assert.True(t, memberlist.Spec.PublishNotReadyAddresses)
+
+	// the secret value is in neither the workloads nor the config
+	var configMap coreV1.ConfigMap
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "log-loki", Namespace: "kalm-log"}, &configMap))
+	assert.NotContains(t, configMap.Data["loki.yaml"], "s3cr3t")
+
+	// grafana queries the query frontend, promtail pushes to distributors
+	var grafana v1alpha1.Component
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "log-grafana", Namespace: "kalm-log"}, &grafana))
+	assert.Contains(t, grafana.Spec.PreInjectedFiles[0].Content, "url: http://log-loki-query-frontend:3100\n")
+
+	var promtail v1alpha1.Component
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "log-promtail", Namespace: "kalm-log"}, &promtail))
+	assert.Contains(t, promtail.Spec.Command, "-client.url=http://log-loki-distributor:3100/loki/api/v1/push")
+
+	components, err := task.getStackComponents()
+	assert.Nil(t, err)
+	assert.Len(t, components, 7)
+}
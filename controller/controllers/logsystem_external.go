@@ -0,0 +1,679 @@
+package controllers
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"strings"
+	"unicode"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/kalmhq/kalm/controller/utils"
+	appsV1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacV1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	fluentBitHTTPPort  = 2020
+	fluentBitConfigKey = "fluent-bit.conf"
+
+	annoLogSinkSecretsVersion = "core.kalm.dev/log-sink-secrets-version"
+	annoFluentBitConfigHash   = "core.kalm.dev/fluent-bit-config-hash"
+
+	KalmLabelLogSystem = "kalm-log-system"
+
+	logSystemFinalizerName = "logsystem.finalizers.kalm.dev"
+)
+
+// rules of the cluster role of fluent bit, the kubernetes filter reads metadata of pods
+var fluentBitPolicyRules = []rbacV1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"namespaces", "pods"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+}
+
+// keys read from the secret of each sink type
+var logSinkSecretKeys = map[corev1alpha1.LogSinkType][]string{
+	corev1alpha1.LogSinkTypeElasticsearch: {"username", "password"},
+	corev1alpha1.LogSinkTypeHTTP:          {"username", "password", "token"},
+	corev1alpha1.LogSinkTypeS3:            {"accessKeyID", "secretAccessKey"},
+	corev1alpha1.LogSinkTypeLoki:          {"username", "password"},
+}
+
+// the s3 output of fluent bit only reads credentials from the standard aws envs
+var s3SecretKeyEnvs = map[string]string{
+	"accessKeyID":     "AWS_ACCESS_KEY_ID",
+	"secretAccessKey": "AWS_SECRET_ACCESS_KEY",
+}
+
+// logSinkSecrets are the keys present in the secrets of sinks, by sink name.
+// Values are never read, fluent bit gets them from envs referencing the secrets.
+type logSinkSecrets map[string]map[string]bool
+
+func (s logSinkSecrets) has(sinkName, key string) bool {
+	return s[sinkName][key]
+}
+
+// getLogSinkSecretEnvName returns the env holding a secret value of a sink.
+// The fluent bit config refers to it as ${ENV}, so the value never appears in the config.
+func getLogSinkSecretEnvName(sink corev1alpha1.LogSink, key string) string {
+	if sink.Type == corev1alpha1.LogSinkTypeS3 {
+		return s3SecretKeyEnvs[key]
+	}
+
+	name := strings.ToUpper(strings.ReplaceAll(sink.Name, "-", "_"))
+	return fmt.Sprintf("LOG_SINK_%s_%s", name, strings.ToUpper(key))
+}
+
+func getLogSinkSecretName(sink corev1alpha1.LogSink) string {
+	switch {
+	case sink.Type == corev1alpha1.LogSinkTypeElasticsearch && sink.Elasticsearch != nil:
+		return sink.Elasticsearch.SecretName
+	case sink.Type == corev1alpha1.LogSinkTypeHTTP && sink.HTTP != nil:
+		return sink.HTTP.SecretName
+	case sink.Type == corev1alpha1.LogSinkTypeS3 && sink.S3 != nil:
+		return sink.S3.SecretName
+	case sink.Type == corev1alpha1.LogSinkTypeLoki && sink.Loki != nil:
+		return sink.Loki.SecretName
+	}
+
+	return ""
+}
+
+// getLogSinkSecretEnvs returns envs of the fluent bit daemonset referencing the secrets of the sinks,
+// so the values stay in the secrets instead of the daemonset spec.
+func getLogSinkSecretEnvs(sinks []corev1alpha1.LogSink, secrets logSinkSecrets) []v1.EnvVar {
+	var envs []v1.EnvVar
+
+	for _, sink := range sinks {
+		for _, key := range logSinkSecretKeys[sink.Type] {
+			if !secrets.has(sink.Name, key) {
+				continue
+			}
+
+			envs = append(envs, v1.EnvVar{
+				Name: getLogSinkSecretEnvName(sink, key),
+				ValueFrom: &v1.EnvVarSource{
+					SecretKeyRef: &v1.SecretKeySelector{
+						LocalObjectReference: v1.LocalObjectReference{Name: getLogSinkSecretName(sink)},
+						Key:                  key,
+					},
+				},
+			})
+		}
+	}
+
+	return envs
+}
+
+// loadLogSinkSecrets reads the secrets of the sinks, which must be in the namespace of the LogSystem.
+// The returned version changes when any of the secrets changes.
+func (r *LogSystemReconcilerTask) loadLogSinkSecrets() (logSinkSecrets, string, error) {
+	secrets := make(logSinkSecrets)
+	var versions []string
+
+	for _, sink := range r.logSystem.Spec.ExternalConfig.Sinks {
+		secretName := getLogSinkSecretName(sink)
+
+		if secretName == "" {
+			continue
+		}
+
+		var secret v1.Secret
+
+		if err := r.Get(r.ctx, types.NamespacedName{Namespace: r.req.Namespace, Name: secretName}, &secret); err != nil {
+			if errors.IsNotFound(err) {
+				return nil, "", fmt.Errorf("secret %s of sink %s is not found in %s namespace", secretName, sink.Name, r.req.Namespace)
+			}
+
+			return nil, "", err
+		}
+
+		versions = append(versions, secretName+"="+secret.ResourceVersion)
+
+		keys := make(map[string]bool)
+
+		for _, key := range logSinkSecretKeys[sink.Type] {
+			if _, exist := secret.Data[key]; exist {
+				keys[key] = true
+			}
+		}
+
+		secrets[sink.Name] = keys
+	}
+
+	return secrets, strings.Join(versions, ","), nil
+}
+
+func (r *LogSystemReconcilerTask) LoadExternalResources() error {
+	names := r.getComponentNames()
+
+	var fluentBit appsV1.DaemonSet
+	if err := r.Get(r.ctx, r.NameToNamespacedName(names.FluentBit), &fluentBit); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	r.fluentBit = &fluentBit
+
+	return nil
+}
+
+func (r *LogSystemReconcilerTask) ReconcileExternal() error {
+	if err := r.LoadExternalResources(); err != nil {
+		return err
+	}
+
+	return r.ReconcileExternalFluentBit()
+}
+
+// getFluentBitClusterRoleName returns the name of the cluster role and its binding,
+// which are cluster scoped and can't be owned by the LogSystem.
+func (r *LogSystemReconcilerTask) getFluentBitClusterRoleName() string {
+	return fmt.Sprintf("kalm-log-%s-%s", r.req.Namespace, r.getComponentNames().FluentBit)
+}
+
+// ReconcileExternalFluentBit deploys fluent bit as a daemonset instead of a component,
+// its envs reference the secrets of the sinks, which components can't express.
+func (r *LogSystemReconcilerTask) ReconcileExternalFluentBit() error {
+	names := r.getComponentNames()
+
+	fluentBitImage := r.logSystem.Spec.ExternalConfig.FluentBit.Image
+
+	if fluentBitImage == "" {
+		fluentBitImage = corev1alpha1.FluentBitImage
+	}
+
+	if r.fluentBit != nil && len(r.fluentBit.Spec.Template.Spec.Containers) > 0 {
+		// Use the old image if exists
+		// make sure we won't update fluent bit image implicitly
+		fluentBitImage = r.fluentBit.Spec.Template.Spec.Containers[0].Image
+	}
+
+	secrets, secretsVersion, err := r.loadLogSinkSecrets()
+
+	if err != nil {
+		r.EmitWarningEvent(r.logSystem, err, "unable to load secrets of log sinks")
+		return err
+	}
+
+	if err := r.reconcileFluentBitPermission(); err != nil {
+		r.EmitWarningEvent(r.logSystem, err, "unable to reconcile permission of fluent bit")
+		return err
+	}
+
+	sinks := r.logSystem.Spec.ExternalConfig.Sinks
+	config := GetFluentBitConfig(sinks, secrets)
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.req.Namespace,
+			Name:      names.FluentBit,
+		},
+	}
+
+	if _, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, configMap, func() error {
+		configMap.Data = map[string]string{fluentBitConfigKey: config}
+		return ctrl.SetControllerReference(r.logSystem, configMap, r.Scheme)
+	}); err != nil {
+		r.EmitWarningEvent(r.logSystem, err, "unable to reconcile config of fluent bit")
+		return err
+	}
+
+	labels := map[string]string{
+		KalmLabelLogSystem: r.req.Name,
+		"app":              names.FluentBit,
+	}
+
+	hostPathVolume := func(name, path string) v1.Volume {
+		return v1.Volume{
+			Name:         name,
+			VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: path}},
+		}
+	}
+
+	podSpec := v1.PodSpec{
+		ServiceAccountName: names.FluentBit,
+		Containers: []v1.Container{
+			{
+				Name:  "fluent-bit",
+				Image: fluentBitImage,
+				// no command, the image is distroless and its default command reads the mounted config
+				Ports: []v1.ContainerPort{
+					{
+						Name:          "http",
+						ContainerPort: fluentBitHTTPPort,
+						Protocol:      v1.ProtocolTCP,
+					},
+				},
+				Env: getLogSinkSecretEnvs(sinks, secrets),
+				ReadinessProbe: &v1.Probe{
+					PeriodSeconds:       10,
+					SuccessThreshold:    1,
+					TimeoutSeconds:      1,
+					FailureThreshold:    5,
+					InitialDelaySeconds: 10,
+					Handler: v1.Handler{
+						HTTPGet: &v1.HTTPGetAction{
+							Path:   "/",
+							Port:   intstr.FromInt(fluentBitHTTPPort),
+							Scheme: v1.URISchemeHTTP,
+						},
+					},
+				},
+				VolumeMounts: []v1.VolumeMount{
+					{Name: "config", MountPath: "/fluent-bit/etc/" + fluentBitConfigKey, SubPath: fluentBitConfigKey, ReadOnly: true},
+					{Name: "var-log", MountPath: "/var/log"},
+					{Name: "docker-containers", MountPath: "/var/lib/docker/containers", ReadOnly: true},
+					{Name: "run", MountPath: "/run/fluent-bit"},
+				},
+			},
+		},
+		Volumes: []v1.Volume{
+			{
+				Name: "config",
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: names.FluentBit}},
+				},
+			},
+			hostPathVolume("var-log", "/var/log"),
+			hostPathVolume("docker-containers", "/var/lib/docker/containers"),
+			hostPathVolume("run", "/run/fluent-bit"),
+		},
+	}
+
+	daemonSet := &appsV1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.req.Namespace,
+			Name:      names.FluentBit,
+		},
+	}
+
+	if _, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, daemonSet, func() error {
+		daemonSet.Labels = labels
+
+		// the selector is immutable
+		if daemonSet.CreationTimestamp.IsZero() {
+			daemonSet.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+		}
+
+		daemonSet.Spec.Template.Labels = labels
+		daemonSet.Spec.Template.Annotations = map[string]string{
+			"sidecar.istio.io/inject": "false",
+			// neither envs referencing secrets nor files mounted with sub paths are updated in running pods,
+			// restart them once a secret or the config changes
+			annoLogSinkSecretsVersion: secretsVersion,
+			annoFluentBitConfigHash:   fmt.Sprintf("%x", md5.Sum([]byte(config))),
+		}
+		daemonSet.Spec.Template.Spec = podSpec
+
+		return ctrl.SetControllerReference(r.logSystem, daemonSet, r.Scheme)
+	}); err != nil {
+		r.EmitWarningEvent(r.logSystem, err, "unable to reconcile fluent bit daemonset")
+		return err
+	}
+
+	r.fluentBit = daemonSet
+
+	return nil
+}
+
+// reconcileFluentBitPermission binds the cluster role of fluent bit to its service account.
+// The cluster scoped ones are deleted by the finalizer of the LogSystem.
+func (r *LogSystemReconcilerTask) reconcileFluentBitPermission() error {
+	if err := r.addFinalizer(); err != nil {
+		return err
+	}
+
+	names := r.getComponentNames()
+	clusterRoleName := r.getFluentBitClusterRoleName()
+
+	serviceAccount := &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.req.Namespace,
+			Name:      names.FluentBit,
+		},
+	}
+
+	if _, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, serviceAccount, func() error {
+		return ctrl.SetControllerReference(r.logSystem, serviceAccount, r.Scheme)
+	}); err != nil {
+		return err
+	}
+
+	clusterRole := &rbacV1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: clusterRoleName}}
+
+	if _, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, clusterRole, func() error {
+		clusterRole.Labels = map[string]string{KalmLabelLogSystem: r.req.Name, KalmLabelNamespaceKey: r.req.Namespace}
+		clusterRole.Rules = fluentBitPolicyRules
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	clusterRoleBinding := &rbacV1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: clusterRoleName}}
+
+	_, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, clusterRoleBinding, func() error {
+		clusterRoleBinding.Labels = map[string]string{KalmLabelLogSystem: r.req.Name, KalmLabelNamespaceKey: r.req.Namespace}
+		// the role ref is immutable, it never changes
+		clusterRoleBinding.RoleRef = rbacV1.RoleRef{
+			APIGroup: rbacV1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     clusterRoleName,
+		}
+		clusterRoleBinding.Subjects = []rbacV1.Subject{
+			{
+				Kind:      rbacV1.ServiceAccountKind,
+				Name:      names.FluentBit,
+				Namespace: r.req.Namespace,
+			},
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (r *LogSystemReconcilerTask) addFinalizer() error {
+	if utils.ContainsString(r.logSystem.Finalizers, logSystemFinalizerName) {
+		return nil
+	}
+
+	logSystemCopy := r.logSystem.DeepCopy()
+	logSystemCopy.Finalizers = append(logSystemCopy.Finalizers, logSystemFinalizerName)
+
+	if err := r.Update(r.ctx, logSystemCopy); err != nil {
+		return err
+	}
+
+	r.logSystem = logSystemCopy
+
+	return nil
+}
+
+// Finalize deletes the cluster role of fluent bit and its binding, other resources are owned by the LogSystem.
+func (r *LogSystemReconcilerTask) Finalize() error {
+	if !utils.ContainsString(r.logSystem.Finalizers, logSystemFinalizerName) {
+		return nil
+	}
+
+	name := r.getFluentBitClusterRoleName()
+
+	if err := r.Delete(r.ctx, &rbacV1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name}}); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+
+	if err := r.Delete(r.ctx, &rbacV1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name}}); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+
+	logSystemCopy := r.logSystem.DeepCopy()
+	logSystemCopy.Finalizers = utils.RemoveString(logSystemCopy.Finalizers, logSystemFinalizerName)
+
+	return r.Update(r.ctx, logSystemCopy)
+}
+
+// GetFluentBitConfig renders the fluent bit config shipping logs of all pods to the sinks.
+// Only the existence of secret values matters here, they are read from envs by fluent bit.
+func GetFluentBitConfig(sinks []corev1alpha1.LogSink, secrets logSinkSecrets) string {
+	sb := &strings.Builder{}
+
+	sb.WriteString(`[SERVICE]
+    Flush        1
+    Log_Level    info
+    Parsers_File parsers.conf
+    HTTP_Server  On
+    HTTP_Listen  0.0.0.0
+    HTTP_Port    2020
+
+[INPUT]
+    Name             tail
+    Tag              kube.*
+    Path             /var/log/containers/*.log
+    Parser           docker
+    DB               /run/fluent-bit/flb_kube.db
+    Mem_Buf_Limit    5MB
+    Skip_Long_Lines  On
+    Refresh_Interval 10
+
+[FILTER]
+    Name                kubernetes
+    Match               kube.*
+    Kube_URL            https://kubernetes.default.svc:443
+    Merge_Log           On
+    Keep_Log            Off
+    K8S-Logging.Parser  On
+    K8S-Logging.Exclude On
+`)
+
+	for _, sink := range sinks {
+		options := getFluentBitOutputOptions(sink, secrets)
+
+		// values with line breaks would inject sections, they are rejected by the webhook too
+		if options == nil || !isValidFluentBitOptions(options) {
+			continue
+		}
+
+		sb.WriteString("\n[OUTPUT]\n")
+
+		for _, option := range options {
+			sb.WriteString(fmt.Sprintf("    %-15s %s\n", option[0], option[1]))
+		}
+	}
+
+	return sb.String()
+}
+
+func isValidFluentBitOptions(options [][2]string) bool {
+	for _, option := range options {
+		if strings.IndexFunc(option[1], unicode.IsControl) >= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getFluentBitOutputOptions returns ordered key value pairs of the output section of a sink.
+func getFluentBitOutputOptions(sink corev1alpha1.LogSink, secrets logSinkSecrets) [][2]string {
+	secretEnv := func(key string) string {
+		return fmt.Sprintf("${%s}", getLogSinkSecretEnvName(sink, key))
+	}
+
+	onOff := func(b bool) string {
+		if b {
+			return "On"
+		}
+		return "Off"
+	}
+
+	var options [][2]string
+
+	switch sink.Type {
+	case corev1alpha1.LogSinkTypeElasticsearch:
+		if sink.Elasticsearch == nil {
+			return nil
+		}
+
+		config := sink.Elasticsearch
+		index := config.Index
+
+		if index == "" {
+			index = "kalm"
+		}
+
+		options = [][2]string{
+			{"Name", "es"},
+			{"Match", "kube.*"},
+			{"Host", config.Host},
+			{"Port", fmt.Sprint(config.Port)},
+			{"tls", onOff(config.TLS)},
+			{"Logstash_Format", "On"},
+			{"Logstash_Prefix", index},
+			{"Replace_Dots", "On"},
+			{"Retry_Limit", "False"},
+		}
+
+		if secrets.has(sink.Name, "username") {
+			options = append(options, [2]string{"HTTP_User", secretEnv("username")})
+		}
+
+		if secrets.has(sink.Name, "password") {
+			options = append(options, [2]string{"HTTP_Passwd", secretEnv("password")})
+		}
+	case corev1alpha1.LogSinkTypeHTTP:
+		if sink.HTTP == nil {
+			return nil
+		}
+
+		config := sink.HTTP
+		uri := config.URI
+
+		if uri == "" {
+			uri = "/"
+		}
+
+		options = [][2]string{
+			{"Name", "http"},
+			{"Match", "kube.*"},
+			{"Host", config.Host},
+			{"Port", fmt.Sprint(config.Port)},
+			{"URI", uri},
+			{"tls", onOff(config.TLS)},
+			{"Format", "json"},
+		}
+
+		if secrets.has(sink.Name, "username") {
+			options = append(options, [2]string{"HTTP_User", secretEnv("username")})
+		}
+
+		if secrets.has(sink.Name, "password") {
+			options = append(options, [2]string{"HTTP_Passwd", secretEnv("password")})
+		}
+
+		if secrets.has(sink.Name, "token") {
+			options = append(options, [2]string{"Header", "Authorization Bearer " + secretEnv("token")})
+		}
+	case corev1alpha1.LogSinkTypeS3:
+		if sink.S3 == nil {
+			return nil
+		}
+
+		config := sink.S3
+		prefix := strings.Trim(config.KeyPrefix, "/")
+
+		if prefix == "" {
+			prefix = "kalm-logs"
+		}
+
+		options = [][2]string{
+			{"Name", "s3"},
+			{"Match", "kube.*"},
+			{"bucket", config.Bucket},
+			{"region", config.Region},
+		}
+
+		if config.Endpoint != "" {
+			options = append(options, [2]string{"endpoint", config.Endpoint})
+		}
+
+		options = append(options,
+			[2]string{"s3_key_format", fmt.Sprintf("/%s/%%Y/%%m/%%d/%%H/$TAG-%%M-%%S", prefix)},
+			[2]string{"total_file_size", "50M"},
+			[2]string{"upload_timeout", "10m"},
+		)
+	case corev1alpha1.LogSinkTypeLoki:
+		if sink.Loki == nil {
+			return nil
+		}
+
+		config := sink.Loki
+
+		options = [][2]string{
+			{"Name", "loki"},
+			{"Match", "kube.*"},
+			{"Host", config.Host},
+			{"Port", fmt.Sprint(config.Port)},
+			{"tls", onOff(config.TLS)},
+			// the same labels as the promtail of plg stacks, so queries work in both
+			{"labels", "job=fluent-bit, namespace=$kubernetes['namespace_name'], pod=$kubernetes['pod_name'], container=$kubernetes['container_name']"},
+			{"line_format", "json"},
+		}
+
+		if config.TenantID != "" {
+			options = append(options, [2]string{"tenant_id", config.TenantID})
+		}
+
+		if secrets.has(sink.Name, "username") {
+			options = append(options, [2]string{"http_user", secretEnv("username")})
+		}
+
+		if secrets.has(sink.Name, "password") {
+			options = append(options, [2]string{"http_passwd", secretEnv("password")})
+		}
+	default:
+		return nil
+	}
+
+	return options
+}
+
+// getLogSystemSecretNames returns the secrets used by the sinks or the loki object storage of a LogSystem.
+func getLogSystemSecretNames(logSystem corev1alpha1.LogSystem) []string {
+	var secretNames []string
+
+	if logSystem.Spec.ExternalConfig != nil {
+		for _, sink := range logSystem.Spec.ExternalConfig.Sinks {
+			secretNames = append(secretNames, getLogSinkSecretName(sink))
+		}
+	}
+
+	if config := logSystem.Spec.PLGConfig; config != nil && config.Loki != nil &&
+		config.Loki.Distributed != nil && config.Loki.Distributed.ObjectStorage != nil {
+		secretNames = append(secretNames, config.Loki.Distributed.ObjectStorage.SecretName)
+	}
+
+	return secretNames
+}
+
+// LogSystemSecretMapper reconciles LogSystems using the changed secret.
+type LogSystemSecretMapper struct {
+	*BaseReconciler
+}
+
+func (m LogSystemSecretMapper) Map(object handler.MapObject) []reconcile.Request {
+	var logSystems corev1alpha1.LogSystemList
+
+	if err := m.List(context.Background(), &logSystems, client.InNamespace(object.Meta.GetNamespace())); err != nil {
+		m.Log.Error(err, "fail to list logSystems")
+		return nil
+	}
+
+	var requests []reconcile.Request
+
+	for _, logSystem := range logSystems.Items {
+		for _, secretName := range getLogSystemSecretNames(logSystem) {
+			if secretName == object.Meta.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: logSystem.Namespace, Name: logSystem.Name},
+				})
+				break
+			}
+		}
+	}
+
+	return requests
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	rbacV1 "k8s.io/api/rbac/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetFluentBitConfig(t *testing.T) {
+	sinks := []v1alpha1.LogSink{
+		{
+			Name: "es",
+			Type: v1alpha1.LogSinkTypeElasticsearch,
+			Elasticsearch: &v1alpha1.ElasticsearchSinkConfig{
+				Host:       "es.example.com",
+				Port:       9200,
+				TLS:        true,
+				SecretName: "es-credentials",
+			},
+		},
+		{
+			Name: "archive",
+			Type: v1alpha1.LogSinkTypeS3,
+			S3: &v1alpha1.S3SinkConfig{
+				Bucket:    "logs",
+				Region:    "us-east-1",
+				KeyPrefix: "/cluster-a/",
+			},
+		},
+		{
+			Name: "remote-loki",
+			Type: v1alpha1.LogSinkTypeLoki,
+			Loki: &v1alpha1.LokiSinkConfig{
+				Host:     "loki.example.com",
+				Port:     3100,
+				TenantID: "kalm",
+			},
+		},
+	}
+
+	secrets := logSinkSecrets{
+		"es": {"username": true, "password": true},
+	}
+
+	res := GetFluentBitConfig(sinks, secrets)
+
+	assert.Equal(t, 3, strings.Count(res, "[OUTPUT]"))
+	assert.Contains(t, res, `
+[OUTPUT]
+    Name            es
+    Match           kube.*
+    Host            es.example.com
+    Port            9200
+    tls             On
+    Logstash_Format On
+    Logstash_Prefix kalm
+    Replace_Dots    On
+    Retry_Limit     False
+    HTTP_User       ${LOG_SINK_ES_USERNAME}
+    HTTP_Passwd     ${LOG_SINK_ES_PASSWORD}
+`)
+	assert.Contains(t, res, "    s3_key_format   /cluster-a/%Y/%m/%d/%H/$TAG-%M-%S\n")
+	assert.Contains(t, res, "    tenant_id       kalm\n")
+	assert.NotContains(t, res, "http_user")
+}
+
+func TestGetFluentBitConfigInjection(t *testing.T) {
+	sinks := []v1alpha1.LogSink{
+		{
+			Name: "es",
+			Type: v1alpha1.LogSinkTypeElasticsearch,
+			Elasticsearch: &v1alpha1.ElasticsearchSinkConfig{
+				Host: "es.example.com\n\n[OUTPUT]\n    Name stdout",
+				Port: 9200,
+			},
+		},
+		{
+			Name: "remote-loki",
+			Type: v1alpha1.LogSinkTypeLoki,
+			Loki: &v1alpha1.LokiSinkConfig{
+				Host:     "loki.example.com",
+				Port:     3100,
+				TenantID: "kalm\r\n[INPUT]",
+			},
+		},
+		{
+			Name: "http",
+			Type: v1alpha1.LogSinkTypeHTTP,
+			HTTP: &v1alpha1.HTTPSinkConfig{
+				Host: "logs.example.com",
+				Port: 443,
+				URI:  "/ingest",
+			},
+		},
+	}
+
+	res := GetFluentBitConfig(sinks, nil)
+
+	// sinks with line breaks in values are skipped
+	assert.Equal(t, 1, strings.Count(res, "[OUTPUT]"))
+	assert.Equal(t, 1, strings.Count(res, "[INPUT]"))
+	assert.NotContains(t, res, "stdout")
+	assert.Contains(t, res, "    URI             /ingest\n")
+}
+
+func TestGetLogSinkSecretEnvs(t *testing.T) {
+	sinks := []v1alpha1.LogSink{
+		{Name: "my-http", Type: v1alpha1.LogSinkTypeHTTP, HTTP: &v1alpha1.HTTPSinkConfig{Host: "logs.example.com", SecretName: "http-token"}},
+		{Name: "archive", Type: v1alpha1.LogSinkTypeS3, S3: &v1alpha1.S3SinkConfig{Bucket: "logs", SecretName: "aws"}},
+	}
+
+	secrets := logSinkSecrets{
+		"my-http": {"token": true},
+		"archive": {"accessKeyID": true, "secretAccessKey": true},
+	}
+
+	envs := getLogSinkSecretEnvs(sinks, secrets)
+
+	secretKeyRef := func(name, key string) *coreV1.EnvVarSource {
+		return &coreV1.EnvVarSource{
+			SecretKeyRef: &coreV1.SecretKeySelector{LocalObjectReference: coreV1.LocalObjectReference{Name: name}, Key: key},
+		}
+	}
+
+	assert.Equal(t, []coreV1.EnvVar{
+		{Name: "LOG_SINK_MY_HTTP_TOKEN", ValueFrom: secretKeyRef("http-token", "token")},
+		{Name: "AWS_ACCESS_KEY_ID", ValueFrom: secretKeyRef("aws", "accessKeyID")},
+		{Name: "AWS_SECRET_ACCESS_KEY", ValueFrom: secretKeyRef("aws", "secretAccessKey")},
+	}, envs)
+
+	assert.Contains(t, GetFluentBitConfig(sinks, secrets), "    Header          Authorization Bearer ${LOG_SINK_MY_HTTP_TOKEN}\n")
+}
+
+func TestReconcileExternalFluentBit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme))
+	assert.Nil(t, v1alpha1.AddToScheme(scheme))
+
+	logSystem := &v1alpha1.LogSystem{
+		ObjectMeta: metaV1.ObjectMeta{Name: "log", Namespace: "kalm-log"},
+		Spec: v1alpha1.LogSystemSpec{
+			Stack: v1alpha1.LogSystemStackExternal,
+			ExternalConfig: &v1alpha1.ExternalLogSystemConfig{
+				FluentBit: &v1alpha1.FluentBitConfig{Image: v1alpha1.FluentBitImage},
+				Sinks: []v1alpha1.LogSink{
+					{Name: "my-http", Type: v1alpha1.LogSinkTypeHTTP, HTTP: &v1alpha1.HTTPSinkConfig{Host: "logs.example.com", Port: 443, SecretName: "http-token"}},
+				},
+			},
+		},
+	}
+
+	secret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: "http-token", Namespace: "kalm-log"},
+		Data:       map[string][]byte{"token": []byte("s3cr3t")},
+	}
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme, logSystem, secret)
+
+	task := &LogSystemReconcilerTask{
+		LogSystemReconciler: &LogSystemReconciler{BaseReconciler: &BaseReconciler{
+			Client:   fakeClient,
+			Reader:   fakeClient,
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}},
+		ctx:       context.Background(),
+		req:       &ctrl.Request{NamespacedName: types.NamespacedName{Name: "log", Namespace: "kalm-log"}},
+		logSystem: logSystem,
+	}
+
+	assert.Nil(t, task.ReconcileExternal())
+
+	var daemonSet appsV1.DaemonSet
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "log-fluent-bit", Namespace: "kalm-log"}, &daemonSet))
+
+	container := daemonSet.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, v1alpha1.FluentBitImage, container.Image)
+	assert.Len(t, container.Env, 1)
+	assert.Equal(t, "LOG_SINK_MY_HTTP_TOKEN", container.Env[0].Name)
+	assert.Equal(t, "http-token", container.Env[0].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "token", container.Env[0].ValueFrom.SecretKeyRef.Key)
+	assert.Equal(t, "log-fluent-bit", daemonSet.Spec.Template.Spec.ServiceAccountName)
+	assert.True(t, metaV1.IsControlledBy(&daemonSet, logSystem))
+
+	// the secret value is in neither the daemonset nor the config
+	var configMap coreV1.ConfigMap
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "log-fluent-bit", Namespace: "kalm-log"}, &configMap))
+	assert.Contains(t, configMap.Data["fluent-bit.conf"], "Authorization Bearer ${LOG_SINK_MY_HTTP_TOKEN}")
+	assert.NotContains(t, configMap.Data["fluent-bit.conf"], "s3cr3t")
+
+	var clusterRoleBinding rbacV1.ClusterRoleBinding
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "kalm-log-kalm-log-log-fluent-bit"}, &clusterRoleBinding))
+	assert.Equal(t, "log-fluent-bit", clusterRoleBinding.Subjects[0].Name)
+	assert.Equal(t, "kalm-log", clusterRoleBinding.Subjects[0].Namespace)
+
+	var res v1alpha1.LogSystem
+	assert.Nil(t, fakeClient.Get(task.ctx, task.req.NamespacedName, &res))
+	assert.Contains(t, res.Finalizers, logSystemFinalizerName)
+
+	// cluster scoped resources are deleted with the logsystem
+	task.logSystem = &res
+	assert.Nil(t, task.Finalize())
+	assert.NotNil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "kalm-log-kalm-log-log-fluent-bit"}, &clusterRoleBinding))
+	assert.NotNil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: "kalm-log-kalm-log-log-fluent-bit"}, &rbacV1.ClusterRole{}))
+
+	var finalized v1alpha1.LogSystem
+	assert.Nil(t, fakeClient.Get(task.ctx, task.req.NamespacedName, &finalized))
+	assert.NotContains(t, finalized.Finalizers, logSystemFinalizerName)
+}
@@ -0,0 +1,408 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	appsV1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apiEquality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	logSystemStatusRefreshInterval = 5 * time.Minute
+
+	// every status change triggers a reconciliation, so the disk usage is not read more often than this
+	lokiDiskUsageMinRefreshInterval = time.Minute
+
+	// grafana is not exposed by a service, it's only reachable through kubectl port-forward
+	grafanaPortForwardURL = "http://localhost:3000"
+)
+
+// conditions of all components, including the ones of other stacks
+var logSystemComponentConditionTypes = []corev1alpha1.LogSystemConditionType{
+	corev1alpha1.LogSystemConditionLokiReady,
+	corev1alpha1.LogSystemConditionGrafanaReady,
+	corev1alpha1.LogSystemConditionPromtailReady,
+	corev1alpha1.LogSystemConditionFluentBitReady,
+	corev1alpha1.LogSystemConditionLokiDistributorReady,
+	corev1alpha1.LogSystemConditionLokiIngesterReady,
+	corev1alpha1.LogSystemConditionLokiQuerierReady,
+	corev1alpha1.LogSystemConditionLokiQueryFrontendReady,
+	corev1alpha1.LogSystemConditionLokiTableManagerReady,
+}
+
+// kinds of workloads deployed by the LogSystem itself instead of components
+const (
+	logSystemWorkloadDaemonSet   = "DaemonSet"
+	logSystemWorkloadDeployment  = "Deployment"
+	logSystemWorkloadStatefulSet = "StatefulSet"
+)
+
+// logSystemStackComponent is a component deployed by the LogSystem, component is nil if it doesn't exist.
+// Workloads deployed by the LogSystem itself set workloadKind instead, with the workload if it exists.
+type logSystemStackComponent struct {
+	conditionType corev1alpha1.LogSystemConditionType
+	name          string
+	component     *corev1alpha1.Component
+	workloadKind  string
+	workload      runtime.Object
+}
+
+func (c logSystemStackComponent) readiness() (v1.ConditionStatus, string, string) {
+	if c.workloadKind != "" {
+		return getLogSystemWorkloadReadiness(c.workloadKind, c.name, c.workload)
+	}
+
+	return getLogSystemComponentReadiness(c.name, c.component)
+}
+
+func newLogSystemWorkload(kind string) runtime.Object {
+	switch kind {
+	case logSystemWorkloadDaemonSet:
+		return &appsV1.DaemonSet{}
+	case logSystemWorkloadDeployment:
+		return &appsV1.Deployment{}
+	default:
+		return &appsV1.StatefulSet{}
+	}
+}
+
+// UpdateStatus writes the readiness of the components of the stack, and the result of
+// the reconciliation (reconcileErr), back to the logsystem status.
+func (r *LogSystemReconcilerTask) UpdateStatus(reconcileErr error) error {
+	stack, err := r.getStackComponents()
+
+	if err != nil {
+		return err
+	}
+
+	status := r.logSystem.Status.DeepCopy()
+	status.ObservedGeneration = r.logSystem.Generation
+
+	if reconcileErr != nil {
+		status.LastReconcileError = reconcileErr.Error()
+	} else {
+		status.LastReconcileError = ""
+	}
+
+	setLogSystemConditions(status, stack, reconcileErr)
+
+	if isPLGStack(r.logSystem.Spec.Stack) && r.logSystem.Spec.PLGConfig != nil {
+		status.GrafanaURL = grafanaPortForwardURL
+
+		if status.Loki == nil {
+			status.Loki = &corev1alpha1.LogSystemLokiStatus{}
+		}
+
+		if r.logSystem.Spec.PLGConfig.Loki != nil {
+			status.Loki.RetentionPeriod = getLokiRetentionPeriod(r.logSystem.Spec.PLGConfig.Loki.RetentionDays)
+		}
+
+		// distributed lokis store logs in the object storage, the disks of ingesters are not reported
+		if r.logSystem.Spec.Stack == corev1alpha1.LogSystemStackPLGMonolithic {
+			r.updateLokiDiskUsage(status.Loki)
+		}
+	} else {
+		status.GrafanaURL = ""
+		status.Loki = nil
+	}
+
+	if apiEquality.Semantic.DeepEqual(&r.logSystem.Status, status) {
+		return nil
+	}
+
+	logSystemCopy := r.logSystem.DeepCopy()
+	logSystemCopy.Status = *status
+
+	if err := r.Status().Patch(r.ctx, logSystemCopy, client.MergeFrom(r.logSystem)); err != nil {
+		return err
+	}
+
+	r.logSystem = logSystemCopy
+
+	return nil
+}
+
+func (r *LogSystemReconcilerTask) getStackComponents() ([]logSystemStackComponent, error) {
+	names := r.getComponentNames()
+
+	var stack []logSystemStackComponent
+
+	switch r.logSystem.Spec.Stack {
+	case corev1alpha1.LogSystemStackPLGMonolithic:
+		stack = []logSystemStackComponent{
+			{conditionType: corev1alpha1.LogSystemConditionLokiReady, name: names.Loki},
+			{conditionType: corev1alpha1.LogSystemConditionGrafanaReady, name: names.Grafana},
+			{conditionType: corev1alpha1.LogSystemConditionPromtailReady, name: names.Promtail},
+		}
+	case corev1alpha1.LogSystemStackExternal:
+		stack = []logSystemStackComponent{
+			{conditionType: corev1alpha1.LogSystemConditionFluentBitReady, name: names.FluentBit, workloadKind: logSystemWorkloadDaemonSet},
+		}
+	case corev1alpha1.LogSystemStackPLGDistributed:
+		for _, target := range lokiDistributedTargets {
+			stack = append(stack, logSystemStackComponent{
+				conditionType: target.conditionType,
+				name:          r.getLokiTargetName(target.name),
+				workloadKind:  target.workloadKind(),
+			})
+		}
+
+		stack = append(stack,
+			logSystemStackComponent{conditionType: corev1alpha1.LogSystemConditionGrafanaReady, name: names.Grafana},
+			logSystemStackComponent{conditionType: corev1alpha1.LogSystemConditionPromtailReady, name: names.Promtail},
+		)
+	}
+
+	for i := range stack {
+		if stack[i].workloadKind != "" {
+			workload := newLogSystemWorkload(stack[i].workloadKind)
+
+			if err := r.Get(r.ctx, r.NameToNamespacedName(stack[i].name), workload); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+
+				return nil, err
+			}
+
+			stack[i].workload = workload
+			continue
+		}
+
+		var component corev1alpha1.Component
+
+		if err := r.Get(r.ctx, r.NameToNamespacedName(stack[i].name), &component); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		stack[i].component = &component
+	}
+
+	return stack, nil
+}
+
+func setLogSystemConditions(status *corev1alpha1.LogSystemStatus, stack []logSystemStackComponent, reconcileErr error) {
+	var notReady []string
+
+	for _, c := range stack {
+		conditionStatus, reason, message := c.readiness()
+		setLogSystemCondition(status, c.conditionType, conditionStatus, reason, message)
+
+		if conditionStatus != v1.ConditionTrue {
+			notReady = append(notReady, c.name)
+		}
+	}
+
+	// conditions of the previous stack are left if the stack is changed
+	for _, conditionType := range logSystemComponentConditionTypes {
+		inStack := false
+
+		for _, c := range stack {
+			if c.conditionType == conditionType {
+				inStack = true
+				break
+			}
+		}
+
+		if !inStack {
+			removeLogSystemCondition(status, conditionType)
+		}
+	}
+
+	switch {
+	case len(stack) == 0:
+		setLogSystemCondition(status, corev1alpha1.LogSystemConditionReady, v1.ConditionFalse, "UnsupportedStack", "No component is deployed for this stack.")
+	case len(notReady) > 0:
+		setLogSystemCondition(status, corev1alpha1.LogSystemConditionReady, v1.ConditionFalse, "ComponentsNotReady", fmt.Sprintf("%s not ready.", strings.Join(notReady, ", ")))
+	default:
+		setLogSystemCondition(status, corev1alpha1.LogSystemConditionReady, v1.ConditionTrue, "ComponentsReady", "")
+	}
+
+	if reconcileErr != nil {
+		setLogSystemCondition(status, corev1alpha1.LogSystemConditionDegraded, v1.ConditionTrue, "ReconcileError", reconcileErr.Error())
+	} else {
+		setLogSystemCondition(status, corev1alpha1.LogSystemConditionDegraded, v1.ConditionFalse, "", "")
+	}
+}
+
+// getLogSystemComponentReadiness summarizes the status of a component as a condition of the logsystem.
+func getLogSystemComponentReadiness(name string, component *corev1alpha1.Component) (v1.ConditionStatus, string, string) {
+	if component == nil {
+		return v1.ConditionFalse, "ComponentNotFound", fmt.Sprintf("Component %s doesn't exist.", name)
+	}
+
+	var ready, degraded *corev1alpha1.ComponentCondition
+
+	for i := range component.Status.Conditions {
+		switch component.Status.Conditions[i].Type {
+		case corev1alpha1.ComponentConditionReady:
+			ready = &component.Status.Conditions[i]
+		case corev1alpha1.ComponentConditionDegraded:
+			degraded = &component.Status.Conditions[i]
+		}
+	}
+
+	switch {
+	case ready == nil || component.Status.ObservedGeneration < component.Generation:
+		return v1.ConditionUnknown, "Pending", fmt.Sprintf("Waiting for the status of component %s.", name)
+	case ready.Status == v1.ConditionTrue:
+		return v1.ConditionTrue, "ComponentReady", ""
+	case degraded != nil && degraded.Status == v1.ConditionTrue:
+		// more helpful than the progressing message of the ready condition
+		return v1.ConditionFalse, degraded.Reason, degraded.Message
+	default:
+		return ready.Status, ready.Reason, ready.Message
+	}
+}
+
+// getLogSystemWorkloadReadiness summarizes the status of a daemonset, deployment or statefulset as a condition of the logsystem.
+// The workload is nil if it doesn't exist.
+func getLogSystemWorkloadReadiness(kind, name string, workload runtime.Object) (v1.ConditionStatus, string, string) {
+	var generation, observedGeneration int64
+	var desired, ready, updated int32
+
+	replicas := func(r *int32) int32 {
+		if r == nil {
+			return 1
+		}
+
+		return *r
+	}
+
+	switch w := workload.(type) {
+	case *appsV1.DaemonSet:
+		generation, observedGeneration = w.Generation, w.Status.ObservedGeneration
+		desired, ready, updated = w.Status.DesiredNumberScheduled, w.Status.NumberReady, w.Status.UpdatedNumberScheduled
+	case *appsV1.Deployment:
+		generation, observedGeneration = w.Generation, w.Status.ObservedGeneration
+		desired, ready, updated = replicas(w.Spec.Replicas), w.Status.ReadyReplicas, w.Status.UpdatedReplicas
+	case *appsV1.StatefulSet:
+		generation, observedGeneration = w.Generation, w.Status.ObservedGeneration
+		desired, ready, updated = replicas(w.Spec.Replicas), w.Status.ReadyReplicas, w.Status.UpdatedReplicas
+	default:
+		return v1.ConditionFalse, kind + "NotFound", fmt.Sprintf("%s %s doesn't exist.", kind, name)
+	}
+
+	switch {
+	case observedGeneration < generation:
+		return v1.ConditionUnknown, "Pending", fmt.Sprintf("Waiting for the status of %s %s.", strings.ToLower(kind), name)
+	case updated >= desired && ready >= desired:
+		return v1.ConditionTrue, kind + "Ready", ""
+	default:
+		return v1.ConditionFalse, kind + "NotReady", fmt.Sprintf("%d of %d pods are ready, %d are updated.", ready, desired, updated)
+	}
+}
+
+// getLokiRetentionPeriod returns the retention_period in the loki config, see GetPLGMonolithicLokiConfig.
+func getLokiRetentionPeriod(retentionDays uint32) string {
+	if retentionDays == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%dh", retentionDays*24)
+}
+
+// updateLokiDiskUsage keeps the previous values if the usage can't be read, e.g. loki is not running.
+func (r *LogSystemReconcilerTask) updateLokiDiskUsage(lokiStatus *corev1alpha1.LogSystemLokiStatus) {
+	if r.queryVolumeStats == nil {
+		return
+	}
+
+	if lokiStatus.DiskUsageUpdatedAt != nil && time.Since(lokiStatus.DiskUsageUpdatedAt.Time) < lokiDiskUsageMinRefreshInterval {
+		return
+	}
+
+	usage, err := r.getLokiDiskUsage()
+
+	if err != nil {
+		r.Log.Error(err, "read disk usage of loki failed", "logSystem", r.req.NamespacedName)
+		return
+	}
+
+	if usage == nil {
+		return
+	}
+
+	now := metav1.Now()
+	lokiStatus.DiskCapacity = resource.NewQuantity(usage.capacityBytes, resource.BinarySI)
+	lokiStatus.DiskUsed = resource.NewQuantity(usage.usedBytes, resource.BinarySI)
+	lokiStatus.DiskUsageUpdatedAt = &now
+}
+
+type volumeStats struct {
+	capacityBytes int64
+	usedBytes     int64
+}
+
+// getLokiDiskUsage returns nil if there is no running loki pod, or the stats of its pvc are not scraped yet.
+func (r *LogSystemReconcilerTask) getLokiDiskUsage() (*volumeStats, error) {
+	var podList v1.PodList
+
+	if err := r.List(
+		r.ctx,
+		&podList,
+		client.InNamespace(r.req.Namespace),
+		client.MatchingLabels{KalmLabelComponentKey: r.getComponentNames().Loki},
+	); err != nil {
+		return nil, err
+	}
+
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+
+			return getPVCVolumeStats(r.queryVolumeStats, pod.Namespace, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+
+	return nil, nil
+}
+
+type prometheusScalarQuery func(query string) (*float64, error)
+
+// getPVCVolumeStats reads the volume stats metrics of kubelet scraped by prometheus,
+// it returns nil if either metric has no sample.
+func getPVCVolumeStats(query prometheusScalarQuery, namespace, pvcName string) (*volumeStats, error) {
+	selector := fmt.Sprintf(`{namespace="%s",persistentvolumeclaim="%s"}`, namespace, pvcName)
+
+	capacity, err := query("max(kubelet_volume_stats_capacity_bytes" + selector + ")")
+
+	if err != nil || capacity == nil {
+		return nil, err
+	}
+
+	used, err := query("max(kubelet_volume_stats_used_bytes" + selector + ")")
+
+	if err != nil || used == nil {
+		return nil, err
+	}
+
+	return &volumeStats{capacityBytes: int64(*capacity), usedBytes: int64(*used)}, nil
+}
+
+func setLogSystemCondition(status *corev1alpha1.LogSystemStatus, conditionType corev1alpha1.LogSystemConditionType, conditionStatus v1.ConditionStatus, reason, message string) {
+	setStatusCondition(&status.Conditions, string(conditionType), conditionStatus, reason, message)
+}
+
+func removeLogSystemCondition(status *corev1alpha1.LogSystemStatus, conditionType corev1alpha1.LogSystemConditionType) {
+	removeStatusCondition(&status.Conditions, string(conditionType))
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+func getLogSystemCondition(status *v1alpha1.LogSystemStatus, conditionType v1alpha1.LogSystemConditionType) *v1alpha1.LogSystemCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+func TestSetLogSystemConditions(t *testing.T) {
+	readyComponent := &v1alpha1.Component{
+		Status: v1alpha1.ComponentStatus{
+			Conditions: []v1alpha1.ComponentCondition{
+				{Type: v1alpha1.ComponentConditionReady, Status: coreV1.ConditionTrue},
+				{Type: v1alpha1.ComponentConditionDegraded, Status: coreV1.ConditionFalse},
+			},
+		},
+	}
+
+	crashingComponent := &v1alpha1.Component{
+		Status: v1alpha1.ComponentStatus{
+			Conditions: []v1alpha1.ComponentCondition{
+				{Type: v1alpha1.ComponentConditionReady, Status: coreV1.ConditionFalse, Reason: "RollingOut"},
+				{Type: v1alpha1.ComponentConditionDegraded, Status: coreV1.ConditionTrue, Reason: "ProgressDeadlineExceeded", Message: "loki-0 is crashing"},
+			},
+		},
+	}
+
+	// left by a previous external stack
+	status := &v1alpha1.LogSystemStatus{
+		Conditions: []v1alpha1.LogSystemCondition{
+			{Type: v1alpha1.LogSystemConditionFluentBitReady, Status: coreV1.ConditionTrue},
+		},
+	}
+
+	setLogSystemConditions(status, []logSystemStackComponent{
+		{conditionType: v1alpha1.LogSystemConditionLokiReady, name: "log-loki", component: crashingComponent},
+		{conditionType: v1alpha1.LogSystemConditionGrafanaReady, name: "log-grafana", component: readyComponent},
+		{conditionType: v1alpha1.LogSystemConditionPromtailReady, name: "log-promtail"},
+	}, fmt.Errorf("unable to create promtail component"))
+
+	assert.Nil(t, getLogSystemCondition(status, v1alpha1.LogSystemConditionFluentBitReady))
+
+	loki := getLogSystemCondition(status, v1alpha1.LogSystemConditionLokiReady)
+	assert.Equal(t, coreV1.ConditionFalse, loki.Status)
+	assert.Equal(t, "ProgressDeadlineExceeded", loki.Reason)
+	assert.Equal(t, "loki-0 is crashing", loki.Message)
+
+	assert.Equal(t, coreV1.ConditionTrue, getLogSystemCondition(status, v1alpha1.LogSystemConditionGrafanaReady).Status)
+	assert.Equal(t, "ComponentNotFound", getLogSystemCondition(status, v1alpha1.LogSystemConditionPromtailReady).Reason)
+
+	ready := getLogSystemCondition(status, v1alpha1.LogSystemConditionReady)
+	assert.Equal(t, coreV1.ConditionFalse, ready.Status)
+	assert.Equal(t, "log-loki, log-promtail not ready.", ready.Message)
+
+	degraded := getLogSystemCondition(status, v1alpha1.LogSystemConditionDegraded)
+	assert.Equal(t, coreV1.ConditionTrue, degraded.Status)
+	assert.Equal(t, "unable to create promtail component", degraded.Message)
+
+	readyDaemonSet := &appsV1.DaemonSet{
+		Status: appsV1.DaemonSetStatus{DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberReady: 3},
+	}
+
+	setLogSystemConditions(status, []logSystemStackComponent{
+		{conditionType: v1alpha1.LogSystemConditionFluentBitReady, name: "log-fluent-bit", workloadKind: logSystemWorkloadDaemonSet, workload: readyDaemonSet},
+	}, nil)
+
+	assert.Len(t, status.Conditions, 3)
+	assert.Equal(t, coreV1.ConditionTrue, getLogSystemCondition(status, v1alpha1.LogSystemConditionReady).Status)
+	assert.Equal(t, coreV1.ConditionFalse, getLogSystemCondition(status, v1alpha1.LogSystemConditionDegraded).Status)
+}
+
+func TestGetLogSystemWorkloadReadiness(t *testing.T) {
+	status, reason, _ := getLogSystemWorkloadReadiness(logSystemWorkloadDaemonSet, "log-fluent-bit", nil)
+	assert.Equal(t, coreV1.ConditionFalse, status)
+	assert.Equal(t, "DaemonSetNotFound", reason)
+
+	daemonSet := &appsV1.DaemonSet{
+		Status: appsV1.DaemonSetStatus{DesiredNumberScheduled: 3, UpdatedNumberScheduled: 2, NumberReady: 3},
+	}
+
+	status, reason, message := getLogSystemWorkloadReadiness(logSystemWorkloadDaemonSet, "log-fluent-bit", daemonSet)
+	assert.Equal(t, coreV1.ConditionFalse, status)
+	assert.Equal(t, "DaemonSetNotReady", reason)
+	assert.Equal(t, "3 of 3 pods are ready, 2 are updated.", message)
+
+	daemonSet.Generation = 2
+	daemonSet.Status.ObservedGeneration = 1
+	status, _, _ = getLogSystemWorkloadReadiness(logSystemWorkloadDaemonSet, "log-fluent-bit", daemonSet)
+	assert.Equal(t, coreV1.ConditionUnknown, status)
+
+	replicas := int32(3)
+	statefulSet := &appsV1.StatefulSet{
+		Spec:   appsV1.StatefulSetSpec{Replicas: &replicas},
+		Status: appsV1.StatefulSetStatus{ReadyReplicas: 3, UpdatedReplicas: 3},
+	}
+
+	status, reason, _ = getLogSystemWorkloadReadiness(logSystemWorkloadStatefulSet, "log-loki-ingester", statefulSet)
+	assert.Equal(t, coreV1.ConditionTrue, status)
+	assert.Equal(t, "StatefulSetReady", reason)
+
+	status, _, message = getLogSystemWorkloadReadiness(logSystemWorkloadDeployment, "log-loki-querier", &appsV1.Deployment{})
+	assert.Equal(t, coreV1.ConditionFalse, status)
+	assert.Equal(t, "0 of 1 pods are ready, 0 are updated.", message)
+}
+
+func TestGetLogSystemComponentReadinessOfStaleStatus(t *testing.T) {
+	component := &v1alpha1.Component{
+		Status: v1alpha1.ComponentStatus{
+			ObservedGeneration: 1,
+			Conditions: []v1alpha1.ComponentCondition{
+				{Type: v1alpha1.ComponentConditionReady, Status: coreV1.ConditionTrue},
+			},
+		},
+	}
+	component.Generation = 2
+
+	status, reason, _ := getLogSystemComponentReadiness("log-loki", component)
+	assert.Equal(t, coreV1.ConditionUnknown, status)
+	assert.Equal(t, "Pending", reason)
+}
+
+func TestGetPVCVolumeStats(t *testing.T) {
+	capacity := float64(10737418240)
+	used := float64(2147483648)
+
+	var queries []string
+
+	query := func(query string) (*float64, error) {
+		queries = append(queries, query)
+
+		switch query {
+		case `max(kubelet_volume_stats_capacity_bytes{namespace="kalm-log",persistentvolumeclaim="storage-log-loki-0"})`:
+			return &capacity, nil
+		case `max(kubelet_volume_stats_used_bytes{namespace="kalm-log",persistentvolumeclaim="storage-log-loki-0"})`:
+			return &used, nil
+		default:
+			return nil, nil
+		}
+	}
+
+	stats, err := getPVCVolumeStats(query, "kalm-log", "storage-log-loki-0")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10737418240), stats.capacityBytes)
+	assert.Equal(t, int64(2147483648), stats.usedBytes)
+	assert.Len(t, queries, 2)
+
+	stats, err = getPVCVolumeStats(query, "default", "storage-log-loki-0")
+	assert.Nil(t, err)
+	assert.Nil(t, stats)
+
+	_, err = getPVCVolumeStats(func(string) (*float64, error) {
+		return nil, fmt.Errorf("prometheus query failed: unavailable")
+	}, "kalm-log", "storage-log-loki-0")
+	assert.NotNil(t, err)
+}
+
+func TestGetLokiRetentionPeriod(t *testing.T) {
+	assert.Equal(t, "", getLokiRetentionPeriod(0))
+	assert.Equal(t, "144h", getLokiRetentionPeriod(6))
+}
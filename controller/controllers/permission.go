@@ -4,14 +4,19 @@ import (
 	"fmt"
 	corev1 "k8s.io/api/core/v1"
 	rbacV1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
 
+// getRunnerPermissionName returns the name of the service account, the role and the binding of a component's runner permission.
+func getRunnerPermissionName(componentName string) string {
+	return fmt.Sprintf("kalm-permission-%s", componentName)
+}
+
 func (r *ComponentReconcilerTask) getNameForPermission() string {
-	name := fmt.Sprintf("kalm-permission-%s", r.component.Name)
-	return name
+	return getRunnerPermissionName(r.component.Name)
 }
 
 func (r *ComponentReconcilerTask) reconcilePermission() error {
@@ -60,8 +65,12 @@ func (r *ComponentReconcilerTask) reconcilePermission() error {
 			}
 		} else if err != nil {
 			return err
-		} else {
-			// ensure
+		} else if !equality.Semantic.DeepEqual(cr.Rules, desiredClusterRole.Rules) {
+			// rules may be narrowed down, e.g. the permissions not needed any more are dropped
+			cr.Rules = desiredClusterRole.Rules
+			if err := r.Update(r.ctx, &cr); err != nil {
+				return err
+			}
 		}
 
 		//binding
@@ -110,8 +119,11 @@ func (r *ComponentReconcilerTask) reconcilePermission() error {
 			}
 		} else if err != nil {
 			return err
-		} else {
-			// ensure
+		} else if !equality.Semantic.DeepEqual(cr.Rules, desiredRole.Rules) {
+			cr.Rules = desiredRole.Rules
+			if err := r.Update(r.ctx, &cr); err != nil {
+				return err
+			}
 		}
 
 		//binding
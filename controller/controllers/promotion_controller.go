@@ -0,0 +1,401 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// the source of a promoted resource, in namespace/name format
+	AnnoPromotedFrom = "core.kalm.dev/promoted-from"
+
+	// older records are dropped
+	maxPromotionHistory = 20
+)
+
+// PromotionReconciler reconciles a Promotion object
+type PromotionReconciler struct {
+	*BaseReconciler
+}
+
+type PromotionReconcilerTask struct {
+	*PromotionReconciler
+	ctx       context.Context
+	promotion *corev1alpha1.Promotion
+}
+
+// +kubebuilder:rbac:groups=core.kalm.dev,resources=promotions,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core.kalm.dev,resources=promotions/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core.kalm.dev,resources=components;httproutes;protectedendpoints;componentpluginbindings,verbs=get;list;watch;create;update;patch
+
+func (r *PromotionReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	task := &PromotionReconcilerTask{
+		PromotionReconciler: r,
+		ctx:                 context.Background(),
+	}
+
+	return ctrl.Result{}, task.Run(req)
+}
+
+func (r *PromotionReconcilerTask) Run(req ctrl.Request) error {
+	var promotion corev1alpha1.Promotion
+
+	if err := r.Get(r.ctx, req.NamespacedName, &promotion); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	// a promotion runs once for each generation of its spec
+	if promotion.Status.ObservedGeneration == promotion.Generation {
+		return nil
+	}
+
+	r.promotion = &promotion
+
+	record, err := r.promote()
+
+	promotionCopy := promotion.DeepCopy()
+
+	if err != nil {
+		promotionCopy.Status.Phase = corev1alpha1.PromotionPhaseFailed
+		promotionCopy.Status.Message = err.Error()
+		r.EmitWarningEvent(&promotion, err, "promote from %s failed.", promotion.Spec.SourceNamespace)
+	} else {
+		promotionCopy.Status.Phase = corev1alpha1.PromotionPhaseSucceeded
+		promotionCopy.Status.Message = ""
+		promotionCopy.Status.ObservedGeneration = promotion.Generation
+		promotionCopy.Status.History = appendPromotionRecord(promotionCopy.Status.History, *record)
+		r.EmitNormalEvent(&promotion, "Promoted", "%d components are promoted from %s.", len(record.Components), promotion.Spec.SourceNamespace)
+	}
+
+	if statusErr := r.Status().Patch(r.ctx, promotionCopy, client.MergeFrom(&promotion)); statusErr != nil {
+		r.Log.Error(statusErr, "update promotion status error.", "promotion", req.NamespacedName)
+
+		if err == nil {
+			return statusErr
+		}
+	}
+
+	// failed promotions are retried
+	return err
+}
+
+func appendPromotionRecord(history []corev1alpha1.PromotionRecord, record corev1alpha1.PromotionRecord) []corev1alpha1.PromotionRecord {
+	history = append(history, record)
+
+	if len(history) > maxPromotionHistory {
+		history = history[len(history)-maxPromotionHistory:]
+	}
+
+	return history
+}
+
+func (r *PromotionReconcilerTask) promote() (*corev1alpha1.PromotionRecord, error) {
+	spec := r.promotion.Spec
+
+	record := &corev1alpha1.PromotionRecord{
+		Generation: r.promotion.Generation,
+	}
+
+	overrides := make(map[string]corev1alpha1.PromotionComponentOverride)
+
+	for _, override := range spec.ComponentOverrides {
+		overrides[override.Name] = override
+	}
+
+	components := make(map[string]bool)
+
+	for _, name := range spec.Components {
+		var source corev1alpha1.Component
+
+		if err := r.getSource(name, &source); err != nil {
+			return nil, err
+		}
+
+		componentSpec := source.Spec.DeepCopy()
+
+		if override, exist := overrides[name]; exist {
+			applyPromotionComponentOverride(componentSpec, override)
+		}
+
+		target := &corev1alpha1.Component{ObjectMeta: r.getTargetObjectMeta(name)}
+
+		if err := r.createOrUpdate(target, &source, func() { target.Spec = *componentSpec }); err != nil {
+			return nil, err
+		}
+
+		if err := r.promoteComponentSecret(&source, target); err != nil {
+			return nil, err
+		}
+
+		components[name] = true
+		record.Components = append(record.Components, corev1alpha1.PromotedComponent{
+			Name:  name,
+			Image: componentSpec.Image,
+		})
+	}
+
+	var bindingList corev1alpha1.ComponentPluginBindingList
+
+	if err := r.List(r.ctx, &bindingList, client.InNamespace(spec.SourceNamespace)); err != nil {
+		return nil, err
+	}
+
+	for i := range bindingList.Items {
+		source := &bindingList.Items[i]
+
+		if !components[source.Spec.ComponentName] || source.DeletionTimestamp != nil {
+			continue
+		}
+
+		target := &corev1alpha1.ComponentPluginBinding{ObjectMeta: r.getTargetObjectMeta(source.Name)}
+
+		if err := r.createOrUpdate(target, source, func() { target.Spec = *source.Spec.DeepCopy() }); err != nil {
+			return nil, err
+		}
+
+		record.ComponentPluginBindings = append(record.ComponentPluginBindings, source.Name)
+	}
+
+	for _, name := range spec.HttpRoutes {
+		var source corev1alpha1.HttpRoute
+
+		if err := r.getSource(name, &source); err != nil {
+			return nil, err
+		}
+
+		routeSpec := getPromotedHttpRouteSpec(&source.Spec, spec.SourceNamespace, r.promotion.Namespace, spec.HostOverrides)
+		target := &corev1alpha1.HttpRoute{ObjectMeta: r.getTargetObjectMeta(name)}
+
+		if err := r.createOrUpdate(target, &source, func() { target.Spec = *routeSpec }); err != nil {
+			return nil, err
+		}
+
+		record.HttpRoutes = append(record.HttpRoutes, name)
+	}
+
+	for _, name := range spec.ProtectedEndpoints {
+		var source corev1alpha1.ProtectedEndpoint
+
+		if err := r.getSource(name, &source); err != nil {
+			return nil, err
+		}
+
+		target := &corev1alpha1.ProtectedEndpoint{ObjectMeta: r.getTargetObjectMeta(name)}
+
+		if err := r.createOrUpdate(target, &source, func() { target.Spec = *source.Spec.DeepCopy() }); err != nil {
+			return nil, err
+		}
+
+		record.ProtectedEndpoints = append(record.ProtectedEndpoints, name)
+	}
+
+	record.PromotedAt = metaV1.Now()
+
+	return record, nil
+}
+
+// promoteComponentSecret copies the values of secret envs and secret files, which are kept in the secret of the component
+// instead of the spec. The secret is owned by the target component, as the one created by the component controller.
+func (r *PromotionReconcilerTask) promoteComponentSecret(source, target *corev1alpha1.Component) error {
+	if !corev1alpha1.IsComponentSecretNeeded(source) {
+		return nil
+	}
+
+	var sourceSecret coreV1.Secret
+
+	err := r.Get(r.ctx, types.NamespacedName{
+		Namespace: source.Namespace,
+		Name:      corev1alpha1.ComponentSecretName(source.Name),
+	}, &sourceSecret)
+
+	// no values are written yet
+	if errors.IsNotFound(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !metaV1.IsControlledBy(&sourceSecret, source) {
+		return nil
+	}
+
+	secret := &coreV1.Secret{ObjectMeta: r.getTargetObjectMeta(corev1alpha1.ComponentSecretName(target.Name))}
+
+	_, err = controllerutil.CreateOrUpdate(r.ctx, r.Client, secret, func() error {
+		// fails if the secret is owned by something else
+		if err := ctrl.SetControllerReference(target, secret, r.Scheme); err != nil {
+			return err
+		}
+
+		secret.Type = coreV1.SecretTypeOpaque
+		secret.Data = make(map[string][]byte, len(sourceSecret.Data))
+
+		for key, value := range sourceSecret.Data {
+			secret.Data[key] = value
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("promote secret values of %s/%s failed: %s", target.Namespace, target.Name, err)
+	}
+
+	return nil
+}
+
+func (r *PromotionReconcilerTask) getSource(name string, obj runtime.Object) error {
+	err := r.Get(r.ctx, types.NamespacedName{Namespace: r.promotion.Spec.SourceNamespace, Name: name}, obj)
+
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("%s not found in %s", name, r.promotion.Spec.SourceNamespace)
+	}
+
+	return err
+}
+
+func (r *PromotionReconcilerTask) getTargetObjectMeta(name string) metaV1.ObjectMeta {
+	return metaV1.ObjectMeta{
+		Name:      name,
+		Namespace: r.promotion.Namespace,
+	}
+}
+
+// createOrUpdate copies the labels of the source object, and marks where the target is promoted from.
+func (r *PromotionReconcilerTask) createOrUpdate(target, source runtime.Object, mutate func()) error {
+	targetMeta := target.(metaV1.Object)
+	sourceMeta := source.(metaV1.Object)
+
+	_, err := controllerutil.CreateOrUpdate(r.ctx, r.Client, target, func() error {
+		targetMeta.SetLabels(mergeMap(targetMeta.GetLabels(), sourceMeta.GetLabels()))
+		targetMeta.SetAnnotations(mergeMap(targetMeta.GetAnnotations(), map[string]string{
+			AnnoPromotedFrom: fmt.Sprintf("%s/%s", sourceMeta.GetNamespace(), sourceMeta.GetName()),
+		}))
+
+		mutate()
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("promote %s/%s failed: %s", targetMeta.GetNamespace(), targetMeta.GetName(), err)
+	}
+
+	return nil
+}
+
+func applyPromotionComponentOverride(spec *corev1alpha1.ComponentSpec, override corev1alpha1.PromotionComponentOverride) {
+	if override.Replicas != nil {
+		replicas := *override.Replicas
+		spec.Replicas = &replicas
+	}
+
+	for _, env := range override.Env {
+		replaced := false
+
+		for i := range spec.Env {
+			if spec.Env[i].Name == env.Name {
+				spec.Env[i] = env
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			spec.Env = append(spec.Env, env)
+		}
+	}
+}
+
+// getPromotedHttpRouteSpec replaces the hosts with the overrides, and points destinations
+// in the source namespace to the promoted components.
+func getPromotedHttpRouteSpec(
+	spec *corev1alpha1.HttpRouteSpec,
+	sourceNamespace, targetNamespace string,
+	hostOverrides []corev1alpha1.PromotionHostOverride,
+) *corev1alpha1.HttpRouteSpec {
+	res := spec.DeepCopy()
+
+	for i, host := range res.Hosts {
+		for _, override := range hostOverrides {
+			if host == override.From {
+				res.Hosts[i] = override.To
+				break
+			}
+		}
+	}
+
+	for i := range res.Destinations {
+		res.Destinations[i].Host = getPromotedDestinationHost(res.Destinations[i].Host, sourceNamespace, targetNamespace)
+	}
+
+	if res.Mirror != nil {
+		res.Mirror.Destination.Host = getPromotedDestinationHost(res.Mirror.Destination.Host, sourceNamespace, targetNamespace)
+	}
+
+	return res
+}
+
+// the host is one of name[:port], name.namespace[:port] or name.namespace.svc.cluster.local[:port]
+func getPromotedDestinationHost(host, sourceNamespace, targetNamespace string) string {
+	parts := strings.SplitN(host, ".", 3)
+
+	if len(parts) < 2 {
+		return host
+	}
+
+	namespace := parts[1]
+	port := ""
+
+	if colon := strings.LastIndexByte(namespace, ':'); colon != -1 {
+		namespace, port = namespace[:colon], namespace[colon:]
+	}
+
+	if namespace != sourceNamespace {
+		return host
+	}
+
+	parts[1] = targetNamespace + port
+
+	return strings.Join(parts, ".")
+}
+
+func NewPromotionReconciler(mgr ctrl.Manager) *PromotionReconciler {
+	return &PromotionReconciler{
+		BaseReconciler: NewBaseReconciler(mgr, "Promotion"),
+	}
+}
+
+func (r *PromotionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1alpha1.Promotion{}).
+		Complete(r)
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetPromotedDestinationHost(t *testing.T) {
+	assert.Equal(t, "web", getPromotedDestinationHost("web", "dev", "staging"))
+	assert.Equal(t, "web:8080", getPromotedDestinationHost("web:8080", "dev", "staging"))
+	assert.Equal(t, "web.staging:8080", getPromotedDestinationHost("web.dev:8080", "dev", "staging"))
+	assert.Equal(t, "web.staging.svc.cluster.local:80", getPromotedDestinationHost("web.dev.svc.cluster.local:80", "dev", "staging"))
+	assert.Equal(t, "auth.kalm-system.svc.cluster.local", getPromotedDestinationHost("auth.kalm-system.svc.cluster.local", "dev", "staging"))
+}
+
+func TestGetPromotedHttpRouteSpec(t *testing.T) {
+	spec := &v1alpha1.HttpRouteSpec{
+		Hosts: []string{"dev.example.com", "api.example.com"},
+		Destinations: []v1alpha1.HttpRouteDestination{
+			{Host: "web.dev.svc.cluster.local:80", Weight: 1},
+		},
+	}
+
+	promoted := getPromotedHttpRouteSpec(spec, "dev", "staging", []v1alpha1.PromotionHostOverride{
+		{From: "dev.example.com", To: "staging.example.com"},
+	})
+
+	assert.Equal(t, []string{"staging.example.com", "api.example.com"}, promoted.Hosts)
+	assert.Equal(t, "web.staging.svc.cluster.local:80", promoted.Destinations[0].Host)
+
+	// the source is untouched
+	assert.Equal(t, "dev.example.com", spec.Hosts[0])
+}
+
+func TestApplyPromotionComponentOverride(t *testing.T) {
+	replicas := int32(3)
+
+	spec := &v1alpha1.ComponentSpec{
+		Env: []v1alpha1.EnvVar{
+			{Name: "APP_ENV", Value: "dev"},
+			{Name: "LOG_LEVEL", Value: "debug"},
+		},
+	}
+
+	applyPromotionComponentOverride(spec, v1alpha1.PromotionComponentOverride{
+		Name:     "web",
+		Replicas: &replicas,
+		Env: []v1alpha1.EnvVar{
+			{Name: "APP_ENV", Value: "staging"},
+			{Name: "SENTRY_DSN", Value: "https://sentry"},
+		},
+	})
+
+	assert.Equal(t, int32(3), *spec.Replicas)
+	assert.Equal(t, []v1alpha1.EnvVar{
+		{Name: "APP_ENV", Value: "staging"},
+		{Name: "LOG_LEVEL", Value: "debug"},
+		{Name: "SENTRY_DSN", Value: "https://sentry"},
+	}, spec.Env)
+}
+
+func TestAppendPromotionRecord(t *testing.T) {
+	var history []v1alpha1.PromotionRecord
+
+	for i := 1; i <= maxPromotionHistory+5; i++ {
+		history = appendPromotionRecord(history, v1alpha1.PromotionRecord{Generation: int64(i)})
+	}
+
+	assert.Len(t, history, maxPromotionHistory)
+	assert.Equal(t, int64(6), history[0].Generation)
+	assert.Equal(t, int64(maxPromotionHistory+5), history[maxPromotionHistory-1].Generation)
+}
+
+func TestPromoteComponentSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme))
+	assert.Nil(t, v1alpha1.AddToScheme(scheme))
+
+	source := &v1alpha1.Component{
+		ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "dev", UID: "source-uid"},
+		Spec: v1alpha1.ComponentSpec{
+			Env: []v1alpha1.EnvVar{{Name: "TOKEN", Type: v1alpha1.EnvVarTypeSecret}},
+		},
+	}
+
+	sourceSecret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: v1alpha1.ComponentSecretName("web"), Namespace: "dev"},
+		Data:       map[string][]byte{v1alpha1.ComponentSecretEnvKey("web", "TOKEN"): []byte("secret-value")},
+	}
+	assert.Nil(t, ctrl.SetControllerReference(source, sourceSecret, scheme))
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme, sourceSecret)
+
+	task := &PromotionReconcilerTask{
+		PromotionReconciler: &PromotionReconciler{&BaseReconciler{
+			Client: fakeClient,
+			Reader: fakeClient,
+			Scheme: scheme,
+		}},
+		ctx:       context.Background(),
+		promotion: &v1alpha1.Promotion{ObjectMeta: metaV1.ObjectMeta{Name: "promotion", Namespace: "staging"}},
+	}
+
+	target := &v1alpha1.Component{ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "staging", UID: "target-uid"}}
+
+	assert.Nil(t, task.promoteComponentSecret(source, target))
+
+	var secret coreV1.Secret
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Namespace: "staging", Name: v1alpha1.ComponentSecretName("web")}, &secret))
+	assert.Equal(t, sourceSecret.Data, secret.Data)
+	assert.True(t, metaV1.IsControlledBy(&secret, target))
+}
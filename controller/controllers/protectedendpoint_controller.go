@@ -17,6 +17,8 @@ package controllers
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	protoTypes "github.com/gogo/protobuf/types"
 	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
@@ -25,6 +27,7 @@ import (
 	v1beta13 "istio.io/api/type/v1beta1"
 	"istio.io/client-go/pkg/apis/networking/v1alpha3"
 	"istio.io/client-go/pkg/apis/security/v1beta1"
+	coreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -118,6 +121,29 @@ func (r *ProtectedEndpointReconcilerTask) Run(req ctrl.Request) error {
 
 	r.endpoint = &endpoint
 
+	reconcileErr := r.reconcile(req)
+
+	if err := r.UpdateStatus(reconcileErr); err != nil {
+		r.EmitWarningEvent(r.endpoint, err, "update protected endpoint status error.")
+
+		if reconcileErr == nil {
+			return err
+		}
+	}
+
+	if endpointErr, ok := reconcileErr.(*protectedEndpointError); ok && !endpointErr.retry {
+		return nil
+	}
+
+	return reconcileErr
+}
+
+func (r *ProtectedEndpointReconcilerTask) reconcile(req ctrl.Request) error {
+	if err := r.LoadResources(req); err != nil {
+		r.Log.Error(err, "Load resources error")
+		return err
+	}
+
 	var ssoList corev1alpha1.SingleSignOnConfigList
 
 	if err := r.Reader.List(r.ctx, &ssoList); err != nil {
@@ -127,24 +153,30 @@ func (r *ProtectedEndpointReconcilerTask) Run(req ctrl.Request) error {
 
 	if len(ssoList.Items) == 0 {
 		r.Log.Info("No sso config, skip.")
-		return r.DeleteResources()
+
+		if err := r.DeleteResources(); err != nil {
+			return err
+		}
+
+		return &protectedEndpointError{
+			reason: "SSOConfigNotFound",
+			err:    fmt.Errorf("No SSO config, the endpoint is not protected."),
+		}
 	}
 
 	if len(ssoList.Items) > 1 {
+		err := fmt.Errorf("Only one SSO config is allowed.")
+
 		r.Log.Error(
-			fmt.Errorf("Only one SSO config is allowed."),
+			err,
 			"Found more than one SSO configs, Please keep single one and delete the others.",
 		)
-		return nil
+
+		return &protectedEndpointError{reason: "MultipleSSOConfigs", err: err}
 	}
 
 	r.ssoConfig = &ssoList.Items[0]
 
-	if err := r.LoadResources(req); err != nil {
-		r.Log.Error(err, "Load resources error")
-		return err
-	}
-
 	return r.ReconcileResources(req)
 }
 
@@ -152,22 +184,28 @@ func (r *ProtectedEndpointReconcilerTask) DeleteResources() error {
 	if r.envoyFilter != nil {
 		if err := r.Delete(r.ctx, r.envoyFilter); err != nil {
 			r.Log.Error(err, "delete envoyFilter error")
-			return err
+			return newProtectedEndpointError("EnvoyFilterFailed", err)
 		}
+
+		r.envoyFilter = nil
 	}
 
 	if r.authorizationPolicy != nil {
 		if err := r.Delete(r.ctx, r.authorizationPolicy); err != nil {
 			r.Log.Error(err, "delete authorizationPolicy error")
-			return err
+			return newProtectedEndpointError("AuthorizationPolicyFailed", err)
 		}
+
+		r.authorizationPolicy = nil
 	}
 
 	if r.requestAuthentication != nil {
 		if err := r.Delete(r.ctx, r.requestAuthentication); err != nil {
 			r.Log.Error(err, "delete requestAuthentication error")
-			return err
+			return newProtectedEndpointError("RequestAuthenticationFailed", err)
 		}
+
+		r.requestAuthentication = nil
 	}
 
 	return nil
@@ -229,6 +267,12 @@ func (r *ProtectedEndpointReconcilerTask) BuildEnvoyFilter(req ctrl.Request) *v1
 		grantedGroups = strings.Join(r.endpoint.Spec.Groups, "|")
 	}
 
+	var authorizationRules string
+	if len(r.endpoint.Spec.AuthorizationRules) > 0 {
+		rulesBytes, _ := json.Marshal(r.endpoint.Spec.AuthorizationRules)
+		authorizationRules = base64.StdEncoding.EncodeToString(rulesBytes)
+	}
+
 	patch := &v1alpha32.EnvoyFilter_Patch{
 		Operation: v1alpha32.EnvoyFilter_Patch_INSERT_BEFORE,
 		Value: golangMapToProtoStruct(map[string]interface{}{
@@ -258,10 +302,25 @@ func (r *ProtectedEndpointReconcilerTask) BuildEnvoyFilter(req ctrl.Request) *v1
 								"value": grantedGroups,
 							},
 
+							map[string]interface{}{
+								"key":   KALM_SSO_AUTHORIZATION_RULES_HEADER,
+								"value": authorizationRules,
+							},
+
 							map[string]interface{}{
 								"key":   KALM_ALLOW_TO_PASS_IF_HAS_BEARER_TOKEN_HEADER,
 								"value": strconv.FormatBool(r.endpoint.Spec.AllowToPassIfHasBearerToken),
 							},
+
+							map[string]interface{}{
+								"key":   KALM_ALLOW_CREDENTIALS_HEADER,
+								"value": strconv.FormatBool(r.endpoint.Spec.AllowCredentials),
+							},
+
+							map[string]interface{}{
+								"key":   KALM_SSO_PROTECTED_ENDPOINT_HEADER,
+								"value": fmt.Sprintf("%s/%s", namespace, r.endpoint.Spec.EndpointName),
+							},
 						},
 					},
 					"authorizationResponse": map[string]interface{}{
@@ -336,12 +395,72 @@ func (r *ProtectedEndpointReconcilerTask) BuildEnvoyFilter(req ctrl.Request) *v1
 	}
 }
 
+// needsAuthorizationPolicy returns true if requests may pass the auth proxy without being checked by the rules.
+func (r *ProtectedEndpointReconcilerTask) needsAuthorizationPolicy() bool {
+	return r.endpoint.Spec.AllowToPassIfHasBearerToken && len(r.endpoint.Spec.AuthorizationRules) > 0
+}
+
+// BuildAuthorizationPolicy denies the requests with bearer tokens which don't satisfy the authorization rules.
+// Only requests with valid jwt tokens have request principals, the others are checked by the auth proxy.
 func (r *ProtectedEndpointReconcilerTask) BuildAuthorizationPolicy(req ctrl.Request) *v1beta1.AuthorizationPolicy {
 	name := fmt.Sprintf("kalm-sso-%s", req.Name)
 	namespace := req.Namespace
 	oidcProviderInfo := GetOIDCProviderInfo(r.ssoConfig)
 
-	policy := &v1beta1.AuthorizationPolicy{
+	var ports []string
+
+	for i := range r.endpoint.Spec.Ports {
+		ports = append(ports, strconv.Itoa(int(r.endpoint.Spec.Ports[i])))
+	}
+
+	from := []*v1beta12.Rule_From{
+		{
+			Source: &v1beta12.Source{
+				RequestPrincipals: []string{"*"},
+			},
+		},
+	}
+
+	rules := []*v1beta12.Rule{
+		{
+			From: from,
+			To:   buildAuthorizationPolicyTo(ports, nil, nil),
+			When: []*v1beta12.Condition{
+				{
+					Key: "request.auth.claims[iss]",
+					NotValues: []string{
+						oidcProviderInfo.Issuer,
+					},
+				},
+			},
+		},
+	}
+
+	for _, rule := range r.endpoint.Spec.AuthorizationRules {
+		to := buildAuthorizationPolicyTo(ports, rule.PathPrefixes, rule.Methods)
+
+		conditions := make([]*v1beta12.Condition, len(rule.Conditions))
+
+		for i, condition := range rule.Conditions {
+			conditions[i] = &v1beta12.Condition{
+				Key:       fmt.Sprintf("request.auth.claims[%s]", condition.Claim),
+				NotValues: condition.Values,
+			}
+		}
+
+		// Conditions of an istio rule are ANDed, and the rules are ORed.
+		if rule.Match == corev1alpha1.ClaimMatchAll {
+			// deny if any of the conditions doesn't hold
+			for _, condition := range conditions {
+				rules = append(rules, &v1beta12.Rule{From: from, To: to, When: []*v1beta12.Condition{condition}})
+			}
+		} else {
+			// deny if none of the conditions holds
+			rules = append(rules, &v1beta12.Rule{From: from, To: to, When: conditions})
+		}
+	}
+
+	return &v1beta1.AuthorizationPolicy{
 		ObjectMeta: metaV1.ObjectMeta{
 			Name:      name,
 			Namespace: namespace,
@@ -353,40 +472,36 @@ func (r *ProtectedEndpointReconcilerTask) BuildAuthorizationPolicy(req ctrl.Requ
 				},
 			},
 			Action: v1beta12.AuthorizationPolicy_DENY,
-			Rules: []*v1beta12.Rule{
-				{
-
-					When: []*v1beta12.Condition{
-						{
-							Key: "request.auth.claims[iss]",
-							NotValues: []string{
-								oidcProviderInfo.Issuer,
-							},
-						},
-						// Check group here
-					},
-				},
-			},
+			Rules:  rules,
 		},
 	}
+}
 
-	if len(r.endpoint.Spec.Ports) > 0 {
-		ports := make([]string, len(r.endpoint.Spec.Ports))
+func buildAuthorizationPolicyTo(ports, pathPrefixes, methods []string) []*v1beta12.Rule_To {
+	if len(ports) == 0 && len(pathPrefixes) == 0 && len(methods) == 0 {
+		return nil
+	}
 
-		for i := range r.endpoint.Spec.Ports {
-			ports[i] = strconv.Itoa(int(r.endpoint.Spec.Ports[i]))
-		}
+	var paths []string
 
-		policy.Spec.Rules[0].To = []*v1beta12.Rule_To{
-			{
-				Operation: &v1beta12.Operation{
-					Ports: ports,
-				},
-			},
+	// same as the auth proxy, /admin matches /admin and /admin/users, but not /administrator
+	for _, prefix := range pathPrefixes {
+		if strings.HasSuffix(prefix, "/") {
+			paths = append(paths, prefix+"*")
+		} else {
+			paths = append(paths, prefix, prefix+"/*")
 		}
 	}
 
-	return policy
+	return []*v1beta12.Rule_To{
+		{
+			Operation: &v1beta12.Operation{
+				Ports:   ports,
+				Paths:   paths,
+				Methods: methods,
+			},
+		},
+	}
 }
 
 func (r *ProtectedEndpointReconcilerTask) BuildRequestAuthentication(req ctrl.Request) *v1beta1.RequestAuthentication {
@@ -406,7 +521,10 @@ func (r *ProtectedEndpointReconcilerTask) BuildRequestAuthentication(req ctrl.Re
 			},
 			JwtRules: []*v1beta12.JWTRule{
 				{
-					Issuer: oidcProviderInfo.Issuer,
+					Issuer:  oidcProviderInfo.Issuer,
+					JwksUri: oidcProviderInfo.JwksURI,
+					// the upstream is responsible for the token if it's allowed to pass
+					ForwardOriginalToken: true,
 				},
 			},
 		},
@@ -416,6 +534,42 @@ func (r *ProtectedEndpointReconcilerTask) BuildRequestAuthentication(req ctrl.Re
 }
 
 func (r *ProtectedEndpointReconcilerTask) ReconcileResources(req ctrl.Request) error {
+	if err := r.reconcileEnvoyFilter(req); err != nil {
+		return newProtectedEndpointError("EnvoyFilterFailed", err)
+	}
+
+	if r.needsAuthorizationPolicy() {
+		if err := r.reconcileRequestAuthentication(req); err != nil {
+			return newProtectedEndpointError("RequestAuthenticationFailed", err)
+		}
+
+		if err := r.reconcileAuthorizationPolicy(req); err != nil {
+			return newProtectedEndpointError("AuthorizationPolicyFailed", err)
+		}
+
+		return nil
+	}
+
+	// Without bearer tokens let pass, all requests are checked by the auth proxy.
+	// Clean resources created by old logic, or before the rules are removed.
+	if r.requestAuthentication != nil {
+		if err := r.Delete(r.ctx, r.requestAuthentication); err != nil && !errors.IsNotFound(err) {
+			r.Log.Error(err, "delete requestAuthentication error")
+			return newProtectedEndpointError("RequestAuthenticationFailed", err)
+		}
+	}
+
+	if r.authorizationPolicy != nil {
+		if err := r.Delete(r.ctx, r.authorizationPolicy); err != nil && !errors.IsNotFound(err) {
+			r.Log.Error(err, "delete authorizationPolicy error")
+			return newProtectedEndpointError("AuthorizationPolicyFailed", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *ProtectedEndpointReconcilerTask) reconcileEnvoyFilter(req ctrl.Request) error {
 	envoyFilter := r.BuildEnvoyFilter(req)
 
 	if r.envoyFilter != nil {
@@ -431,6 +585,8 @@ func (r *ProtectedEndpointReconcilerTask) ReconcileResources(req ctrl.Request) e
 			r.Log.Error(err, "Patch envoyFilter failed.")
 			return err
 		}
+
+		r.envoyFilter = copied
 	} else {
 		if err := ctrl.SetControllerReference(r.endpoint, envoyFilter, r.Scheme); err != nil {
 			r.EmitWarningEvent(r.endpoint, err, "unable to set owner for envoyFilter")
@@ -441,18 +597,74 @@ func (r *ProtectedEndpointReconcilerTask) ReconcileResources(req ctrl.Request) e
 			r.Log.Error(err, "Create envoyFilter failed.")
 			return err
 		}
+
+		r.envoyFilter = envoyFilter
 	}
 
-	// requestAuthentication policy can't satisfy our demands
-	// Clean old resources created by old logic
+	return nil
+}
+
+func (r *ProtectedEndpointReconcilerTask) reconcileRequestAuthentication(req ctrl.Request) error {
+	requestAuthentication := r.BuildRequestAuthentication(req)
+
 	if r.requestAuthentication != nil {
-		r.Delete(r.ctx, r.requestAuthentication)
+		copied := r.requestAuthentication.DeepCopy()
+		copied.Spec = requestAuthentication.Spec
+
+		if err := ctrl.SetControllerReference(r.endpoint, copied, r.Scheme); err != nil {
+			r.EmitWarningEvent(r.endpoint, err, "unable to set owner for requestAuthentication")
+			return err
+		}
+
+		if err := r.Patch(r.ctx, copied, client.MergeFrom(r.requestAuthentication)); err != nil {
+			r.Log.Error(err, "Patch requestAuthentication failed.")
+			return err
+		}
+
+		return nil
+	}
+
+	if err := ctrl.SetControllerReference(r.endpoint, requestAuthentication, r.Scheme); err != nil {
+		r.EmitWarningEvent(r.endpoint, err, "unable to set owner for requestAuthentication")
+		return err
 	}
 
-	// authorization policy can't satisfy our demands
-	// Clean old resources created by old logic
+	if err := r.Create(r.ctx, requestAuthentication); err != nil {
+		r.Log.Error(err, "Create requestAuthentication failed.")
+		return err
+	}
+
+	return nil
+}
+
+func (r *ProtectedEndpointReconcilerTask) reconcileAuthorizationPolicy(req ctrl.Request) error {
+	authorizationPolicy := r.BuildAuthorizationPolicy(req)
+
 	if r.authorizationPolicy != nil {
-		r.Delete(r.ctx, r.authorizationPolicy)
+		copied := r.authorizationPolicy.DeepCopy()
+		copied.Spec = authorizationPolicy.Spec
+
+		if err := ctrl.SetControllerReference(r.endpoint, copied, r.Scheme); err != nil {
+			r.EmitWarningEvent(r.endpoint, err, "unable to set owner for authorizationPolicy")
+			return err
+		}
+
+		if err := r.Patch(r.ctx, copied, client.MergeFrom(r.authorizationPolicy)); err != nil {
+			r.Log.Error(err, "Patch authorizationPolicy failed.")
+			return err
+		}
+
+		return nil
+	}
+
+	if err := ctrl.SetControllerReference(r.endpoint, authorizationPolicy, r.Scheme); err != nil {
+		r.EmitWarningEvent(r.endpoint, err, "unable to set owner for authorizationPolicy")
+		return err
+	}
+
+	if err := r.Create(r.ctx, authorizationPolicy); err != nil {
+		r.Log.Error(err, "Create authorizationPolicy failed.")
+		return err
 	}
 
 	return nil
@@ -523,6 +735,8 @@ func golangValueToProtoValue(val interface{}) *protoTypes.Value {
 
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=protectedendpoints,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=protectedendpoints/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch
 // +kubebuilder:rbac:groups=networking.istio.io,resources=envoyfilters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.istio.io,resources=envoyfilters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=security.istio.io,resources=requestauthentications,verbs=get;list;watch;create;update;patch;delete
@@ -572,6 +786,49 @@ func (r *WatchAllSSOConfig) Map(object handler.MapObject) []reconcile.Request {
 	return reqs
 }
 
+// PodMapperForProtectedEndpoint enqueues the endpoints protecting the component of the pod, to count the protected pods.
+type PodMapperForProtectedEndpoint struct {
+	*BaseReconciler
+}
+
+func (r *PodMapperForProtectedEndpoint) Map(object handler.MapObject) []reconcile.Request {
+	componentName := object.Meta.GetLabels()[KalmLabelComponentKey]
+
+	if componentName == "" {
+		return nil
+	}
+
+	// pods change all the time, the endpoints are listed from the cache instead of the api server
+	var endpointList corev1alpha1.ProtectedEndpointList
+
+	if err := r.List(context.Background(), &endpointList, client.InNamespace(object.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "Get protected endpoints list failed.")
+		return nil
+	}
+
+	// most namespaces have no protected endpoints
+	if len(endpointList.Items) == 0 {
+		return nil
+	}
+
+	var reqs []reconcile.Request
+
+	for _, endpoint := range endpointList.Items {
+		if endpoint.Spec.EndpointName != componentName {
+			continue
+		}
+
+		reqs = append(reqs, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      endpoint.Name,
+				Namespace: endpoint.Namespace,
+			},
+		})
+	}
+
+	return reqs
+}
+
 func (r *ProtectedEndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1alpha1.ProtectedEndpoint{}).
@@ -584,6 +841,12 @@ func (r *ProtectedEndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				ToRequests: &WatchAllSSOConfig{r.BaseReconciler},
 			},
 		).
+		Watches(
+			genSourceForObject(&coreV1.Pod{}),
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: &PodMapperForProtectedEndpoint{r.BaseReconciler},
+			},
+		).
 		Complete(r)
 }
 
@@ -1 +1,186 @@
 package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	v1beta12 "istio.io/api/security/v1beta1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newProtectedEndpointTestTask(spec corev1alpha1.ProtectedEndpointSpec) *ProtectedEndpointReconcilerTask {
+	return &ProtectedEndpointReconcilerTask{
+		endpoint: &corev1alpha1.ProtectedEndpoint{
+			ObjectMeta: metaV1.ObjectMeta{Name: "component-web", Namespace: "test"},
+			Spec:       spec,
+		},
+		ssoConfig: &corev1alpha1.SingleSignOnConfig{
+			Spec: corev1alpha1.SingleSignOnConfigSpec{Domain: "sso.test"},
+		},
+	}
+}
+
+// headers added to the requests sent to the auth proxy
+func envoyFilterHeadersToAdd(task *ProtectedEndpointReconcilerTask) map[string]string {
+	envoyFilter := task.BuildEnvoyFilter(ctrl.Request{NamespacedName: types.NamespacedName{Name: "component-web", Namespace: "test"}})
+
+	headers := envoyFilter.Spec.ConfigPatches[0].Patch.Value.
+		Fields["config"].GetStructValue().
+		Fields["httpService"].GetStructValue().
+		Fields["authorizationRequest"].GetStructValue().
+		Fields["headersToAdd"].GetListValue().Values
+
+	rst := make(map[string]string)
+
+	for _, header := range headers {
+		fields := header.GetStructValue().Fields
+		rst[fields["key"].GetStringValue()] = fields["value"].GetStringValue()
+	}
+
+	return rst
+}
+
+var testAuthorizationRules = []corev1alpha1.AuthorizationRule{
+	{
+		PathPrefixes: []string{"/admin"},
+		Conditions: []corev1alpha1.ClaimCondition{
+			{Claim: "email", Values: []string{"*@example.com"}},
+			{Claim: "sub", Values: []string{"root"}},
+		},
+	},
+	{
+		PathPrefixes: []string{"/api/"},
+		Methods:      []string{"POST"},
+		Match:        corev1alpha1.ClaimMatchAll,
+		Conditions: []corev1alpha1.ClaimCondition{
+			{Claim: "groups", Values: []string{"dev"}},
+			{Claim: "tier", Values: []string{"gold"}},
+		},
+	},
+}
+
+func TestBuildProtectedEndpointAuthorizationPolicy(t *testing.T) {
+	task := newProtectedEndpointTestTask(corev1alpha1.ProtectedEndpointSpec{
+		EndpointName:                "web",
+		Ports:                       []uint32{8080},
+		AllowToPassIfHasBearerToken: true,
+		AuthorizationRules:          testAuthorizationRules,
+	})
+
+	assert.True(t, task.needsAuthorizationPolicy())
+
+	policy := task.BuildAuthorizationPolicy(ctrl.Request{NamespacedName: types.NamespacedName{Name: "component-web", Namespace: "test"}})
+	assert.Equal(t, "kalm-sso-component-web", policy.Name)
+	assert.Equal(t, v1beta12.AuthorizationPolicy_DENY, policy.Spec.Action)
+
+	// issuer, one rule for the any rule, and one rule per condition for the all rule
+	rules := policy.Spec.Rules
+	assert.Len(t, rules, 4)
+
+	for _, rule := range rules {
+		assert.Equal(t, []string{"*"}, rule.From[0].Source.RequestPrincipals)
+		assert.Equal(t, []string{"8080"}, rule.To[0].Operation.Ports)
+	}
+
+	assert.Equal(t, "request.auth.claims[iss]", rules[0].When[0].Key)
+	assert.Equal(t, []string{"https://sso.test/dex"}, rules[0].When[0].NotValues)
+	assert.Nil(t, rules[0].To[0].Operation.Paths)
+
+	assert.Equal(t, []string{"/admin", "/admin/*"}, rules[1].To[0].Operation.Paths)
+	assert.Len(t, rules[1].When, 2)
+	assert.Equal(t, "request.auth.claims[email]", rules[1].When[0].Key)
+	assert.Equal(t, []string{"*@example.com"}, rules[1].When[0].NotValues)
+
+	for _, rule := range rules[2:] {
+		assert.Equal(t, []string{"/api/*"}, rule.To[0].Operation.Paths)
+		assert.Equal(t, []string{"POST"}, rule.To[0].Operation.Methods)
+		assert.Len(t, rule.When, 1)
+	}
+
+	assert.Equal(t, "request.auth.claims[groups]", rules[2].When[0].Key)
+	assert.Equal(t, "request.auth.claims[tier]", rules[3].When[0].Key)
+
+	// requests with bearer tokens are checked by the auth proxy
+	task.endpoint.Spec.AllowToPassIfHasBearerToken = false
+	assert.False(t, task.needsAuthorizationPolicy())
+}
+
+func TestBuildProtectedEndpointEnvoyFilterAuthorizationRules(t *testing.T) {
+	task := newProtectedEndpointTestTask(corev1alpha1.ProtectedEndpointSpec{
+		EndpointName:       "web",
+		AuthorizationRules: testAuthorizationRules,
+	})
+
+	headers := envoyFilterHeadersToAdd(task)
+
+	bts, err := base64.StdEncoding.DecodeString(headers[KALM_SSO_AUTHORIZATION_RULES_HEADER])
+	assert.Nil(t, err)
+
+	var rules []corev1alpha1.AuthorizationRule
+	assert.Nil(t, json.Unmarshal(bts, &rules))
+	assert.Equal(t, testAuthorizationRules, rules)
+}
+
+func TestBuildProtectedEndpointEnvoyFilterCredentials(t *testing.T) {
+	task := newProtectedEndpointTestTask(corev1alpha1.ProtectedEndpointSpec{
+		EndpointName:     "web",
+		AllowCredentials: true,
+	})
+
+	headers := envoyFilterHeadersToAdd(task)
+	assert.Equal(t, "true", headers[KALM_ALLOW_CREDENTIALS_HEADER])
+	assert.Equal(t, "test/web", headers[KALM_SSO_PROTECTED_ENDPOINT_HEADER])
+
+	task.endpoint.Spec.AllowCredentials = false
+	assert.Equal(t, "false", envoyFilterHeadersToAdd(task)[KALM_ALLOW_CREDENTIALS_HEADER])
+}
+
+func TestPodMapperForProtectedEndpoint(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, corev1alpha1.AddToScheme(scheme))
+
+	newEndpoint := func(namespace, name, endpointName string) *corev1alpha1.ProtectedEndpoint {
+		return &corev1alpha1.ProtectedEndpoint{
+			ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1alpha1.ProtectedEndpointSpec{EndpointName: endpointName},
+		}
+	}
+
+	// the reader is not set, endpoints must be listed from the cache
+	mapper := &PodMapperForProtectedEndpoint{&BaseReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme,
+			newEndpoint("test", "component-web", "web"),
+			newEndpoint("test", "component-api", "api"),
+			newEndpoint("other", "component-web", "web"),
+		),
+		Log: ctrl.Log,
+	}}
+
+	mapPod := func(namespace, component string) []reconcile.Request {
+		pod := &coreV1.Pod{ObjectMeta: metaV1.ObjectMeta{
+			Name:      "pod",
+			Namespace: namespace,
+			Labels:    map[string]string{KalmLabelComponentKey: component},
+		}}
+
+		return mapper.Map(handler.MapObject{Meta: pod, Object: pod})
+	}
+
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "test", Name: "component-web"}},
+	}, mapPod("test", "web"))
+
+	assert.Nil(t, mapPod("test", "worker"))
+	assert.Nil(t, mapPod("no-endpoints", "web"))
+	assert.Nil(t, mapPod("test", ""))
+}
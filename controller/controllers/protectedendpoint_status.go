@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+
+	corev1alpha1 "github.com/kalmhq/kalm/controller/api/v1alpha1"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	apiEquality "k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const istioSidecarContainerName = "istio-proxy"
+
+// protectedEndpointError is reported as the reason of the Error condition of the endpoint.
+type protectedEndpointError struct {
+	reason string
+	err    error
+
+	// Errors of the sso config are not retried, endpoints are reconciled when sso configs change.
+	retry bool
+}
+
+func (e *protectedEndpointError) Error() string {
+	return e.err.Error()
+}
+
+func newProtectedEndpointError(reason string, err error) *protectedEndpointError {
+	return &protectedEndpointError{reason: reason, err: err, retry: true}
+}
+
+// protectedEndpointPodsSummary is the result of the running pods of the protected component.
+type protectedEndpointPodsSummary struct {
+	matched     int
+	withSidecar int
+
+	// container ports, the envoy filter applies to all of them if no port is set in the spec
+	ports []uint32
+}
+
+// UpdateStatus writes the matched workloads and pods, and the result of the reconciliation (reconcileErr),
+// back to the protected endpoint status.
+func (r *ProtectedEndpointReconcilerTask) UpdateStatus(reconcileErr error) error {
+	workloads, err := r.getMatchedWorkloads()
+
+	if err != nil {
+		return err
+	}
+
+	var podList coreV1.PodList
+
+	if err := r.List(
+		r.ctx,
+		&podList,
+		client.InNamespace(r.endpoint.Namespace),
+		client.MatchingLabels{KalmLabelComponentKey: r.endpoint.Spec.EndpointName},
+	); err != nil {
+		return err
+	}
+
+	summary := summarizeProtectedEndpointPods(podList.Items)
+
+	status := r.endpoint.Status.DeepCopy()
+	status.ObservedGeneration = r.endpoint.Generation
+	status.MatchedWorkloads = workloads
+	status.MatchedPods = summary.matched
+
+	if len(r.endpoint.Spec.Ports) > 0 {
+		status.ProtectedPorts = r.endpoint.Spec.Ports
+	} else {
+		status.ProtectedPorts = summary.ports
+	}
+
+	// the filter is deleted if there is no sso config
+	if r.envoyFilter != nil {
+		status.ProtectedPods = summary.withSidecar
+	} else {
+		status.ProtectedPods = 0
+	}
+
+	if r.ssoConfig != nil {
+		status.Issuer = GetOIDCProviderInfo(r.ssoConfig).Issuer
+	} else {
+		status.Issuer = ""
+	}
+
+	setProtectedEndpointConditions(status, reconcileErr)
+
+	if apiEquality.Semantic.DeepEqual(&r.endpoint.Status, status) {
+		return nil
+	}
+
+	endpointCopy := r.endpoint.DeepCopy()
+	endpointCopy.Status = *status
+
+	if err := r.Status().Patch(r.ctx, endpointCopy, client.MergeFrom(r.endpoint)); err != nil {
+		return err
+	}
+
+	r.endpoint = endpointCopy
+
+	return nil
+}
+
+// getMatchedWorkloads returns the workloads selected by the envoy filter, cronjobs don't serve requests.
+func (r *ProtectedEndpointReconcilerTask) getMatchedWorkloads() ([]string, error) {
+	opts := []client.ListOption{
+		client.InNamespace(r.endpoint.Namespace),
+		client.MatchingLabels{KalmLabelComponentKey: r.endpoint.Spec.EndpointName},
+	}
+
+	var workloads []string
+
+	var deploymentList appsV1.DeploymentList
+
+	if err := r.List(r.ctx, &deploymentList, opts...); err != nil {
+		return nil, err
+	}
+
+	for _, deployment := range deploymentList.Items {
+		workloads = append(workloads, "Deployment/"+deployment.Name)
+	}
+
+	var statefulSetList appsV1.StatefulSetList
+
+	if err := r.List(r.ctx, &statefulSetList, opts...); err != nil {
+		return nil, err
+	}
+
+	for _, statefulSet := range statefulSetList.Items {
+		workloads = append(workloads, "StatefulSet/"+statefulSet.Name)
+	}
+
+	var daemonSetList appsV1.DaemonSetList
+
+	if err := r.List(r.ctx, &daemonSetList, opts...); err != nil {
+		return nil, err
+	}
+
+	for _, daemonSet := range daemonSetList.Items {
+		workloads = append(workloads, "DaemonSet/"+daemonSet.Name)
+	}
+
+	return workloads, nil
+}
+
+// summarizeProtectedEndpointPods counts the running pods. The envoy filter only takes effect in the istio sidecar.
+func summarizeProtectedEndpointPods(pods []coreV1.Pod) protectedEndpointPodsSummary {
+	var summary protectedEndpointPodsSummary
+	ports := make(map[uint32]struct{})
+
+	for _, pod := range pods {
+		if pod.Status.Phase != coreV1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		summary.matched += 1
+
+		for _, container := range pod.Spec.Containers {
+			if container.Name == istioSidecarContainerName {
+				summary.withSidecar += 1
+				continue
+			}
+
+			for _, port := range container.Ports {
+				ports[uint32(port.ContainerPort)] = struct{}{}
+			}
+		}
+	}
+
+	for port := range ports {
+		summary.ports = append(summary.ports, port)
+	}
+
+	sort.Slice(summary.ports, func(i, j int) bool { return summary.ports[i] < summary.ports[j] })
+
+	return summary
+}
+
+func setProtectedEndpointConditions(status *corev1alpha1.ProtectedEndpointStatus, reconcileErr error) {
+	if reconcileErr != nil {
+		reason := "ReconcileError"
+
+		if endpointErr, ok := reconcileErr.(*protectedEndpointError); ok {
+			reason = endpointErr.reason
+		}
+
+		setProtectedEndpointCondition(status, corev1alpha1.ProtectedEndpointConditionError, coreV1.ConditionTrue, reason, reconcileErr.Error())
+		setProtectedEndpointCondition(status, corev1alpha1.ProtectedEndpointConditionReady, coreV1.ConditionFalse, reason, reconcileErr.Error())
+		return
+	}
+
+	setProtectedEndpointCondition(status, corev1alpha1.ProtectedEndpointConditionError, coreV1.ConditionFalse, "", "")
+
+	switch {
+	case status.MatchedPods == 0 && len(status.MatchedWorkloads) == 0:
+		setProtectedEndpointCondition(status, corev1alpha1.ProtectedEndpointConditionReady, coreV1.ConditionFalse, "NoMatchedWorkloads", "No workload of the component is found.")
+	case status.MatchedPods == 0:
+		setProtectedEndpointCondition(status, corev1alpha1.ProtectedEndpointConditionReady, coreV1.ConditionFalse, "NoRunningPods", "No pod of the component is running.")
+	case status.ProtectedPods < status.MatchedPods:
+		setProtectedEndpointCondition(status, corev1alpha1.ProtectedEndpointConditionReady, coreV1.ConditionFalse, "SidecarNotInjected",
+			fmt.Sprintf("%d of %d running pods have no istio sidecar, they are not protected.", status.MatchedPods-status.ProtectedPods, status.MatchedPods))
+	default:
+		setProtectedEndpointCondition(status, corev1alpha1.ProtectedEndpointConditionReady, coreV1.ConditionTrue, "Protected", "")
+	}
+}
+
+func setProtectedEndpointCondition(status *corev1alpha1.ProtectedEndpointStatus, conditionType corev1alpha1.ProtectedEndpointConditionType, conditionStatus coreV1.ConditionStatus, reason, message string) {
+	setStatusCondition(&status.Conditions, string(conditionType), conditionStatus, reason, message)
+}
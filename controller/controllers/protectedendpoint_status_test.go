@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func getProtectedEndpointCondition(status *v1alpha1.ProtectedEndpointStatus, conditionType v1alpha1.ProtectedEndpointConditionType) *v1alpha1.ProtectedEndpointCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+func newProtectedEndpointTestPod(phase coreV1.PodPhase, withSidecar bool, ports ...int32) coreV1.Pod {
+	containerPorts := make([]coreV1.ContainerPort, len(ports))
+
+	for i := range ports {
+		containerPorts[i] = coreV1.ContainerPort{ContainerPort: ports[i]}
+	}
+
+	pod := coreV1.Pod{
+		Spec: coreV1.PodSpec{
+			Containers: []coreV1.Container{{Name: "web", Ports: containerPorts}},
+		},
+		Status: coreV1.PodStatus{Phase: phase},
+	}
+
+	if withSidecar {
+		pod.Spec.Containers = append(pod.Spec.Containers, coreV1.Container{
+			Name:  istioSidecarContainerName,
+			Ports: []coreV1.ContainerPort{{ContainerPort: 15090}},
+		})
+	}
+
+	return pod
+}
+
+func TestSummarizeProtectedEndpointPods(t *testing.T) {
+	terminating := newProtectedEndpointTestPod(coreV1.PodRunning, true, 8080)
+	terminating.DeletionTimestamp = &metaV1.Time{}
+
+	summary := summarizeProtectedEndpointPods([]coreV1.Pod{
+		newProtectedEndpointTestPod(coreV1.PodRunning, true, 8080, 3000),
+		newProtectedEndpointTestPod(coreV1.PodRunning, false, 8080),
+		newProtectedEndpointTestPod(coreV1.PodPending, true, 9090),
+		terminating,
+	})
+
+	assert.Equal(t, 2, summary.matched)
+	assert.Equal(t, 1, summary.withSidecar)
+
+	// ports of the sidecar are not protected
+	assert.Equal(t, []uint32{3000, 8080}, summary.ports)
+}
+
+func TestSetProtectedEndpointConditions(t *testing.T) {
+	status := &v1alpha1.ProtectedEndpointStatus{}
+
+	setProtectedEndpointConditions(status, &protectedEndpointError{
+		reason: "SSOConfigNotFound",
+		err:    fmt.Errorf("No SSO config, the endpoint is not protected."),
+	})
+
+	errorCondition := getProtectedEndpointCondition(status, v1alpha1.ProtectedEndpointConditionError)
+	assert.Equal(t, coreV1.ConditionTrue, errorCondition.Status)
+	assert.Equal(t, "SSOConfigNotFound", errorCondition.Reason)
+	assert.Equal(t, "No SSO config, the endpoint is not protected.", errorCondition.Message)
+	assert.Equal(t, coreV1.ConditionFalse, getProtectedEndpointCondition(status, v1alpha1.ProtectedEndpointConditionReady).Status)
+
+	setProtectedEndpointConditions(status, newProtectedEndpointError("EnvoyFilterFailed", fmt.Errorf("admission webhook denied the request")))
+	assert.Equal(t, "EnvoyFilterFailed", getProtectedEndpointCondition(status, v1alpha1.ProtectedEndpointConditionError).Reason)
+
+	setProtectedEndpointConditions(status, fmt.Errorf("connection refused"))
+	assert.Equal(t, "ReconcileError", getProtectedEndpointCondition(status, v1alpha1.ProtectedEndpointConditionReady).Reason)
+
+	setProtectedEndpointConditions(status, nil)
+	assert.Equal(t, coreV1.ConditionFalse, getProtectedEndpointCondition(status, v1alpha1.ProtectedEndpointConditionError).Status)
+	assert.Equal(t, "NoMatchedWorkloads", getProtectedEndpointCondition(status, v1alpha1.ProtectedEndpointConditionReady).Reason)
+
+	status.MatchedWorkloads = []string{"Deployment/web"}
+	setProtectedEndpointConditions(status, nil)
+	assert.Equal(t, "NoRunningPods", getProtectedEndpointCondition(status, v1alpha1.ProtectedEndpointConditionReady).Reason)
+
+	status.MatchedPods = 2
+	status.ProtectedPods = 1
+	setProtectedEndpointConditions(status, nil)
+
+	ready := getProtectedEndpointCondition(status, v1alpha1.ProtectedEndpointConditionReady)
+	assert.Equal(t, coreV1.ConditionFalse, ready.Status)
+	assert.Equal(t, "SidecarNotInjected", ready.Reason)
+	assert.Equal(t, "1 of 2 running pods have no istio sidecar, they are not protected.", ready.Message)
+
+	status.ProtectedPods = 2
+	setProtectedEndpointConditions(status, nil)
+	assert.Equal(t, coreV1.ConditionTrue, getProtectedEndpointCondition(status, v1alpha1.ProtectedEndpointConditionReady).Status)
+	assert.Len(t, status.Conditions, 2)
+}
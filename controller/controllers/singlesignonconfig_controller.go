@@ -26,6 +26,7 @@ import (
 	v1alpha32 "istio.io/client-go/pkg/apis/networking/v1alpha3"
 	coreV1 "k8s.io/api/core/v1"
 	rbacV1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -41,6 +42,22 @@ const KALM_DEX_NAMESPACE = "kalm-system"
 const KALM_DEX_NAME = "dex"
 const KALM_AUTH_PROXY_NAME = "auth-proxy"
 
+// Namespace in which the auth proxy keeps its leases and secrets
+const KALM_AUTH_PROXY_NAMESPACE_ENV = "KALM_AUTH_PROXY_NAMESPACE"
+
+// Envs telling the auth proxy how to share refreshes of tokens between its replicas
+const KALM_AUTH_PROXY_REFRESH_COORDINATOR_ENV = "KALM_AUTH_PROXY_REFRESH_COORDINATOR"
+const KALM_AUTH_PROXY_REFRESH_COORDINATOR_LEASE = "lease"
+
+// Env telling the auth proxy where to keep sessions
+const KALM_AUTH_PROXY_SESSION_STORE_ENV = "KALM_AUTH_PROXY_SESSION_STORE"
+const KALM_AUTH_PROXY_SESSION_STORE_SECRET = "secret"
+
+// Session secrets are kept in their own namespace, the auth proxy is not allowed to access other secrets
+const KALM_AUTH_PROXY_SESSION_NAMESPACE = "kalm-sso-sessions"
+const KALM_AUTH_PROXY_SESSION_NAMESPACE_ENV = "KALM_AUTH_PROXY_SESSION_NAMESPACE"
+const KALM_AUTH_PROXY_SESSION_ROLE_NAME = "auth-proxy-sessions"
+
 // SingleSignOnConfigReconciler reconciles a SingleSignOnConfig object
 type SingleSignOnConfigReconciler struct {
 	*BaseReconciler
@@ -188,6 +205,10 @@ func (r *SingleSignOnConfigReconcilerTask) LoadResources() error {
 }
 
 func (r *SingleSignOnConfigReconcilerTask) DeleteResources() error {
+	if err := r.DeleteAuthProxySessionPermission(); err != nil {
+		return err
+	}
+
 	if r.secret != nil {
 		if err := r.Delete(r.ctx, r.secret); err != nil {
 			r.Log.Error(err, "delete dex secret error")
@@ -600,6 +621,66 @@ func (r *SingleSignOnConfigReconcilerTask) ReconcileInternalAuthProxyComponent()
 		},
 	}
 
+	replicas := int32(1)
+
+	if r.ssoConfig.Spec.AuthProxyReplicas != nil {
+		replicas = *r.ssoConfig.Spec.AuthProxyReplicas
+	}
+
+	authProxyComponent.Spec.Replicas = &replicas
+
+	// sso credentials are verified by the auth proxy, their usage is recorded in the status
+	permissionRules := []rbacV1.PolicyRule{
+		{
+			APIGroups: []string{corev1alpha1.GroupVersion.Group},
+			Resources: []string{"ssocredentials"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+		{
+			APIGroups: []string{corev1alpha1.GroupVersion.Group},
+			Resources: []string{"ssocredentials/status"},
+			Verbs:     []string{"get", "update", "patch"},
+		},
+	}
+
+	// a refresh token can only be used once, replicas have to share the refreshed tokens
+	if replicas > 1 {
+		authProxyComponent.Spec.Env = append(authProxyComponent.Spec.Env, corev1alpha1.EnvVar{
+			Type:  corev1alpha1.EnvVarTypeStatic,
+			Name:  KALM_AUTH_PROXY_REFRESH_COORDINATOR_ENV,
+			Value: KALM_AUTH_PROXY_REFRESH_COORDINATOR_LEASE,
+		})
+
+		permissionRules = append(permissionRules, rbacV1.PolicyRule{
+			APIGroups: []string{"coordination.k8s.io"},
+			Resources: []string{"leases"},
+			Verbs:     []string{"get", "list", "create", "update", "delete"},
+		})
+	}
+
+	if r.ssoConfig.Spec.AuthProxySessionStore == KALM_AUTH_PROXY_SESSION_STORE_SECRET {
+		authProxyComponent.Spec.Env = append(authProxyComponent.Spec.Env, corev1alpha1.EnvVar{
+			Type:  corev1alpha1.EnvVarTypeStatic,
+			Name:  KALM_AUTH_PROXY_SESSION_STORE_ENV,
+			Value: KALM_AUTH_PROXY_SESSION_STORE_SECRET,
+		}, corev1alpha1.EnvVar{
+			Type:  corev1alpha1.EnvVarTypeStatic,
+			Name:  KALM_AUTH_PROXY_SESSION_NAMESPACE_ENV,
+			Value: KALM_AUTH_PROXY_SESSION_NAMESPACE,
+		})
+	}
+
+	authProxyComponent.Spec.Env = append(authProxyComponent.Spec.Env, corev1alpha1.EnvVar{
+		Type:  corev1alpha1.EnvVarTypeStatic,
+		Name:  KALM_AUTH_PROXY_NAMESPACE_ENV,
+		Value: KALM_DEX_NAMESPACE,
+	})
+
+	authProxyComponent.Spec.RunnerPermission = &corev1alpha1.RunnerPermission{
+		RoleType: "role",
+		Rules:    permissionRules,
+	}
+
 	if r.authProxyComponent != nil {
 		copied := r.authProxyComponent.DeepCopy()
 		copied.Spec = authProxyComponent.Spec
@@ -642,8 +723,9 @@ func (r *SingleSignOnConfigReconcilerTask) ReconcileInternalAuthProxyRoute() err
 			},
 			Methods: []corev1alpha1.HttpRouteMethod{
 				"GET",
+				"POST",
 			},
-			Paths: []string{"/oidc/login", "/oidc/callback"},
+			Paths: []string{"/oidc/login", "/oidc/callback", "/oauth2/token"},
 			Schemes: []corev1alpha1.HttpRouteScheme{
 				corev1alpha1.HttpRouteScheme("http"),
 				corev1alpha1.HttpRouteScheme("https"),
@@ -692,7 +774,142 @@ func (r *SingleSignOnConfigReconcilerTask) ReconcileInternalAuthProxyRoute() err
 	return nil
 }
 
+// ReconcileAuthProxySessionPermission allows the internal auth proxy to access secrets in the session namespace only.
+// The permission is revoked once sessions are no longer kept in secrets.
+func (r *SingleSignOnConfigReconcilerTask) ReconcileAuthProxySessionPermission() error {
+	if r.ssoConfig.Spec.ExternalEnvoyExtAuthz != nil || r.ssoConfig.Spec.AuthProxySessionStore != KALM_AUTH_PROXY_SESSION_STORE_SECRET {
+		return r.DeleteAuthProxySessionPermission()
+	}
+
+	var namespace coreV1.Namespace
+
+	if err := r.Get(r.ctx, types.NamespacedName{Name: KALM_AUTH_PROXY_SESSION_NAMESPACE}, &namespace); err != nil {
+		if !errors.IsNotFound(err) {
+			r.Log.Error(err, "get auth proxy session namespace failed.")
+			return err
+		}
+
+		namespace = coreV1.Namespace{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name: KALM_AUTH_PROXY_SESSION_NAMESPACE,
+			},
+		}
+
+		if err := r.Create(r.ctx, &namespace); err != nil {
+			r.Log.Error(err, "create auth proxy session namespace failed.")
+			return err
+		}
+	}
+
+	// the auth proxy watches sessions, so revoked ones are removed from its cache
+	rules := []rbacV1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     []string{"get", "list", "watch", "create", "update", "delete"},
+		},
+	}
+
+	var role rbacV1.Role
+
+	if err := r.Get(r.ctx, types.NamespacedName{
+		Name:      KALM_AUTH_PROXY_SESSION_ROLE_NAME,
+		Namespace: KALM_AUTH_PROXY_SESSION_NAMESPACE,
+	}, &role); err != nil {
+		if !errors.IsNotFound(err) {
+			r.Log.Error(err, "get auth proxy session role failed.")
+			return err
+		}
+
+		role = rbacV1.Role{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      KALM_AUTH_PROXY_SESSION_ROLE_NAME,
+				Namespace: KALM_AUTH_PROXY_SESSION_NAMESPACE,
+			},
+			Rules: rules,
+		}
+
+		if err := r.Create(r.ctx, &role); err != nil {
+			r.Log.Error(err, "create auth proxy session role failed.")
+			return err
+		}
+	} else if !equality.Semantic.DeepEqual(role.Rules, rules) {
+		role.Rules = rules
+
+		if err := r.Update(r.ctx, &role); err != nil {
+			r.Log.Error(err, "update auth proxy session role failed.")
+			return err
+		}
+	}
+
+	var roleBinding rbacV1.RoleBinding
+
+	if err := r.Get(r.ctx, types.NamespacedName{
+		Name:      KALM_AUTH_PROXY_SESSION_ROLE_NAME,
+		Namespace: KALM_AUTH_PROXY_SESSION_NAMESPACE,
+	}, &roleBinding); err != nil {
+		if !errors.IsNotFound(err) {
+			r.Log.Error(err, "get auth proxy session role binding failed.")
+			return err
+		}
+
+		roleBinding = rbacV1.RoleBinding{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      KALM_AUTH_PROXY_SESSION_ROLE_NAME,
+				Namespace: KALM_AUTH_PROXY_SESSION_NAMESPACE,
+			},
+			RoleRef: rbacV1.RoleRef{
+				APIGroup: rbacV1.GroupName,
+				Kind:     "Role",
+				Name:     KALM_AUTH_PROXY_SESSION_ROLE_NAME,
+			},
+			Subjects: []rbacV1.Subject{
+				{
+					Kind:      "ServiceAccount",
+					Name:      getRunnerPermissionName(KALM_AUTH_PROXY_NAME),
+					Namespace: KALM_DEX_NAMESPACE,
+				},
+			},
+		}
+
+		if err := r.Create(r.ctx, &roleBinding); err != nil {
+			r.Log.Error(err, "create auth proxy session role binding failed.")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAuthProxySessionPermission keeps the session secrets, they expire and are deleted by the auth proxy if it's enabled again.
+func (r *SingleSignOnConfigReconcilerTask) DeleteAuthProxySessionPermission() error {
+	var roleBinding rbacV1.RoleBinding
+
+	if err := r.Get(r.ctx, types.NamespacedName{
+		Name:      KALM_AUTH_PROXY_SESSION_ROLE_NAME,
+		Namespace: KALM_AUTH_PROXY_SESSION_NAMESPACE,
+	}, &roleBinding); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		r.Log.Error(err, "get auth proxy session role binding failed.")
+		return err
+	}
+
+	if err := r.Delete(r.ctx, &roleBinding); err != nil && !errors.IsNotFound(err) {
+		r.Log.Error(err, "delete auth proxy session role binding failed.")
+		return err
+	}
+
+	return nil
+}
+
 func (r *SingleSignOnConfigReconcilerTask) ReconcileAuthProxy() error {
+	if err := r.ReconcileAuthProxySessionPermission(); err != nil {
+		return err
+	}
+
 	if r.ssoConfig.Spec.ExternalEnvoyExtAuthz != nil {
 		if r.authProxyComponent != nil {
 			if err := r.Delete(r.ctx, r.authProxyComponent); err != nil {
@@ -801,6 +1018,8 @@ func (r *SingleSignOnConfigReconcilerTask) ReconcileResources() error {
 
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=singlesignonconfigs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core.kalm.dev,resources=singlesignonconfigs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core.kalm.dev,resources=ssocredentials,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core.kalm.dev,resources=ssocredentials/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=networking.istio.io,resources=serviceentries,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.istio.io,resources=serviceentries/status,verbs=get;update;patch
 
@@ -5,13 +5,19 @@ import (
 	"context"
 	"fmt"
 	"github.com/kalmhq/kalm/controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"gopkg.in/yaml.v3"
 	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	rbacV1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"testing"
 )
@@ -203,3 +209,47 @@ func (suite *SSOConfigControllerSuite) TestSSOBasicCRUD() {
 		)
 	})
 }
+
+func TestReconcileAuthProxySessionPermission(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme))
+	assert.Nil(t, v1alpha1.AddToScheme(scheme))
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme)
+
+	task := &SingleSignOnConfigReconcilerTask{
+		SingleSignOnConfigReconciler: &SingleSignOnConfigReconciler{&BaseReconciler{
+			Client: fakeClient,
+			Reader: fakeClient,
+			Log:    ctrl.Log,
+			Scheme: scheme,
+		}},
+		ctx: context.Background(),
+		ssoConfig: &v1alpha1.SingleSignOnConfig{
+			Spec: v1alpha1.SingleSignOnConfigSpec{AuthProxySessionStore: KALM_AUTH_PROXY_SESSION_STORE_SECRET},
+		},
+	}
+
+	assert.Nil(t, task.ReconcileAuthProxySessionPermission())
+
+	var namespace coreV1.Namespace
+	assert.Nil(t, fakeClient.Get(task.ctx, types.NamespacedName{Name: KALM_AUTH_PROXY_SESSION_NAMESPACE}, &namespace))
+
+	sessionObjectKey := types.NamespacedName{Name: KALM_AUTH_PROXY_SESSION_ROLE_NAME, Namespace: KALM_AUTH_PROXY_SESSION_NAMESPACE}
+
+	// secrets can only be accessed in the session namespace
+	var role rbacV1.Role
+	assert.Nil(t, fakeClient.Get(task.ctx, sessionObjectKey, &role))
+	assert.Len(t, role.Rules, 1)
+	assert.Equal(t, []string{"secrets"}, role.Rules[0].Resources)
+
+	var roleBinding rbacV1.RoleBinding
+	assert.Nil(t, fakeClient.Get(task.ctx, sessionObjectKey, &roleBinding))
+	assert.Equal(t, "kalm-permission-auth-proxy", roleBinding.Subjects[0].Name)
+	assert.Equal(t, KALM_DEX_NAMESPACE, roleBinding.Subjects[0].Namespace)
+
+	// the access is revoked once sessions are kept in cookies
+	task.ssoConfig.Spec.AuthProxySessionStore = ""
+	assert.Nil(t, task.ReconcileAuthProxySessionPermission())
+	assert.True(t, errors.IsNotFound(fakeClient.Get(task.ctx, sessionObjectKey, &roleBinding)))
+}
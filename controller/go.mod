@@ -18,9 +18,11 @@ require (
 	github.com/jetstack/cert-manager v0.13.1
 	github.com/joho/godotenv v1.3.0
 	github.com/onsi/ginkgo v1.12.1
+	github.com/opencontainers/go-digest v1.0.0-rc1
 	github.com/robfig/cron v1.2.0
 	github.com/stretchr/testify v1.6.1
 	github.com/xeipuuv/gojsonschema v1.2.0
+	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
 	istio.io/api v0.0.0-20200721175012-ae75c7e9ae26
 	istio.io/client-go v0.0.0-20200717004237-1af75184beba
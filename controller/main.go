@@ -175,6 +175,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = (controllers.NewPromotionReconciler(mgr)).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Promotion")
+		os.Exit(1)
+	}
+
+	if err = (controllers.NewGitSourceReconciler(mgr)).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GitSource")
+		os.Exit(1)
+	}
+
 	// only run webhook if explicitly declared
 	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
 		if err = (&corev1alpha1.Component{}).SetupWebhookWithManager(mgr); err != nil {
@@ -222,10 +232,30 @@ func main() {
 			os.Exit(1)
 		}
 
+		if err = (&corev1alpha1.SSOCredential{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SSOCredential")
+			os.Exit(1)
+		}
+
 		if err = (&corev1alpha1.LogSystem{}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "LogSystem")
 			os.Exit(1)
 		}
+
+		if err = (&corev1alpha1.Promotion{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Promotion")
+			os.Exit(1)
+		}
+
+		if err = (&corev1alpha1.GitSource{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "GitSource")
+			os.Exit(1)
+		}
+
+		if err = (&corev1alpha1.ImagePolicy{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ImagePolicy")
+			os.Exit(1)
+		}
 		setupLog.Info("WEBHOOK enabled")
 	} else {
 		setupLog.Info("WEBHOOK not enabled")
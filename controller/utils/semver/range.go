@@ -0,0 +1,175 @@
+package semver
+
+// This package matches image tags against ranges like ">=1.2.0 <2.0.0", "^1.2" or "~1.2.3 || >=2.1".
+// Comparators separated by spaces must all match, and any of the sets separated by "||" may match.
+// A leading v of tags and versions is ignored. Pre-release tags never match.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+type comparator struct {
+	op      string
+	version *version.Version
+}
+
+func (c comparator) matches(v *version.Version) bool {
+	cmp, _ := v.Compare(c.version.String())
+
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return cmp == 0
+	}
+}
+
+type Range [][]comparator
+
+// ParseVersion parses a tag, which should be a full semantic version.
+func ParseVersion(tag string) (*version.Version, error) {
+	return version.ParseSemantic(strings.TrimPrefix(tag, "v"))
+}
+
+// parsePartialVersion parses 1, 1.2 or 1.2.3, and returns the number of parts.
+func parsePartialVersion(s string) (*version.Version, int, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+
+	if len(parts) > 3 {
+		return nil, 0, fmt.Errorf("invalid version: %s", s)
+	}
+
+	nums := []uint{0, 0, 0}
+
+	for i, part := range parts {
+		num, err := strconv.ParseUint(part, 10, 32)
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid version: %s", s)
+		}
+
+		nums[i] = uint(num)
+	}
+
+	v, err := version.ParseSemantic(fmt.Sprintf("%d.%d.%d", nums[0], nums[1], nums[2]))
+
+	return v, len(parts), err
+}
+
+func mustVersion(major, minor, patch uint) *version.Version {
+	return version.MustParseSemantic(fmt.Sprintf("%d.%d.%d", major, minor, patch))
+}
+
+func parseComparators(s string) ([]comparator, error) {
+	if s == "*" {
+		return nil, nil
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if !strings.HasPrefix(s, op) {
+			continue
+		}
+
+		v, parts, err := parsePartialVersion(strings.TrimPrefix(s, op))
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case "^":
+			// the left-most non-zero part can't change
+			upper := mustVersion(v.Major()+1, 0, 0)
+
+			if v.Major() == 0 && parts > 1 {
+				if v.Minor() > 0 || parts == 2 {
+					upper = mustVersion(0, v.Minor()+1, 0)
+				} else {
+					upper = mustVersion(0, 0, v.Patch()+1)
+				}
+			}
+
+			return []comparator{{">=", v}, {"<", upper}}, nil
+		case "~":
+			// the patch can change, or the minor if it's not given
+			upper := mustVersion(v.Major(), v.Minor()+1, 0)
+
+			if parts == 1 {
+				upper = mustVersion(v.Major()+1, 0, 0)
+			}
+
+			return []comparator{{">=", v}, {"<", upper}}, nil
+		default:
+			return []comparator{{op, v}}, nil
+		}
+	}
+
+	v, _, err := parsePartialVersion(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []comparator{{"=", v}}, nil
+}
+
+func ParseRange(s string) (Range, error) {
+	var res Range
+
+	for _, set := range strings.Split(s, "||") {
+		fields := strings.Fields(set)
+
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid range: %s", s)
+		}
+
+		var comparators []comparator
+
+		for _, field := range fields {
+			c, err := parseComparators(field)
+
+			if err != nil {
+				return nil, err
+			}
+
+			comparators = append(comparators, c...)
+		}
+
+		res = append(res, comparators)
+	}
+
+	return res, nil
+}
+
+func (r Range) Contains(v *version.Version) bool {
+	if v.PreRelease() != "" {
+		return false
+	}
+
+	for _, set := range r {
+		matched := true
+
+		for _, c := range set {
+			if !c.matches(v) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,53 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRange(t *testing.T) {
+	cases := []struct {
+		rng     string
+		tag     string
+		matches bool
+	}{
+		{">=1.2.0 <2.0.0", "1.2.0", true},
+		{">=1.2.0 <2.0.0", "v1.9.3", true},
+		{">=1.2.0 <2.0.0", "2.0.0", false},
+		{">1.2", "1.2.0", false},
+		{"<=1.2", "1.2.0", true},
+		{"1.2.3", "1.2.3", true},
+		{"=1.2.3", "1.2.4", false},
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "2.0.0", false},
+		{"^1.2", "1.1.0", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9.0", true},
+		{"~1.2 || >=3", "3.1.0", true},
+		{"~1.2 || >=3", "2.0.0", false},
+		{"*", "4.5.6", true},
+		{"*", "1.0.0-rc.1", false},
+	}
+
+	for _, c := range cases {
+		r, err := ParseRange(c.rng)
+		assert.Nil(t, err, c.rng)
+
+		v, err := ParseVersion(c.tag)
+		assert.Nil(t, err, c.tag)
+
+		assert.Equal(t, c.matches, r.Contains(v), "%s %s", c.rng, c.tag)
+	}
+}
+
+func TestParseInvalidRange(t *testing.T) {
+	for _, rng := range []string{"", ">=a", "1.2.3.4", ">=1 ||", "latest"} {
+		_, err := ParseRange(rng)
+		assert.NotNil(t, err, rng)
+	}
+}